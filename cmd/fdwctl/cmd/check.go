@@ -0,0 +1,101 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/olekukonko/tablewriter"
+	"github.com/spf13/cobra"
+
+	"github.com/neflyte/fdwctl/lib/config"
+	"github.com/neflyte/fdwctl/lib/database"
+	"github.com/neflyte/fdwctl/lib/logger"
+	"github.com/neflyte/fdwctl/lib/model"
+	"github.com/neflyte/fdwctl/lib/util"
+)
+
+var (
+	checkCmd = &cobra.Command{
+		Use:               "check",
+		Short:             "Check imported objects against the remote database",
+		PersistentPreRunE: preDoCheck,
+		PersistentPostRun: postDoCheck,
+	}
+	checkSchemaCmd = &cobra.Command{
+		Use:           "schema <local schema name>",
+		Short:         "Report foreign tables whose columns no longer match their remote table",
+		Long:          "Compare the column names, types, nullability, and order of each foreign table in a foreign schema with its remote table. Exits with status 0 when the tables match, 2 when columns have changed, and 1 on error.",
+		RunE:          checkSchema,
+		Args:          cobra.ExactArgs(1),
+		SilenceUsage:  true,
+		SilenceErrors: true,
+	}
+	checkEnumConnection string
+	checkOutputFormat   string
+)
+
+func init() {
+	checkSchemaCmd.Flags().StringVar(&checkEnumConnection, "enumconnection", "", "connection string of the remote database; derived from the server and its user mapping when omitted")
+	checkSchemaCmd.Flags().StringVar(&checkOutputFormat, "format", diffFormatText, "output format [text, json]")
+	checkCmd.AddCommand(checkSchemaCmd)
+}
+
+func preDoCheck(cmd *cobra.Command, _ []string) error {
+	var err error
+	log := logger.Log(cmd.Context()).
+		WithField("function", "preDoCheck")
+	dbConnection, err = database.GetConnection(cmd.Context(), config.Instance().GetDatabaseConnectionString())
+	if err != nil {
+		return logger.ErrorfAsError(log, "error getting database connection: %s", err)
+	}
+	return nil
+}
+
+func postDoCheck(cmd *cobra.Command, _ []string) {
+	database.CloseConnection(cmd.Context(), dbConnection)
+}
+
+func checkSchema(cmd *cobra.Command, args []string) error {
+	log := logger.Log(cmd.Context()).
+		WithField("function", "checkSchema")
+	csLocalSchema := strings.TrimSpace(args[0])
+	if csLocalSchema == "" {
+		return logger.ErrorfAsError(log, "local schema name is required")
+	}
+	drifts, err := util.CheckSchema(cmd.Context(), dbConnection, model.Schema{
+		LocalSchema:    csLocalSchema,
+		ENUMConnection: checkEnumConnection,
+	})
+	if err != nil {
+		log.Errorf("error checking foreign schema %s: %s", csLocalSchema, err)
+		return err
+	}
+	switch checkOutputFormat {
+	case diffFormatJSON:
+		reportBytes, marshalErr := json.MarshalIndent(driftReport{Drift: drifts, InSync: len(drifts) == 0}, "", "  ")
+		if marshalErr != nil {
+			return logger.ErrorfAsError(log, "error marshaling drift report: %s", marshalErr)
+		}
+		fmt.Println(string(reportBytes))
+	case diffFormatText:
+		if len(drifts) == 0 {
+			fmt.Printf("No drift. The foreign tables of schema %s match their remote tables.\n", csLocalSchema)
+			break
+		}
+		table := tablewriter.NewWriter(os.Stdout)
+		table.SetHeader([]string{"Foreign Table", "Server", "Drift", "Attribute", "Remote", "Local"})
+		for _, drift := range drifts {
+			table.Append([]string{drift.ObjectName, drift.ServerName, drift.Kind, drift.Attribute, drift.Desired, drift.Actual})
+		}
+		table.Render()
+	default:
+		return logger.ErrorfAsError(log, "unknown output format: %s", checkOutputFormat)
+	}
+	if len(drifts) > 0 {
+		log.Infof("%d differences found", len(drifts))
+		return ErrDriftDetected
+	}
+	return nil
+}
@@ -42,9 +42,18 @@ var (
 		Short: "Create (import) a schema from a foreign server",
 		Run:   createSchema,
 	}
+	createForeignTableCmd = &cobra.Command{
+		Use:   "foreigntable <table name>",
+		Short: "Create a foreign table from a column definition",
+		Run:   createForeignTable,
+		Args:  cobra.MinimumNArgs(1),
+	}
 	serverHost           string
 	serverPort           string
 	serverDBName         string
+	serverWrapper        string
+	serverOptions        []string
+	usermapOptions       []string
 	localUser            string
 	remoteUser           string
 	remotePassword       string
@@ -54,39 +63,66 @@ var (
 	csServerName         string
 	importEnums          bool
 	importEnumConnection string
+	importTypeSchema     string
+	limitToTables        []string
+	exceptTables         []string
+	importOptions        []string
+	ftServerName         string
+	ftLocalSchema        string
+	ftRemoteSchema       string
+	ftRemoteTable        string
+	ftColumns            []string
+	ftColumnOptions      []string
+	ftOptions            []string
 )
 
 func init() {
-	createServerCmd.Flags().StringVar(&serverHost, "serverhost", "", "hostname of the remote PG server")
-	createServerCmd.Flags().StringVar(&serverPort, "serverport", "5432", "port of the remote PG server")
-	createServerCmd.Flags().StringVar(&serverDBName, "serverdbname", "", "database name on remote PG server")
-	_ = createServerCmd.MarkFlagRequired("serverhost")
-	_ = createServerCmd.MarkFlagRequired("serverport")
-	_ = createServerCmd.MarkFlagRequired("serverdbname")
+	createServerCmd.Flags().StringVar(&serverHost, "serverhost", "", "hostname of the remote server")
+	createServerCmd.Flags().StringVar(&serverPort, "serverport", "5432", "port of the remote server; only used by other wrappers when specified")
+	createServerCmd.Flags().StringVar(&serverDBName, "serverdbname", "", "database name on remote server")
+	createServerCmd.Flags().StringVar(&serverWrapper, "wrapper", model.DefaultWrapper, "foreign data wrapper of the server")
+	createServerCmd.Flags().StringArrayVar(&serverOptions, "option", []string{}, "server option in key=value form; may be repeated")
 
 	createUsermapCmd.Flags().StringVar(&serverName, "servername", "", "foreign server name")
 	createUsermapCmd.Flags().StringVar(&localUser, "localuser", "", "local user name")
 	createUsermapCmd.Flags().StringVar(&remoteUser, "remoteuser", "", "remote user name")
-	createUsermapCmd.Flags().StringVar(&remotePassword, "remotepassword", "", "remote user password")
+	createUsermapCmd.Flags().StringVar(&remotePassword, "remotepassword", "", "remote user password; omit for mappings that do not use a password")
+	createUsermapCmd.Flags().StringArrayVar(&usermapOptions, "option", []string{}, "user mapping option in key=value form; may be repeated")
 	_ = createUsermapCmd.MarkFlagRequired("servername")
 	_ = createUsermapCmd.MarkFlagRequired("localuser")
 	_ = createUsermapCmd.MarkFlagRequired("remoteuser")
-	_ = createUsermapCmd.MarkFlagRequired("remotepassword")
 
 	createSchemaCmd.Flags().StringVar(&localSchemaName, "localschema", "", "local schema name")
 	createSchemaCmd.Flags().StringVar(&csServerName, "servername", "", "foreign server name")
 	createSchemaCmd.Flags().StringVar(&remoteSchemaName, "remoteschema", "", "the remote schema to import")
-	createSchemaCmd.Flags().BoolVar(&importEnums, "importenums", false, "attempt to auto-create ENUMs locally before import")
-	createSchemaCmd.Flags().StringVar(&importEnumConnection, "enumconnection", "", "connection string of database to import enums from")
+	createSchemaCmd.Flags().BoolVar(&importEnums, "importenums", false, "attempt to auto-create ENUMs and other user-defined types locally before import")
+	createSchemaCmd.Flags().StringVar(&importEnumConnection, "enumconnection", "", "connection string of the remote database to import types from; derived from the server and its user mapping when omitted")
+	createSchemaCmd.Flags().StringVar(&importTypeSchema, "typeschema", "", "local schema to create the imported types in; requires --importenums")
+	createSchemaCmd.Flags().StringArrayVar(&limitToTables, "limitto", []string{}, "only import this table, glob pattern, or /regex/; may be repeated")
+	createSchemaCmd.Flags().StringArrayVar(&exceptTables, "except", []string{}, "do not import this table, glob pattern, or /regex/; may be repeated")
+	createSchemaCmd.Flags().StringArrayVar(&importOptions, "import-option", []string{}, "IMPORT FOREIGN SCHEMA option in key=value form; may be repeated")
 	// TODO: Add a flag to accept a list of users for grants
 	_ = createSchemaCmd.MarkFlagRequired("localschema")
 	_ = createSchemaCmd.MarkFlagRequired("servername")
 	_ = createSchemaCmd.MarkFlagRequired("remoteschema")
 
+	createForeignTableCmd.Flags().StringVar(&ftServerName, "servername", "", "foreign server name")
+	createForeignTableCmd.Flags().StringVar(&ftLocalSchema, "localschema", "", "local schema name")
+	createForeignTableCmd.Flags().StringVar(&ftRemoteSchema, "remoteschema", "", "schema of the remote table; the wrapper's default when omitted")
+	createForeignTableCmd.Flags().StringVar(&ftRemoteTable, "remotetable", "", "name of the remote table or view; the wrapper's default when omitted")
+	createForeignTableCmd.Flags().StringArrayVar(&ftColumns, "column", []string{}, "column definition in 'name type [NOT NULL]' form; may be repeated")
+	createForeignTableCmd.Flags().StringArrayVar(&ftColumnOptions, "column-option", []string{}, "column option in column:key=value form; may be repeated")
+	createForeignTableCmd.Flags().StringArrayVar(&ftOptions, "option", []string{}, "foreign table option in key=value form; may be repeated")
+	_ = createForeignTableCmd.MarkFlagRequired("servername")
+	_ = createForeignTableCmd.MarkFlagRequired("localschema")
+	_ = createForeignTableCmd.MarkFlagRequired("column")
+
 	createCmd.AddCommand(createServerCmd)
 	createCmd.AddCommand(createExtensionCmd)
 	createCmd.AddCommand(createUsermapCmd)
 	createCmd.AddCommand(createSchemaCmd)
+	createCmd.AddCommand(createForeignTableCmd)
+	addLockFlags(createCmd)
 }
 
 func preDoCreate(cmd *cobra.Command, _ []string) error {
@@ -97,10 +133,11 @@ func preDoCreate(cmd *cobra.Command, _ []string) error {
 	if err != nil {
 		return logger.ErrorfAsError(log, "error getting database connection: %s", err)
 	}
-	return nil
+	return lockDatabase(cmd.Context())
 }
 
 func postDoCreate(cmd *cobra.Command, _ []string) {
+	unlockDatabase(cmd.Context())
 	database.CloseConnection(cmd.Context(), dbConnection)
 }
 
@@ -119,6 +156,7 @@ func createExtension(cmd *cobra.Command, args []string) {
 }
 
 func createServer(cmd *cobra.Command, args []string) {
+	var err error
 	log := logger.Log(cmd.Context()).
 		WithField("function", "createServer")
 	serverSlug := strings.TrimSpace(args[0])
@@ -132,17 +170,26 @@ func createServer(cmd *cobra.Command, args []string) {
 			serverSlug = fmt.Sprintf("server_%s", serverSlug)
 		}
 	}
-	portInt, err := strconv.Atoi(serverPort)
+	fServer := model.ForeignServer{
+		Name:    serverSlug,
+		Host:    serverHost,
+		DB:      serverDBName,
+		Wrapper: serverWrapper,
+	}
+	// The default port is a postgres_fdw port so it is only used by other wrappers when it was specified
+	if serverPort != "" && (fServer.WrapperName() == model.DefaultWrapper || cmd.Flags().Changed("serverport")) {
+		fServer.Port, err = strconv.Atoi(serverPort)
+		if err != nil {
+			log.Errorf("error converting port to integer: %s", err)
+			return
+		}
+	}
+	err = util.ApplyServerOptionChanges(&fServer, serverOptions, nil)
 	if err != nil {
-		log.Errorf("error converting port to integer: %s", err)
+		log.Errorf("error parsing server options: %s", err)
 		return
 	}
-	err = util.CreateServer(cmd.Context(), dbConnection, model.ForeignServer{
-		Name: serverSlug,
-		Host: serverHost,
-		Port: portInt,
-		DB:   serverDBName,
-	})
+	err = util.CreateServer(cmd.Context(), dbConnection, fServer)
 	if err != nil {
 		log.Errorf("error creating server: %s", err)
 		return
@@ -158,14 +205,20 @@ func createUsermap(cmd *cobra.Command, _ []string) {
 		log.Errorf("error ensuring local user exists: %s", err)
 		return
 	}
-	err = util.CreateUserMap(cmd.Context(), dbConnection, model.UserMap{
+	usermap := model.UserMap{
 		ServerName: serverName,
 		LocalUser:  localUser,
 		RemoteUser: remoteUser,
 		RemoteSecret: model.Secret{
 			Value: remotePassword,
 		},
-	})
+	}
+	err = util.ApplyUserMapOptionChanges(&usermap, usermapOptions, nil)
+	if err != nil {
+		log.Errorf("error parsing user mapping options: %s", err)
+		return
+	}
+	err = util.CreateUserMap(cmd.Context(), dbConnection, usermap)
 	if err != nil {
 		log.Errorf("error creating user mapping: %s", err)
 		return
@@ -176,19 +229,57 @@ func createUsermap(cmd *cobra.Command, _ []string) {
 func createSchema(cmd *cobra.Command, _ []string) {
 	log := logger.Log(cmd.Context()).
 		WithField("function", "createSchema")
-	err := util.ImportSchema(cmd.Context(), dbConnection, csServerName, model.Schema{
+	schema := model.Schema{
 		ServerName:     csServerName,
 		LocalSchema:    localSchemaName,
 		RemoteSchema:   remoteSchemaName,
 		ImportENUMs:    importEnums,
 		ENUMConnection: importEnumConnection,
-		SchemaGrants: model.Grants{
-			Users: make([]string, 0),
-		},
-	})
+		TypeSchema:     importTypeSchema,
+		LimitTo:        limitToTables,
+		Except:         exceptTables,
+	}
+	err := util.ApplyImportOptionChanges(&schema, importOptions, nil)
+	if err != nil {
+		log.Errorf("error parsing import options: %s", err)
+		return
+	}
+	err = util.ImportSchema(cmd.Context(), dbConnection, csServerName, schema)
 	if err != nil {
 		log.Errorf("error importing foreign schema: %s", err)
 		return
 	}
 	log.Infof("foreign schema %s imported", remoteSchemaName)
 }
+
+func createForeignTable(cmd *cobra.Command, args []string) {
+	log := logger.Log(cmd.Context()).
+		WithField("function", "createForeignTable")
+	table := model.ForeignTable{
+		ServerName:   ftServerName,
+		LocalSchema:  ftLocalSchema,
+		Name:         strings.TrimSpace(args[0]),
+		RemoteSchema: ftRemoteSchema,
+		RemoteTable:  ftRemoteTable,
+		Columns:      make([]model.Column, 0, len(ftColumns)),
+	}
+	for _, columnDefinition := range ftColumns {
+		column, err := util.ParseColumnDefinition(columnDefinition)
+		if err != nil {
+			log.Errorf("error parsing column: %s", err)
+			return
+		}
+		table.Columns = append(table.Columns, column)
+	}
+	err := util.ApplyForeignTableOptionChanges(&table, ftOptions, ftColumnOptions)
+	if err != nil {
+		log.Errorf("error parsing foreign table options: %s", err)
+		return
+	}
+	err = util.CreateForeignTable(cmd.Context(), dbConnection, table)
+	if err != nil {
+		log.Errorf("error creating foreign table: %s", err)
+		return
+	}
+	log.Infof("foreign table %s created", table.QualifiedName())
+}
@@ -2,7 +2,6 @@ package cmd
 
 import (
 	"context"
-	"database/sql"
 
 	"github.com/neflyte/fdwctl/lib/config"
 	"github.com/neflyte/fdwctl/lib/database"
@@ -22,10 +21,25 @@ var (
 		RunE:              doDesiredState,
 	}
 	desiredStateRecreateSchemas = false
+	desiredStateDryRun          = false
+	desiredStateNoTransaction   = false
+	desiredStateOutputFormat    string
+	desiredStatePlanFile        string
+	desiredStatePrune           string
+	desiredStateServers         []string
+	desiredStateOnly            []string
 )
 
 func init() {
 	desiredStateCmd.Flags().BoolVar(&desiredStateRecreateSchemas, "recreateschemas", false, "flag indicating that foreign schemas should be re-created")
+	desiredStateCmd.Flags().BoolVar(&desiredStateDryRun, "dry-run", false, "show the planned actions without changing the database")
+	desiredStateCmd.Flags().BoolVar(&desiredStateNoTransaction, "notransaction", false, "execute each statement on its own instead of in a single transaction (for statements that cannot run in a transaction block)")
+	desiredStateCmd.Flags().StringVar(&desiredStatePlanFile, "plan", "", "apply the actions of a plan saved with plan --out instead of computing a new plan")
+	desiredStateCmd.Flags().StringVar(&desiredStateOutputFormat, "format", planFormatTable, "output format of the planned actions when --dry-run is set [table, json]")
+	desiredStateCmd.Flags().StringVar(&desiredStatePrune, "prune", util.PruneOwned, "which objects that are not in the desired state are dropped [none, owned, all]")
+	desiredStateCmd.Flags().StringArrayVar(&desiredStateServers, "server", []string{}, "only apply the desired state of this server, glob pattern, or /regex/; may be repeated")
+	desiredStateCmd.Flags().StringSliceVar(&desiredStateOnly, "only", []string{}, "only apply these kinds of objects [extensions, servers, usermaps, schemas, foreigntables]")
+	addLockFlags(desiredStateCmd)
 }
 
 func preDoDesiredState(cmd *cobra.Command, _ []string) error {
@@ -37,260 +51,78 @@ func preDoDesiredState(cmd *cobra.Command, _ []string) error {
 	if err != nil {
 		return logger.ErrorfAsError(log, "error getting database connection: %s", err)
 	}
-	return nil
+	if desiredStateDryRun {
+		return nil
+	}
+	return lockDatabase(cmd.Context())
 }
 
 func postDoDesiredState(cmd *cobra.Command, _ []string) {
+	unlockDatabase(cmd.Context())
 	database.CloseConnection(cmd.Context(), dbConnection)
 }
 
 func doDesiredState(cmd *cobra.Command, _ []string) error {
+	var plan *model.Plan
+	var err error
+
 	log := logger.Log(cmd.Context()).
 		WithField("function", "doDesiredState")
-	// Apply Extensions
-	err := applyExtensions(cmd.Context(), dbConnection)
-	if err != nil {
-		log.Errorf("error applying extensions: %s", err)
-		return err
+	if desiredStatePlanFile != "" && (len(desiredStateServers) > 0 || len(desiredStateOnly) > 0) {
+		return logger.ErrorfAsError(log, "--server and --only cannot be used with --plan; pass them to plan --out instead")
+	}
+	if desiredStatePlanFile != "" {
+		plan, err = loadSavedPlan(cmd.Context(), desiredStatePlanFile)
+	} else {
+		plan, err = util.PlanDesiredState(cmd.Context(), dbConnection, config.Instance().DesiredState, util.PlanOptions{
+			RecreateSchemas: desiredStateRecreateSchemas,
+			Prune:           desiredStatePrune,
+			Servers:         desiredStateServers,
+			Only:            desiredStateOnly,
+		})
 	}
-	// Convert DState servers to ForeignServers
-	dStateServers := config.Instance().DesiredState.Servers
-	// List servers in DB
-	dbServers, err := util.GetServers(cmd.Context(), dbConnection)
 	if err != nil {
-		log.Errorf("error getting foreign servers: %s", err)
+		log.Errorf("error planning desired state: %s", err)
 		return err
 	}
-	// Diff servers
-	serversInDBButNotInDState, serversInDStateButNotInDB, serversAlreadyInDB := util.DiffForeignServers(dStateServers, dbServers)
-	log.Tracef(
-		"serversInDBButNotInDState: %#v, serversInDStateButNotInDB: %#v, serversAlreadyInDB: %#v",
-		serversInDBButNotInDState,
-		serversInDStateButNotInDB,
-		serversAlreadyInDB,
-	)
-	// Remove servers in DB but not in DState
-	for _, serverNotInDState := range serversInDBButNotInDState {
-		log.Debugf("removing server %s", serverNotInDState.Name)
-		err = util.DropServer(cmd.Context(), dbConnection, serverNotInDState.Name, true)
-		if err != nil {
-			log.Errorf("error dropping server %s that is not in desired state: %s", serverNotInDState.Name, err)
-			return err
-		}
-		log.Infof("server %s dropped", serverNotInDState.Name)
-	}
-	// Create servers that are in DState but not yet in DB
-	for _, serverNotInDB := range serversInDStateButNotInDB {
-		log.Debugf("creating server %s", serverNotInDB.Name)
-		err = util.CreateServer(cmd.Context(), dbConnection, serverNotInDB)
-		if err != nil {
-			log.Errorf("error creating server: %s", err)
-			return err
-		}
-		log.Infof("server %s created", serverNotInDB.Name)
-	}
-	// Update servers that were already in the DB
-	for _, serverAlreadyInDB := range serversAlreadyInDB {
-		log.Debugf("updating server %s", serverAlreadyInDB.Name)
-		dsServer := util.FindForeignServer(config.Instance().DesiredState.Servers, serverAlreadyInDB.Name)
-		if dsServer == nil {
-			log.Errorf("cannot find desired state server %s", serverAlreadyInDB.Name)
-			return err
-		}
-		dbServer := *dsServer
-		if !dbServer.Equals(serverAlreadyInDB) {
-			err = util.UpdateServer(cmd.Context(), dbConnection, serverAlreadyInDB)
-			if err != nil {
-				log.Errorf("error updating server: %s", err)
-				return err
-			}
-			log.Infof("server %s updated", serverAlreadyInDB.Name)
-		} else {
-			log.Debugf("server %s is no different from the database; skipping it", serverAlreadyInDB.Name)
-		}
+	if desiredStateDryRun {
+		return outputPlan(plan, desiredStateOutputFormat)
 	}
-	// Collect a list of servers to process UserMap and Schemas for
-	serversToProcess := make([]model.ForeignServer, 0)
-	serversToProcess = append(serversToProcess, serversInDStateButNotInDB...)
-	serversToProcess = append(serversToProcess, serversAlreadyInDB...)
-	// Process UserMaps and Schemas
-	for _, serverToProcess := range serversToProcess {
-		log.Debugf("applying user maps to %s", serverToProcess.Name)
-		err = applyUserMaps(cmd.Context(), dbConnection, serverToProcess)
-		if err != nil {
-			log.Errorf("error applying usermaps for server %s: %s", serverToProcess.Name, err)
-			return err
-		}
-		log.Debugf("applying schemas to %s", serverToProcess.Name)
-		err = applySchemas(cmd.Context(), dbConnection, serverToProcess)
-		if err != nil {
-			log.Errorf("error applying schemas for server %s: %s", serverToProcess.Name, err)
-			return err
-		}
+	if desiredStateNoTransaction {
+		log.Warn("applying desired state without a transaction; a failure will leave the database partially changed")
+		err = util.ExecutePlan(cmd.Context(), dbConnection, plan)
+	} else {
+		err = util.ExecutePlanInTransaction(cmd.Context(), dbConnection, plan)
 	}
-	log.Info("desired state applied.")
-	return nil
-}
-
-func applyExtensions(ctx context.Context, dbConnection *sql.DB) error {
-	log := logger.Log(ctx).
-		WithField("function", "applyExtensions")
-	// List extensions in DB
-	dbExts, err := util.GetExtensions(ctx, dbConnection)
 	if err != nil {
-		log.Errorf("error getting extensions: %s", err)
+		log.Errorf("error applying desired state: %s", err)
 		return err
 	}
-	// Diff extensions
-	_, extAdd := util.DiffExtensions(config.Instance().DesiredState.Extensions, dbExts)
-	// NOTE: Don't remove extensions with abandon since we might remove something that's needed
-	/*// Remove extensions
-	for _, extToRemove := range extRemove {
-		err = util.DropExtension(ctx, dbConnection, extToRemove)
-		if err != nil {
-			return logger.ErrorfAsError(log, "error dropping extension: %s", err)
-		}
-		log.Infof("extension %s dropped", extToRemove.Name)
-	}*/
-	// Add extensions
-	for _, extToAdd := range extAdd {
-		log.Debugf("creating extension %s", extToAdd.Name)
-		err = util.CreateExtension(ctx, dbConnection, extToAdd)
-		if err != nil {
-			return logger.ErrorfAsError(log, "error creating extension: %s", err)
-		}
-		log.Infof("extension %s created", extToAdd.Name)
-	}
+	log.Info("desired state applied.")
 	return nil
 }
 
-func applyUserMaps(ctx context.Context, dbConnection *sql.DB, server model.ForeignServer) error {
+// loadSavedPlan reads a saved plan, verifies that the database has not changed since the plan was computed, and
+// resolves any redacted credentials from the desired state
+func loadSavedPlan(ctx context.Context, fileName string) (*model.Plan, error) {
 	log := logger.Log(ctx).
-		WithField("function", "applyUserMaps")
-	// List Usermaps for this server in the DB
-	dbServerUsermaps, err := util.GetUserMapsForServer(ctx, dbConnection, server.Name)
+		WithField("function", "loadSavedPlan")
+	plan, err := util.ReadPlanFile(fileName)
 	if err != nil {
-		log.Errorf("error getting usermaps for server %s: %s", server.Name, err)
-		return err
-	}
-	// List Usermaps for this server in DState
-	dsServer := util.FindForeignServer(config.Instance().DesiredState.Servers, server.Name)
-	if dsServer == nil {
-		return logger.ErrorfAsError(log, "cannot find desired state server %s; THIS IS UNEXPECTED", server.Name)
-	}
-	dStateServerUsermaps := dsServer.UserMaps
-	// Diff usermaps
-	usRemove, usAdd, usModify := util.DiffUserMaps(dStateServerUsermaps, dbServerUsermaps)
-	// Delete Usermaps not in DState
-	for _, usermapToRemove := range usRemove {
-		usermapToRemove.ServerName = dsServer.Name
-		log.Debugf("removing usermap for local user %s", usermapToRemove.LocalUser)
-		err = util.DropUserMap(ctx, dbConnection, usermapToRemove, true)
-		if err != nil {
-			log.Errorf("error dropping user map for local user %s: %s", usermapToRemove.LocalUser, err)
-			return err
-		}
-		log.Infof("user mapping for %s dropped", usermapToRemove.LocalUser)
-	}
-	// Add Usermaps in DState but not in DB
-	for _, usermapToAdd := range usAdd {
-		usermapToAdd.ServerName = dsServer.Name
-		log.Debugf("adding usermap for local user %s", usermapToAdd.LocalUser)
-		err = util.CreateUserMap(ctx, dbConnection, usermapToAdd)
-		if err != nil {
-			log.Errorf("error creating user map for local user %s: %s", usermapToAdd.LocalUser, err)
-			return err
-		}
-		log.Infof("user mapping %s -> %s created", usermapToAdd.LocalUser, usermapToAdd.RemoteUser)
+		return nil, err
 	}
-	// Update usermaps that are already there
-	for _, usermapToUpdate := range usModify {
-		usermapToUpdate.ServerName = dsServer.Name
-		log.Debugf("updating usermap for local user %s", usermapToUpdate.LocalUser)
-		dbUserMap := util.FindUserMap(dbServerUsermaps, usermapToUpdate.LocalUser)
-		if dbUserMap == nil {
-			return logger.ErrorfAsError(log, "cannot find user mapping for local user %s", usermapToUpdate.LocalUser)
-		}
-		// if util.SecretIsDefined(usermapToUpdate.RemoteSecret) {
-		if usermapToUpdate.RemoteSecret.IsDefined() {
-			remoteSecret := ""
-			remoteSecret, err = util.GetSecret(ctx, usermapToUpdate.RemoteSecret)
-			if err != nil {
-				return logger.ErrorfAsError(log, "error getting secret value: %s", err)
-			}
-			usermapToUpdate.RemoteSecret.Value = remoteSecret
-		}
-		if !usermapToUpdate.Equals(*dbUserMap) {
-			err = util.UpdateUserMap(ctx, dbConnection, usermapToUpdate)
-			if err != nil {
-				log.Errorf("error updating user map for local user %s: %s", usermapToUpdate.LocalUser, err)
-				return err
-			}
-			log.Infof("user mapping %s -> %s updated", usermapToUpdate.LocalUser, usermapToUpdate.RemoteUser)
-		} else {
-			log.Debugf("user mapping %s -> %s is no different from the database; skipping it", usermapToUpdate.LocalUser, usermapToUpdate.RemoteUser)
-		}
-	}
-	return nil
-}
-
-func applySchemas(ctx context.Context, dbConnection *sql.DB, server model.ForeignServer) error {
-	log := logger.Log(ctx).
-		WithField("function", "applySchemas")
-	// Get DB remote schemas
-	dbSchemas, err := util.GetSchemasForServer(ctx, dbConnection, server.Name)
+	err = util.VerifyPlanFingerprint(ctx, dbConnection, plan)
 	if err != nil {
-		log.Errorf("error getting remote schemas: %s", err)
-		return err
-	}
-	// Get DState schemas
-	dStateSchemas := server.Schemas
-	// Diff schemas
-	schRemove, schAdd, schModify := util.DiffSchemas(dStateSchemas, dbSchemas)
-	log.Tracef("schRemove: %#v, schAdd: %#v, schModify: %#v", schRemove, schAdd, schModify)
-	// Drop schemas not in DState
-	for _, schemaToRemove := range schRemove {
-		log.Debugf("removing schema %s", schemaToRemove.LocalSchema)
-		err = util.DropSchema(ctx, dbConnection, schemaToRemove, true)
-		if err != nil {
-			log.Errorf("error dropping local schema %s: %s", schemaToRemove.LocalSchema, err)
-			return err
-		}
-		log.Infof("local schema %s dropped", schemaToRemove.LocalSchema)
+		return nil, err
 	}
-	// Import schemas in DState but not imported
-	for _, schemaToAdd := range schAdd {
-		log.Debugf("adding schema %s", schemaToAdd.LocalSchema)
-		err = util.ImportSchema(ctx, dbConnection, server.Name, schemaToAdd)
-		if err != nil {
-			log.Errorf("error importing into local schema %s: %s", schemaToAdd.LocalSchema, err)
-			return err
-		}
-		log.Infof("foreign schema %s imported", schemaToAdd.RemoteSchema)
+	dState, err := util.ResolveLocalUsers(ctx, dbConnection, config.Instance().DesiredState)
+	if err != nil {
+		return nil, err
 	}
-	// Drop + Re-Import all other schemas
-	for _, schemaToModify := range schModify {
-		log.Debugf("modifying schema %s", schemaToModify.LocalSchema)
-		if desiredStateRecreateSchemas {
-			// Drop
-			log.Debugf("recreating schema %s (drop)", schemaToModify.LocalSchema)
-			err = util.DropSchema(ctx, dbConnection, schemaToModify, true)
-			if err != nil {
-				log.Errorf("error dropping local schema %s: %s", schemaToModify.LocalSchema, err)
-				return err
-			}
-			// Import
-			log.Debugf("recreating schema %s (import)", schemaToModify.LocalSchema)
-			err = util.ImportSchema(ctx, dbConnection, server.Name, schemaToModify)
-			if err != nil {
-				log.Errorf("error importing into local schema %s: %s", schemaToModify.LocalSchema, err)
-				return err
-			}
-			// Done
-			log.Infof("foreign schema %s re-imported", schemaToModify.RemoteSchema)
-		} else {
-			log.Infof("foreign schema %s exists; will not re-create it", schemaToModify.RemoteSchema)
-		}
+	err = util.ResolvePlanSecrets(ctx, plan, dState)
+	if err != nil {
+		return nil, err
 	}
-	return nil
+	log.Infof("loaded plan %s with %d actions", fileName, len(plan.Actions))
+	return plan, nil
 }
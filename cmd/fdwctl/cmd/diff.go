@@ -0,0 +1,148 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/olekukonko/tablewriter"
+	"github.com/spf13/cobra"
+
+	"github.com/neflyte/fdwctl/lib/config"
+	"github.com/neflyte/fdwctl/lib/database"
+	"github.com/neflyte/fdwctl/lib/logger"
+	"github.com/neflyte/fdwctl/lib/model"
+	"github.com/neflyte/fdwctl/lib/util"
+)
+
+const (
+	// diffFormatText is the human-readable table output format of a drift report
+	diffFormatText = "text"
+	// diffFormatJSON is the JSON output format of a drift report
+	diffFormatJSON = "json"
+	// diffFormatYAML is the unified diff of the desired and current states in YAML format
+	diffFormatYAML = "yaml"
+	// ExitCodeDrift is the program exit code when drift between the desired state and the database is detected
+	ExitCodeDrift = 2
+)
+
+var (
+	// ErrDriftDetected is returned by commands that found drift between the desired state and the database
+	ErrDriftDetected = errors.New("drift detected")
+
+	diffCmd = &cobra.Command{
+		Use:               "diff",
+		Short:             "Detect drift between the desired state and the database",
+		Long:              "Compare the desired state configuration with the FDW database and report every difference that apply would change. Exits with status 0 when in sync, 2 when drift exists, and 1 on error.",
+		PersistentPreRunE: preDoDiff,
+		PersistentPostRun: postDoDiff,
+		RunE:              doDiff,
+		SilenceUsage:      true,
+		SilenceErrors:     true,
+	}
+	diffOutputFormat string
+	diffPrune        string
+	diffServers      []string
+	diffOnly         []string
+)
+
+// driftReport is the JSON output of the diff command
+type driftReport struct {
+	Drift  []model.Drift `json:"drift"`
+	InSync bool          `json:"inSync"`
+}
+
+func init() {
+	diffCmd.Flags().StringVar(&diffOutputFormat, "format", diffFormatText, "output format [text, json, yaml]")
+	diffCmd.Flags().StringVar(&diffPrune, "prune", util.PruneOwned, "which objects that are not in the desired state are reported [none, owned, all]")
+	diffCmd.Flags().StringArrayVar(&diffServers, "server", []string{}, "only compare the desired state of this server, glob pattern, or /regex/; may be repeated")
+	diffCmd.Flags().StringSliceVar(&diffOnly, "only", []string{}, "only compare these kinds of objects [extensions, servers, usermaps, schemas, foreigntables]")
+}
+
+func preDoDiff(cmd *cobra.Command, _ []string) error {
+	var err error
+
+	log := logger.Log(cmd.Context()).
+		WithField("function", "preDoDiff")
+	dbConnection, err = database.GetConnection(cmd.Context(), config.Instance().GetDatabaseConnectionString())
+	if err != nil {
+		return logger.ErrorfAsError(log, "error getting database connection: %s", err)
+	}
+	return nil
+}
+
+func postDoDiff(cmd *cobra.Command, _ []string) {
+	database.CloseConnection(cmd.Context(), dbConnection)
+}
+
+func doDiff(cmd *cobra.Command, _ []string) error {
+	log := logger.Log(cmd.Context()).
+		WithField("function", "doDiff")
+	currentState, err := util.GetCurrentState(cmd.Context(), dbConnection)
+	if err != nil {
+		log.Errorf("error getting current state: %s", err)
+		return err
+	}
+	dState, err := util.ResolveLocalUsers(cmd.Context(), dbConnection, config.Instance().DesiredState)
+	if err != nil {
+		log.Errorf("error resolving user mapping local users: %s", err)
+		return err
+	}
+	// Objects that apply leaves alone are not drift
+	dState, currentState, err = util.ScopeStates(cmd.Context(), dState, currentState, util.PlanOptions{
+		Prune:   diffPrune,
+		Servers: diffServers,
+		Only:    diffOnly,
+	})
+	if err != nil {
+		return err
+	}
+	normalizedDState, err := util.NormalizeState(cmd.Context(), dState, nil)
+	if err != nil {
+		log.Errorf("error normalizing desired state: %s", err)
+		return err
+	}
+	normalizedDBState, err := util.NormalizeState(cmd.Context(), currentState, &dState)
+	if err != nil {
+		log.Errorf("error normalizing current state: %s", err)
+		return err
+	}
+	drifts := util.DiffState(normalizedDState, normalizedDBState)
+	switch diffOutputFormat {
+	case diffFormatJSON:
+		reportBytes, marshalErr := json.MarshalIndent(driftReport{Drift: drifts, InSync: len(drifts) == 0}, "", "  ")
+		if marshalErr != nil {
+			return logger.ErrorfAsError(log, "error marshaling drift report: %s", marshalErr)
+		}
+		fmt.Println(string(reportBytes))
+	case diffFormatYAML:
+		dStateYAML, marshalErr := util.StateYAML(normalizedDState)
+		if marshalErr != nil {
+			return logger.ErrorfAsError(log, "error marshaling desired state: %s", marshalErr)
+		}
+		dbStateYAML, marshalErr := util.StateYAML(normalizedDBState)
+		if marshalErr != nil {
+			return logger.ErrorfAsError(log, "error marshaling current state: %s", marshalErr)
+		}
+		fmt.Print(util.UnifiedDiff("desired", "database", dStateYAML, dbStateYAML))
+	case diffFormatText:
+		if len(drifts) == 0 {
+			fmt.Println("No drift. The database matches the desired state.")
+			break
+		}
+		table := tablewriter.NewWriter(os.Stdout)
+		table.SetHeader([]string{"Object Type", "Object", "Server", "Drift", "Attribute", "Desired", "Actual"})
+		for _, drift := range drifts {
+			table.Append([]string{drift.ObjectType, drift.ObjectName, drift.ServerName, drift.Kind, drift.Attribute, drift.Desired, drift.Actual})
+		}
+		table.Render()
+	default:
+		return logger.ErrorfAsError(log, "unknown output format: %s", diffOutputFormat)
+	}
+	if len(drifts) > 0 {
+		log.Infof("%d differences found", len(drifts))
+		return ErrDriftDetected
+	}
+	return nil
+}
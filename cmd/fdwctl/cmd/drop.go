@@ -12,7 +12,8 @@ import (
 )
 
 const (
-	dropServerCmdMinArgCount = 2
+	dropServerCmdMinArgCount       = 2
+	dropForeignTableCmdMinArgCount = 2
 )
 
 var (
@@ -46,18 +47,28 @@ var (
 		Run:   dropSchema,
 		Args:  cobra.MinimumNArgs(1),
 	}
+	dropForeignTableCmd = &cobra.Command{
+		Use:   "foreigntable <local schema> <table name>",
+		Short: "Drop a foreign table",
+		Run:   dropForeignTable,
+		Args:  cobra.MinimumNArgs(dropForeignTableCmdMinArgCount),
+	}
 	cascadeDrop   bool
 	dropLocalUser bool
+	dropWithTypes bool
 )
 
 func init() {
 	dropUsermapCmd.Flags().BoolVar(&dropLocalUser, "droplocal", false, "also drop the local USER object")
+	dropSchemaCmd.Flags().BoolVar(&dropWithTypes, "with-types", false, "also drop the types imported for the schema that are no longer used")
 
 	dropCmd.PersistentFlags().BoolVar(&cascadeDrop, "cascade", false, "drop objects with CASCADE option")
 	dropCmd.AddCommand(dropExtensionCmd)
 	dropCmd.AddCommand(dropServerCmd)
 	dropCmd.AddCommand(dropUsermapCmd)
 	dropCmd.AddCommand(dropSchemaCmd)
+	dropCmd.AddCommand(dropForeignTableCmd)
+	addLockFlags(dropCmd)
 }
 
 func preDoDrop(cmd *cobra.Command, _ []string) error {
@@ -68,10 +79,11 @@ func preDoDrop(cmd *cobra.Command, _ []string) error {
 	if err != nil {
 		return logger.ErrorfAsError(log, "error getting database connection: %s", err)
 	}
-	return nil
+	return lockDatabase(cmd.Context())
 }
 
 func postDoDrop(cmd *cobra.Command, _ []string) {
+	unlockDatabase(cmd.Context())
 	database.CloseConnection(cmd.Context(), dbConnection)
 }
 
@@ -141,4 +153,27 @@ func dropSchema(cmd *cobra.Command, args []string) {
 		return
 	}
 	log.Infof("schema %s dropped", dsSchemaName)
+	if dropWithTypes {
+		err = util.DropSchemaTypes(cmd.Context(), dbConnection, dsSchemaName)
+		if err != nil {
+			log.Errorf("error dropping types of schema %s: %s", dsSchemaName, err)
+			return
+		}
+		log.Infof("unused types of schema %s dropped", dsSchemaName)
+	}
+}
+
+func dropForeignTable(cmd *cobra.Command, args []string) {
+	log := logger.Log(cmd.Context()).
+		WithField("function", "dropForeignTable")
+	table := model.ForeignTable{
+		LocalSchema: strings.TrimSpace(args[0]),
+		Name:        strings.TrimSpace(args[1]),
+	}
+	err := util.DropForeignTable(cmd.Context(), dbConnection, table, cascadeDrop)
+	if err != nil {
+		log.Errorf("error dropping foreign table: %s", err)
+		return
+	}
+	log.Infof("foreign table %s dropped", table.QualifiedName())
 }
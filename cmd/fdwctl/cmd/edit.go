@@ -35,12 +35,16 @@ var (
 		Run:   editUsermap,
 		Args:  cobra.MinimumNArgs(editUserCmdMinArgCount),
 	}
-	editServerName     string
-	editServerHost     string
-	editServerPort     string
-	editServerDBName   string
-	editRemoteUser     string
-	editRemotePassword string
+	editServerName         string
+	editServerHost         string
+	editServerPort         string
+	editServerDBName       string
+	editServerOptions      []string
+	editDropOptions        []string
+	editRemoteUser         string
+	editRemotePassword     string
+	editUsermapOptions     []string
+	editUsermapDropOptions []string
 )
 
 func init() {
@@ -48,10 +52,15 @@ func init() {
 	editServerCmd.Flags().StringVar(&editServerHost, "serverhost", "", "the new hostname of the server object")
 	editServerCmd.Flags().StringVar(&editServerPort, "serverport", "", "the new port of the server object")
 	editServerCmd.Flags().StringVar(&editServerDBName, "serverdbname", "", "the new database name of the server object")
+	editServerCmd.Flags().StringArrayVar(&editServerOptions, "option", []string{}, "add or set a server option in key=value form; may be repeated")
+	editServerCmd.Flags().StringArrayVar(&editDropOptions, "drop-option", []string{}, "drop a server option; may be repeated")
 	editUsermapCmd.Flags().StringVar(&editRemoteUser, "remoteuser", "", "the new remote user name")
 	editUsermapCmd.Flags().StringVar(&editRemotePassword, "remotepassword", "", "the new password for the remote user")
+	editUsermapCmd.Flags().StringArrayVar(&editUsermapOptions, "option", []string{}, "add or set a user mapping option in key=value form; may be repeated")
+	editUsermapCmd.Flags().StringArrayVar(&editUsermapDropOptions, "drop-option", []string{}, "drop a user mapping option (e.g. password); may be repeated")
 	editCmd.AddCommand(editServerCmd)
 	editCmd.AddCommand(editUsermapCmd)
+	addLockFlags(editCmd)
 }
 
 func preDoEdit(cmd *cobra.Command, _ []string) error {
@@ -62,10 +71,11 @@ func preDoEdit(cmd *cobra.Command, _ []string) error {
 	if err != nil {
 		return logger.ErrorfAsError(log, "error getting database connection: %s", err)
 	}
-	return nil
+	return lockDatabase(cmd.Context())
 }
 
 func postDoEdit(cmd *cobra.Command, _ []string) {
+	unlockDatabase(cmd.Context())
 	database.CloseConnection(cmd.Context(), dbConnection)
 }
 
@@ -77,16 +87,34 @@ func editServer(cmd *cobra.Command, args []string) {
 		log.Errorf("server name is required")
 		return
 	}
-	portInt, err := strconv.Atoi(editServerPort)
+	servers, err := util.GetServers(cmd.Context(), dbConnection)
 	if err != nil {
-		log.Errorf("error converting port to integer: %s", err)
+		log.Errorf("error getting servers: %s", err)
 		return
 	}
-	fServer := model.ForeignServer{
-		Name: esServerName,
-		Host: editServerHost,
-		Port: portInt,
-		DB:   editServerDBName,
+	dbServer := util.FindForeignServer(servers, esServerName)
+	if dbServer == nil {
+		log.Errorf("server %s does not exist", esServerName)
+		return
+	}
+	fServer := *dbServer
+	if editServerHost != "" {
+		fServer.Host = editServerHost
+	}
+	if editServerPort != "" {
+		fServer.Port, err = strconv.Atoi(editServerPort)
+		if err != nil {
+			log.Errorf("error converting port to integer: %s", err)
+			return
+		}
+	}
+	if editServerDBName != "" {
+		fServer.DB = editServerDBName
+	}
+	err = util.ApplyServerOptionChanges(&fServer, editServerOptions, editDropOptions)
+	if err != nil {
+		log.Errorf("error parsing server options: %s", err)
+		return
 	}
 	err = util.UpdateServer(cmd.Context(), dbConnection, fServer)
 	if err != nil {
@@ -118,14 +146,36 @@ func editUsermap(cmd *cobra.Command, args []string) {
 		log.Errorf("local user name is required")
 		return
 	}
-	err := util.UpdateUserMap(cmd.Context(), dbConnection, model.UserMap{
-		ServerName: euServerName,
-		LocalUser:  euLocalUser,
-		RemoteUser: editRemoteUser,
-		RemoteSecret: model.Secret{
+	euLocalUser, err := util.ResolveLocalUser(cmd.Context(), dbConnection, euLocalUser)
+	if err != nil {
+		log.Errorf("error resolving local user %s: %s", args[1], err)
+		return
+	}
+	usermaps, err := util.GetUserMapsForServer(cmd.Context(), dbConnection, euServerName)
+	if err != nil {
+		log.Errorf("error getting user mappings for server %s: %s", euServerName, err)
+		return
+	}
+	dbUserMap := util.FindUserMap(usermaps, euLocalUser)
+	if dbUserMap == nil {
+		log.Errorf("user mapping for local user %s on server %s does not exist", euLocalUser, euServerName)
+		return
+	}
+	usermap := *dbUserMap
+	if editRemoteUser != "" {
+		usermap.RemoteUser = editRemoteUser
+	}
+	if editRemotePassword != "" {
+		usermap.RemoteSecret = model.Secret{
 			Value: editRemotePassword,
-		},
-	})
+		}
+	}
+	err = util.ApplyUserMapOptionChanges(&usermap, editUsermapOptions, editUsermapDropOptions)
+	if err != nil {
+		log.Errorf("error parsing user mapping options: %s", err)
+		return
+	}
+	err = util.UpdateUserMap(cmd.Context(), dbConnection, usermap)
 	if err != nil {
 		log.Errorf("error editing user mapping: %s", err)
 		return
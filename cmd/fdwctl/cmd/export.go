@@ -0,0 +1,100 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+
+	"github.com/neflyte/fdwctl/lib/config"
+	"github.com/neflyte/fdwctl/lib/database"
+	"github.com/neflyte/fdwctl/lib/logger"
+	"github.com/neflyte/fdwctl/lib/model"
+	"github.com/neflyte/fdwctl/lib/util"
+)
+
+const (
+	// exportFormatYAML is the YAML output format of an exported desired state
+	exportFormatYAML = "yaml"
+	// exportFormatJSON is the JSON output format of an exported desired state
+	exportFormatJSON = "json"
+	// exportFilePermissions are the file permissions of an exported desired state file
+	exportFilePermissions = 0o600
+)
+
+var (
+	exportCmd = &cobra.Command{
+		Use:               "export",
+		Short:             "Export the FDW configuration as a desired state",
+		Long:              "Read the extensions, foreign servers, user mappings, and foreign schemas of the FDW database and write them as a desired state configuration. Credentials are replaced with fromEnv placeholders.",
+		PersistentPreRunE: preDoExport,
+		PersistentPostRun: postDoExport,
+		RunE:              doExport,
+	}
+	exportOutputFormat string
+	exportOutFile      string
+)
+
+// exportDocument is the configuration file document produced by the export command
+type exportDocument struct {
+	DesiredState model.DesiredState `yaml:"DesiredState" json:"DesiredState"`
+}
+
+func init() {
+	exportCmd.Flags().StringVar(&exportOutputFormat, "format", exportFormatYAML, "output format [yaml, json]")
+	exportCmd.Flags().StringVar(&exportOutFile, "out", "", "write the desired state to a file instead of stdout")
+}
+
+func preDoExport(cmd *cobra.Command, _ []string) error {
+	var err error
+
+	log := logger.Log(cmd.Context()).
+		WithField("function", "preDoExport")
+	dbConnection, err = database.GetConnection(cmd.Context(), config.Instance().GetDatabaseConnectionString())
+	if err != nil {
+		return logger.ErrorfAsError(log, "error getting database connection: %s", err)
+	}
+	return nil
+}
+
+func postDoExport(cmd *cobra.Command, _ []string) {
+	database.CloseConnection(cmd.Context(), dbConnection)
+}
+
+func doExport(cmd *cobra.Command, _ []string) error {
+	var docBytes []byte
+
+	log := logger.Log(cmd.Context()).
+		WithField("function", "doExport")
+	exported, err := util.ExportState(cmd.Context(), dbConnection)
+	if err != nil {
+		log.Errorf("error exporting state: %s", err)
+		return err
+	}
+	doc := exportDocument{
+		DesiredState: exported,
+	}
+	switch exportOutputFormat {
+	case exportFormatJSON:
+		docBytes, err = json.MarshalIndent(doc, "", "  ")
+	case exportFormatYAML:
+		docBytes, err = yaml.Marshal(doc)
+	default:
+		return logger.ErrorfAsError(log, "unknown output format: %s", exportOutputFormat)
+	}
+	if err != nil {
+		return logger.ErrorfAsError(log, "error marshaling desired state: %s", err)
+	}
+	if exportOutFile == "" {
+		fmt.Print(string(docBytes))
+		return nil
+	}
+	err = os.WriteFile(exportOutFile, docBytes, exportFilePermissions)
+	if err != nil {
+		return logger.ErrorfAsError(log, "error writing desired state file %s: %s", exportOutFile, err)
+	}
+	log.Infof("desired state exported to %s", exportOutFile)
+	return nil
+}
@@ -0,0 +1,70 @@
+package cmd
+
+import (
+	"strings"
+
+	"github.com/neflyte/fdwctl/lib/config"
+	"github.com/neflyte/fdwctl/lib/database"
+	"github.com/neflyte/fdwctl/lib/logger"
+	"github.com/neflyte/fdwctl/lib/util"
+	"github.com/spf13/cobra"
+)
+
+const (
+	grantServerCmdMinArgCount = 2
+)
+
+var (
+	grantCmd = &cobra.Command{
+		Use:               "grant",
+		Short:             "Grant privileges on objects",
+		PersistentPreRunE: preDoGrant,
+		PersistentPostRun: postDoGrant,
+	}
+	grantServerCmd = &cobra.Command{
+		Use:   "server <server name> <user> [user...]",
+		Short: "Grant usage on a foreign server to one or more users",
+		Run:   grantServer,
+		Args:  cobra.MinimumNArgs(grantServerCmdMinArgCount),
+	}
+)
+
+func init() {
+	grantCmd.AddCommand(grantServerCmd)
+	addLockFlags(grantCmd)
+}
+
+func preDoGrant(cmd *cobra.Command, _ []string) error {
+	var err error
+	log := logger.Log(cmd.Context()).
+		WithField("function", "preDoGrant")
+	dbConnection, err = database.GetConnection(cmd.Context(), config.Instance().GetDatabaseConnectionString())
+	if err != nil {
+		return logger.ErrorfAsError(log, "error getting database connection: %s", err)
+	}
+	return lockDatabase(cmd.Context())
+}
+
+func postDoGrant(cmd *cobra.Command, _ []string) {
+	unlockDatabase(cmd.Context())
+	database.CloseConnection(cmd.Context(), dbConnection)
+}
+
+func grantServer(cmd *cobra.Command, args []string) {
+	log := logger.Log(cmd.Context()).
+		WithField("function", "grantServer")
+	gsServerName := strings.TrimSpace(args[0])
+	if gsServerName == "" {
+		log.Errorf("server name is required")
+		return
+	}
+	for _, arg := range args[1:] {
+		gsUser := strings.TrimSpace(arg)
+		err := util.GrantServer(cmd.Context(), dbConnection, gsServerName, gsUser)
+		if err != nil {
+			log.Errorf("error granting usage on server %s to %s: %s", gsServerName, gsUser, err)
+			return
+		}
+		log.Infof("usage on server %s granted to %s", gsServerName, gsUser)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"database/sql"
 	"fmt"
 	"os"
+	"sort"
 	"strings"
 
 	"github.com/olekukonko/tablewriter"
@@ -42,6 +43,11 @@ var (
 		Short: "List schemas that contain foreign tables",
 		Run:   listSchema,
 	}
+	listForeignTableCmd = &cobra.Command{
+		Use:   "foreigntable [server name]",
+		Short: "List foreign tables defined column by column",
+		Run:   listForeignTable,
+	}
 	dbConnection *sql.DB
 )
 
@@ -50,6 +56,7 @@ func init() {
 	listCmd.AddCommand(listExtensionCmd)
 	listCmd.AddCommand(listUsermapCmd)
 	listCmd.AddCommand(listSchemaCmd)
+	listCmd.AddCommand(listForeignTableCmd)
 }
 
 func preDoList(cmd *cobra.Command, _ []string) error {
@@ -77,13 +84,31 @@ func listServers(cmd *cobra.Command, _ []string) {
 		return
 	}
 	table := tablewriter.NewWriter(os.Stdout)
-	table.SetHeader([]string{"Name", "Wrapper", "Owner", "Hostname", "Port", "DB Name"})
+	table.SetHeader([]string{"Name", "Wrapper", "Owner", "Hostname", "Port", "DB Name", "Options"})
 	for _, server := range servers {
-		table.Append([]string{server.Name, server.Wrapper, server.Owner, server.Host, fmt.Sprintf("%d", server.Port), server.DB})
+		port := ""
+		if server.Port > 0 {
+			port = fmt.Sprintf("%d", server.Port)
+		}
+		table.Append([]string{server.Name, server.Wrapper, server.Owner, server.Host, port, server.DB, formatOptions(server.Options)})
 	}
 	table.Render()
 }
 
+// formatOptions returns the supplied options as a list of key=value pairs ordered by key
+func formatOptions(options map[string]string) string {
+	optionNames := make([]string, 0, len(options))
+	for optionName := range options {
+		optionNames = append(optionNames, optionName)
+	}
+	sort.Strings(optionNames)
+	formatted := make([]string, len(optionNames))
+	for idx, optionName := range optionNames {
+		formatted[idx] = fmt.Sprintf("%s=%s", optionName, options[optionName])
+	}
+	return strings.Join(formatted, ", ")
+}
+
 func listExtension(cmd *cobra.Command, _ []string) {
 	log := logger.Log(cmd.Context()).
 		WithField("function", "listExtension")
@@ -114,9 +139,9 @@ func listUsermap(cmd *cobra.Command, args []string) {
 		return
 	}
 	table := tablewriter.NewWriter(os.Stdout)
-	table.SetHeader([]string{"Local User", "Remote User", "Remote Password", "Remote Server"})
+	table.SetHeader([]string{"Local User", "Remote User", "Remote Password", "Remote Server", "Options"})
 	for _, usermap := range usermaps {
-		table.Append([]string{usermap.LocalUser, usermap.RemoteUser, usermap.RemoteSecret.Value, usermap.ServerName})
+		table.Append([]string{usermap.LocalUser, usermap.RemoteUser, usermap.RemoteSecret.Value, usermap.ServerName, formatOptions(usermap.Options)})
 	}
 	table.Render()
 }
@@ -136,3 +161,35 @@ func listSchema(cmd *cobra.Command, _ []string) {
 	}
 	table.Render()
 }
+
+func listForeignTable(cmd *cobra.Command, args []string) {
+	log := logger.Log(cmd.Context()).
+		WithField("function", "listForeignTable")
+	foreignServer := ""
+	if len(args) > 0 {
+		foreignServer = strings.TrimSpace(args[0])
+	}
+	tables, err := util.GetForeignTables(cmd.Context(), dbConnection, foreignServer)
+	if err != nil {
+		log.Errorf("error getting foreign tables for server %s: %s", foreignServer, err)
+		return
+	}
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader([]string{"Schema Name", "Table Name", "Foreign Server", "Remote Schema", "Remote Table", "Columns", "Options"})
+	for _, foreignTable := range tables {
+		columns := make([]string, len(foreignTable.Columns))
+		for idx, column := range foreignTable.Columns {
+			columns[idx] = column.String()
+		}
+		table.Append([]string{
+			foreignTable.LocalSchema,
+			foreignTable.Name,
+			foreignTable.ServerName,
+			foreignTable.RemoteSchema,
+			foreignTable.RemoteTable,
+			strings.Join(columns, ", "),
+			formatOptions(foreignTable.Options),
+		})
+	}
+	table.Render()
+}
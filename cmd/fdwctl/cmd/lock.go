@@ -0,0 +1,51 @@
+package cmd
+
+import (
+	"context"
+	"time"
+
+	"github.com/neflyte/fdwctl/lib/database"
+	"github.com/neflyte/fdwctl/lib/logger"
+	"github.com/neflyte/fdwctl/lib/util"
+	"github.com/spf13/cobra"
+)
+
+const (
+	// defaultLockTimeout is how long a command waits for another fdwctl process to release the database by default
+	defaultLockTimeout = 5 * time.Minute
+)
+
+var (
+	lockTimeout  time.Duration
+	lockKey      int64
+	advisoryLock *util.AdvisoryLock
+)
+
+// addLockFlags adds the flags of the advisory lock a command that changes the database takes
+func addLockFlags(cmd *cobra.Command) {
+	cmd.PersistentFlags().DurationVar(&lockTimeout, "lock-timeout", defaultLockTimeout, "how long to wait for another fdwctl process to release the database; 0 waits indefinitely")
+	cmd.PersistentFlags().Int64Var(&lockKey, "lock-key", util.DefaultLockKey, "key of the advisory lock taken on the database before changing it")
+}
+
+// lockDatabase takes the advisory lock on the database so that only one fdwctl process changes it at a time. It is
+// called last in the pre-run hook of a command; since cobra does not run the post-run hook when the pre-run hook
+// fails, the database connection is closed here when the lock cannot be taken.
+func lockDatabase(ctx context.Context) error {
+	var err error
+
+	log := logger.Log(ctx).
+		WithField("function", "lockDatabase")
+	advisoryLock, err = util.AcquireAdvisoryLock(ctx, dbConnection, lockKey, lockTimeout)
+	if err != nil {
+		log.Errorf("error locking database: %s", err)
+		database.CloseConnection(ctx, dbConnection)
+		return err
+	}
+	return nil
+}
+
+// unlockDatabase releases the advisory lock on the database if it was taken
+func unlockDatabase(ctx context.Context) {
+	advisoryLock.Release(ctx)
+	advisoryLock = nil
+}
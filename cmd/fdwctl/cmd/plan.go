@@ -0,0 +1,120 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/olekukonko/tablewriter"
+	"github.com/spf13/cobra"
+
+	"github.com/neflyte/fdwctl/lib/config"
+	"github.com/neflyte/fdwctl/lib/database"
+	"github.com/neflyte/fdwctl/lib/logger"
+	"github.com/neflyte/fdwctl/lib/model"
+	"github.com/neflyte/fdwctl/lib/util"
+)
+
+const (
+	// planFormatTable is the human-readable table output format of a plan
+	planFormatTable = "table"
+	// planFormatJSON is the JSON output format of a plan
+	planFormatJSON = "json"
+)
+
+var (
+	planCmd = &cobra.Command{
+		Use:               "plan",
+		Short:             "Show the actions needed to apply a desired state",
+		Long:              "Compare the desired state configuration with the FDW database and show the actions that apply would take without changing anything",
+		PersistentPreRunE: preDoPlan,
+		PersistentPostRun: postDoPlan,
+		RunE:              doPlan,
+	}
+	planRecreateSchemas bool
+	planOutputFormat    string
+	planOutFile         string
+	planPrune           string
+	planServers         []string
+	planOnly            []string
+)
+
+func init() {
+	planCmd.Flags().BoolVar(&planRecreateSchemas, "recreateschemas", false, "flag indicating that foreign schemas should be re-created")
+	planCmd.Flags().StringVar(&planOutputFormat, "format", planFormatTable, "output format [table, json]")
+	planCmd.Flags().StringVar(&planOutFile, "out", "", "save the plan to a file that can be applied later with apply --plan")
+	planCmd.Flags().StringVar(&planPrune, "prune", util.PruneOwned, "which objects that are not in the desired state are dropped [none, owned, all]")
+	planCmd.Flags().StringArrayVar(&planServers, "server", []string{}, "only plan the desired state of this server, glob pattern, or /regex/; may be repeated")
+	planCmd.Flags().StringSliceVar(&planOnly, "only", []string{}, "only plan these kinds of objects [extensions, servers, usermaps, schemas, foreigntables]")
+}
+
+func preDoPlan(cmd *cobra.Command, _ []string) error {
+	var err error
+
+	log := logger.Log(cmd.Context()).
+		WithField("function", "preDoPlan")
+	dbConnection, err = database.GetConnection(cmd.Context(), config.Instance().GetDatabaseConnectionString())
+	if err != nil {
+		return logger.ErrorfAsError(log, "error getting database connection: %s", err)
+	}
+	return nil
+}
+
+func postDoPlan(cmd *cobra.Command, _ []string) {
+	database.CloseConnection(cmd.Context(), dbConnection)
+}
+
+func doPlan(cmd *cobra.Command, _ []string) error {
+	log := logger.Log(cmd.Context()).
+		WithField("function", "doPlan")
+	plan, err := util.PlanDesiredState(cmd.Context(), dbConnection, config.Instance().DesiredState, util.PlanOptions{
+		RecreateSchemas: planRecreateSchemas,
+		Prune:           planPrune,
+		Servers:         planServers,
+		Only:            planOnly,
+	})
+	if err != nil {
+		log.Errorf("error planning desired state: %s", err)
+		return err
+	}
+	if planOutFile != "" {
+		err = util.WritePlanFile(planOutFile, plan)
+		if err != nil {
+			log.Errorf("error saving plan: %s", err)
+			return err
+		}
+		log.Infof("plan saved to %s", planOutFile)
+	}
+	return outputPlan(plan, planOutputFormat)
+}
+
+// outputPlan writes the actions of a plan to stdout in the specified format
+func outputPlan(plan *model.Plan, format string) error {
+	log := logger.Log().
+		WithField("function", "outputPlan")
+	switch format {
+	case planFormatJSON:
+		planBytes, err := json.MarshalIndent(plan, "", "  ")
+		if err != nil {
+			return logger.ErrorfAsError(log, "error marshaling plan: %s", err)
+		}
+		fmt.Println(string(planBytes))
+	case planFormatTable:
+		if plan.IsEmpty() {
+			fmt.Println("No changes. The database matches the desired state.")
+			return nil
+		}
+		table := tablewriter.NewWriter(os.Stdout)
+		table.SetHeader([]string{"Step", "Operation", "Object Type", "Object", "Server", "SQL"})
+		table.SetAutoWrapText(false)
+		for _, action := range plan.Actions {
+			table.Append([]string{strconv.Itoa(action.Step), action.Operation, action.ObjectType, action.ObjectName, action.ServerName, action.SQL})
+		}
+		table.Render()
+		fmt.Printf("Catalog fingerprint: %s\n", plan.Fingerprint)
+	default:
+		return logger.ErrorfAsError(log, "unknown output format: %s", format)
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+package cmd
+
+import (
+	"strings"
+
+	"github.com/neflyte/fdwctl/lib/config"
+	"github.com/neflyte/fdwctl/lib/database"
+	"github.com/neflyte/fdwctl/lib/logger"
+	"github.com/neflyte/fdwctl/lib/model"
+	"github.com/neflyte/fdwctl/lib/util"
+	"github.com/spf13/cobra"
+)
+
+var (
+	refreshCmd = &cobra.Command{
+		Use:               "refresh",
+		Short:             "Bring imported objects up to date with the remote database",
+		PersistentPreRunE: preDoRefresh,
+		PersistentPostRun: postDoRefresh,
+	}
+	refreshSchemaCmd = &cobra.Command{
+		Use:   "schema <local schema name>",
+		Short: "Import new remote tables, drop vanished ones, and re-create tables whose columns changed",
+		Long:  "Incrementally refresh a foreign schema instead of dropping and re-importing it. The remote database is read through the enum connection or the user mapping of the server.",
+		RunE:  refreshSchema,
+		Args:  cobra.ExactArgs(1),
+	}
+	refreshImportEnums    bool
+	refreshEnumConnection string
+	refreshDryRun         bool
+	refreshOutputFormat   string
+)
+
+func init() {
+	refreshSchemaCmd.Flags().BoolVar(&refreshImportEnums, "importenums", false, "attempt to auto-create ENUMs and other user-defined types locally before importing tables")
+	refreshSchemaCmd.Flags().StringVar(&refreshEnumConnection, "enumconnection", "", "connection string of the remote database; derived from the server and its user mapping when omitted")
+	refreshSchemaCmd.Flags().BoolVar(&refreshDryRun, "dry-run", false, "show the planned actions without changing the database")
+	refreshSchemaCmd.Flags().StringVar(&refreshOutputFormat, "format", planFormatTable, "output format of the planned actions when --dry-run is set [table, json]")
+	refreshCmd.AddCommand(refreshSchemaCmd)
+	addLockFlags(refreshCmd)
+}
+
+func preDoRefresh(cmd *cobra.Command, _ []string) error {
+	var err error
+	log := logger.Log(cmd.Context()).
+		WithField("function", "preDoRefresh")
+	dbConnection, err = database.GetConnection(cmd.Context(), config.Instance().GetDatabaseConnectionString())
+	if err != nil {
+		return logger.ErrorfAsError(log, "error getting database connection: %s", err)
+	}
+	if refreshDryRun {
+		return nil
+	}
+	return lockDatabase(cmd.Context())
+}
+
+func postDoRefresh(cmd *cobra.Command, _ []string) {
+	unlockDatabase(cmd.Context())
+	database.CloseConnection(cmd.Context(), dbConnection)
+}
+
+func refreshSchema(cmd *cobra.Command, args []string) error {
+	log := logger.Log(cmd.Context()).
+		WithField("function", "refreshSchema")
+	rsLocalSchema := strings.TrimSpace(args[0])
+	if rsLocalSchema == "" {
+		return logger.ErrorfAsError(log, "local schema name is required")
+	}
+	plan, err := util.PlanRefreshSchema(cmd.Context(), dbConnection, model.Schema{
+		LocalSchema:    rsLocalSchema,
+		ImportENUMs:    refreshImportEnums,
+		ENUMConnection: refreshEnumConnection,
+	})
+	if err != nil {
+		log.Errorf("error planning refresh of foreign schema %s: %s", rsLocalSchema, err)
+		return err
+	}
+	if refreshDryRun {
+		return outputPlan(plan, refreshOutputFormat)
+	}
+	err = util.ExecutePlanInTransaction(cmd.Context(), dbConnection, plan)
+	if err != nil {
+		log.Errorf("error refreshing foreign schema %s: %s", rsLocalSchema, err)
+		return err
+	}
+	log.Infof("foreign schema %s refreshed; %d changes made", rsLocalSchema, len(plan.Actions))
+	return nil
+}
@@ -0,0 +1,70 @@
+package cmd
+
+import (
+	"strings"
+
+	"github.com/neflyte/fdwctl/lib/config"
+	"github.com/neflyte/fdwctl/lib/database"
+	"github.com/neflyte/fdwctl/lib/logger"
+	"github.com/neflyte/fdwctl/lib/util"
+	"github.com/spf13/cobra"
+)
+
+const (
+	revokeServerCmdMinArgCount = 2
+)
+
+var (
+	revokeCmd = &cobra.Command{
+		Use:               "revoke",
+		Short:             "Revoke privileges on objects",
+		PersistentPreRunE: preDoRevoke,
+		PersistentPostRun: postDoRevoke,
+	}
+	revokeServerCmd = &cobra.Command{
+		Use:   "server <server name> <user> [user...]",
+		Short: "Revoke usage on a foreign server from one or more users",
+		Run:   revokeServer,
+		Args:  cobra.MinimumNArgs(revokeServerCmdMinArgCount),
+	}
+)
+
+func init() {
+	revokeCmd.AddCommand(revokeServerCmd)
+	addLockFlags(revokeCmd)
+}
+
+func preDoRevoke(cmd *cobra.Command, _ []string) error {
+	var err error
+	log := logger.Log(cmd.Context()).
+		WithField("function", "preDoRevoke")
+	dbConnection, err = database.GetConnection(cmd.Context(), config.Instance().GetDatabaseConnectionString())
+	if err != nil {
+		return logger.ErrorfAsError(log, "error getting database connection: %s", err)
+	}
+	return lockDatabase(cmd.Context())
+}
+
+func postDoRevoke(cmd *cobra.Command, _ []string) {
+	unlockDatabase(cmd.Context())
+	database.CloseConnection(cmd.Context(), dbConnection)
+}
+
+func revokeServer(cmd *cobra.Command, args []string) {
+	log := logger.Log(cmd.Context()).
+		WithField("function", "revokeServer")
+	rsServerName := strings.TrimSpace(args[0])
+	if rsServerName == "" {
+		log.Errorf("server name is required")
+		return
+	}
+	for _, arg := range args[1:] {
+		rsUser := strings.TrimSpace(arg)
+		err := util.RevokeServer(cmd.Context(), dbConnection, rsServerName, rsUser)
+		if err != nil {
+			log.Errorf("error revoking usage on server %s from %s: %s", rsServerName, rsUser, err)
+			return
+		}
+		log.Infof("usage on server %s revoked from %s", rsServerName, rsUser)
+	}
+}
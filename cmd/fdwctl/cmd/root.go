@@ -39,6 +39,14 @@ func init() {
 	rootCmd.AddCommand(dropCmd)
 	rootCmd.AddCommand(editCmd)
 	rootCmd.AddCommand(desiredStateCmd)
+	rootCmd.AddCommand(planCmd)
+	rootCmd.AddCommand(diffCmd)
+	rootCmd.AddCommand(exportCmd)
+	rootCmd.AddCommand(grantCmd)
+	rootCmd.AddCommand(revokeCmd)
+	rootCmd.AddCommand(refreshCmd)
+	rootCmd.AddCommand(checkCmd)
+	rootCmd.AddCommand(syncCmd)
 }
 
 func initCommand() {
@@ -0,0 +1,98 @@
+package cmd
+
+import (
+	"strings"
+
+	"github.com/neflyte/fdwctl/lib/config"
+	"github.com/neflyte/fdwctl/lib/database"
+	"github.com/neflyte/fdwctl/lib/logger"
+	"github.com/neflyte/fdwctl/lib/model"
+	"github.com/neflyte/fdwctl/lib/util"
+	"github.com/spf13/cobra"
+)
+
+var (
+	syncCmd = &cobra.Command{
+		Use:               "sync",
+		Short:             "Synchronize local objects with the remote database",
+		PersistentPreRunE: preDoSync,
+		PersistentPostRun: postDoSync,
+	}
+	syncEnumsCmd = &cobra.Command{
+		Use:           "enums <local schema name>",
+		Short:         "Create missing ENUM types and add missing ENUM values used by a foreign schema",
+		Long:          "Reconcile the local ENUM types used by the remote schema of a foreign schema with their remote definitions. Missing values are added in remote sort order. Values that were removed or reordered remotely cannot be changed in place and are reported instead. Exits with status 0 when the ENUM types match, 2 when such differences remain, and 1 on error.",
+		RunE:          syncEnums,
+		Args:          cobra.ExactArgs(1),
+		SilenceUsage:  true,
+		SilenceErrors: true,
+	}
+	syncEnumConnection string
+	syncDryRun         bool
+	syncOutputFormat   string
+)
+
+func init() {
+	syncEnumsCmd.Flags().StringVar(&syncEnumConnection, "enumconnection", "", "connection string of the remote database; derived from the server and its user mapping when omitted")
+	syncEnumsCmd.Flags().BoolVar(&syncDryRun, "dry-run", false, "show the planned actions without changing the database")
+	syncEnumsCmd.Flags().StringVar(&syncOutputFormat, "format", planFormatTable, "output format of the planned actions when --dry-run is set [table, json]")
+	syncCmd.AddCommand(syncEnumsCmd)
+	addLockFlags(syncCmd)
+}
+
+func preDoSync(cmd *cobra.Command, _ []string) error {
+	var err error
+	log := logger.Log(cmd.Context()).
+		WithField("function", "preDoSync")
+	dbConnection, err = database.GetConnection(cmd.Context(), config.Instance().GetDatabaseConnectionString())
+	if err != nil {
+		return logger.ErrorfAsError(log, "error getting database connection: %s", err)
+	}
+	if syncDryRun {
+		return nil
+	}
+	return lockDatabase(cmd.Context())
+}
+
+func postDoSync(cmd *cobra.Command, _ []string) {
+	unlockDatabase(cmd.Context())
+	database.CloseConnection(cmd.Context(), dbConnection)
+}
+
+func syncEnums(cmd *cobra.Command, args []string) error {
+	log := logger.Log(cmd.Context()).
+		WithField("function", "syncEnums")
+	seLocalSchema := strings.TrimSpace(args[0])
+	if seLocalSchema == "" {
+		return logger.ErrorfAsError(log, "local schema name is required")
+	}
+	plan, drifts, err := util.PlanSyncEnums(cmd.Context(), dbConnection, model.Schema{
+		LocalSchema:    seLocalSchema,
+		ENUMConnection: syncEnumConnection,
+	})
+	if err != nil {
+		log.Errorf("error planning ENUM sync of foreign schema %s: %s", seLocalSchema, err)
+		return err
+	}
+	if syncDryRun {
+		err = outputPlan(plan, syncOutputFormat)
+		if err != nil {
+			return err
+		}
+	} else {
+		// ALTER TYPE ... ADD VALUE cannot run inside a transaction block before PostgreSQL 12
+		err = util.ExecutePlan(cmd.Context(), dbConnection, plan)
+		if err != nil {
+			log.Errorf("error syncing ENUMs of foreign schema %s: %s", seLocalSchema, err)
+			return err
+		}
+		log.Infof("ENUMs of foreign schema %s synced; %d changes made", seLocalSchema, len(plan.Actions))
+	}
+	for _, drift := range drifts {
+		log.Warnf("%s; the enum type must be re-created to fix it", drift.String())
+	}
+	if len(drifts) > 0 {
+		return ErrDriftDetected
+	}
+	return nil
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"errors"
 	"os"
 
 	"github.com/neflyte/fdwctl/cmd/fdwctl/cmd"
@@ -9,6 +10,9 @@ import (
 func main() {
 	err := cmd.Execute()
 	if err != nil {
+		if errors.Is(err, cmd.ErrDriftDetected) {
+			os.Exit(cmd.ExitCodeDrift)
+		}
 		os.Exit(1)
 	}
 }
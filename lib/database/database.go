@@ -6,6 +6,7 @@ package database
 import (
 	"context"
 	"database/sql"
+	"errors"
 
 	_ "github.com/jackc/pgx/v4/stdlib"
 
@@ -17,6 +18,13 @@ const (
 	driverName = "pgx"
 )
 
+// Executor is the set of statement execution methods shared by *sql.DB, *sql.Conn, and *sql.Tx. Functions that
+// accept an Executor can run their statements either directly against the database or inside a transaction.
+type Executor interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+}
+
 // GetConnection returns an established connection to a database using the supplied connection string
 func GetConnection(ctx context.Context, connectionString string) (*sql.DB, error) {
 	log := logger.Log(ctx).
@@ -57,3 +65,16 @@ func CloseRows(ctx context.Context, rows *sql.Rows) {
 		}
 	}
 }
+
+// RollbackTransaction rolls back a transaction and logs any resulting errors
+func RollbackTransaction(ctx context.Context, tx *sql.Tx) {
+	log := logger.Log(ctx).
+		WithField("function", "RollbackTransaction")
+	if tx != nil {
+		log.Trace("rolling back transaction")
+		err := tx.Rollback()
+		if err != nil && !errors.Is(err, sql.ErrTxDone) {
+			log.Errorf("error rolling back transaction: %s", err)
+		}
+	}
+}
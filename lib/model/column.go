@@ -0,0 +1,22 @@
+package model
+
+import "fmt"
+
+// Column represents a column of a table or foreign table
+type Column struct {
+	// Name is the name of the column
+	Name string `yaml:"name" json:"name"`
+	// Type is the data type of the column including any type modifiers (e.g. character varying(20))
+	Type string `yaml:"type" json:"type"`
+	// NotNull indicates that the column has a NOT NULL constraint
+	NotNull bool `yaml:"notNull,omitempty" json:"notNull,omitempty"`
+	// Options are the column options of a column of a foreign table (e.g. column_name for postgres_fdw)
+	Options map[string]string `yaml:"options,omitempty" json:"options,omitempty"`
+}
+
+func (c Column) String() string {
+	if c.NotNull {
+		return fmt.Sprintf("%s %s NOT NULL", c.Name, c.Type)
+	}
+	return fmt.Sprintf("%s %s", c.Name, c.Type)
+}
@@ -11,6 +11,10 @@ type DesiredState struct {
 	Extensions []Extension `yaml:"Extensions,omitempty" json:"Extensions,omitempty"`
 	// Servers is a list of foreign servers
 	Servers []ForeignServer `yaml:"Servers,omitempty" json:"Servers,omitempty"`
+	// Ignore are the names of foreign servers, local schemas, and foreign tables (schema.table) that are never
+	// dropped when they are not in the desired state. Entries may be glob patterns or regular expressions enclosed in
+	// slashes.
+	Ignore []string `yaml:"Ignore,omitempty" json:"Ignore,omitempty"`
 }
 
 func (d DesiredState) String() string {
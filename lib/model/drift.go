@@ -0,0 +1,41 @@
+package model
+
+import "fmt"
+
+const (
+	// DriftMissing indicates that an object in the desired state does not exist in the database
+	DriftMissing = "missing"
+	// DriftUnexpected indicates that an object in the database is not in the desired state
+	DriftUnexpected = "unexpected"
+	// DriftChanged indicates that an attribute of an object differs between the desired state and the database
+	DriftChanged = "changed"
+)
+
+// Drift represents a single difference between the desired state and the database
+type Drift struct {
+	// ObjectType is the type of the object that has drifted
+	ObjectType string `yaml:"objectType" json:"objectType"`
+	// ObjectName is the name of the object that has drifted
+	ObjectName string `yaml:"objectName" json:"objectName"`
+	// ServerName is the name of the foreign server the object belongs to, if any
+	ServerName string `yaml:"serverName,omitempty" json:"serverName,omitempty"`
+	// Kind is the kind of drift (missing, unexpected, changed)
+	Kind string `yaml:"kind" json:"kind"`
+	// Attribute is the attribute of the object that differs, if any
+	Attribute string `yaml:"attribute,omitempty" json:"attribute,omitempty"`
+	// Desired is the value of the attribute in the desired state
+	Desired string `yaml:"desired,omitempty" json:"desired,omitempty"`
+	// Actual is the value of the attribute in the database
+	Actual string `yaml:"actual,omitempty" json:"actual,omitempty"`
+}
+
+func (d *Drift) String() string {
+	object := fmt.Sprintf("%s %s", d.ObjectType, d.ObjectName)
+	if d.ServerName != "" {
+		object = fmt.Sprintf("%s (server %s)", object, d.ServerName)
+	}
+	if d.Attribute != "" {
+		return fmt.Sprintf("%s %s: %s: desired %q, actual %q", object, d.Kind, d.Attribute, d.Desired, d.Actual)
+	}
+	return fmt.Sprintf("%s %s", object, d.Kind)
+}
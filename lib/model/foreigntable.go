@@ -0,0 +1,48 @@
+package model
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ForeignTable represents a foreign table that is defined column by column in the desired state instead of being
+// imported with a foreign schema
+type ForeignTable struct {
+	// ServerName is the name of the foreign server
+	ServerName string `yaml:"-" json:"-"`
+	// LocalSchema is the name of the local schema that holds the foreign table
+	LocalSchema string `yaml:"localschema" json:"localschema"`
+	// Name is the name of the foreign table
+	Name string `yaml:"name" json:"name"`
+	// RemoteSchema is the schema of the remote table; the default of the foreign data wrapper is used when it is empty
+	RemoteSchema string `yaml:"remoteschema,omitempty" json:"remoteschema,omitempty"`
+	// RemoteTable is the name of the remote table or view; the default of the foreign data wrapper, usually the name
+	// of the foreign table, is used when it is empty
+	RemoteTable string `yaml:"remotetable,omitempty" json:"remotetable,omitempty"`
+	// Columns are the columns of the foreign table in order
+	Columns []Column `yaml:"columns" json:"columns"`
+	// Options are the foreign table options other than the ones that name the remote schema and table
+	Options map[string]string `yaml:"options,omitempty" json:"options,omitempty"`
+}
+
+// QualifiedName returns the name of this foreign table prefixed with its local schema
+func (ft ForeignTable) QualifiedName() string {
+	return fmt.Sprintf("%s.%s", ft.LocalSchema, ft.Name)
+}
+
+func (ft ForeignTable) String() string {
+	columns := make([]string, len(ft.Columns))
+	for idx, column := range ft.Columns {
+		columns[idx] = column.String()
+	}
+	return fmt.Sprintf(
+		"server: %s, localschema: %s, name: %s, remoteschema: %s, remotetable: %s, columns: {%s}, options: %v",
+		ft.ServerName,
+		ft.LocalSchema,
+		ft.Name,
+		ft.RemoteSchema,
+		ft.RemoteTable,
+		strings.Join(columns, ","),
+		ft.Options,
+	)
+}
@@ -0,0 +1,101 @@
+package model
+
+import "fmt"
+
+const (
+	// OperationCreate represents an action that creates an object
+	OperationCreate = "create"
+	// OperationDrop represents an action that drops an object
+	OperationDrop = "drop"
+	// OperationUpdate represents an action that alters an existing object
+	OperationUpdate = "update"
+	// OperationImport represents an action that imports a foreign schema
+	OperationImport = "import"
+	// OperationGrant represents an action that grants privileges on an object
+	OperationGrant = "grant"
+	// OperationRevoke represents an action that revokes privileges on an object
+	OperationRevoke = "revoke"
+
+	// ObjectExtension is the object type of a Postgres extension
+	ObjectExtension = "extension"
+	// ObjectServer is the object type of a foreign server
+	ObjectServer = "server"
+	// ObjectUserMap is the object type of a user mapping
+	ObjectUserMap = "usermap"
+	// ObjectUser is the object type of a local database user
+	ObjectUser = "user"
+	// ObjectSchema is the object type of a local schema
+	ObjectSchema = "schema"
+	// ObjectEnum is the object type of an ENUM type
+	ObjectEnum = "enum"
+	// ObjectDomain is the object type of a domain
+	ObjectDomain = "domain"
+	// ObjectComposite is the object type of a composite type
+	ObjectComposite = "composite"
+	// ObjectRange is the object type of a range type
+	ObjectRange = "range"
+	// ObjectForeignTable is the object type of a foreign table
+	ObjectForeignTable = "foreigntable"
+)
+
+// PlanAction represents a single change to be made to the FDW database
+type PlanAction struct {
+	// Operation is the kind of change this action makes (create, drop, update, ...)
+	Operation string `yaml:"operation" json:"operation"`
+	// ObjectType is the type of database object this action changes
+	ObjectType string `yaml:"objectType" json:"objectType"`
+	// ObjectName is the name of the database object this action changes
+	ObjectName string `yaml:"objectName" json:"objectName"`
+	// ServerName is the name of the foreign server the object belongs to, if any
+	ServerName string `yaml:"serverName,omitempty" json:"serverName,omitempty"`
+	// SQL is the statement this action executes with any credentials redacted
+	SQL string `yaml:"sql" json:"sql"`
+	// Statement is the statement this action executes verbatim; it is never serialized
+	Statement string `yaml:"-" json:"-"`
+	// Step is the 1-based position of this action in its plan
+	Step int `yaml:"step" json:"step"`
+	// NonTransactional indicates that the statement cannot run inside a transaction block on PostgreSQL versions
+	// before 12
+	NonTransactional bool `yaml:"nonTransactional,omitempty" json:"nonTransactional,omitempty"`
+	// RedactedOption is the name of the user mapping option whose value is redacted in SQL; the credential must be
+	// resolved from the desired state before the action can be executed
+	RedactedOption string `yaml:"redactedOption,omitempty" json:"redactedOption,omitempty"`
+	// RedactedPosition is the byte offset in SQL of the quoted, redacted value of RedactedOption
+	RedactedPosition int `yaml:"redactedPosition,omitempty" json:"redactedPosition,omitempty"`
+}
+
+func (pa *PlanAction) String() string {
+	if pa.ServerName != "" {
+		return fmt.Sprintf("%s %s %s (server %s)", pa.Operation, pa.ObjectType, pa.ObjectName, pa.ServerName)
+	}
+	return fmt.Sprintf("%s %s %s", pa.Operation, pa.ObjectType, pa.ObjectName)
+}
+
+// Plan is the ordered list of actions that bring the FDW database in line with a desired state
+type Plan struct {
+	// Fingerprint identifies the state of the database catalog that the plan was computed against
+	Fingerprint string `yaml:"fingerprint,omitempty" json:"fingerprint,omitempty"`
+	// Actions is the list of actions in the order they are to be executed
+	Actions []PlanAction `yaml:"actions" json:"actions"`
+}
+
+// NewPlan returns a new, empty Plan
+func NewPlan() *Plan {
+	return &Plan{
+		Actions: make([]PlanAction, 0),
+	}
+}
+
+// Add appends an action to the end of the plan and assigns its step number
+func (p *Plan) Add(action PlanAction) {
+	action.Step = len(p.Actions) + 1
+	if action.SQL == "" {
+		action.SQL = action.Statement
+	}
+	p.Actions = append(p.Actions, action)
+}
+
+// IsEmpty determines if the plan contains no actions
+func (p *Plan) IsEmpty() bool {
+	return len(p.Actions) == 0
+}
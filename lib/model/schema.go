@@ -5,14 +5,51 @@ import (
 	"strings"
 )
 
-// Grants represents a permission configuration for an imported remote schema
+const (
+	// RefreshPolicyNone leaves an existing foreign schema alone; it is the default refresh policy
+	RefreshPolicyNone = "none"
+	// RefreshPolicyIncremental imports new remote tables, drops vanished ones, and re-creates tables whose columns
+	// changed each time the desired state is applied
+	RefreshPolicyIncremental = "incremental"
+	// RefreshPolicyRecreate drops and re-imports the whole schema each time the desired state is applied
+	RefreshPolicyRecreate = "recreate"
+)
+
+// Grants represents a permission configuration for an imported remote schema or a foreign server
 type Grants struct {
-	// Users is the list of users to apply the permissions to
-	Users []string `yaml:"users" json:"users"`
+	// Users is the list of users that are granted usage on the object; on a schema they are also granted SELECT on
+	// every table
+	Users []string `yaml:"users,omitempty" json:"users,omitempty"`
+	// Roles are the table privileges granted to roles on a schema; they are not used by foreign servers
+	Roles []RoleGrant `yaml:"roles,omitempty" json:"roles,omitempty"`
 }
 
 func (g Grants) String() string {
-	return fmt.Sprintf("users: {%s}", strings.Join(g.Users, ","))
+	roles := make([]string, len(g.Roles))
+	for idx, roleGrant := range g.Roles {
+		roles[idx] = roleGrant.String()
+	}
+	return fmt.Sprintf("users: {%s}, roles: {%s}", strings.Join(g.Users, ","), strings.Join(roles, ","))
+}
+
+// RoleGrant represents the privileges granted to a role on the tables of an imported schema. The role is also
+// granted usage on the schema.
+type RoleGrant struct {
+	// Role is the name of the role that is granted the privileges, or PUBLIC
+	Role string `yaml:"role" json:"role"`
+	// Privileges are the table privileges granted to the role: SELECT, INSERT, UPDATE, DELETE, TRUNCATE, REFERENCES,
+	// or ALL
+	Privileges []string `yaml:"privileges" json:"privileges"`
+	// Tables limits the privileges to the named tables. When it is empty the privileges apply to every table of the
+	// schema, including tables that are imported later.
+	Tables []string `yaml:"tables,omitempty" json:"tables,omitempty"`
+}
+
+func (rg RoleGrant) String() string {
+	if len(rg.Tables) == 0 {
+		return fmt.Sprintf("%s: %s", rg.Role, strings.Join(rg.Privileges, " "))
+	}
+	return fmt.Sprintf("%s: %s on %s", rg.Role, strings.Join(rg.Privileges, " "), strings.Join(rg.Tables, " "))
 }
 
 // Schema represents a foreign schema configuration
@@ -22,13 +59,47 @@ type Schema struct {
 	LocalSchema    string `yaml:"localschema" json:"localschema"`
 	RemoteSchema   string `yaml:"remoteschema" json:"remoteschema"`
 	ENUMConnection string `yaml:"enumconnection,omitempty" json:"enumconnection,omitempty"`
-	SchemaGrants   Grants `yaml:"grants,omitempty" json:"grants,omitempty"`
-	ImportENUMs    bool   `yaml:"importenums" json:"importenums"`
+	// LimitTo restricts the import to the named remote tables. Entries may be glob patterns (e.g. `order_*`) or
+	// regular expressions enclosed in slashes (e.g. `/^order_[0-9]+$/`), which are expanded against the remote
+	// catalog through the enum connection.
+	LimitTo []string `yaml:"limitTo,omitempty" json:"limitTo,omitempty"`
+	// Except excludes the named remote tables from the import; entries may be patterns as in LimitTo
+	Except []string `yaml:"except,omitempty" json:"except,omitempty"`
+	// ImportOptions are the options of the OPTIONS clause of IMPORT FOREIGN SCHEMA, e.g. import_default for
+	// postgres_fdw. Changing them re-imports the schema.
+	ImportOptions map[string]string `yaml:"importoptions,omitempty" json:"importoptions,omitempty"`
+	// RefreshPolicy determines how an existing foreign schema is brought up to date with the remote schema: none,
+	// incremental, or recreate
+	RefreshPolicy string `yaml:"refreshPolicy,omitempty" json:"refreshPolicy,omitempty"`
+	// SchemaGrants are the privileges granted on the local schema and its tables; the privileges of the schema are
+	// not managed when it is nil
+	SchemaGrants *Grants `yaml:"grants,omitempty" json:"grants,omitempty"`
+	ImportENUMs  bool    `yaml:"importenums" json:"importenums"`
+	// TypeSchema is the local schema that the imported user-defined types are created in. The types are created in
+	// local schemas named after their remote schemas when it is empty.
+	TypeSchema string `yaml:"typeSchema,omitempty" json:"typeSchema,omitempty"`
+	// Managed indicates that the local schema is marked as managed by fdwctl
+	Managed bool `yaml:"-" json:"-"`
+	// Comment is the part of the comment of the local schema that fdwctl did not write
+	Comment string `yaml:"-" json:"-"`
+}
+
+// RefreshPolicyName returns the refresh policy of this schema, which is RefreshPolicyNone if none is specified
+func (s Schema) RefreshPolicyName() string {
+	if s.RefreshPolicy == "" {
+		return RefreshPolicyNone
+	}
+	return s.RefreshPolicy
+}
+
+// ImportOptionsEqual determines if this schema is imported with the same options as the supplied schema
+func (s Schema) ImportOptionsEqual(schema Schema) bool {
+	return optionsEqual(s.ImportOptions, schema.ImportOptions)
 }
 
 func (s Schema) String() string {
 	return fmt.Sprintf(
-		"name: %s, localschema: %s, remoteschema: %s, importenumps: %t, enumconnection: %s, enumsecret: %s, grants: %s",
+		"name: %s, localschema: %s, remoteschema: %s, importenumps: %t, enumconnection: %s, enumsecret: %s, grants: %s, limitTo: {%s}, except: {%s}, importoptions: %v, refreshPolicy: %s, typeSchema: %s",
 		s.ServerName,
 		s.LocalSchema,
 		s.RemoteSchema,
@@ -36,14 +107,60 @@ func (s Schema) String() string {
 		s.ENUMConnection,
 		s.ENUMSecret,
 		s.SchemaGrants,
+		strings.Join(s.LimitTo, ","),
+		strings.Join(s.Except, ","),
+		s.ImportOptions,
+		s.RefreshPolicy,
+		s.TypeSchema,
 	)
 }
 
+// SchemaEnum represents an ENUM type and, optionally, its values in sort order
 type SchemaEnum struct {
 	Schema string
 	Name   string
+	Values []string
 }
 
 func (se *SchemaEnum) String() string {
 	return fmt.Sprintf("%s.%s", se.Schema, se.Name)
 }
+
+// SchemaType represents a user-defined type (ENUM, domain, composite, or range type) used by the tables of a schema
+// and enough of its definition to re-create it
+type SchemaType struct {
+	Schema string
+	Name   string
+	// Kind is the object type of the type: ObjectEnum, ObjectDomain, ObjectComposite, or ObjectRange
+	Kind string
+	// Values are the values of an ENUM type in sort order
+	Values []string
+	// BaseType is the underlying type of a domain or the subtype of a range type
+	BaseType string
+	// Default is the default expression of a domain
+	Default string
+	// NotNull is true when a domain does not allow NULL values
+	NotNull bool
+	// Constraints are the named CHECK constraints of a domain
+	Constraints []string
+	// Attributes are the attributes of a composite type in order
+	Attributes []Column
+	// SubtypeOpClass is the non-default operator class of the subtype of a range type
+	SubtypeOpClass string
+	// Collation is the non-default collation of a range type
+	Collation string
+	// Canonical is the canonical function of a range type
+	Canonical string
+	// SubtypeDiff is the subtype difference function of a range type
+	SubtypeDiff string
+	// DependsOn are the schema-qualified names of the user-defined types this type refers to
+	DependsOn []string
+	// ImportedFor are the local foreign schemas that fdwctl created a local type for
+	ImportedFor []string
+	// Comment is the part of the comment of a local type that fdwctl did not write
+	Comment string
+}
+
+func (st *SchemaType) String() string {
+	return fmt.Sprintf("%s.%s", st.Schema, st.Name)
+}
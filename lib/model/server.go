@@ -5,22 +5,60 @@ import (
 	"strings"
 )
 
+const (
+	// DefaultWrapper is the foreign data wrapper used by a foreign server that does not specify one
+	DefaultWrapper = "postgres_fdw"
+)
+
 // ForeignServer represents a Postgres foreign server including related user mappings and remote schemas
 type ForeignServer struct {
-	Name     string    `yaml:"name" json:"name"`
-	Host     string    `yaml:"host" json:"host"`
-	DB       string    `yaml:"db" json:"db"`
-	Wrapper  string    `yaml:"wrapper,omitempty" json:"wrapper,omitempty"`
-	Owner    string    `yaml:"-" json:"-"`
-	UserMaps []UserMap `yaml:"UserMap,omitempty" json:"UserMap,omitempty"`
-	Schemas  []Schema  `yaml:"Schemas,omitempty" json:"Schemas,omitempty"`
-	Port     int       `yaml:"port" json:"port"`
+	// Options are the server options other than host, port, and dbname
+	Options map[string]string `yaml:"options,omitempty" json:"options,omitempty"`
+	Name    string            `yaml:"name" json:"name"`
+	Host    string            `yaml:"host" json:"host"`
+	DB      string            `yaml:"db" json:"db"`
+	Wrapper string            `yaml:"wrapper,omitempty" json:"wrapper,omitempty"`
+	Owner   string            `yaml:"-" json:"-"`
+	// Managed indicates that the server is marked as managed by fdwctl
+	Managed bool `yaml:"-" json:"-"`
+	// Comment is the part of the comment of the server that fdwctl did not write
+	Comment string `yaml:"-" json:"-"`
+	// ServerGrants are the users that are granted USAGE on the server; the privileges of the server are not managed
+	// when it is nil
+	ServerGrants *Grants   `yaml:"grants,omitempty" json:"grants,omitempty"`
+	UserMaps     []UserMap `yaml:"UserMap,omitempty" json:"UserMap,omitempty"`
+	Schemas      []Schema  `yaml:"Schemas,omitempty" json:"Schemas,omitempty"`
+	// ForeignTables are the foreign tables of the server that are defined column by column rather than imported
+	ForeignTables []ForeignTable `yaml:"ForeignTables,omitempty" json:"ForeignTables,omitempty"`
+	Port          int            `yaml:"port" json:"port"`
 }
 
 // Equals determines if this object is equal to the supplied object
 func (fs *ForeignServer) Equals(fserver ForeignServer) bool {
 	return fs.Name == fserver.Name && fs.Host == fserver.Host && fs.Port == fserver.Port &&
-		fs.DB == fserver.DB && fs.Wrapper == fserver.Wrapper
+		fs.DB == fserver.DB && fs.WrapperName() == fserver.WrapperName() && optionsEqual(fs.Options, fserver.Options)
+}
+
+// optionsEqual determines if two option maps contain the same options; a nil map is equal to an empty map
+func optionsEqual(options map[string]string, otherOptions map[string]string) bool {
+	if len(options) != len(otherOptions) {
+		return false
+	}
+	for optionName, optionValue := range options {
+		otherValue, ok := otherOptions[optionName]
+		if !ok || otherValue != optionValue {
+			return false
+		}
+	}
+	return true
+}
+
+// WrapperName returns the name of the foreign data wrapper of this server, which is DefaultWrapper if none is specified
+func (fs *ForeignServer) WrapperName() string {
+	if fs.Wrapper == "" {
+		return DefaultWrapper
+	}
+	return fs.Wrapper
 }
 
 func (fs *ForeignServer) String() string {
@@ -1,6 +1,20 @@
 package model
 
-import "fmt"
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	// LocalUserPublic is the local user keyword of a user mapping that applies to every local user
+	LocalUserPublic = "PUBLIC"
+	// LocalUserCurrentUser is the local user keyword of a user mapping for the user executing the statement
+	LocalUserCurrentUser = "CURRENT_USER"
+	// LocalUserSessionUser is the local user keyword of a user mapping for the session user
+	LocalUserSessionUser = "SESSION_USER"
+	// LocalUserUser is the local user keyword equivalent to CURRENT_USER
+	LocalUserUser = "USER"
+)
 
 // UserMap represents a Postgres user mapping
 type UserMap struct {
@@ -8,15 +22,30 @@ type UserMap struct {
 	ServerName string `yaml:"-" json:"-"`
 	// LocalUser is the name of the local database user to map
 	LocalUser string `yaml:"localuser" json:"localuser"`
+	// LocalUserKeyword is the keyword, such as CURRENT_USER, that LocalUser was resolved from
+	LocalUserKeyword string `yaml:"-" json:"-"`
 	// RemoteUser is the name of the remote database user to connect as
 	RemoteUser string `yaml:"remoteuser" json:"remoteuser"`
 	// RemoteSecret configures how to retrieve the optional credential for the RemoteUser user
-	RemoteSecret Secret `yaml:"remotesecret" json:"remotesecret"`
+	RemoteSecret Secret `yaml:"remotesecret,omitempty" json:"remotesecret,omitempty"`
+	// Options are the user mapping options other than user and password (e.g. sslcert, password_required)
+	Options map[string]string `yaml:"options,omitempty" json:"options,omitempty"`
+}
+
+// IsSpecialLocalUser determines if the supplied local user name is one of the keywords PUBLIC, CURRENT_USER,
+// SESSION_USER, or USER rather than the name of a role. Keywords are matched case-insensitively.
+func IsSpecialLocalUser(localUser string) bool {
+	switch strings.ToUpper(localUser) {
+	case LocalUserPublic, LocalUserCurrentUser, LocalUserSessionUser, LocalUserUser:
+		return true
+	}
+	return false
 }
 
 // Equals determines if this object is equal to the supplied object
 func (um *UserMap) Equals(umap UserMap) bool {
-	return um.LocalUser == umap.LocalUser && um.RemoteUser == umap.RemoteUser && um.RemoteSecret.Value == umap.RemoteSecret.Value
+	return um.LocalUser == umap.LocalUser && um.RemoteUser == umap.RemoteUser && um.RemoteSecret.Value == umap.RemoteSecret.Value &&
+		optionsEqual(um.Options, umap.Options)
 }
 
 func (um *UserMap) String() string {
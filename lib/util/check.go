@@ -0,0 +1,117 @@
+package util
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/neflyte/fdwctl/lib/database"
+	"github.com/neflyte/fdwctl/lib/logger"
+	"github.com/neflyte/fdwctl/lib/model"
+)
+
+// CheckSchema compares the columns of each foreign table of an imported foreign schema with the columns of its remote
+// table and returns the differences. The desired values of a difference are those of the remote table and the actual
+// values are those of the foreign table. The ENUM connection settings of the supplied schema are used to connect to
+// the remote database when they are set.
+func CheckSchema(ctx context.Context, dbConnection database.Executor, schema model.Schema) ([]model.Drift, error) {
+	log := logger.Log(ctx).
+		WithField("function", "CheckSchema")
+	dbSchema, server, err := getImportedSchema(ctx, dbConnection, schema)
+	if err != nil {
+		return nil, err
+	}
+	remoteTables, remoteColumns, err := getRemoteSchemaCatalog(ctx, dbConnection, server, dbSchema)
+	if err != nil {
+		return nil, err
+	}
+	localTables, err := getImportedTables(ctx, dbConnection, dbSchema.LocalSchema, server.Name)
+	if err != nil {
+		log.Errorf("error getting foreign tables: %s", err)
+		return nil, err
+	}
+	localColumns, err := getSchemaColumns(ctx, dbConnection, dbSchema.LocalSchema)
+	if err != nil {
+		log.Errorf("error getting local columns: %s", err)
+		return nil, err
+	}
+	drifts := make([]model.Drift, 0)
+	for _, table := range localTables {
+		tableName := fmt.Sprintf("%s.%s", dbSchema.LocalSchema, table)
+		if !containsString(remoteTables, table) {
+			drifts = append(drifts, model.Drift{ObjectType: model.ObjectForeignTable, ObjectName: tableName, ServerName: server.Name, Kind: model.DriftUnexpected})
+			continue
+		}
+		for _, drift := range diffTableColumns(localColumns[table], remoteColumns[table], importsNotNull(dbSchema)) {
+			drift.ObjectName = tableName
+			drift.ServerName = server.Name
+			drifts = append(drifts, drift)
+		}
+	}
+	return drifts, nil
+}
+
+// diffTableColumns returns the differences between the columns of a foreign table and those of its remote table:
+// columns added to or removed from the remote table, columns whose type or NOT NULL constraint changed, and columns
+// that moved relative to the others. NOT NULL constraints are only compared when compareNotNull is true.
+func diffTableColumns(localColumns []model.Column, remoteColumns []model.Column, compareNotNull bool) []model.Drift {
+	drifts := make([]model.Drift, 0)
+	localByName := make(map[string]model.Column)
+	for _, column := range localColumns {
+		localByName[column.Name] = column
+	}
+	remoteByName := make(map[string]model.Column)
+	for _, column := range remoteColumns {
+		remoteByName[column.Name] = column
+	}
+	remoteOrder := make([]string, 0)
+	for _, remoteColumn := range remoteColumns {
+		localColumn, ok := localByName[remoteColumn.Name]
+		if !ok {
+			drifts = append(drifts, model.Drift{ObjectType: model.ObjectForeignTable, Kind: model.DriftMissing, Attribute: "column", Desired: remoteColumn.String()})
+			continue
+		}
+		remoteOrder = append(remoteOrder, remoteColumn.Name)
+		if localColumn.Type != remoteColumn.Type {
+			drifts = append(drifts, model.Drift{
+				ObjectType: model.ObjectForeignTable,
+				Kind:       model.DriftChanged,
+				Attribute:  fmt.Sprintf("column.%s.type", remoteColumn.Name),
+				Desired:    remoteColumn.Type,
+				Actual:     localColumn.Type,
+			})
+		}
+		if compareNotNull && localColumn.NotNull != remoteColumn.NotNull {
+			drifts = append(drifts, model.Drift{
+				ObjectType: model.ObjectForeignTable,
+				Kind:       model.DriftChanged,
+				Attribute:  fmt.Sprintf("column.%s.notnull", remoteColumn.Name),
+				Desired:    strconv.FormatBool(remoteColumn.NotNull),
+				Actual:     strconv.FormatBool(localColumn.NotNull),
+			})
+		}
+	}
+	localOrder := make([]string, 0)
+	localPositions := make(map[string]int)
+	for _, localColumn := range localColumns {
+		if _, ok := remoteByName[localColumn.Name]; !ok {
+			drifts = append(drifts, model.Drift{ObjectType: model.ObjectForeignTable, Kind: model.DriftUnexpected, Attribute: "column", Actual: localColumn.String()})
+			continue
+		}
+		localOrder = append(localOrder, localColumn.Name)
+		localPositions[localColumn.Name] = len(localOrder)
+	}
+	// Columns that were added or removed shift the others, so positions are counted among the columns both tables share
+	for idx, columnName := range remoteOrder {
+		if localOrder[idx] != columnName {
+			drifts = append(drifts, model.Drift{
+				ObjectType: model.ObjectForeignTable,
+				Kind:       model.DriftChanged,
+				Attribute:  fmt.Sprintf("column.%s.position", columnName),
+				Desired:    strconv.Itoa(idx + 1),
+				Actual:     strconv.Itoa(localPositions[columnName]),
+			})
+		}
+	}
+	return drifts
+}
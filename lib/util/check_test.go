@@ -0,0 +1,34 @@
+package util
+
+import (
+	"testing"
+
+	"github.com/neflyte/fdwctl/lib/model"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUnit_diffTableColumns(t *testing.T) {
+	remoteColumns := []model.Column{
+		{Name: "id", Type: "integer", NotNull: true},
+		{Name: "total", Type: "numeric(12,2)", NotNull: true},
+		{Name: "status", Type: "status"},
+		{Name: "created_at", Type: "timestamp with time zone"},
+	}
+	require.Empty(t, diffTableColumns(remoteColumns, remoteColumns, true))
+	localColumns := []model.Column{
+		{Name: "id", Type: "integer", NotNull: true},
+		{Name: "status", Type: "status"},
+		{Name: "total", Type: "numeric(10,2)"},
+		{Name: "note", Type: "text"},
+	}
+	require.Equal(t, []model.Drift{
+		{ObjectType: model.ObjectForeignTable, Kind: model.DriftChanged, Attribute: "column.total.type", Desired: "numeric(12,2)", Actual: "numeric(10,2)"},
+		{ObjectType: model.ObjectForeignTable, Kind: model.DriftChanged, Attribute: "column.total.notnull", Desired: "true", Actual: "false"},
+		{ObjectType: model.ObjectForeignTable, Kind: model.DriftMissing, Attribute: "column", Desired: "created_at timestamp with time zone"},
+		{ObjectType: model.ObjectForeignTable, Kind: model.DriftUnexpected, Attribute: "column", Actual: "note text"},
+		{ObjectType: model.ObjectForeignTable, Kind: model.DriftChanged, Attribute: "column.total.position", Desired: "2", Actual: "3"},
+		{ObjectType: model.ObjectForeignTable, Kind: model.DriftChanged, Attribute: "column.status.position", Desired: "3", Actual: "2"},
+	}, diffTableColumns(localColumns, remoteColumns, true))
+	nullable := []model.Column{{Name: "id", Type: "integer"}}
+	require.Empty(t, diffTableColumns(nullable, remoteColumns[:1], false))
+}
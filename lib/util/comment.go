@@ -0,0 +1,129 @@
+package util
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/neflyte/fdwctl/lib/model"
+)
+
+const (
+	sqlCommentOnSchema       = `COMMENT ON SCHEMA %s IS %s`
+	sqlCommentOnForeignTable = `COMMENT ON FOREIGN TABLE %s IS %s`
+	sqlCommentOnType         = `COMMENT ON TYPE %s IS %s`
+	sqlCommentOnServer       = `COMMENT ON SERVER %s IS %s`
+	sqlCommentOnDomain       = `COMMENT ON DOMAIN %s IS %s`
+	sqlCommentOnRole         = `COMMENT ON ROLE %s IS %s`
+
+	// metadataCommentPrefix starts the line of the comment of a database object that holds the metadata fdwctl records
+	// about it
+	metadataCommentPrefix = "fdwctl:"
+	// metadataCommentSeparator separates the text of a comment that fdwctl did not write from the metadata that follows it
+	metadataCommentSeparator = "\n"
+)
+
+// objectMetadata is the information fdwctl records in the comment of a database object because it cannot be read
+// back from the catalog
+type objectMetadata struct {
+	// ImportOptions are the options a foreign schema was imported with
+	ImportOptions map[string]string `json:"importOptions,omitempty"`
+	// LimitTo is the LIMIT TO table filter a foreign schema was imported with, before patterns were expanded
+	LimitTo []string `json:"limitTo,omitempty"`
+	// Except is the EXCEPT table filter a foreign schema was imported with, before patterns were expanded
+	Except []string `json:"except,omitempty"`
+	// Declared indicates that a foreign table was created from its definition in the desired state rather than
+	// imported with a foreign schema
+	Declared bool `json:"declared,omitempty"`
+	// ImportedFor are the local foreign schemas that a user-defined type was created for
+	ImportedFor []string `json:"importedFor,omitempty"`
+	// TypeSchema indicates that a local schema was created to hold imported user-defined types
+	TypeSchema bool `json:"typeSchema,omitempty"`
+	// TypeSchemaName is the local schema that the user-defined types of a foreign schema were imported into
+	TypeSchemaName string `json:"typeSchemaName,omitempty"`
+	// Managed indicates that a foreign server or schema was created by fdwctl or adopted from the desired state, so
+	// that it may be dropped when it is no longer in the desired state
+	Managed bool `json:"managed,omitempty"`
+}
+
+// isEmpty determines if the metadata records nothing
+func (om objectMetadata) isEmpty() bool {
+	return len(om.ImportOptions) == 0 && len(om.LimitTo) == 0 && len(om.Except) == 0 && !om.Declared &&
+		len(om.ImportedFor) == 0 && !om.TypeSchema && om.TypeSchemaName == "" && !om.Managed
+}
+
+// metadataComment returns the comment that records the supplied metadata after the supplied text, which is the part of
+// an existing comment that fdwctl did not write
+func metadataComment(text string, metadata objectMetadata) string {
+	// Marshalling a struct of string slices and maps cannot fail
+	metadataJSON, _ := json.Marshal(metadata)
+	if text == "" {
+		return fmt.Sprintf("%s%s", metadataCommentPrefix, metadataJSON)
+	}
+	return fmt.Sprintf("%s%s%s%s", text, metadataCommentSeparator, metadataCommentPrefix, metadataJSON)
+}
+
+// parseMetadataComment returns the metadata recorded in the supplied comment. Comments that were not written by
+// fdwctl, or which cannot be parsed, yield empty metadata.
+func parseMetadataComment(comment string) objectMetadata {
+	_, metadata := splitMetadataComment(comment)
+	return metadata
+}
+
+// splitMetadataComment separates the supplied comment into the text that fdwctl did not write and the metadata that
+// fdwctl recorded on its last line. A comment without metadata, or whose metadata cannot be parsed, is returned as
+// text with empty metadata.
+func splitMetadataComment(comment string) (string, objectMetadata) {
+	start := 0
+	if !strings.HasPrefix(comment, metadataCommentPrefix) {
+		start = strings.LastIndex(comment, metadataCommentSeparator+metadataCommentPrefix)
+		if start < 0 {
+			return comment, objectMetadata{}
+		}
+		start += len(metadataCommentSeparator)
+	}
+	metadata := objectMetadata{}
+	err := json.Unmarshal([]byte(comment[start+len(metadataCommentPrefix):]), &metadata)
+	if err != nil {
+		return comment, objectMetadata{}
+	}
+	return strings.TrimSuffix(comment[:start], metadataCommentSeparator), metadata
+}
+
+// commentOnSchemaSQL returns the statement that records the supplied metadata in the comment of a local schema after
+// the text that fdwctl did not write. Only the text is kept when the metadata is empty.
+func commentOnSchemaSQL(schemaName string, text string, metadata objectMetadata) string {
+	if metadata.isEmpty() {
+		if text == "" {
+			return fmt.Sprintf(sqlCommentOnSchema, QuoteIdentifier(schemaName), "NULL")
+		}
+		return fmt.Sprintf(sqlCommentOnSchema, QuoteIdentifier(schemaName), QuoteLiteral(text))
+	}
+	return fmt.Sprintf(sqlCommentOnSchema, QuoteIdentifier(schemaName), QuoteLiteral(metadataComment(text, metadata)))
+}
+
+// commentOnForeignTableSQL returns the statement that records the supplied metadata in the comment of a foreign table
+func commentOnForeignTableSQL(schemaName string, tableName string, metadata objectMetadata) string {
+	return fmt.Sprintf(sqlCommentOnForeignTable, QuoteQualifiedIdentifier(schemaName, tableName), QuoteLiteral(metadataComment("", metadata)))
+}
+
+// commentOnServerSQL returns the statement that records the supplied metadata in the comment of a foreign server after
+// the text that fdwctl did not write
+func commentOnServerSQL(serverName string, text string, metadata objectMetadata) string {
+	return fmt.Sprintf(sqlCommentOnServer, QuoteIdentifier(serverName), QuoteLiteral(metadataComment(text, metadata)))
+}
+
+// commentOnRoleSQL returns the statement that records the supplied metadata in the comment of a local role
+func commentOnRoleSQL(roleName string, metadata objectMetadata) string {
+	return fmt.Sprintf(sqlCommentOnRole, QuoteIdentifier(roleName), QuoteLiteral(metadataComment("", metadata)))
+}
+
+// commentOnTypeSQL returns the statement that records the supplied metadata in the comment of a user-defined type
+// after the text that fdwctl did not write
+func commentOnTypeSQL(schemaType *model.SchemaType, text string, metadata objectMetadata) string {
+	query := sqlCommentOnType
+	if schemaType.Kind == model.ObjectDomain {
+		query = sqlCommentOnDomain
+	}
+	return fmt.Sprintf(query, QuoteQualifiedIdentifier(schemaType.Schema, schemaType.Name), QuoteLiteral(metadataComment(text, metadata)))
+}
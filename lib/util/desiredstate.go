@@ -0,0 +1,194 @@
+package util
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/neflyte/fdwctl/lib/database"
+	"github.com/neflyte/fdwctl/lib/logger"
+	"github.com/neflyte/fdwctl/lib/model"
+)
+
+// GetCurrentState reads the extensions, foreign servers, user mappings, foreign schemas, and declared foreign tables
+// from the database and returns them in the form of a DesiredState
+func GetCurrentState(ctx context.Context, dbConnection database.Executor) (model.DesiredState, error) {
+	currentState, _, err := getCurrentState(ctx, dbConnection)
+	return currentState, err
+}
+
+// getCurrentState returns the current state of the database along with the tables of each local foreign schema and
+// the privileges on it as they are in the catalog, keyed by schema name. The grants of the current state only hold
+// the effect of the privileges.
+func getCurrentState(ctx context.Context, dbConnection database.Executor) (model.DesiredState, map[string][]string, error) {
+	log := logger.Log(ctx).
+		WithField("function", "getCurrentState")
+	currentState := model.DesiredState{}
+	privileges := make(map[string][]string)
+	exts, err := GetExtensions(ctx, dbConnection)
+	if err != nil {
+		log.Errorf("error getting extensions: %s", err)
+		return currentState, nil, err
+	}
+	servers, err := GetServers(ctx, dbConnection)
+	if err != nil {
+		log.Errorf("error getting foreign servers: %s", err)
+		return currentState, nil, err
+	}
+	for idx := range servers {
+		servers[idx].UserMaps, err = GetUserMapsForServer(ctx, dbConnection, servers[idx].Name)
+		if err != nil {
+			log.Errorf("error getting usermaps for server %s: %s", servers[idx].Name, err)
+			return currentState, nil, err
+		}
+		serverGrants, err := GetServerGrants(ctx, dbConnection, servers[idx].Name)
+		if err != nil {
+			log.Errorf("error getting grants for server %s: %s", servers[idx].Name, err)
+			return currentState, nil, err
+		}
+		servers[idx].ServerGrants = &serverGrants
+		servers[idx].Schemas, err = GetSchemasForServer(ctx, dbConnection, servers[idx].Name)
+		if err != nil {
+			log.Errorf("error getting schemas for server %s: %s", servers[idx].Name, err)
+			return currentState, nil, err
+		}
+		for schemaIdx := range servers[idx].Schemas {
+			schemaName := servers[idx].Schemas[schemaIdx].LocalSchema
+			current, tables, err := getSchemaPrivileges(ctx, dbConnection, schemaName)
+			if err != nil {
+				log.Errorf("error getting grants for schema %s: %s", schemaName, err)
+				return currentState, nil, err
+			}
+			schemaGrants := canonicalGrants(current.grantSet(tables))
+			servers[idx].Schemas[schemaIdx].SchemaGrants = &schemaGrants
+			privileges[schemaName] = current.entries(tables)
+		}
+		servers[idx].ForeignTables, err = GetForeignTables(ctx, dbConnection, servers[idx].Name)
+		if err != nil {
+			log.Errorf("error getting foreign tables for server %s: %s", servers[idx].Name, err)
+			return currentState, nil, err
+		}
+	}
+	currentState.Extensions = exts
+	currentState.Servers = servers
+	return currentState, privileges, nil
+}
+
+// sortedState returns a copy of the supplied state with extensions, servers, user mappings, schemas, and foreign tables
+// sorted by name
+func sortedState(state model.DesiredState) model.DesiredState {
+	sorted := model.DesiredState{
+		Extensions: make([]model.Extension, len(state.Extensions)),
+		Servers:    make([]model.ForeignServer, len(state.Servers)),
+	}
+	copy(sorted.Extensions, state.Extensions)
+	sort.Slice(sorted.Extensions, func(i, j int) bool {
+		return sorted.Extensions[i].Name < sorted.Extensions[j].Name
+	})
+	for idx, server := range state.Servers {
+		server.UserMaps = append(make([]model.UserMap, 0, len(server.UserMaps)), server.UserMaps...)
+		sort.Slice(server.UserMaps, func(i, j int) bool {
+			return server.UserMaps[i].LocalUser < server.UserMaps[j].LocalUser
+		})
+		server.Schemas = append(make([]model.Schema, 0, len(server.Schemas)), server.Schemas...)
+		sort.Slice(server.Schemas, func(i, j int) bool {
+			return server.Schemas[i].LocalSchema < server.Schemas[j].LocalSchema
+		})
+		server.ForeignTables = append(make([]model.ForeignTable, 0, len(server.ForeignTables)), server.ForeignTables...)
+		sort.Slice(server.ForeignTables, func(i, j int) bool {
+			return server.ForeignTables[i].QualifiedName() < server.ForeignTables[j].QualifiedName()
+		})
+		sorted.Servers[idx] = server
+	}
+	sort.Slice(sorted.Servers, func(i, j int) bool {
+		return sorted.Servers[i].Name < sorted.Servers[j].Name
+	})
+	return sorted
+}
+
+// catalogSnapshot is the part of the database catalog that a plan is computed against: the current state along with
+// everything else the planner reads from the local database
+type catalogSnapshot struct {
+	State model.DesiredState `json:"state"`
+	// Comments are the comments of the foreign servers and schemas, which record whether fdwctl manages them, keyed by
+	// object type and name
+	Comments map[string]string `json:"comments"`
+	// Privileges are the tables of each local foreign schema and the privileges on the schema, its tables, and the
+	// tables created in it later, keyed by schema name
+	Privileges map[string][]string `json:"privileges"`
+	// Types are the user-defined types with the labels of ENUM types and the comment fdwctl marks imported types with
+	Types []*model.SchemaType `json:"types"`
+	// TypeSchemas are the local schemas fdwctl created for imported types with the number of other objects in them
+	TypeSchemas map[string]int `json:"typeSchemas"`
+	// TypeUsages are the tables that use user-defined types
+	TypeUsages []string `json:"typeUsages"`
+	// ManagedRoles are the local roles fdwctl created
+	ManagedRoles []string `json:"managedRoles"`
+}
+
+// getCatalogSnapshot returns the current state of the database along with a snapshot of the catalog the current state
+// is part of
+func getCatalogSnapshot(ctx context.Context, dbConnection database.Executor) (model.DesiredState, *catalogSnapshot, error) {
+	log := logger.Log(ctx).
+		WithField("function", "getCatalogSnapshot")
+	currentState, privileges, err := getCurrentState(ctx, dbConnection)
+	if err != nil {
+		log.Errorf("error getting current state: %s", err)
+		return currentState, nil, err
+	}
+	snapshot := &catalogSnapshot{
+		State:      currentState,
+		Comments:   make(map[string]string),
+		Privileges: privileges,
+		TypeUsages: make([]string, 0),
+	}
+	// The mark and comment of an object are not part of the state
+	for _, server := range currentState.Servers {
+		snapshot.Comments[fmt.Sprintf("%s %s", model.ObjectServer, server.Name)] = metadataComment(server.Comment, objectMetadata{Managed: server.Managed})
+		for _, schema := range server.Schemas {
+			snapshot.Comments[fmt.Sprintf("%s %s", model.ObjectSchema, schema.LocalSchema)] = metadataComment(schema.Comment, objectMetadata{Managed: schema.Managed})
+		}
+	}
+	snapshot.Types, err = getLocalTypes(ctx, dbConnection)
+	if err != nil {
+		return currentState, nil, err
+	}
+	snapshot.TypeSchemas, err = getTypeSchemas(ctx, dbConnection)
+	if err != nil {
+		return currentState, nil, err
+	}
+	usages, err := getTypeUsages(ctx, dbConnection)
+	if err != nil {
+		return currentState, nil, err
+	}
+	for _, usage := range usages {
+		snapshot.TypeUsages = append(snapshot.TypeUsages, fmt.Sprintf("%s.%s %s %s", usage.typeSchema, usage.typeName, usage.tableSchema, usage.serverName))
+	}
+	sort.Strings(snapshot.TypeUsages)
+	managedRoles, err := getManagedRoles(ctx, dbConnection)
+	if err != nil {
+		return currentState, nil, err
+	}
+	snapshot.ManagedRoles = make([]string, 0, len(managedRoles))
+	for roleName := range managedRoles {
+		snapshot.ManagedRoles = append(snapshot.ManagedRoles, roleName)
+	}
+	sort.Strings(snapshot.ManagedRoles)
+	return currentState, snapshot, nil
+}
+
+// fingerprint returns a hash that identifies the catalog snapshot. Objects are sorted by name before hashing so that
+// the order in which the catalog returns them does not affect the result.
+func (cs *catalogSnapshot) fingerprint() (string, error) {
+	sorted := *cs
+	sorted.State = sortedState(cs.State)
+	snapshotBytes, err := json.Marshal(sorted)
+	if err != nil {
+		return "", err
+	}
+	hash := sha256.Sum256(snapshotBytes)
+	return hex.EncodeToString(hash[:]), nil
+}
@@ -0,0 +1,614 @@
+package util
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/neflyte/fdwctl/lib/logger"
+	"github.com/neflyte/fdwctl/lib/model"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// diffContextLines is the number of unchanged lines shown around each change in a unified diff
+	diffContextLines = 3
+	// secretHashLength is the number of hex characters of a credential hash shown in drift reports
+	secretHashLength = 12
+)
+
+// secretHash returns a short, printable hash of a credential so that credentials can be compared without being shown
+func secretHash(secretValue string) string {
+	if secretValue == "" {
+		return ""
+	}
+	hash := sha256.Sum256([]byte(secretValue))
+	return fmt.Sprintf("sha256:%s", hex.EncodeToString(hash[:])[:secretHashLength])
+}
+
+// NormalizeState returns a sorted copy of the supplied state that contains only the attributes that can be read back
+// from the database. Credentials are resolved and replaced with their hash, ENUM import settings and table filters
+// are removed, column types of foreign tables are named the way the catalog names them, and the default wrapper is
+// filled in. When reference is not nil, only extensions that are also in the reference are
+// kept and the grants of servers whose privileges the reference does not manage are removed.
+func NormalizeState(ctx context.Context, state model.DesiredState, reference *model.DesiredState) (model.DesiredState, error) {
+	log := logger.Log(ctx).
+		WithField("function", "NormalizeState")
+	normalized := sortedState(state)
+	if reference != nil {
+		filteredExts := make([]model.Extension, 0)
+		for _, ext := range normalized.Extensions {
+			for _, filterExt := range reference.Extensions {
+				if filterExt.Equals(ext) {
+					filteredExts = append(filteredExts, model.Extension{Name: ext.Name})
+					break
+				}
+			}
+		}
+		normalized.Extensions = filteredExts
+	}
+	for idx := range normalized.Extensions {
+		normalized.Extensions[idx].Version = ""
+	}
+	for serverIdx := range normalized.Servers {
+		server := &normalized.Servers[serverIdx]
+		server.Wrapper = server.WrapperName()
+		server.Owner = ""
+		if reference != nil {
+			referenceServer := FindForeignServer(reference.Servers, server.Name)
+			if referenceServer == nil || referenceServer.ServerGrants == nil {
+				server.ServerGrants = nil
+			}
+		}
+		if server.ServerGrants != nil {
+			grantees := make([]string, 0, len(server.ServerGrants.Users))
+			for _, grantee := range server.ServerGrants.Users {
+				grantees = append(grantees, canonicalGrantee(grantee))
+			}
+			sort.Strings(grantees)
+			server.ServerGrants = &model.Grants{Users: grantees}
+		}
+		for umIdx := range server.UserMaps {
+			usermap := &server.UserMaps[umIdx]
+			secretValue := ""
+			if usermap.RemoteSecret.IsDefined() {
+				var err error
+				secretValue, err = GetSecret(ctx, usermap.RemoteSecret)
+				if err != nil {
+					return normalized, logger.ErrorfAsError(log, "error getting secret value for user mapping %s: %s", usermap.LocalUser, err)
+				}
+			}
+			usermap.ServerName = server.Name
+			usermap.RemoteSecret = model.Secret{
+				Value: secretHash(secretValue),
+			}
+		}
+		for schemaIdx := range server.Schemas {
+			schema := &server.Schemas[schemaIdx]
+			schema.ServerName = server.Name
+			schema.ImportENUMs = false
+			schema.ENUMConnection = ""
+			schema.ENUMSecret = model.Secret{}
+			schema.LimitTo = nil
+			schema.Except = nil
+			if reference != nil {
+				referenceSchema := findSchema(reference.Servers, server.Name, schema.LocalSchema)
+				if referenceSchema == nil || referenceSchema.SchemaGrants == nil {
+					schema.SchemaGrants = nil
+				}
+			}
+			if schema.SchemaGrants != nil {
+				schemaGrants := NormalizeGrants(*schema.SchemaGrants)
+				schema.SchemaGrants = &schemaGrants
+			}
+		}
+		for tableIdx := range server.ForeignTables {
+			table := normalizeForeignTable(server.ForeignTables[tableIdx])
+			table.ServerName = server.Name
+			server.ForeignTables[tableIdx] = table
+		}
+	}
+	return normalized, nil
+}
+
+// ScopeStates restricts a desired state and the current state of the database to the objects that a plan with the
+// supplied options would change, so that comparing them reports no drift that apply leaves in place. The servers and
+// kinds of objects outside the selection are removed from both states, and the objects of the current state that are
+// not in the desired state are removed when the prune mode or the Ignore list of the desired state keeps them.
+func ScopeStates(ctx context.Context, dState model.DesiredState, currentState model.DesiredState, opts PlanOptions) (model.DesiredState, model.DesiredState, error) {
+	log := logger.Log(ctx).
+		WithField("function", "ScopeStates")
+	err := validatePlanOptions(dState, opts)
+	if err != nil {
+		return dState, currentState, logger.ErrorfAsError(log, "%s", err)
+	}
+	p := newPlanner(nil, opts)
+	p.ignore = dState.Ignore
+	scopedDState, scopedCurrentState := dState, currentState
+	if !p.selects(SelectExtensions) {
+		scopedDState.Extensions = nil
+		scopedCurrentState.Extensions = nil
+	}
+	scopedDState.Servers = make([]model.ForeignServer, 0, len(dState.Servers))
+	for _, dsServer := range p.selectServers(ctx, dState.Servers) {
+		// The servers that do not exist are only created when servers are selected
+		if p.selects(SelectServers) || FindForeignServer(currentState.Servers, dsServer.Name) != nil {
+			scopedDState.Servers = append(scopedDState.Servers, dsServer)
+		}
+	}
+	scopedCurrentState.Servers = make([]model.ForeignServer, 0, len(currentState.Servers))
+	for _, dbServer := range p.selectServers(ctx, currentState.Servers) {
+		dsIdx := -1
+		for idx := range scopedDState.Servers {
+			if scopedDState.Servers[idx].Name == dbServer.Name {
+				dsIdx = idx
+				break
+			}
+		}
+		if dsIdx < 0 {
+			if p.selects(SelectServers) && p.canPrune(ctx, model.ObjectServer, dbServer.Name, dbServer.Managed) {
+				scopedCurrentState.Servers = append(scopedCurrentState.Servers, dbServer)
+			}
+			continue
+		}
+		scopedCurrentState.Servers = append(scopedCurrentState.Servers, p.scopeServer(ctx, &scopedDState.Servers[dsIdx], dbServer))
+	}
+	return scopedDState, scopedCurrentState, nil
+}
+
+// scopeServer restricts a desired state server, in place, and the database server of the same name to the objects that
+// a plan would change and returns the restricted database server
+func (p *planner) scopeServer(ctx context.Context, dsServer *model.ForeignServer, dbServer model.ForeignServer) model.ForeignServer {
+	if !p.selects(SelectServers) {
+		// The attributes and privileges of the server are left as they are
+		dbServer.Host, dbServer.Port, dbServer.DB = dsServer.Host, dsServer.Port, dsServer.DB
+		dbServer.Wrapper, dbServer.Options, dbServer.ServerGrants = dsServer.Wrapper, dsServer.Options, dsServer.ServerGrants
+	}
+	if p.selects(SelectUserMaps) {
+		userMaps := make([]model.UserMap, 0, len(dbServer.UserMaps))
+		for _, usermap := range dbServer.UserMaps {
+			// The user mappings of a server in the desired state are managed along with the server
+			if FindUserMap(dsServer.UserMaps, usermap.LocalUser) != nil || p.canPrune(ctx, model.ObjectUserMap, usermap.LocalUser, true, dbServer.Name) {
+				userMaps = append(userMaps, usermap)
+			}
+		}
+		dbServer.UserMaps = userMaps
+	} else {
+		dsServer.UserMaps, dbServer.UserMaps = nil, nil
+	}
+	if p.selects(SelectSchemas) {
+		schemas := make([]model.Schema, 0, len(dbServer.Schemas))
+		for _, schema := range dbServer.Schemas {
+			if findSchema([]model.ForeignServer{*dsServer}, dsServer.Name, schema.LocalSchema) != nil || p.canPrune(ctx, model.ObjectSchema, schema.LocalSchema, schema.Managed) {
+				schemas = append(schemas, schema)
+			}
+		}
+		dbServer.Schemas = schemas
+	} else {
+		dsServer.Schemas, dbServer.Schemas = nil, nil
+	}
+	if p.selects(SelectForeignTables) {
+		tables := make([]model.ForeignTable, 0, len(dbServer.ForeignTables))
+		for _, table := range dbServer.ForeignTables {
+			// The foreign tables of a server in the desired state are managed along with the server
+			if FindForeignTable(dsServer.ForeignTables, table.LocalSchema, table.Name) != nil || p.canPrune(ctx, model.ObjectForeignTable, table.QualifiedName(), true) {
+				tables = append(tables, table)
+			}
+		}
+		dbServer.ForeignTables = tables
+	} else {
+		dsServer.ForeignTables, dbServer.ForeignTables = nil, nil
+	}
+	return dbServer
+}
+
+// DiffState compares a normalized desired state with a normalized current state and returns every difference
+// between them. Extensions in the database that are not in the desired state are not reported since they are never
+// removed.
+func DiffState(dState model.DesiredState, dbState model.DesiredState) []model.Drift {
+	drifts := make([]model.Drift, 0)
+	// Extensions
+	_, extAdd := DiffExtensions(dState.Extensions, dbState.Extensions)
+	for _, ext := range extAdd {
+		drifts = append(drifts, model.Drift{ObjectType: model.ObjectExtension, ObjectName: ext.Name, Kind: model.DriftMissing})
+	}
+	// Servers
+	fsRemove, fsAdd, fsModify := DiffForeignServers(dState.Servers, dbState.Servers)
+	for _, server := range fsRemove {
+		drifts = append(drifts, model.Drift{ObjectType: model.ObjectServer, ObjectName: server.Name, Kind: model.DriftUnexpected})
+	}
+	for _, server := range fsAdd {
+		drifts = append(drifts, model.Drift{ObjectType: model.ObjectServer, ObjectName: server.Name, Kind: model.DriftMissing})
+	}
+	for _, dsServer := range fsModify {
+		dbServer := FindForeignServer(dbState.Servers, dsServer.Name)
+		changed := func(attribute string, desired string, actual string) {
+			if desired != actual {
+				drifts = append(drifts, model.Drift{
+					ObjectType: model.ObjectServer,
+					ObjectName: dsServer.Name,
+					Kind:       model.DriftChanged,
+					Attribute:  attribute,
+					Desired:    desired,
+					Actual:     actual,
+				})
+			}
+		}
+		changed("wrapper", dsServer.WrapperName(), dbServer.WrapperName())
+		changed("host", dsServer.Host, dbServer.Host)
+		changed("port", strconv.Itoa(dsServer.Port), strconv.Itoa(dbServer.Port))
+		changed("dbname", dsServer.DB, dbServer.DB)
+		for _, optionName := range optionNamesOf(dsServer.Options, dbServer.Options) {
+			changed(fmt.Sprintf("options.%s", optionName), dsServer.Options[optionName], dbServer.Options[optionName])
+		}
+		drifts = append(drifts, diffServerGrantState(dsServer, *dbServer)...)
+		drifts = append(drifts, diffUserMapState(dsServer, dbServer.UserMaps)...)
+		drifts = append(drifts, diffSchemaState(dsServer, dbServer.Schemas)...)
+		drifts = append(drifts, diffForeignTableState(dsServer, dbServer.ForeignTables)...)
+	}
+	return drifts
+}
+
+// diffServerGrantState returns the differences between the grantees of a desired state server that manages its
+// privileges and the database
+func diffServerGrantState(dsServer model.ForeignServer, dbServer model.ForeignServer) []model.Drift {
+	drifts := make([]model.Drift, 0)
+	if dsServer.ServerGrants == nil {
+		return drifts
+	}
+	dbGrantees := make([]string, 0)
+	if dbServer.ServerGrants != nil {
+		dbGrantees = dbServer.ServerGrants.Users
+	}
+	granteesToRevoke, granteesToGrant := DiffGrantees(dsServer.ServerGrants.Users, dbGrantees)
+	for _, grantee := range granteesToRevoke {
+		drifts = append(drifts, model.Drift{
+			ObjectType: model.ObjectServer,
+			ObjectName: dsServer.Name,
+			Kind:       model.DriftUnexpected,
+			Attribute:  "grant",
+			Actual:     grantee,
+		})
+	}
+	for _, grantee := range granteesToGrant {
+		drifts = append(drifts, model.Drift{
+			ObjectType: model.ObjectServer,
+			ObjectName: dsServer.Name,
+			Kind:       model.DriftMissing,
+			Attribute:  "grant",
+			Desired:    grantee,
+		})
+	}
+	return drifts
+}
+
+// diffUserMapState returns the differences between the user mappings of a desired state server and the database
+func diffUserMapState(dsServer model.ForeignServer, dbUserMaps []model.UserMap) []model.Drift {
+	drifts := make([]model.Drift, 0)
+	umRemove, umAdd, umModify := DiffUserMaps(dsServer.UserMaps, dbUserMaps)
+	for _, usermap := range umRemove {
+		drifts = append(drifts, model.Drift{ObjectType: model.ObjectUserMap, ObjectName: usermap.LocalUser, ServerName: dsServer.Name, Kind: model.DriftUnexpected})
+	}
+	for _, usermap := range umAdd {
+		drifts = append(drifts, model.Drift{ObjectType: model.ObjectUserMap, ObjectName: usermap.LocalUser, ServerName: dsServer.Name, Kind: model.DriftMissing})
+	}
+	for _, dsUserMap := range umModify {
+		dbUserMap := FindUserMap(dbUserMaps, dsUserMap.LocalUser)
+		if dsUserMap.RemoteUser != dbUserMap.RemoteUser {
+			drifts = append(drifts, model.Drift{
+				ObjectType: model.ObjectUserMap,
+				ObjectName: dsUserMap.LocalUser,
+				ServerName: dsServer.Name,
+				Kind:       model.DriftChanged,
+				Attribute:  "remoteuser",
+				Desired:    dsUserMap.RemoteUser,
+				Actual:     dbUserMap.RemoteUser,
+			})
+		}
+		if dsUserMap.RemoteSecret.Value != dbUserMap.RemoteSecret.Value {
+			drifts = append(drifts, model.Drift{
+				ObjectType: model.ObjectUserMap,
+				ObjectName: dsUserMap.LocalUser,
+				ServerName: dsServer.Name,
+				Kind:       model.DriftChanged,
+				Attribute:  "password",
+				Desired:    dsUserMap.RemoteSecret.Value,
+				Actual:     dbUserMap.RemoteSecret.Value,
+			})
+		}
+		for _, optionName := range optionNamesOf(dsUserMap.Options, dbUserMap.Options) {
+			if dsUserMap.Options[optionName] != dbUserMap.Options[optionName] {
+				drifts = append(drifts, model.Drift{
+					ObjectType: model.ObjectUserMap,
+					ObjectName: dsUserMap.LocalUser,
+					ServerName: dsServer.Name,
+					Kind:       model.DriftChanged,
+					Attribute:  fmt.Sprintf("options.%s", optionName),
+					Desired:    dsUserMap.Options[optionName],
+					Actual:     dbUserMap.Options[optionName],
+				})
+			}
+		}
+	}
+	return drifts
+}
+
+// diffSchemaState returns the differences between the foreign schemas of a desired state server and the database
+func diffSchemaState(dsServer model.ForeignServer, dbSchemas []model.Schema) []model.Drift {
+	drifts := make([]model.Drift, 0)
+	schRemove, schAdd, schModify := DiffSchemas(dsServer.Schemas, dbSchemas)
+	for _, schema := range schRemove {
+		drifts = append(drifts, model.Drift{ObjectType: model.ObjectSchema, ObjectName: schema.LocalSchema, ServerName: dsServer.Name, Kind: model.DriftUnexpected})
+	}
+	for _, schema := range schAdd {
+		drifts = append(drifts, model.Drift{ObjectType: model.ObjectSchema, ObjectName: schema.LocalSchema, ServerName: dsServer.Name, Kind: model.DriftMissing})
+	}
+	for _, dsSchema := range schModify {
+		var dbSchema model.Schema
+		for _, schema := range dbSchemas {
+			if schema.LocalSchema == dsSchema.LocalSchema {
+				dbSchema = schema
+				break
+			}
+		}
+		if dsSchema.RemoteSchema != dbSchema.RemoteSchema {
+			drifts = append(drifts, model.Drift{
+				ObjectType: model.ObjectSchema,
+				ObjectName: dsSchema.LocalSchema,
+				ServerName: dsServer.Name,
+				Kind:       model.DriftChanged,
+				Attribute:  "remoteschema",
+				Desired:    dsSchema.RemoteSchema,
+				Actual:     dbSchema.RemoteSchema,
+			})
+		}
+		if dsSchema.TypeSchema != dbSchema.TypeSchema {
+			drifts = append(drifts, model.Drift{
+				ObjectType: model.ObjectSchema,
+				ObjectName: dsSchema.LocalSchema,
+				ServerName: dsServer.Name,
+				Kind:       model.DriftChanged,
+				Attribute:  "typeSchema",
+				Desired:    dsSchema.TypeSchema,
+				Actual:     dbSchema.TypeSchema,
+			})
+		}
+		for _, optionName := range optionNamesOf(dsSchema.ImportOptions, dbSchema.ImportOptions) {
+			if dsSchema.ImportOptions[optionName] != dbSchema.ImportOptions[optionName] {
+				drifts = append(drifts, model.Drift{
+					ObjectType: model.ObjectSchema,
+					ObjectName: dsSchema.LocalSchema,
+					ServerName: dsServer.Name,
+					Kind:       model.DriftChanged,
+					Attribute:  fmt.Sprintf("importoptions.%s", optionName),
+					Desired:    dsSchema.ImportOptions[optionName],
+					Actual:     dbSchema.ImportOptions[optionName],
+				})
+			}
+		}
+		drifts = append(drifts, diffSchemaGrantState(dsServer.Name, dsSchema, dbSchema)...)
+	}
+	return drifts
+}
+
+// diffForeignTableState returns the differences between the declared foreign tables of a desired state server and the
+// database
+func diffForeignTableState(dsServer model.ForeignServer, dbTables []model.ForeignTable) []model.Drift {
+	drifts := make([]model.Drift, 0)
+	ftRemove, ftAdd, ftModify := DiffForeignTables(dsServer.ForeignTables, dbTables)
+	for _, table := range ftRemove {
+		drifts = append(drifts, model.Drift{ObjectType: model.ObjectForeignTable, ObjectName: table.QualifiedName(), ServerName: dsServer.Name, Kind: model.DriftUnexpected})
+	}
+	for _, table := range ftAdd {
+		drifts = append(drifts, model.Drift{ObjectType: model.ObjectForeignTable, ObjectName: table.QualifiedName(), ServerName: dsServer.Name, Kind: model.DriftMissing})
+	}
+	for _, dsTable := range ftModify {
+		dbTable := FindForeignTable(dbTables, dsTable.LocalSchema, dsTable.Name)
+		changed := func(attribute string, desired string, actual string) {
+			if desired != actual {
+				drifts = append(drifts, model.Drift{
+					ObjectType: model.ObjectForeignTable,
+					ObjectName: dsTable.QualifiedName(),
+					ServerName: dsServer.Name,
+					Kind:       model.DriftChanged,
+					Attribute:  attribute,
+					Desired:    desired,
+					Actual:     actual,
+				})
+			}
+		}
+		changed("remoteschema", dsTable.RemoteSchema, dbTable.RemoteSchema)
+		changed("remotetable", dsTable.RemoteTable, dbTable.RemoteTable)
+		for _, optionName := range optionNamesOf(dsTable.Options, dbTable.Options) {
+			changed(fmt.Sprintf("options.%s", optionName), dsTable.Options[optionName], dbTable.Options[optionName])
+		}
+		// The columns of the desired state are compared with the database as the columns of a remote table would be
+		for _, drift := range diffTableColumns(dbTable.Columns, dsTable.Columns, true) {
+			drift.ObjectName = dsTable.QualifiedName()
+			drift.ServerName = dsServer.Name
+			drifts = append(drifts, drift)
+		}
+		for _, dsColumn := range dsTable.Columns {
+			dbColumn := findColumn(dbTable.Columns, dsColumn.Name)
+			if dbColumn == nil {
+				continue
+			}
+			for _, optionName := range optionNamesOf(dsColumn.Options, dbColumn.Options) {
+				changed(fmt.Sprintf("column.%s.options.%s", dsColumn.Name, optionName), dsColumn.Options[optionName], dbColumn.Options[optionName])
+			}
+		}
+	}
+	return drifts
+}
+
+// diffSchemaGrantState returns the differences between the normalized grants of a desired state schema that manages
+// its privileges and the database
+func diffSchemaGrantState(serverName string, dsSchema model.Schema, dbSchema model.Schema) []model.Drift {
+	drifts := make([]model.Drift, 0)
+	if dsSchema.SchemaGrants == nil {
+		return drifts
+	}
+	dbGrants := model.Grants{}
+	if dbSchema.SchemaGrants != nil {
+		dbGrants = *dbSchema.SchemaGrants
+	}
+	roles := make([]string, 0)
+	for _, roleGrant := range append(append(make([]model.RoleGrant, 0), dsSchema.SchemaGrants.Roles...), dbGrants.Roles...) {
+		if !containsString(roles, roleGrant.Role) {
+			roles = append(roles, roleGrant.Role)
+		}
+	}
+	sort.Strings(roles)
+	for _, role := range roles {
+		desired := describeRoleGrants(*dsSchema.SchemaGrants, role)
+		actual := describeRoleGrants(dbGrants, role)
+		drift := model.Drift{
+			ObjectType: model.ObjectSchema,
+			ObjectName: dsSchema.LocalSchema,
+			ServerName: serverName,
+		}
+		switch {
+		case desired == actual:
+			continue
+		case actual == "":
+			drift.Kind = model.DriftMissing
+			drift.Attribute = "grant"
+			drift.Desired = role
+		case desired == "":
+			drift.Kind = model.DriftUnexpected
+			drift.Attribute = "grant"
+			drift.Actual = role
+		default:
+			drift.Kind = model.DriftChanged
+			drift.Attribute = fmt.Sprintf("grant.%s", role)
+			drift.Desired = desired
+			drift.Actual = actual
+		}
+		drifts = append(drifts, drift)
+	}
+	return drifts
+}
+
+// findSchema returns the schema with the supplied local schema name of the named server in the list of servers, or
+// nil if there is no such schema
+func findSchema(servers []model.ForeignServer, serverName string, localSchema string) *model.Schema {
+	server := FindForeignServer(servers, serverName)
+	if server == nil {
+		return nil
+	}
+	for idx := range server.Schemas {
+		if server.Schemas[idx].LocalSchema == localSchema {
+			return &server.Schemas[idx]
+		}
+	}
+	return nil
+}
+
+// containsString determines if the supplied list contains the supplied string
+func containsString(haystack []string, needle string) bool {
+	for _, str := range haystack {
+		if str == needle {
+			return true
+		}
+	}
+	return false
+}
+
+// StateYAML returns the YAML representation of a state
+func StateYAML(state model.DesiredState) (string, error) {
+	stateBytes, err := yaml.Marshal(state)
+	if err != nil {
+		return "", err
+	}
+	return string(stateBytes), nil
+}
+
+// UnifiedDiff returns a unified diff of two texts, compared line by line. An empty string is returned when the texts
+// are the same.
+func UnifiedDiff(fromName string, toName string, from string, to string) string {
+	fromLines := strings.Split(strings.TrimSuffix(from, "\n"), "\n")
+	toLines := strings.Split(strings.TrimSuffix(to, "\n"), "\n")
+	// lcs[i][j] is the length of the longest common subsequence of fromLines[i:] and toLines[j:]
+	lcs := make([][]int, len(fromLines)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(toLines)+1)
+	}
+	for i := len(fromLines) - 1; i >= 0; i-- {
+		for j := len(toLines) - 1; j >= 0; j-- {
+			if fromLines[i] == toLines[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+	// Walk the table to produce an edit script
+	type diffLine struct {
+		text   string
+		op     byte
+		fromNo int
+		toNo   int
+	}
+	lines := make([]diffLine, 0, len(fromLines)+len(toLines))
+	i, j := 0, 0
+	for i < len(fromLines) || j < len(toLines) {
+		switch {
+		case i < len(fromLines) && j < len(toLines) && fromLines[i] == toLines[j]:
+			lines = append(lines, diffLine{op: ' ', text: fromLines[i], fromNo: i, toNo: j})
+			i++
+			j++
+		case j < len(toLines) && (i == len(fromLines) || lcs[i][j+1] > lcs[i+1][j]):
+			lines = append(lines, diffLine{op: '+', text: toLines[j], fromNo: i, toNo: j})
+			j++
+		default:
+			lines = append(lines, diffLine{op: '-', text: fromLines[i], fromNo: i, toNo: j})
+			i++
+		}
+	}
+	// Group changes into hunks with surrounding context
+	var out strings.Builder
+	for start := 0; start < len(lines); {
+		if lines[start].op == ' ' {
+			start++
+			continue
+		}
+		hunkStart := start - diffContextLines
+		if hunkStart < 0 {
+			hunkStart = 0
+		}
+		hunkEnd := start
+		for idx := start; idx < len(lines) && idx <= hunkEnd+2*diffContextLines; idx++ {
+			if lines[idx].op != ' ' {
+				hunkEnd = idx
+			}
+		}
+		hunkEnd += diffContextLines
+		if hunkEnd >= len(lines) {
+			hunkEnd = len(lines) - 1
+		}
+		if out.Len() == 0 {
+			out.WriteString(fmt.Sprintf("--- %s\n+++ %s\n", fromName, toName))
+		}
+		fromCount, toCount := 0, 0
+		for _, line := range lines[hunkStart : hunkEnd+1] {
+			if line.op != '+' {
+				fromCount++
+			}
+			if line.op != '-' {
+				toCount++
+			}
+		}
+		out.WriteString(fmt.Sprintf("@@ -%d,%d +%d,%d @@\n", lines[hunkStart].fromNo+1, fromCount, lines[hunkStart].toNo+1, toCount))
+		for _, line := range lines[hunkStart : hunkEnd+1] {
+			out.WriteString(fmt.Sprintf("%c%s\n", line.op, line.text))
+		}
+		start = hunkEnd + 1
+	}
+	return out.String()
+}
@@ -0,0 +1,290 @@
+package util
+
+import (
+	"context"
+	"testing"
+
+	"github.com/neflyte/fdwctl/lib/model"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUnit_DiffState_InSync(t *testing.T) {
+	dState := model.DesiredState{
+		Extensions: []model.Extension{{Name: "postgres_fdw"}},
+		Servers: []model.ForeignServer{
+			{
+				Name: "remotedb",
+				Host: "remotehost",
+				Port: 5432,
+				DB:   "remotedb",
+				UserMaps: []model.UserMap{
+					{LocalUser: "fdw", RemoteUser: "remoteuser", RemoteSecret: model.Secret{Value: "s3cret"}},
+				},
+				Schemas: []model.Schema{
+					{LocalSchema: "remotedb", RemoteSchema: "public", ImportENUMs: true, ENUMConnection: "postgres://remotehost/remotedb"},
+				},
+			},
+		},
+	}
+	dbState := model.DesiredState{
+		Extensions: []model.Extension{{Name: "plpgsql", Version: "1.0"}, {Name: "postgres_fdw", Version: "1.1"}},
+		Servers: []model.ForeignServer{
+			{
+				Name:    "remotedb",
+				Wrapper: "postgres_fdw",
+				Owner:   "postgres",
+				Host:    "remotehost",
+				Port:    5432,
+				DB:      "remotedb",
+				// The desired state does not manage the privileges of the server
+				ServerGrants: &model.Grants{Users: []string{"fdw"}},
+				UserMaps: []model.UserMap{
+					{ServerName: "remotedb", LocalUser: "fdw", RemoteUser: "remoteuser", RemoteSecret: model.Secret{Value: "s3cret"}},
+				},
+				Schemas: []model.Schema{
+					{ServerName: "remotedb", LocalSchema: "remotedb", RemoteSchema: "public"},
+				},
+			},
+		},
+	}
+	normalizedDState, err := NormalizeState(context.Background(), dState, nil)
+	require.Nil(t, err)
+	normalizedDBState, err := NormalizeState(context.Background(), dbState, &dState)
+	require.Nil(t, err)
+	require.Empty(t, DiffState(normalizedDState, normalizedDBState))
+
+	dStateYAML, err := StateYAML(normalizedDState)
+	require.Nil(t, err)
+	dbStateYAML, err := StateYAML(normalizedDBState)
+	require.Nil(t, err)
+	require.Equal(t, "", UnifiedDiff("desired", "database", dStateYAML, dbStateYAML))
+}
+
+func TestUnit_DiffState_Drift(t *testing.T) {
+	dState := model.DesiredState{
+		Extensions: []model.Extension{{Name: "postgres_fdw"}},
+		Servers: []model.ForeignServer{
+			{
+				Name:         "remotedb",
+				Host:         "newhost",
+				Port:         5432,
+				DB:           "remotedb",
+				ServerGrants: &model.Grants{Users: []string{"public", "reporting"}},
+				UserMaps: []model.UserMap{
+					{LocalUser: "fdw", RemoteUser: "remoteuser", RemoteSecret: model.Secret{Value: "n3w"}},
+					{LocalUser: "reporting", RemoteUser: "remoteuser"},
+				},
+				Schemas: []model.Schema{
+					{LocalSchema: "remotedb", RemoteSchema: "public", SchemaGrants: &model.Grants{Users: []string{"fdw"}}},
+				},
+			},
+			{Name: "newserver"},
+		},
+	}
+	dbState := model.DesiredState{
+		Servers: []model.ForeignServer{
+			{
+				Name:         "remotedb",
+				Host:         "oldhost",
+				Port:         5432,
+				DB:           "remotedb",
+				ServerGrants: &model.Grants{Users: []string{"PUBLIC", "fdw"}},
+				UserMaps: []model.UserMap{
+					{LocalUser: "fdw", RemoteUser: "remoteuser", RemoteSecret: model.Secret{Value: "0ld"}},
+				},
+				Schemas: []model.Schema{
+					{LocalSchema: "remotedb", RemoteSchema: "public"},
+				},
+			},
+			{Name: "handmade"},
+		},
+	}
+	normalizedDState, err := NormalizeState(context.Background(), dState, nil)
+	require.Nil(t, err)
+	normalizedDBState, err := NormalizeState(context.Background(), dbState, &dState)
+	require.Nil(t, err)
+	expected := []model.Drift{
+		{ObjectType: model.ObjectExtension, ObjectName: "postgres_fdw", Kind: model.DriftMissing},
+		{ObjectType: model.ObjectServer, ObjectName: "handmade", Kind: model.DriftUnexpected},
+		{ObjectType: model.ObjectServer, ObjectName: "newserver", Kind: model.DriftMissing},
+		{ObjectType: model.ObjectServer, ObjectName: "remotedb", Kind: model.DriftChanged, Attribute: "host", Desired: "newhost", Actual: "oldhost"},
+		{ObjectType: model.ObjectServer, ObjectName: "remotedb", Kind: model.DriftUnexpected, Attribute: "grant", Actual: "fdw"},
+		{ObjectType: model.ObjectServer, ObjectName: "remotedb", Kind: model.DriftMissing, Attribute: "grant", Desired: "reporting"},
+		{ObjectType: model.ObjectUserMap, ObjectName: "reporting", ServerName: "remotedb", Kind: model.DriftMissing},
+		{ObjectType: model.ObjectUserMap, ObjectName: "fdw", ServerName: "remotedb", Kind: model.DriftChanged, Attribute: "password", Desired: secretHash("n3w"), Actual: secretHash("0ld")},
+		{ObjectType: model.ObjectSchema, ObjectName: "remotedb", ServerName: "remotedb", Kind: model.DriftMissing, Attribute: "grant", Desired: "fdw"},
+	}
+	require.Equal(t, expected, DiffState(normalizedDState, normalizedDBState))
+}
+
+func TestUnit_UnifiedDiff(t *testing.T) {
+	from := "a\nb\nc\nd\ne\nf\ng\nh\ni\nj\n"
+	to := "a\nb\nc\nd\nE\nf\ng\nh\ni\nj\nk\n"
+	expected := "--- desired\n+++ database\n" +
+		"@@ -2,9 +2,10 @@\n" +
+		" b\n c\n d\n-e\n+E\n f\n g\n h\n i\n j\n+k\n"
+	require.Equal(t, expected, UnifiedDiff("desired", "database", from, to))
+	require.Equal(t, "", UnifiedDiff("desired", "database", from, from))
+}
+
+func TestUnit_DiffState_SchemaGrants(t *testing.T) {
+	dState := model.DesiredState{
+		Servers: []model.ForeignServer{
+			{
+				Name: "remotedb",
+				Schemas: []model.Schema{
+					{
+						LocalSchema:  "remotedb",
+						RemoteSchema: "public",
+						SchemaGrants: &model.Grants{Roles: []model.RoleGrant{{Role: "reporting", Privileges: []string{"select"}}}},
+					},
+				},
+			},
+		},
+	}
+	dbState := model.DesiredState{
+		Servers: []model.ForeignServer{
+			{
+				Name: "remotedb",
+				Schemas: []model.Schema{
+					{
+						LocalSchema:  "remotedb",
+						RemoteSchema: "public",
+						SchemaGrants: &model.Grants{Roles: []model.RoleGrant{
+							{Role: "legacy", Privileges: []string{}},
+							{Role: "reporting", Privileges: []string{"SELECT"}},
+							{Role: "reporting", Privileges: []string{"INSERT"}, Tables: []string{"orders"}},
+						}},
+					},
+				},
+			},
+		},
+	}
+	normalizedDState, err := NormalizeState(context.Background(), dState, nil)
+	require.Nil(t, err)
+	normalizedDBState, err := NormalizeState(context.Background(), dbState, &dState)
+	require.Nil(t, err)
+	require.Equal(t, []model.Drift{
+		{ObjectType: model.ObjectSchema, ObjectName: "remotedb", ServerName: "remotedb", Kind: model.DriftUnexpected, Attribute: "grant", Actual: "legacy"},
+		{
+			ObjectType: model.ObjectSchema,
+			ObjectName: "remotedb",
+			ServerName: "remotedb",
+			Kind:       model.DriftChanged,
+			Attribute:  "grant.reporting",
+			Desired:    "all tables: SELECT",
+			Actual:     "all tables: SELECT; orders: INSERT",
+		},
+	}, DiffState(normalizedDState, normalizedDBState))
+}
+
+func TestUnit_DiffState_ForeignTables(t *testing.T) {
+	dState := model.DesiredState{
+		Servers: []model.ForeignServer{
+			{
+				Name: "remotedb",
+				ForeignTables: []model.ForeignTable{
+					{LocalSchema: "reporting", Name: "daily_totals", RemoteTable: "daily_totals_v", Columns: []model.Column{
+						{Name: "day", Type: "date", NotNull: true},
+						{Name: "total", Type: "numeric(12,2)", Options: map[string]string{"column_name": "sum_total"}},
+					}},
+					{LocalSchema: "reporting", Name: "regions", Columns: []model.Column{{Name: "id", Type: "int"}}},
+				},
+			},
+		},
+	}
+	dbState := model.DesiredState{
+		Servers: []model.ForeignServer{
+			{
+				Name: "remotedb",
+				ForeignTables: []model.ForeignTable{
+					{LocalSchema: "reporting", Name: "daily_totals", RemoteTable: "daily_totals", Columns: []model.Column{
+						{Name: "day", Type: "date", NotNull: true},
+						{Name: "total", Type: "numeric(10,2)"},
+					}},
+					{LocalSchema: "reporting", Name: "regions", Columns: []model.Column{{Name: "id", Type: "integer"}}},
+				},
+			},
+		},
+	}
+	normalizedDState, err := NormalizeState(context.Background(), dState, nil)
+	require.Nil(t, err)
+	normalizedDBState, err := NormalizeState(context.Background(), dbState, &dState)
+	require.Nil(t, err)
+	require.Equal(t, []model.Drift{
+		{ObjectType: model.ObjectForeignTable, ObjectName: "reporting.daily_totals", ServerName: "remotedb", Kind: model.DriftChanged, Attribute: "remotetable", Desired: "daily_totals_v", Actual: "daily_totals"},
+		{ObjectType: model.ObjectForeignTable, ObjectName: "reporting.daily_totals", ServerName: "remotedb", Kind: model.DriftChanged, Attribute: "column.total.type", Desired: "numeric(12,2)", Actual: "numeric(10,2)"},
+		{ObjectType: model.ObjectForeignTable, ObjectName: "reporting.daily_totals", ServerName: "remotedb", Kind: model.DriftChanged, Attribute: "column.total.options.column_name", Desired: "sum_total"},
+	}, DiffState(normalizedDState, normalizedDBState))
+}
+
+func TestUnit_ScopeStates(t *testing.T) {
+	dState := model.DesiredState{
+		Ignore: []string{"legacy_*"},
+		Servers: []model.ForeignServer{
+			{Name: "remotedb", Host: "remotehost", Port: 5432},
+			{Name: "created", Host: "remotehost"},
+		},
+	}
+	dbState := model.DesiredState{
+		Servers: []model.ForeignServer{
+			{
+				Name:     "remotedb",
+				Host:     "otherhost",
+				Port:     5432,
+				Managed:  true,
+				UserMaps: []model.UserMap{{LocalUser: "fdw", RemoteUser: "remoteuser"}},
+				Schemas: []model.Schema{
+					{LocalSchema: "handmade", RemoteSchema: "public"},
+					{LocalSchema: "legacy_reports", RemoteSchema: "reports", Managed: true},
+					{LocalSchema: "stale", RemoteSchema: "stale", Managed: true},
+				},
+			},
+			{Name: "manual", Host: "remotehost"},
+			{Name: "legacy_billing", Host: "remotehost", Managed: true},
+			{Name: "scratch", Host: "remotehost", Managed: true},
+		},
+	}
+	drifted := func(opts PlanOptions) []string {
+		scopedDState, scopedDBState, err := ScopeStates(context.Background(), dState, dbState, opts)
+		require.Nil(t, err)
+		normalizedDState, err := NormalizeState(context.Background(), scopedDState, nil)
+		require.Nil(t, err)
+		normalizedDBState, err := NormalizeState(context.Background(), scopedDBState, &scopedDState)
+		require.Nil(t, err)
+		drifts := make([]string, 0)
+		for _, drift := range DiffState(normalizedDState, normalizedDBState) {
+			drifts = append(drifts, drift.String())
+		}
+		return drifts
+	}
+
+	hostDrift := `server remotedb changed: host: desired "remotehost", actual "otherhost"`
+	// Unmanaged and ignored objects are not drift by default
+	require.Equal(t, []string{
+		"server scratch unexpected",
+		"server created missing",
+		hostDrift,
+		"usermap fdw (server remotedb) unexpected",
+		"schema stale (server remotedb) unexpected",
+	}, drifted(PlanOptions{}))
+	require.Equal(t, []string{
+		"server manual unexpected",
+		"server scratch unexpected",
+		"server created missing",
+		hostDrift,
+		"usermap fdw (server remotedb) unexpected",
+		"schema handmade (server remotedb) unexpected",
+		"schema stale (server remotedb) unexpected",
+	}, drifted(PlanOptions{Prune: PruneAll}))
+	require.Equal(t, []string{"server created missing", hostDrift}, drifted(PlanOptions{Prune: PruneNone}))
+	// Only the selected kinds of objects of the selected servers are compared
+	require.Equal(t, []string{"usermap fdw (server remotedb) unexpected"}, drifted(PlanOptions{Only: []string{SelectUserMaps}}))
+	require.Equal(t, []string{
+		"schema handmade (server remotedb) unexpected",
+		"schema stale (server remotedb) unexpected",
+	}, drifted(PlanOptions{Prune: PruneAll, Only: []string{SelectSchemas}}))
+	require.Empty(t, drifted(PlanOptions{Servers: []string{"manual"}}))
+	_, _, err := ScopeStates(context.Background(), dState, dbState, PlanOptions{Only: []string{"tables"}})
+	require.NotNil(t, err)
+}
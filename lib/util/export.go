@@ -0,0 +1,52 @@
+package util
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/neflyte/fdwctl/lib/database"
+	"github.com/neflyte/fdwctl/lib/logger"
+	"github.com/neflyte/fdwctl/lib/model"
+)
+
+var (
+	// envNameInvalidCharsRE is a regular expression that matches runs of characters not allowed in an environment variable name
+	envNameInvalidCharsRE = regexp.MustCompile(`[^A-Z0-9_]+`)
+)
+
+// SecretEnvName returns the name of the placeholder environment variable that holds the credential of the user
+// mapping for the local user on the named foreign server
+func SecretEnvName(serverName string, localUser string) string {
+	envName := strings.ToUpper(fmt.Sprintf("FDW_%s_%s_PASSWORD", serverName, localUser))
+	return envNameInvalidCharsRE.ReplaceAllString(envName, "_")
+}
+
+// ExportState reads the current state of the database and returns it as a desired state that can be applied to
+// reproduce it. User mapping credentials are never exported; each one is replaced by a reference to a placeholder
+// environment variable named by SecretEnvName.
+func ExportState(ctx context.Context, dbConnection database.Executor) (model.DesiredState, error) {
+	log := logger.Log(ctx).
+		WithField("function", "ExportState")
+	currentState, err := GetCurrentState(ctx, dbConnection)
+	if err != nil {
+		log.Errorf("error getting current state: %s", err)
+		return currentState, err
+	}
+	exported := sortedState(currentState)
+	for serverIdx := range exported.Servers {
+		server := &exported.Servers[serverIdx]
+		for umIdx := range server.UserMaps {
+			usermap := &server.UserMaps[umIdx]
+			if usermap.RemoteSecret.Value == "" {
+				usermap.RemoteSecret = model.Secret{}
+				continue
+			}
+			usermap.RemoteSecret = model.Secret{
+				FromEnv: SecretEnvName(server.Name, usermap.LocalUser),
+			}
+		}
+	}
+	return exported, nil
+}
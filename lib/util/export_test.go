@@ -0,0 +1,72 @@
+package util
+
+import (
+	"context"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/neflyte/fdwctl/lib/model"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUnit_SecretEnvName(t *testing.T) {
+	require.Equal(t, "FDW_REMOTEDB_FDW_PASSWORD", SecretEnvName("remotedb", "fdw"))
+	require.Equal(t, "FDW_REMOTE_DB_FDW_USER_PASSWORD", SecretEnvName("remote-db", "fdw.user"))
+}
+
+func TestUnit_ExportState_ReplacesSecrets(t *testing.T) {
+	db, mock := newSQLMock(t)
+	defer closeSQLMock(t, db)
+
+	mock.ExpectQuery(regexp.QuoteMeta(sqlGetExtensions)).
+		WillReturnRows(sqlmock.NewRows([]string{"extname", "extversion"}).AddRow("postgres_fdw", "1.0")).
+		RowsWillBeClosed()
+	mock.ExpectQuery(regexp.QuoteMeta(sqlForeignServerInfo)).
+		WillReturnRows(
+			sqlmock.NewRows([]string{"srvname", "fdwname", "owner", "server_comment", "option_name", "option_value"}).
+				AddRow("remotedb", "postgres_fdw", "postgres", managedComment, "dbname", "data").
+				AddRow("remotedb", "postgres_fdw", "postgres", managedComment, "fetch_size", "500").
+				AddRow("remotedb", "postgres_fdw", "postgres", managedComment, "host", "remotehost").
+				AddRow("remotedb", "postgres_fdw", "postgres", managedComment, "port", "5432"),
+		).
+		RowsWillBeClosed()
+	mock.ExpectQuery(regexp.QuoteMeta(sqlGetUsermaps)).
+		WithArgs("remotedb").
+		WillReturnRows(
+			sqlmock.NewRows([]string{"authorization_identifier", "foreign_server_name", "option_name", "option_value"}).
+				AddRow("certuser", "remotedb", "sslcert", "/certs/client.crt").
+				AddRow("certuser", "remotedb", "user", "remotecert").
+				AddRow("fdw", "remotedb", "password", "s3cret").
+				AddRow("fdw", "remotedb", "user", "remoteuser"),
+		).
+		RowsWillBeClosed()
+	mock.ExpectQuery(regexp.QuoteMeta(sqlGetServerGrantees)).
+		WithArgs("remotedb").
+		WillReturnRows(sqlmock.NewRows([]string{"grantee"}).AddRow("fdw")).
+		RowsWillBeClosed()
+	mock.ExpectQuery(regexp.QuoteMeta(sqlGetForeignSchemas)).
+		WithArgs("remotedb").
+		WillReturnRows(sqlmock.NewRows([]string{"foreign_table_schema", "foreign_server_name", "remote_schema", "schema_comment"})).
+		RowsWillBeClosed()
+	expectNoForeignTables(mock, "remotedb")
+	mock.ExpectClose()
+
+	exported, err := ExportState(context.Background(), db)
+	require.Nil(t, err)
+	require.Len(t, exported.Extensions, 1)
+	require.Len(t, exported.Servers, 1)
+	server := exported.Servers[0]
+	require.Equal(t, "remotehost", server.Host)
+	require.Equal(t, 5432, server.Port)
+	require.Equal(t, "data", server.DB)
+	require.Equal(t, map[string]string{"fetch_size": "500"}, server.Options)
+	require.Equal(t, &model.Grants{Users: []string{"fdw"}}, server.ServerGrants)
+	require.Len(t, server.UserMaps, 2)
+	require.Equal(t, "remotecert", server.UserMaps[0].RemoteUser)
+	require.Equal(t, model.Secret{}, server.UserMaps[0].RemoteSecret)
+	require.Equal(t, map[string]string{"sslcert": "/certs/client.crt"}, server.UserMaps[0].Options)
+	require.Equal(t, model.Secret{FromEnv: "FDW_REMOTEDB_FDW_PASSWORD"}, server.UserMaps[1].RemoteSecret)
+	closeSQLMock(t, db)
+	require.Nil(t, mock.ExpectationsWereMet())
+}
@@ -2,7 +2,6 @@ package util
 
 import (
 	"context"
-	"database/sql"
 	"fmt"
 
 	"github.com/neflyte/fdwctl/lib/database"
@@ -12,16 +11,16 @@ import (
 
 const (
 	sqlGetExtensions   = `SELECT extname, extversion FROM pg_extension`
-	sqlCreateExtension = `CREATE EXTENSION IF NOT EXISTS "%s"`
-	sqlDropExtension   = `DROP EXTENSION IF EXISTS "%s"`
+	sqlCreateExtension = `CREATE EXTENSION IF NOT EXISTS %s`
+	sqlDropExtension   = `DROP EXTENSION IF EXISTS %s`
 )
 
 // GetExtensions returns a list of installed extensions
-func GetExtensions(ctx context.Context, dbConnection *sql.DB) ([]model.Extension, error) {
+func GetExtensions(ctx context.Context, dbConnection database.Executor) ([]model.Extension, error) {
 	log := logger.Log(ctx).
 		WithField("function", "GetExtensions")
 	exts := make([]model.Extension, 0)
-	rows, err := dbConnection.Query(sqlGetExtensions)
+	rows, err := dbConnection.QueryContext(ctx, sqlGetExtensions)
 	if err != nil {
 		log.Errorf("error querying for extensions: %s", err)
 		return nil, err
@@ -78,11 +77,16 @@ func DiffExtensions(dStateExts []model.Extension, dbExts []model.Extension) (ext
 	return
 }
 
+// createExtensionSQL returns the statement that creates the supplied extension
+func createExtensionSQL(ext model.Extension) string {
+	return fmt.Sprintf(sqlCreateExtension, QuoteIdentifier(ext.Name))
+}
+
 // CreateExtension creates a postgres extension in the database
-func CreateExtension(ctx context.Context, dbConnection *sql.DB, ext model.Extension) error {
+func CreateExtension(ctx context.Context, dbConnection database.Executor, ext model.Extension) error {
 	log := logger.Log(ctx).
 		WithField("function", "CreateExtension")
-	_, err := dbConnection.Exec(fmt.Sprintf(sqlCreateExtension, ext.Name))
+	_, err := dbConnection.ExecContext(ctx, createExtensionSQL(ext))
 	if err != nil {
 		return logger.ErrorfAsError(log, "error creating extension %s: %s", ext.Name, err)
 	}
@@ -90,10 +94,10 @@ func CreateExtension(ctx context.Context, dbConnection *sql.DB, ext model.Extens
 }
 
 // DropExtension drops a postgres extension from the database
-func DropExtension(ctx context.Context, dbConnection *sql.DB, ext model.Extension) error {
+func DropExtension(ctx context.Context, dbConnection database.Executor, ext model.Extension) error {
 	log := logger.Log(ctx).
 		WithField("function", "DropExtension")
-	_, err := dbConnection.Exec(fmt.Sprintf(sqlDropExtension, ext.Name))
+	_, err := dbConnection.ExecContext(ctx, fmt.Sprintf(sqlDropExtension, QuoteIdentifier(ext.Name)))
 	if err != nil {
 		return logger.ErrorfAsError(log, "error dropping extension %s: %s", ext.Name, err)
 	}
@@ -0,0 +1,573 @@
+package util
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/neflyte/fdwctl/lib/database"
+	"github.com/neflyte/fdwctl/lib/logger"
+	"github.com/neflyte/fdwctl/lib/model"
+)
+
+const (
+	// sqlDeclaredTableFilter matches the foreign tables, as pg_class rows named c, that were created from their
+	// definition in the desired state
+	sqlDeclaredTableFilter = `COALESCE(obj_description(c.oid, 'pg_class'), '') LIKE '%fdwctl:%"declared":true%'`
+
+	sqlGetImportedTables = `SELECT ft.foreign_table_name
+	FROM information_schema.foreign_tables ft
+	JOIN pg_catalog.pg_namespace n ON n.nspname = ft.foreign_table_schema
+	JOIN pg_catalog.pg_class c ON c.relnamespace = n.oid AND c.relname = ft.foreign_table_name
+	WHERE ft.foreign_table_schema = $1 AND ft.foreign_server_name = $2 AND NOT ` + sqlDeclaredTableFilter + `
+	ORDER BY ft.foreign_table_name`
+	sqlGetForeignTables = `SELECT s.srvname, w.fdwname, n.nspname, c.relname, opt.option_name, opt.option_value
+	FROM pg_catalog.pg_foreign_table ft
+	JOIN pg_catalog.pg_class c ON c.oid = ft.ftrelid
+	JOIN pg_catalog.pg_namespace n ON n.oid = c.relnamespace
+	JOIN pg_catalog.pg_foreign_server s ON s.oid = ft.ftserver
+	JOIN pg_catalog.pg_foreign_data_wrapper w ON w.oid = s.srvfdw
+	LEFT JOIN LATERAL pg_catalog.pg_options_to_table(ft.ftoptions) opt ON true
+	WHERE ` + sqlDeclaredTableFilter
+	sqlGetForeignTablesOrder  = `ORDER BY s.srvname, n.nspname, c.relname, opt.option_name`
+	sqlGetForeignTableColumns = `SELECT s.srvname, n.nspname, c.relname, a.attname, pg_catalog.format_type(a.atttypid, a.atttypmod), a.attnotnull,
+	opt.option_name, opt.option_value
+	FROM pg_catalog.pg_foreign_table ft
+	JOIN pg_catalog.pg_class c ON c.oid = ft.ftrelid
+	JOIN pg_catalog.pg_namespace n ON n.oid = c.relnamespace
+	JOIN pg_catalog.pg_foreign_server s ON s.oid = ft.ftserver
+	JOIN pg_catalog.pg_attribute a ON a.attrelid = c.oid AND a.attnum > 0 AND NOT a.attisdropped
+	LEFT JOIN LATERAL pg_catalog.pg_options_to_table(a.attfdwoptions) opt ON true
+	WHERE ` + sqlDeclaredTableFilter
+	sqlGetForeignTableColumnsOrder = `ORDER BY s.srvname, n.nspname, c.relname, a.attnum, opt.option_name`
+	sqlForeignTablesConstraint     = `AND s.srvname = $1`
+	sqlDropForeignTable            = `DROP FOREIGN TABLE IF EXISTS %s`
+	sqlCreateForeignTable          = `CREATE FOREIGN TABLE %s (%s) SERVER %s`
+	sqlAlterForeignTable           = `ALTER FOREIGN TABLE %s %s`
+)
+
+var (
+	// columnTypeAliases maps the alternative names of built-in types to the names format_type reports them with
+	columnTypeAliases = map[string]string{
+		"int":         "integer",
+		"int4":        "integer",
+		"int8":        "bigint",
+		"int2":        "smallint",
+		"bool":        "boolean",
+		"float":       "double precision",
+		"float8":      "double precision",
+		"float4":      "real",
+		"decimal":     "numeric",
+		"varchar":     "character varying",
+		"char":        "character",
+		"bpchar":      "character",
+		"varbit":      "bit varying",
+		"timestamp":   "timestamp without time zone",
+		"timestamptz": "timestamp with time zone",
+		"time":        "time without time zone",
+		"timetz":      "time with time zone",
+	}
+)
+
+// getImportedTables returns the names of the foreign tables of the named server in the local schema that were
+// imported rather than created from their definition in the desired state
+func getImportedTables(ctx context.Context, dbConnection database.Executor, schemaName string, serverName string) ([]string, error) {
+	log := logger.Log(ctx).
+		WithField("function", "getImportedTables")
+	log.Tracef("query: %s, args: %#v, %#v", sqlGetImportedTables, schemaName, serverName)
+	tableRows, err := dbConnection.QueryContext(ctx, sqlGetImportedTables, schemaName, serverName)
+	if err != nil {
+		log.Errorf("error querying foreign tables: %s", err)
+		return nil, err
+	}
+	defer database.CloseRows(ctx, tableRows)
+	tables := make([]string, 0)
+	var table string
+	for tableRows.Next() {
+		err = tableRows.Scan(&table)
+		if err != nil {
+			log.Errorf("error scanning result row: %s", err)
+			return nil, err
+		}
+		tables = append(tables, table)
+	}
+	if tableRows.Err() != nil {
+		log.Errorf("error iterating result rows: %s", tableRows.Err())
+		return nil, tableRows.Err()
+	}
+	return tables, nil
+}
+
+// dropForeignTableSQL returns the statement that drops a foreign table of the local schema
+func dropForeignTableSQL(schemaName string, tableName string) string {
+	return fmt.Sprintf(sqlDropForeignTable, QuoteQualifiedIdentifier(schemaName, tableName))
+}
+
+// ValidateForeignTable determines if the supplied foreign table definition is complete: it must have a local schema,
+// a name, and at least one column, and every column must have a unique name and a type
+func ValidateForeignTable(table model.ForeignTable) error {
+	if table.LocalSchema == "" || table.Name == "" {
+		return fmt.Errorf("foreign table %q: local schema and name are required", table.QualifiedName())
+	}
+	if len(table.Columns) == 0 {
+		return fmt.Errorf("foreign table %s: at least one column is required", table.QualifiedName())
+	}
+	columnNames := make([]string, 0, len(table.Columns))
+	for _, column := range table.Columns {
+		if column.Name == "" || strings.TrimSpace(column.Type) == "" {
+			return fmt.Errorf("foreign table %s: every column requires a name and a type", table.QualifiedName())
+		}
+		if containsString(columnNames, column.Name) {
+			return fmt.Errorf("foreign table %s: column %s is defined more than once", table.QualifiedName(), column.Name)
+		}
+		columnNames = append(columnNames, column.Name)
+	}
+	return nil
+}
+
+// FindForeignTable returns the foreign table with the supplied local schema and name in the list, or nil if there is
+// no such foreign table
+func FindForeignTable(tables []model.ForeignTable, localSchema string, name string) *model.ForeignTable {
+	for idx := range tables {
+		if tables[idx].LocalSchema == localSchema && tables[idx].Name == name {
+			return &tables[idx]
+		}
+	}
+	return nil
+}
+
+// DiffForeignTables returns the foreign tables that are only in the database, the ones that are only in the desired
+// state, and the desired state foreign tables that are in both
+func DiffForeignTables(dStateTables []model.ForeignTable, dbTables []model.ForeignTable) (ftRemove []model.ForeignTable, ftAdd []model.ForeignTable, ftModify []model.ForeignTable) {
+	ftRemove = make([]model.ForeignTable, 0)
+	ftAdd = make([]model.ForeignTable, 0)
+	ftModify = make([]model.ForeignTable, 0)
+	for _, dbTable := range dbTables {
+		if FindForeignTable(dStateTables, dbTable.LocalSchema, dbTable.Name) == nil {
+			ftRemove = append(ftRemove, dbTable)
+		}
+	}
+	for _, dStateTable := range dStateTables {
+		if FindForeignTable(dbTables, dStateTable.LocalSchema, dStateTable.Name) == nil {
+			ftAdd = append(ftAdd, dStateTable)
+		} else {
+			ftModify = append(ftModify, dStateTable)
+		}
+	}
+	return
+}
+
+// GetForeignTables returns the foreign tables of the named server, or of every server when the name is empty, that
+// were created from their definition in the desired state. Foreign tables imported with a foreign schema are not
+// returned.
+func GetForeignTables(ctx context.Context, dbConnection database.Executor, serverName string) ([]model.ForeignTable, error) {
+	log := logger.Log(ctx).
+		WithField("function", "GetForeignTables")
+	query := sqlGetForeignTables
+	qArgs := make([]interface{}, 0)
+	if serverName != "" {
+		query = fmt.Sprintf("%s %s", query, sqlForeignTablesConstraint)
+		qArgs = append(qArgs, serverName)
+	}
+	query = fmt.Sprintf("%s %s", query, sqlGetForeignTablesOrder)
+	log.Tracef("query: %s, args: %#v", query, qArgs)
+	tableRows, err := dbConnection.QueryContext(ctx, query, qArgs...)
+	if err != nil {
+		log.Errorf("error querying foreign tables: %s", err)
+		return nil, err
+	}
+	defer database.CloseRows(ctx, tableRows)
+	tables := make([]model.ForeignTable, 0)
+	var tableServer, wrapper, tableSchema, tableName string
+	var optionName, optionValue sql.NullString
+	for tableRows.Next() {
+		err = tableRows.Scan(&tableServer, &wrapper, &tableSchema, &tableName, &optionName, &optionValue)
+		if err != nil {
+			log.Errorf("error scanning result row: %s", err)
+			return nil, err
+		}
+		// Rows are ordered by server, schema, and table so the options of a table are always on consecutive rows
+		if len(tables) == 0 || tables[len(tables)-1].ServerName != tableServer ||
+			tables[len(tables)-1].LocalSchema != tableSchema || tables[len(tables)-1].Name != tableName {
+			tables = append(tables, model.ForeignTable{
+				ServerName:  tableServer,
+				LocalSchema: tableSchema,
+				Name:        tableName,
+				Columns:     make([]model.Column, 0),
+			})
+		}
+		if optionName.Valid {
+			setForeignTableOption(&tables[len(tables)-1], wrapper, optionName.String, optionValue.String)
+		}
+	}
+	if tableRows.Err() != nil {
+		log.Errorf("error iterating result rows: %s", tableRows.Err())
+		return nil, tableRows.Err()
+	}
+	err = getForeignTableColumns(ctx, dbConnection, serverName, tables)
+	if err != nil {
+		return nil, err
+	}
+	return tables, nil
+}
+
+// getForeignTableColumns reads the columns, with their options, of the foreign tables of the named server, or of
+// every server when the name is empty, into the matching foreign tables of the supplied list
+func getForeignTableColumns(ctx context.Context, dbConnection database.Executor, serverName string, tables []model.ForeignTable) error {
+	log := logger.Log(ctx).
+		WithField("function", "getForeignTableColumns")
+	query := sqlGetForeignTableColumns
+	qArgs := make([]interface{}, 0)
+	if serverName != "" {
+		query = fmt.Sprintf("%s %s", query, sqlForeignTablesConstraint)
+		qArgs = append(qArgs, serverName)
+	}
+	query = fmt.Sprintf("%s %s", query, sqlGetForeignTableColumnsOrder)
+	log.Tracef("query: %s, args: %#v", query, qArgs)
+	columnRows, err := dbConnection.QueryContext(ctx, query, qArgs...)
+	if err != nil {
+		log.Errorf("error querying foreign table columns: %s", err)
+		return err
+	}
+	defer database.CloseRows(ctx, columnRows)
+	var tableServer, tableSchema, tableName string
+	var optionName, optionValue sql.NullString
+	for columnRows.Next() {
+		column := model.Column{}
+		err = columnRows.Scan(&tableServer, &tableSchema, &tableName, &column.Name, &column.Type, &column.NotNull, &optionName, &optionValue)
+		if err != nil {
+			log.Errorf("error scanning result row: %s", err)
+			return err
+		}
+		table := FindForeignTable(tables, tableSchema, tableName)
+		if table == nil || table.ServerName != tableServer {
+			continue
+		}
+		// Rows are ordered by column position so the options of a column are always on consecutive rows
+		if len(table.Columns) == 0 || table.Columns[len(table.Columns)-1].Name != column.Name {
+			table.Columns = append(table.Columns, column)
+		}
+		if optionName.Valid {
+			lastColumn := &table.Columns[len(table.Columns)-1]
+			if lastColumn.Options == nil {
+				lastColumn.Options = make(map[string]string)
+			}
+			lastColumn.Options[optionName.String] = optionValue.String
+		}
+	}
+	if columnRows.Err() != nil {
+		log.Errorf("error iterating result rows: %s", columnRows.Err())
+		return columnRows.Err()
+	}
+	return nil
+}
+
+// setForeignTableOption stores a foreign table option from the catalog in the supplied foreign table. The options
+// that name the remote schema and table for the foreign data wrapper are stored in RemoteSchema and RemoteTable and
+// all other options are stored in the Options map.
+func setForeignTableOption(table *model.ForeignTable, wrapper string, optionName string, optionValue string) {
+	tableOptions := remoteTableOptionsOf(wrapper)
+	switch optionName {
+	case tableOptions.schema:
+		table.RemoteSchema = optionValue
+	case tableOptions.table:
+		table.RemoteTable = optionValue
+	default:
+		if table.Options == nil {
+			table.Options = make(map[string]string)
+		}
+		table.Options[optionName] = optionValue
+	}
+}
+
+// foreignTableOptions returns all options of the supplied foreign table, including the ones that name the remote
+// schema and table for the foreign data wrapper, keyed by option name
+func foreignTableOptions(table model.ForeignTable, wrapper string) map[string]string {
+	options := copyOptions(table.Options)
+	tableOptions := remoteTableOptionsOf(wrapper)
+	if table.RemoteSchema != "" {
+		options[tableOptions.schema] = table.RemoteSchema
+	}
+	if table.RemoteTable != "" {
+		options[tableOptions.table] = table.RemoteTable
+	}
+	return options
+}
+
+// columnDefinitionSQL returns the definition of a column of a foreign table as it appears in CREATE FOREIGN TABLE and
+// in the ADD COLUMN action of ALTER FOREIGN TABLE
+func columnDefinitionSQL(column model.Column) string {
+	definition := fmt.Sprintf("%s %s", QuoteIdentifier(column.Name), column.Type)
+	if len(column.Options) > 0 {
+		definition = fmt.Sprintf("%s OPTIONS (%s)", definition, optionsClause(column.Options))
+	}
+	if column.NotNull {
+		definition = fmt.Sprintf("%s NOT NULL", definition)
+	}
+	return definition
+}
+
+// createForeignTableSQL returns the statement that creates the supplied foreign table with its columns and options
+func createForeignTableSQL(table model.ForeignTable, wrapper string) string {
+	columns := make([]string, len(table.Columns))
+	for idx, column := range table.Columns {
+		columns[idx] = columnDefinitionSQL(column)
+	}
+	query := fmt.Sprintf(sqlCreateForeignTable, QuoteQualifiedIdentifier(table.LocalSchema, table.Name), strings.Join(columns, ", "), QuoteIdentifier(table.ServerName))
+	options := foreignTableOptions(table, wrapper)
+	if len(options) == 0 {
+		return query
+	}
+	return fmt.Sprintf("%s OPTIONS (%s)", query, optionsClause(options))
+}
+
+// declaredTableCommentSQL returns the statement that marks a foreign table as created from its definition in the
+// desired state
+func declaredTableCommentSQL(table model.ForeignTable) string {
+	return commentOnForeignTableSQL(table.LocalSchema, table.Name, objectMetadata{Declared: true})
+}
+
+// alterForeignTableSQL returns the statement that changes the database foreign table dbTable into the supplied foreign
+// table. An empty string is returned if they are the same. Since the columns of a foreign table cannot be reordered,
+// recreate is true when the columns the two tables share are in a different order or when a new column does not come
+// after them; the foreign table must then be dropped and created again.
+func alterForeignTableSQL(table model.ForeignTable, dbTable model.ForeignTable, wrapper string) (query string, recreate bool) {
+	actions := make([]string, 0)
+	expectedOrder := make([]string, 0, len(table.Columns))
+	for _, dbColumn := range dbTable.Columns {
+		column := findColumn(table.Columns, dbColumn.Name)
+		if column == nil {
+			actions = append(actions, fmt.Sprintf("DROP COLUMN %s", QuoteIdentifier(dbColumn.Name)))
+			continue
+		}
+		expectedOrder = append(expectedOrder, column.Name)
+		quotedName := QuoteIdentifier(column.Name)
+		if normalizeColumnType(column.Type) != normalizeColumnType(dbColumn.Type) {
+			actions = append(actions, fmt.Sprintf("ALTER COLUMN %s TYPE %s", quotedName, column.Type))
+		}
+		if column.NotNull != dbColumn.NotNull {
+			if column.NotNull {
+				actions = append(actions, fmt.Sprintf("ALTER COLUMN %s SET NOT NULL", quotedName))
+			} else {
+				actions = append(actions, fmt.Sprintf("ALTER COLUMN %s DROP NOT NULL", quotedName))
+			}
+		}
+		if changes := diffOptions(column.Options, dbColumn.Options); len(changes) > 0 {
+			actions = append(actions, fmt.Sprintf("ALTER COLUMN %s OPTIONS (%s)", quotedName, optionChangesClause(changes)))
+		}
+	}
+	for _, column := range table.Columns {
+		if findColumn(dbTable.Columns, column.Name) == nil {
+			expectedOrder = append(expectedOrder, column.Name)
+			actions = append(actions, fmt.Sprintf("ADD COLUMN %s", columnDefinitionSQL(column)))
+		}
+	}
+	for idx, column := range table.Columns {
+		if expectedOrder[idx] != column.Name {
+			return "", true
+		}
+	}
+	if changes := diffOptions(foreignTableOptions(table, wrapper), foreignTableOptions(dbTable, wrapper)); len(changes) > 0 {
+		actions = append(actions, fmt.Sprintf("OPTIONS (%s)", optionChangesClause(changes)))
+	}
+	if len(actions) == 0 {
+		return "", false
+	}
+	return fmt.Sprintf(sqlAlterForeignTable, QuoteQualifiedIdentifier(table.LocalSchema, table.Name), strings.Join(actions, ", ")), false
+}
+
+// findColumn returns the column with the supplied name in the list, or nil if there is no such column
+func findColumn(columns []model.Column, name string) *model.Column {
+	for idx := range columns {
+		if columns[idx].Name == name {
+			return &columns[idx]
+		}
+	}
+	return nil
+}
+
+// CreateForeignTable creates the local schema of the supplied foreign table if it does not exist and then creates the
+// foreign table and marks it as defined in the desired state
+func CreateForeignTable(ctx context.Context, dbConnection database.Executor, table model.ForeignTable) error {
+	log := logger.Log(ctx).
+		WithField("function", "CreateForeignTable")
+	if table.ServerName == "" {
+		return logger.ErrorfAsError(log, "server name is required")
+	}
+	err := ValidateForeignTable(table)
+	if err != nil {
+		return logger.ErrorfAsError(log, "invalid foreign table: %s", err)
+	}
+	server, err := getForeignServer(ctx, dbConnection, table.ServerName)
+	if err != nil {
+		log.Errorf("error getting foreign server %s: %s", table.ServerName, err)
+		return err
+	}
+	err = ensureSchema(ctx, dbConnection, table.LocalSchema)
+	if err != nil {
+		log.Errorf("error ensuring local schema %s exists: %s", table.LocalSchema, err)
+		return err
+	}
+	for _, query := range []string{createForeignTableSQL(table, server.WrapperName()), declaredTableCommentSQL(table)} {
+		log.Tracef("query: %s", query)
+		_, err = dbConnection.ExecContext(ctx, query)
+		if err != nil {
+			log.Errorf("error creating foreign table %s: %s", table.QualifiedName(), err)
+			return err
+		}
+	}
+	return nil
+}
+
+// AlterForeignTable changes an existing foreign table that was defined in the desired state to match the supplied
+// foreign table. The foreign table is dropped and created again when its columns cannot be altered into place.
+func AlterForeignTable(ctx context.Context, dbConnection database.Executor, table model.ForeignTable) error {
+	log := logger.Log(ctx).
+		WithField("function", "AlterForeignTable")
+	if table.ServerName == "" {
+		return logger.ErrorfAsError(log, "server name is required")
+	}
+	err := ValidateForeignTable(table)
+	if err != nil {
+		return logger.ErrorfAsError(log, "invalid foreign table: %s", err)
+	}
+	server, err := getForeignServer(ctx, dbConnection, table.ServerName)
+	if err != nil {
+		log.Errorf("error getting foreign server %s: %s", table.ServerName, err)
+		return err
+	}
+	dbTables, err := GetForeignTables(ctx, dbConnection, table.ServerName)
+	if err != nil {
+		log.Errorf("error getting foreign tables of server %s: %s", table.ServerName, err)
+		return err
+	}
+	dbTable := FindForeignTable(dbTables, table.LocalSchema, table.Name)
+	if dbTable == nil {
+		return logger.ErrorfAsError(log, "foreign table %s on server %s does not exist", table.QualifiedName(), table.ServerName)
+	}
+	query, recreate := alterForeignTableSQL(table, *dbTable, server.WrapperName())
+	if recreate {
+		log.Debugf("columns of foreign table %s were reordered; re-creating it", table.QualifiedName())
+		err = DropForeignTable(ctx, dbConnection, table, false)
+		if err != nil {
+			return err
+		}
+		return CreateForeignTable(ctx, dbConnection, table)
+	}
+	if query == "" {
+		log.Debugf("foreign table %s is unchanged", table.QualifiedName())
+		return nil
+	}
+	log.Tracef("query: %s", query)
+	_, err = dbConnection.ExecContext(ctx, query)
+	if err != nil {
+		log.Errorf("error altering foreign table %s: %s", table.QualifiedName(), err)
+		return err
+	}
+	return nil
+}
+
+// DropForeignTable drops the supplied foreign table if it exists, along with the objects that depend on it when
+// cascadeDrop is true
+func DropForeignTable(ctx context.Context, dbConnection database.Executor, table model.ForeignTable, cascadeDrop bool) error {
+	log := logger.Log(ctx).
+		WithField("function", "DropForeignTable")
+	if table.LocalSchema == "" || table.Name == "" {
+		return logger.ErrorfAsError(log, "local schema and foreign table name are required")
+	}
+	query := dropForeignTableSQL(table.LocalSchema, table.Name)
+	if cascadeDrop {
+		query = fmt.Sprintf("%s CASCADE", query)
+	}
+	log.Tracef("query: %s", query)
+	_, err := dbConnection.ExecContext(ctx, query)
+	if err != nil {
+		log.Errorf("error dropping foreign table %s: %s", table.QualifiedName(), err)
+		return err
+	}
+	return nil
+}
+
+// normalizeColumnType returns the supplied column type the way format_type reports it so that a type written with an
+// alias, such as int or varchar(20), compares equal to the type of a column read from the catalog
+func normalizeColumnType(columnType string) string {
+	normalized := strings.ToLower(strings.Join(strings.Fields(columnType), " "))
+	arraySuffix := ""
+	for strings.HasSuffix(normalized, "[]") {
+		normalized = strings.TrimSuffix(normalized, "[]")
+		arraySuffix += "[]"
+	}
+	typeName, modifier := normalized, ""
+	if idx := strings.Index(normalized, "("); idx >= 0 && strings.HasSuffix(normalized, ")") {
+		typeName, modifier = strings.TrimSpace(normalized[:idx]), strings.ReplaceAll(normalized[idx:], " ", "")
+	}
+	if alias, ok := columnTypeAliases[typeName]; ok {
+		typeName = alias
+	}
+	// format_type puts the precision of a time type before its time zone (e.g. timestamp(3) with time zone)
+	if baseName, timeZone, found := strings.Cut(typeName, " with"); found && modifier != "" {
+		return fmt.Sprintf("%s%s with%s%s", baseName, modifier, timeZone, arraySuffix)
+	}
+	return fmt.Sprintf("%s%s%s", typeName, modifier, arraySuffix)
+}
+
+// normalizeForeignTable returns a copy of the supplied foreign table whose column types are named the way format_type
+// reports them
+func normalizeForeignTable(table model.ForeignTable) model.ForeignTable {
+	columns := make([]model.Column, len(table.Columns))
+	for idx, column := range table.Columns {
+		column.Type = normalizeColumnType(column.Type)
+		columns[idx] = column
+	}
+	table.Columns = columns
+	return table
+}
+
+// ParseColumnDefinition returns the column described by a definition of the form `name type [NOT NULL]`, e.g.
+// `total numeric(12,2) NOT NULL`
+func ParseColumnDefinition(definition string) (model.Column, error) {
+	fields := strings.Fields(definition)
+	if len(fields) < 2 {
+		return model.Column{}, fmt.Errorf("invalid column %q; expected name and type", definition)
+	}
+	column := model.Column{Name: fields[0]}
+	typeFields := fields[1:]
+	if len(typeFields) > 2 && strings.EqualFold(strings.Join(typeFields[len(typeFields)-2:], " "), "NOT NULL") {
+		column.NotNull = true
+		typeFields = typeFields[:len(typeFields)-2]
+	}
+	column.Type = strings.Join(typeFields, " ")
+	return column, nil
+}
+
+// ApplyForeignTableOptionChanges sets each `key=value` option in setOptions on the supplied foreign table and each
+// `column:key=value` option in setColumnOptions on the named column of the foreign table
+func ApplyForeignTableOptionChanges(table *model.ForeignTable, setOptions []string, setColumnOptions []string) error {
+	// Copy the options before changing them so that the maps of the original foreign table are unaffected
+	table.Options = copyOptions(table.Options)
+	for _, setOption := range setOptions {
+		optionName, optionValue, found := strings.Cut(setOption, "=")
+		optionName = strings.TrimSpace(optionName)
+		if !found || optionName == "" {
+			return fmt.Errorf("invalid option %q; expected key=value", setOption)
+		}
+		table.Options[optionName] = optionValue
+	}
+	table.Columns = append(make([]model.Column, 0, len(table.Columns)), table.Columns...)
+	for _, setColumnOption := range setColumnOptions {
+		columnName, option, found := strings.Cut(setColumnOption, ":")
+		optionName, optionValue, hasValue := strings.Cut(option, "=")
+		optionName = strings.TrimSpace(optionName)
+		if !found || !hasValue || optionName == "" {
+			return fmt.Errorf("invalid column option %q; expected column:key=value", setColumnOption)
+		}
+		column := findColumn(table.Columns, strings.TrimSpace(columnName))
+		if column == nil {
+			return fmt.Errorf("invalid column option %q; foreign table has no column %s", setColumnOption, columnName)
+		}
+		column.Options = copyOptions(column.Options)
+		column.Options[optionName] = optionValue
+	}
+	return nil
+}
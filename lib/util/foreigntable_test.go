@@ -0,0 +1,288 @@
+package util
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/neflyte/fdwctl/lib/model"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUnit_importForeignSchemaSQL_TableFilter(t *testing.T) {
+	schema := model.Schema{LocalSchema: "remotedb", RemoteSchema: "public"}
+	require.Equal(t, `IMPORT FOREIGN SCHEMA "public" FROM SERVER "remotedb" INTO "remotedb"`, importForeignSchemaSQL("remotedb", schema))
+	schema.LimitTo = []string{"orders", "Items"}
+	require.Equal(t, `IMPORT FOREIGN SCHEMA "public" LIMIT TO ("orders", "Items") FROM SERVER "remotedb" INTO "remotedb"`, importForeignSchemaSQL("remotedb", schema))
+	schema.LimitTo = nil
+	schema.Except = []string{"audit_log"}
+	require.Equal(t, `IMPORT FOREIGN SCHEMA "public" EXCEPT ("audit_log") FROM SERVER "remotedb" INTO "remotedb"`, importForeignSchemaSQL("remotedb", schema))
+	require.Equal(t, `DROP FOREIGN TABLE IF EXISTS "remotedb"."audit_log"`, dropForeignTableSQL("remotedb", "audit_log"))
+}
+
+func TestUnit_PlanDesiredState_TableFilter(t *testing.T) {
+	db, mock := newSQLMock(t)
+	defer closeSQLMock(t, db)
+
+	mock.ExpectQuery(regexp.QuoteMeta(sqlGetExtensions)).
+		WillReturnRows(sqlmock.NewRows([]string{"extname", "extversion"})).
+		RowsWillBeClosed()
+	mock.ExpectQuery(regexp.QuoteMeta(sqlForeignServerInfo)).
+		WillReturnRows(
+			sqlmock.NewRows([]string{"srvname", "fdwname", "owner", "server_comment", "option_name", "option_value"}).
+				AddRow("remotedb", "postgres_fdw", "postgres", managedComment, "host", "remotehost"),
+		).
+		RowsWillBeClosed()
+	mock.ExpectQuery(regexp.QuoteMeta(sqlGetUsermaps)).
+		WithArgs("remotedb").
+		WillReturnRows(sqlmock.NewRows([]string{"authorization_identifier", "foreign_server_name", "option_name", "option_value"})).
+		RowsWillBeClosed()
+	mock.ExpectQuery(regexp.QuoteMeta(sqlGetServerGrantees)).
+		WithArgs("remotedb").
+		WillReturnRows(sqlmock.NewRows([]string{"grantee"})).
+		RowsWillBeClosed()
+	mock.ExpectQuery(regexp.QuoteMeta(sqlGetForeignSchemas)).
+		WithArgs("remotedb").
+		WillReturnRows(
+			sqlmock.NewRows([]string{"foreign_table_schema", "foreign_server_name", "remote_schema", "schema_comment"}).
+				AddRow("remotedb", "remotedb", "public", ""),
+		).
+		RowsWillBeClosed()
+	mock.ExpectQuery(regexp.QuoteMeta(sqlGetSchemaTables)).
+		WithArgs("remotedb").
+		WillReturnRows(sqlmock.NewRows([]string{"relname"})).
+		RowsWillBeClosed()
+	mock.ExpectQuery(regexp.QuoteMeta(sqlGetSchemaPrivileges)).
+		WithArgs("remotedb").
+		WillReturnRows(sqlmock.NewRows([]string{"kind", "grantee", "table_name", "privilege_type"})).
+		RowsWillBeClosed()
+	expectNoForeignTables(mock, "remotedb")
+	expectCatalog(mock)
+	mock.ExpectQuery(regexp.QuoteMeta(sqlGetImportedTables)).
+		WithArgs("remotedb", "remotedb").
+		WillReturnRows(sqlmock.NewRows([]string{"foreign_table_name"}).AddRow("audit_log").AddRow("orders")).
+		RowsWillBeClosed()
+	expectNoImportedTypes(mock)
+	mock.ExpectClose()
+
+	dState := model.DesiredState{
+		Servers: []model.ForeignServer{
+			{
+				Name: "remotedb",
+				Host: "remotehost",
+				Schemas: []model.Schema{
+					{LocalSchema: "remotedb", RemoteSchema: "public", LimitTo: []string{"items", "orders"}},
+				},
+			},
+		},
+	}
+	plan, err := PlanDesiredState(context.Background(), db, dState, PlanOptions{})
+	require.Nil(t, err)
+	require.Len(t, plan.Actions, 3)
+	require.Equal(t, model.OperationDrop, plan.Actions[0].Operation)
+	require.Equal(t, model.ObjectForeignTable, plan.Actions[0].ObjectType)
+	require.Equal(t, "remotedb.audit_log", plan.Actions[0].ObjectName)
+	require.Equal(t, `DROP FOREIGN TABLE IF EXISTS "remotedb"."audit_log"`, plan.Actions[0].SQL)
+	require.Equal(t, model.OperationImport, plan.Actions[1].Operation)
+	require.Equal(t, `IMPORT FOREIGN SCHEMA "public" LIMIT TO ("items") FROM SERVER "remotedb" INTO "remotedb"`, plan.Actions[1].SQL)
+	require.Equal(t, `COMMENT ON SCHEMA "remotedb" IS 'fdwctl:{"limitTo":["items","orders"],"managed":true}'`, plan.Actions[2].SQL)
+	closeSQLMock(t, db)
+	require.Nil(t, mock.ExpectationsWereMet())
+}
+
+// expectNoForeignTables expects GetForeignTables to read the declared foreign tables of the named server and find none
+func expectNoForeignTables(mock sqlmock.Sqlmock, serverName string) {
+	mock.ExpectQuery(regexp.QuoteMeta(fmt.Sprintf("%s %s %s", sqlGetForeignTables, sqlForeignTablesConstraint, sqlGetForeignTablesOrder))).
+		WithArgs(serverName).
+		WillReturnRows(sqlmock.NewRows([]string{"srvname", "fdwname", "nspname", "relname", "option_name", "option_value"})).
+		RowsWillBeClosed()
+	mock.ExpectQuery(regexp.QuoteMeta(fmt.Sprintf("%s %s %s", sqlGetForeignTableColumns, sqlForeignTablesConstraint, sqlGetForeignTableColumnsOrder))).
+		WithArgs(serverName).
+		WillReturnRows(sqlmock.NewRows([]string{"srvname", "nspname", "relname", "attname", "format_type", "attnotnull", "option_name", "option_value"})).
+		RowsWillBeClosed()
+}
+
+func TestUnit_GetForeignTables(t *testing.T) {
+	db, mock := newSQLMock(t)
+	defer closeSQLMock(t, db)
+
+	mock.ExpectQuery(regexp.QuoteMeta(fmt.Sprintf("%s %s", sqlGetForeignTables, sqlGetForeignTablesOrder))).
+		WillReturnRows(
+			sqlmock.NewRows([]string{"srvname", "fdwname", "nspname", "relname", "option_name", "option_value"}).
+				AddRow("mysql", "mysql_fdw", "legacy", "customers", "dbname", "crm").
+				AddRow("mysql", "mysql_fdw", "legacy", "customers", "table_name", "CUSTOMERS").
+				AddRow("remotedb", "postgres_fdw", "reporting", "daily_totals", "fetch_size", "1000").
+				AddRow("remotedb", "postgres_fdw", "reporting", "daily_totals", "schema_name", "reports"),
+		).
+		RowsWillBeClosed()
+	mock.ExpectQuery(regexp.QuoteMeta(fmt.Sprintf("%s %s", sqlGetForeignTableColumns, sqlGetForeignTableColumnsOrder))).
+		WillReturnRows(
+			sqlmock.NewRows([]string{"srvname", "nspname", "relname", "attname", "format_type", "attnotnull", "option_name", "option_value"}).
+				AddRow("mysql", "legacy", "customers", "id", "integer", true, "column_name", "ID").
+				AddRow("mysql", "legacy", "customers", "name", "text", false, nil, nil).
+				AddRow("remotedb", "reporting", "daily_totals", "day", "date", true, nil, nil),
+		).
+		RowsWillBeClosed()
+	mock.ExpectClose()
+
+	tables, err := GetForeignTables(context.Background(), db, "")
+	require.Nil(t, err)
+	require.Equal(t, []model.ForeignTable{
+		{
+			ServerName:   "mysql",
+			LocalSchema:  "legacy",
+			Name:         "customers",
+			RemoteSchema: "crm",
+			RemoteTable:  "CUSTOMERS",
+			Columns: []model.Column{
+				{Name: "id", Type: "integer", NotNull: true, Options: map[string]string{"column_name": "ID"}},
+				{Name: "name", Type: "text"},
+			},
+		},
+		{
+			ServerName:   "remotedb",
+			LocalSchema:  "reporting",
+			Name:         "daily_totals",
+			RemoteSchema: "reports",
+			Columns:      []model.Column{{Name: "day", Type: "date", NotNull: true}},
+			Options:      map[string]string{"fetch_size": "1000"},
+		},
+	}, tables)
+	closeSQLMock(t, db)
+	require.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestUnit_ValidateForeignTable(t *testing.T) {
+	columns := []model.Column{{Name: "id", Type: "integer"}}
+	require.Nil(t, ValidateForeignTable(model.ForeignTable{LocalSchema: "reporting", Name: "daily_totals", Columns: columns}))
+	require.NotNil(t, ValidateForeignTable(model.ForeignTable{LocalSchema: "reporting", Columns: columns}))
+	require.NotNil(t, ValidateForeignTable(model.ForeignTable{LocalSchema: "reporting", Name: "daily_totals"}))
+	require.NotNil(t, ValidateForeignTable(model.ForeignTable{LocalSchema: "reporting", Name: "daily_totals", Columns: []model.Column{{Name: "id"}}}))
+	require.NotNil(t, ValidateForeignTable(model.ForeignTable{LocalSchema: "reporting", Name: "daily_totals", Columns: append(columns, columns...)}))
+}
+
+func TestUnit_normalizeColumnType(t *testing.T) {
+	require.Equal(t, "integer", normalizeColumnType("INT"))
+	require.Equal(t, "character varying(20)", normalizeColumnType("varchar( 20 )"))
+	require.Equal(t, "character varying(20)", normalizeColumnType("character varying(20)"))
+	require.Equal(t, "timestamp(3) with time zone", normalizeColumnType("timestamptz(3)"))
+	require.Equal(t, "timestamp without time zone", normalizeColumnType("timestamp"))
+	require.Equal(t, "bigint[]", normalizeColumnType("int8[]"))
+	require.Equal(t, "status", normalizeColumnType("status"))
+}
+
+func TestUnit_createForeignTableSQL(t *testing.T) {
+	table := model.ForeignTable{
+		ServerName:  "remotedb",
+		LocalSchema: "reporting",
+		Name:        "daily_totals",
+		RemoteTable: "daily_totals_v",
+		Columns: []model.Column{
+			{Name: "day", Type: "date", NotNull: true},
+			{Name: "total", Type: "numeric(12,2)", Options: map[string]string{"column_name": "sum_total"}},
+		},
+		Options: map[string]string{"fetch_size": "1000"},
+	}
+	require.Equal(
+		t,
+		`CREATE FOREIGN TABLE "reporting"."daily_totals" ("day" date NOT NULL, "total" numeric(12,2) OPTIONS ("column_name" 'sum_total')) SERVER "remotedb" OPTIONS ("fetch_size" '1000', "table_name" 'daily_totals_v')`,
+		createForeignTableSQL(table, model.DefaultWrapper),
+	)
+	require.Equal(t, `COMMENT ON FOREIGN TABLE "reporting"."daily_totals" IS 'fdwctl:{"declared":true}'`, declaredTableCommentSQL(table))
+}
+
+func TestUnit_alterForeignTableSQL(t *testing.T) {
+	dbTable := model.ForeignTable{
+		LocalSchema: "reporting",
+		Name:        "daily_totals",
+		RemoteTable: "daily_totals_v",
+		Columns: []model.Column{
+			{Name: "day", Type: "date", NotNull: true},
+			{Name: "total", Type: "numeric(12,2)", Options: map[string]string{"column_name": "sum_total"}},
+			{Name: "note", Type: "text"},
+		},
+	}
+	query, recreate := alterForeignTableSQL(dbTable, dbTable, model.DefaultWrapper)
+	require.False(t, recreate)
+	require.Empty(t, query)
+	table := model.ForeignTable{
+		LocalSchema: "reporting",
+		Name:        "daily_totals",
+		Columns: []model.Column{
+			{Name: "day", Type: "DATE"},
+			{Name: "total", Type: "numeric(14,2)"},
+			{Name: "region", Type: "varchar(10)", NotNull: true},
+		},
+		Options: map[string]string{"fetch_size": "1000"},
+	}
+	query, recreate = alterForeignTableSQL(table, dbTable, model.DefaultWrapper)
+	require.False(t, recreate)
+	require.Equal(
+		t,
+		`ALTER FOREIGN TABLE "reporting"."daily_totals" ALTER COLUMN "day" DROP NOT NULL, ALTER COLUMN "total" TYPE numeric(14,2), ALTER COLUMN "total" OPTIONS (DROP "column_name"), DROP COLUMN "note", ADD COLUMN "region" varchar(10) NOT NULL, OPTIONS (ADD "fetch_size" '1000', DROP "table_name")`,
+		query,
+	)
+	table.Columns = []model.Column{{Name: "total", Type: "numeric(12,2)"}, {Name: "day", Type: "date", NotNull: true}}
+	_, recreate = alterForeignTableSQL(table, dbTable, model.DefaultWrapper)
+	require.True(t, recreate)
+}
+
+func TestUnit_planner_planForeignTables(t *testing.T) {
+	db, mock := newSQLMock(t)
+	defer closeSQLMock(t, db)
+
+	mock.ExpectQuery(regexp.QuoteMeta(sqlGetSchemaComment)).
+		WithArgs("reporting").
+		WillReturnRows(sqlmock.NewRows([]string{"1"})).
+		RowsWillBeClosed()
+	mock.ExpectClose()
+
+	columns := []model.Column{{Name: "day", Type: "date", NotNull: true}}
+	server := model.ForeignServer{
+		Name: "remotedb",
+		ForeignTables: []model.ForeignTable{
+			{LocalSchema: "reporting", Name: "daily_totals", Columns: columns},
+			{LocalSchema: "legacy", Name: "customers", Columns: []model.Column{{Name: "id", Type: "int"}}},
+		},
+	}
+	dbTables := []model.ForeignTable{
+		{ServerName: "remotedb", LocalSchema: "legacy", Name: "customers", Columns: []model.Column{{Name: "id", Type: "integer"}}},
+		{ServerName: "remotedb", LocalSchema: "legacy", Name: "orders", Columns: columns},
+	}
+	p := newPlanner(db, PlanOptions{})
+	require.Nil(t, p.planForeignTables(context.Background(), server, dbTables))
+	statements := make([]string, 0)
+	for _, action := range p.plan.Actions {
+		statements = append(statements, action.SQL)
+	}
+	require.Equal(t, []string{
+		`DROP FOREIGN TABLE IF EXISTS "legacy"."orders"`,
+		`CREATE SCHEMA "reporting"`,
+		`CREATE FOREIGN TABLE "reporting"."daily_totals" ("day" date NOT NULL) SERVER "remotedb"`,
+		`COMMENT ON FOREIGN TABLE "reporting"."daily_totals" IS 'fdwctl:{"declared":true}'`,
+	}, statements)
+	closeSQLMock(t, db)
+	require.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestUnit_ParseColumnDefinition(t *testing.T) {
+	column, err := ParseColumnDefinition("total numeric(12,2) not null")
+	require.Nil(t, err)
+	require.Equal(t, model.Column{Name: "total", Type: "numeric(12,2)", NotNull: true}, column)
+	column, err = ParseColumnDefinition("created_at timestamp with time zone")
+	require.Nil(t, err)
+	require.Equal(t, model.Column{Name: "created_at", Type: "timestamp with time zone"}, column)
+	_, err = ParseColumnDefinition("total")
+	require.NotNil(t, err)
+}
+
+func TestUnit_ApplyForeignTableOptionChanges(t *testing.T) {
+	table := model.ForeignTable{Columns: []model.Column{{Name: "id", Type: "integer"}}}
+	require.Nil(t, ApplyForeignTableOptionChanges(&table, []string{"fetch_size=1000"}, []string{"id:column_name=ID"}))
+	require.Equal(t, map[string]string{"fetch_size": "1000"}, table.Options)
+	require.Equal(t, map[string]string{"column_name": "ID"}, table.Columns[0].Options)
+	require.NotNil(t, ApplyForeignTableOptionChanges(&table, nil, []string{"missing:column_name=ID"}))
+	require.NotNil(t, ApplyForeignTableOptionChanges(&table, nil, []string{"column_name=ID"}))
+}
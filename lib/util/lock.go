@@ -0,0 +1,178 @@
+package util
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/neflyte/fdwctl/lib/database"
+	"github.com/neflyte/fdwctl/lib/logger"
+)
+
+const (
+	// DefaultLockKey is the key of the advisory lock fdwctl takes before changing the database; it spells "fdwctl"
+	DefaultLockKey int64 = 0x66647763746c
+
+	sqlTryAdvisoryLock    = `SELECT pg_try_advisory_lock($1)`
+	sqlAdvisoryUnlock     = `SELECT pg_advisory_unlock($1)`
+	sqlSetApplicationName = `SELECT set_config('application_name', $1, false) WHERE current_setting('application_name') = ''`
+	// sqlAdvisoryLockHolder finds the session holding a bigint advisory lock, which postgres records as the high and
+	// low 32 bits of the key in classid and objid
+	sqlAdvisoryLockHolder = `SELECT a.pid, COALESCE(a.application_name, '')
+	FROM pg_catalog.pg_locks l
+	JOIN pg_catalog.pg_stat_activity a ON a.pid = l.pid
+	WHERE l.locktype = 'advisory' AND l.granted AND l.objsubid = 1
+	AND l.classid::bigint = $1 AND l.objid::bigint = $2`
+
+	// lockApplicationName is the application name of the session that holds the lock when the connection does not set one
+	lockApplicationName = "fdwctl"
+	// lockPollInterval is how long to wait between attempts to take an advisory lock that is held by another session
+	lockPollInterval = time.Second
+)
+
+// AdvisoryLock is a session-level advisory lock on the FDW database. It is held on a connection of its own until it
+// is released, so the other statements of a command may use any connection.
+type AdvisoryLock struct {
+	conn *sql.Conn
+	key  int64
+}
+
+// AcquireAdvisoryLock takes the advisory lock with the supplied key, waiting up to the timeout for another session to
+// release it; a timeout of zero waits indefinitely. When the timeout expires, the error names the process ID and
+// application name of the session that holds the lock.
+func AcquireAdvisoryLock(ctx context.Context, dbConnection *sql.DB, key int64, timeout time.Duration) (*AdvisoryLock, error) {
+	log := logger.Log(ctx).
+		WithField("function", "AcquireAdvisoryLock")
+	conn, err := dbConnection.Conn(ctx)
+	if err != nil {
+		return nil, logger.ErrorfAsError(log, "error getting database connection for advisory lock: %s", err)
+	}
+	applicationName := lockApplicationName
+	hostname, err := os.Hostname()
+	if err == nil && hostname != "" {
+		applicationName = fmt.Sprintf("%s@%s", lockApplicationName, hostname)
+	}
+	log.Tracef("query: %s, args: %#v", sqlSetApplicationName, applicationName)
+	_, err = conn.ExecContext(ctx, sqlSetApplicationName, applicationName)
+	if err != nil {
+		closeLockConnection(ctx, conn)
+		return nil, logger.ErrorfAsError(log, "error setting application name: %s", err)
+	}
+	deadline := time.Now().Add(timeout)
+	var acquired bool
+	var holder string
+	for {
+		acquired, err = tryAdvisoryLock(ctx, conn, key)
+		if err != nil {
+			closeLockConnection(ctx, conn)
+			return nil, err
+		}
+		if acquired {
+			log.Debugf("acquired advisory lock %d", key)
+			return &AdvisoryLock{conn: conn, key: key}, nil
+		}
+		if timeout > 0 && !time.Now().Before(deadline) {
+			holder, err = advisoryLockHolder(ctx, conn, key)
+			closeLockConnection(ctx, conn)
+			if err != nil {
+				return nil, err
+			}
+			return nil, logger.ErrorfAsError(log, "timed out after %s waiting for advisory lock %d held by %s", timeout, key, holder)
+		}
+		log.Infof("advisory lock %d is held by another session; waiting for it", key)
+		select {
+		case <-ctx.Done():
+			closeLockConnection(ctx, conn)
+			return nil, logger.ErrorfAsError(log, "error waiting for advisory lock %d: %s", key, ctx.Err())
+		case <-time.After(lockPollInterval):
+		}
+	}
+}
+
+// Release releases the advisory lock and the connection it is held on
+func (l *AdvisoryLock) Release(ctx context.Context) {
+	log := logger.Log(ctx).
+		WithField("function", "Release")
+	if l == nil || l.conn == nil {
+		return
+	}
+	log.Tracef("query: %s, args: %#v", sqlAdvisoryUnlock, l.key)
+	_, err := l.conn.ExecContext(ctx, sqlAdvisoryUnlock, l.key)
+	if err != nil {
+		// The lock is still released when the database connection is closed
+		log.Errorf("error releasing advisory lock %d: %s", l.key, err)
+	}
+	closeLockConnection(ctx, l.conn)
+	l.conn = nil
+}
+
+// tryAdvisoryLock attempts to take the advisory lock with the supplied key without waiting
+func tryAdvisoryLock(ctx context.Context, dbConnection database.Executor, key int64) (bool, error) {
+	log := logger.Log(ctx).
+		WithField("function", "tryAdvisoryLock")
+	log.Tracef("query: %s, args: %#v", sqlTryAdvisoryLock, key)
+	rows, err := dbConnection.QueryContext(ctx, sqlTryAdvisoryLock, key)
+	if err != nil {
+		return false, logger.ErrorfAsError(log, "error taking advisory lock %d: %s", key, err)
+	}
+	defer database.CloseRows(ctx, rows)
+	acquired := false
+	if rows.Next() {
+		err = rows.Scan(&acquired)
+		if err != nil {
+			log.Errorf("error scanning result row: %s", err)
+			return false, err
+		}
+	}
+	if rows.Err() != nil {
+		log.Errorf("error iterating result rows: %s", rows.Err())
+		return false, rows.Err()
+	}
+	return acquired, nil
+}
+
+// advisoryLockHolder returns a description of the session that holds the advisory lock with the supplied key
+func advisoryLockHolder(ctx context.Context, dbConnection database.Executor, key int64) (string, error) {
+	log := logger.Log(ctx).
+		WithField("function", "advisoryLockHolder")
+	classID := int64(uint64(key) >> 32)
+	objID := int64(uint64(key) & 0xffffffff)
+	log.Tracef("query: %s, args: %#v, %#v", sqlAdvisoryLockHolder, classID, objID)
+	rows, err := dbConnection.QueryContext(ctx, sqlAdvisoryLockHolder, classID, objID)
+	if err != nil {
+		log.Errorf("error querying advisory lock holder: %s", err)
+		return "", err
+	}
+	defer database.CloseRows(ctx, rows)
+	var pid int
+	var applicationName string
+	if !rows.Next() {
+		if rows.Err() != nil {
+			log.Errorf("error iterating result rows: %s", rows.Err())
+			return "", rows.Err()
+		}
+		// The holder released the lock after the last attempt to take it
+		return "a session that has since released it", nil
+	}
+	err = rows.Scan(&pid, &applicationName)
+	if err != nil {
+		log.Errorf("error scanning result row: %s", err)
+		return "", err
+	}
+	if applicationName == "" {
+		return fmt.Sprintf("pid %d", pid), nil
+	}
+	return fmt.Sprintf("pid %d (application_name %s)", pid, applicationName), nil
+}
+
+// closeLockConnection returns the connection of an advisory lock to the pool and logs any resulting errors
+func closeLockConnection(ctx context.Context, conn *sql.Conn) {
+	log := logger.Log(ctx).
+		WithField("function", "closeLockConnection")
+	err := conn.Close()
+	if err != nil {
+		log.Errorf("error closing advisory lock connection: %s", err)
+	}
+}
@@ -0,0 +1,62 @@
+package util
+
+import (
+	"context"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUnit_AcquireAdvisoryLock_Nominal(t *testing.T) {
+	db, mock := newSQLMock(t)
+	defer closeSQLMock(t, db)
+
+	mock.ExpectExec(regexp.QuoteMeta(sqlSetApplicationName)).
+		WithArgs(sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(regexp.QuoteMeta(sqlTryAdvisoryLock)).
+		WithArgs(DefaultLockKey).
+		WillReturnRows(sqlmock.NewRows([]string{"pg_try_advisory_lock"}).AddRow(true)).
+		RowsWillBeClosed()
+	mock.ExpectExec(regexp.QuoteMeta(sqlAdvisoryUnlock)).
+		WithArgs(DefaultLockKey).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectClose()
+
+	lock, err := AcquireAdvisoryLock(context.Background(), db, DefaultLockKey, time.Minute)
+	require.Nil(t, err)
+	require.NotNil(t, lock)
+	lock.Release(context.Background())
+	lock.Release(context.Background())
+	closeSQLMock(t, db)
+	require.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestUnit_AcquireAdvisoryLock_Timeout(t *testing.T) {
+	db, mock := newSQLMock(t)
+	defer closeSQLMock(t, db)
+
+	key := int64(0x0000000200000003)
+	mock.ExpectExec(regexp.QuoteMeta(sqlSetApplicationName)).
+		WithArgs(sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(regexp.QuoteMeta(sqlTryAdvisoryLock)).
+		WithArgs(key).
+		WillReturnRows(sqlmock.NewRows([]string{"pg_try_advisory_lock"}).AddRow(false)).
+		RowsWillBeClosed()
+	mock.ExpectQuery(regexp.QuoteMeta(sqlAdvisoryLockHolder)).
+		WithArgs(int64(2), int64(3)).
+		WillReturnRows(sqlmock.NewRows([]string{"pid", "application_name"}).AddRow(4242, "fdwctl@replica-1")).
+		RowsWillBeClosed()
+	mock.ExpectClose()
+
+	lock, err := AcquireAdvisoryLock(context.Background(), db, key, time.Nanosecond)
+	require.Nil(t, lock)
+	require.NotNil(t, err)
+	require.Contains(t, err.Error(), "pid 4242 (application_name fdwctl@replica-1)")
+	closeSQLMock(t, db)
+	require.Nil(t, mock.ExpectationsWereMet())
+}
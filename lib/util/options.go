@@ -0,0 +1,115 @@
+package util
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+const (
+	// optionAdd is the operation that adds an option an object does not have yet
+	optionAdd = "ADD"
+	// optionSet is the operation that changes the value of an existing option
+	optionSet = "SET"
+	// optionDrop is the operation that removes an existing option
+	optionDrop = "DROP"
+)
+
+// optionChange represents a single change in the OPTIONS clause of an ALTER statement
+type optionChange struct {
+	operation string
+	name      string
+	value     string
+}
+
+func (oc optionChange) String() string {
+	if oc.operation == optionDrop {
+		return fmt.Sprintf("%s %s", optionDrop, QuoteIdentifier(oc.name))
+	}
+	return fmt.Sprintf("%s %s %s", oc.operation, QuoteIdentifier(oc.name), QuoteLiteral(oc.value))
+}
+
+// diffOptions returns the changes, ordered by option name, that turn dbOptions into options. Options that are new
+// are added, options whose values differ are set, and options that are no longer present are dropped.
+func diffOptions(options map[string]string, dbOptions map[string]string) []optionChange {
+	changes := make([]optionChange, 0)
+	for _, optionName := range optionNamesOf(options, dbOptions) {
+		optionValue, desired := options[optionName]
+		dbOptionValue, existing := dbOptions[optionName]
+		switch {
+		case desired && !existing:
+			changes = append(changes, optionChange{operation: optionAdd, name: optionName, value: optionValue})
+		case desired && optionValue != dbOptionValue:
+			changes = append(changes, optionChange{operation: optionSet, name: optionName, value: optionValue})
+		case !desired:
+			changes = append(changes, optionChange{operation: optionDrop, name: optionName})
+		}
+	}
+	return changes
+}
+
+// optionChangesClause returns the body of the OPTIONS clause of an ALTER statement that makes the supplied changes
+func optionChangesClause(changes []optionChange) string {
+	return strings.Join(optionChangeClauses(changes), ", ")
+}
+
+// optionChangeClauses returns the clauses, one for each of the supplied changes, of the OPTIONS clause of an ALTER
+// statement
+func optionChangeClauses(changes []optionChange) []string {
+	clauses := make([]string, len(changes))
+	for idx, change := range changes {
+		clauses[idx] = change.String()
+	}
+	return clauses
+}
+
+// optionsClause returns the body of the OPTIONS clause of a CREATE statement with the supplied options ordered by name
+func optionsClause(options map[string]string) string {
+	_, clauses := optionClauses(options)
+	return strings.Join(clauses, ", ")
+}
+
+// optionClauses returns the names of the supplied options ordered by name and the clause of each option in the
+// OPTIONS clause of a CREATE statement
+func optionClauses(options map[string]string) ([]string, []string) {
+	optionNames := optionNamesOf(options, nil)
+	clauses := make([]string, len(optionNames))
+	for idx, optionName := range optionNames {
+		clauses[idx] = fmt.Sprintf("%s %s", QuoteIdentifier(optionName), QuoteLiteral(options[optionName]))
+	}
+	return optionNames, clauses
+}
+
+// optionValuePosition returns the byte offset, in the body of an OPTIONS clause made of the supplied clauses, of the
+// quoted value that ends the clause at clauseIdx
+func optionValuePosition(clauses []string, clauseIdx int, value string) int {
+	position := 0
+	for _, clause := range clauses[:clauseIdx] {
+		position += len(clause) + len(", ")
+	}
+	return position + len(clauses[clauseIdx]) - len(QuoteLiteral(value))
+}
+
+// optionNamesOf returns the sorted names of the options in either of the supplied option maps
+func optionNamesOf(options map[string]string, otherOptions map[string]string) []string {
+	optionNames := make([]string, 0, len(options)+len(otherOptions))
+	for optionName := range options {
+		optionNames = append(optionNames, optionName)
+	}
+	for optionName := range otherOptions {
+		if _, ok := options[optionName]; !ok {
+			optionNames = append(optionNames, optionName)
+		}
+	}
+	sort.Strings(optionNames)
+	return optionNames
+}
+
+// copyOptions returns a copy of the supplied option map
+func copyOptions(options map[string]string) map[string]string {
+	optionsCopy := make(map[string]string, len(options))
+	for optionName, optionValue := range options {
+		optionsCopy[optionName] = optionValue
+	}
+	return optionsCopy
+}
@@ -0,0 +1,1600 @@
+package util
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/neflyte/fdwctl/lib/database"
+	"github.com/neflyte/fdwctl/lib/logger"
+	"github.com/neflyte/fdwctl/lib/model"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// redactedSecretValue is the value that replaces credentials in the displayed SQL of a plan action
+	redactedSecretValue = "********"
+	// planFilePermissions are the file permissions of a saved plan file
+	planFilePermissions = 0o600
+	// minTransactionalAddValueVersion is the first server version, 12, that allows ALTER TYPE ... ADD VALUE inside a
+	// transaction block
+	minTransactionalAddValueVersion = 120000
+
+	sqlServerVersionNum = `SELECT current_setting('server_version_num')::integer`
+)
+
+// PlanOptions configures how a desired state plan is computed
+type PlanOptions struct {
+	// RecreateSchemas indicates that foreign schemas which already exist should be dropped and re-imported
+	RecreateSchemas bool
+	// Prune is the prune mode of the plan: none, owned, or all; an empty mode is owned
+	Prune string
+	// Servers restricts the plan to the foreign servers that match one of these names, glob patterns, or regular
+	// expressions; every server is planned when it is empty
+	Servers []string
+	// Only restricts the plan to these kinds of objects; every kind is planned when it is empty
+	Only []string
+}
+
+// typeKey identifies a local user-defined type by schema and name
+type typeKey struct {
+	schema string
+	name   string
+}
+
+// planner accumulates the actions of a desired state plan and tracks the effect the planned actions will have on
+// local schemas and user-defined types
+type planner struct {
+	dbConnection database.Executor
+	plan         *model.Plan
+	// schemas records whether a local schema will exist once the actions planned so far have been executed
+	schemas map[string]bool
+	// schemaComments are the comments of the local schemas that were read from the database
+	schemaComments map[string]string
+	// types records whether a local user-defined type will exist once the actions planned so far have been executed
+	types map[typeKey]bool
+	// enumValues records the values a local ENUM type will have once the actions planned so far have been executed
+	enumValues map[typeKey][]string
+	// enumDrift records the differences between local and remote ENUM types that cannot be planned
+	enumDrift []model.Drift
+	// importedTypes records the user-defined types fdwctl created and the local schemas they will be imported for
+	// once the actions planned so far have been executed
+	importedTypes []*model.SchemaType
+	// droppedServers records the foreign servers that the plan drops, including the servers it re-creates
+	droppedServers map[string]bool
+	// remoteTypes records the user-defined types the remote schema of each local schema uses, keyed by local schema
+	remoteTypes map[string][]*model.SchemaType
+	// typedTables records the columns of the remote tables that use user-defined types which are created in a type
+	// schema, keyed by local schema and table name
+	typedTables map[string]map[string][]model.Column
+	// ignore lists the names, glob patterns, and regular expressions of the objects the plan never drops
+	ignore []string
+	// currentUser and sessionUser are the roles of the database connection once they have been read
+	currentUser string
+	sessionUser string
+	// managedRoles records the local roles fdwctl created
+	managedRoles map[string]bool
+	opts         PlanOptions
+}
+
+// newPlanner returns a planner with an empty plan
+func newPlanner(dbConnection database.Executor, opts PlanOptions) *planner {
+	return &planner{
+		dbConnection:   dbConnection,
+		plan:           model.NewPlan(),
+		schemas:        make(map[string]bool),
+		schemaComments: make(map[string]string),
+		enumValues:     make(map[typeKey][]string),
+		enumDrift:      make([]model.Drift, 0),
+		droppedServers: make(map[string]bool),
+		remoteTypes:    make(map[string][]*model.SchemaType),
+		typedTables:    make(map[string]map[string][]model.Column),
+		managedRoles:   make(map[string]bool),
+		opts:           opts,
+	}
+}
+
+// PlanDesiredState compares the supplied desired state with the current state of the database and returns the
+// ordered list of actions that bring the database in line with the desired state. The database is not modified.
+func PlanDesiredState(ctx context.Context, dbConnection database.Executor, dState model.DesiredState, opts PlanOptions) (*model.Plan, error) {
+	log := logger.Log(ctx).
+		WithField("function", "PlanDesiredState")
+	err := validatePlanOptions(dState, opts)
+	if err != nil {
+		return nil, logger.ErrorfAsError(log, "%s", err)
+	}
+	currentState, snapshot, err := getCatalogSnapshot(ctx, dbConnection)
+	if err != nil {
+		log.Errorf("error getting current state: %s", err)
+		return nil, err
+	}
+	dState, err = ResolveLocalUsers(ctx, dbConnection, dState)
+	if err != nil {
+		log.Errorf("error resolving user mapping local users: %s", err)
+		return nil, err
+	}
+	p := newPlanner(dbConnection, opts)
+	p.ignore = dState.Ignore
+	for _, roleName := range snapshot.ManagedRoles {
+		p.managedRoles[roleName] = true
+	}
+	p.plan.Fingerprint, err = snapshot.fingerprint()
+	if err != nil {
+		log.Errorf("error computing fingerprint of current state: %s", err)
+		return nil, err
+	}
+	// Servers outside the selection are neither changed nor dropped
+	dStateServers := p.selectServers(ctx, dState.Servers)
+	dbServers := p.selectServers(ctx, currentState.Servers)
+	if len(opts.Servers) > 0 && len(dStateServers) == 0 && len(dbServers) == 0 {
+		return nil, logger.ErrorfAsError(log, "no foreign server matches the server selection %v", opts.Servers)
+	}
+	if p.selects(SelectSchemas) {
+		err = p.loadRemoteTypes(ctx, dState.Servers)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if p.selects(SelectExtensions) {
+		p.planExtensions(dState.Extensions, currentState.Extensions)
+	}
+	err = p.planServers(ctx, dStateServers, dbServers)
+	if err != nil {
+		return nil, err
+	}
+	if p.selects(SelectSchemas) {
+		// The types imported for the schemas of servers outside the selection are kept along with the schemas
+		keptSchemas := make(map[string]bool)
+		for _, server := range dState.Servers {
+			for _, schema := range server.Schemas {
+				keptSchemas[schema.LocalSchema] = true
+			}
+		}
+		for _, server := range currentState.Servers {
+			if p.selectsServer(server.Name) {
+				continue
+			}
+			for _, schema := range server.Schemas {
+				keptSchemas[schema.LocalSchema] = true
+			}
+		}
+		err = p.planPruneTypes(ctx, keptSchemas, "")
+		if err != nil {
+			log.Errorf("error planning removal of unused imported types: %s", err)
+			return nil, err
+		}
+	}
+	for _, drift := range p.enumDrift {
+		log.Warnf("%s; the enum type must be re-created to fix it", drift.String())
+	}
+	return p.plan, nil
+}
+
+// validatePlanOptions determines if the prune mode and selection of the plan options and the Ignore list of the
+// desired state are valid
+func validatePlanOptions(dState model.DesiredState, opts PlanOptions) error {
+	err := ValidatePruneMode(opts.Prune)
+	if err != nil {
+		return err
+	}
+	err = ValidateNamePatterns(dState.Ignore)
+	if err != nil {
+		return fmt.Errorf("invalid desired state Ignore list: %s", err)
+	}
+	err = ValidateNamePatterns(opts.Servers)
+	if err != nil {
+		return fmt.Errorf("invalid server selection: %s", err)
+	}
+	return ValidateObjectSelection(opts.Only)
+}
+
+// planExtensions plans the creation of extensions that are in the desired state but not in the database
+func (p *planner) planExtensions(dStateExts []model.Extension, dbExts []model.Extension) {
+	// NOTE: Don't remove extensions with abandon since we might remove something that's needed
+	_, extAdd := DiffExtensions(dStateExts, dbExts)
+	for _, extToAdd := range extAdd {
+		p.plan.Add(model.PlanAction{
+			Operation:  model.OperationCreate,
+			ObjectType: model.ObjectExtension,
+			ObjectName: extToAdd.Name,
+			Statement:  createExtensionSQL(extToAdd),
+		})
+	}
+}
+
+// planServers plans the removal, creation, and update of foreign servers followed by the privileges, user mappings,
+// and schemas of each server in the desired state
+func (p *planner) planServers(ctx context.Context, dStateServers []model.ForeignServer, dbServers []model.ForeignServer) error {
+	log := logger.Log(ctx).
+		WithField("function", "planServers")
+	serversInDBButNotInDState, serversInDStateButNotInDB, serversAlreadyInDB := DiffForeignServers(dStateServers, dbServers)
+	log.Tracef(
+		"serversInDBButNotInDState: %#v, serversInDStateButNotInDB: %#v, serversAlreadyInDB: %#v",
+		serversInDBButNotInDState,
+		serversInDStateButNotInDB,
+		serversAlreadyInDB,
+	)
+	for _, dStateServer := range dStateServers {
+		err := ValidateServerOptions(dStateServer)
+		if err != nil {
+			return logger.ErrorfAsError(log, "invalid desired state server: %s", err)
+		}
+	}
+	recreatedServers := make(map[string]bool)
+	if p.selects(SelectServers) {
+		var err error
+		recreatedServers, err = p.planServerChanges(ctx, dbServers, serversInDBButNotInDState, serversInDStateButNotInDB, serversAlreadyInDB)
+		if err != nil {
+			return err
+		}
+	} else {
+		// Only the objects of the servers that already exist can be planned when the servers themselves are not
+		for _, serverNotInDB := range serversInDStateButNotInDB {
+			log.Warnf("server %s does not exist and servers are not selected; skipping it", serverNotInDB.Name)
+		}
+		serversInDStateButNotInDB = nil
+	}
+	// Process Grants, UserMaps, and Schemas of the servers that will exist
+	serversToProcess := make([]model.ForeignServer, 0)
+	serversToProcess = append(serversToProcess, serversInDStateButNotInDB...)
+	serversToProcess = append(serversToProcess, serversAlreadyInDB...)
+	for _, serverToProcess := range serversToProcess {
+		dbServerGrantees := make([]string, 0)
+		dbServerUserMaps := make([]model.UserMap, 0)
+		dbServerSchemas := make([]model.Schema, 0)
+		dbServerForeignTables := make([]model.ForeignTable, 0)
+		dbServer := FindForeignServer(dbServers, serverToProcess.Name)
+		// The privileges, user mappings, and foreign tables of a re-created server are dropped along with it
+		if dbServer != nil && !recreatedServers[serverToProcess.Name] {
+			if dbServer.ServerGrants != nil {
+				dbServerGrantees = dbServer.ServerGrants.Users
+			}
+			dbServerUserMaps = dbServer.UserMaps
+			dbServerSchemas = dbServer.Schemas
+			dbServerForeignTables = dbServer.ForeignTables
+		}
+		if p.selects(SelectServers) {
+			p.planServerGrants(serverToProcess, dbServerGrantees)
+		}
+		if p.selects(SelectUserMaps) {
+			err := p.planUserMaps(ctx, serverToProcess, dbServerUserMaps)
+			if err != nil {
+				log.Errorf("error planning usermaps for server %s: %s", serverToProcess.Name, err)
+				return err
+			}
+		}
+		if p.selects(SelectSchemas) {
+			err := p.planSchemas(ctx, serverToProcess, dbServerSchemas)
+			if err != nil {
+				log.Errorf("error planning schemas for server %s: %s", serverToProcess.Name, err)
+				return err
+			}
+		}
+		if p.selects(SelectForeignTables) {
+			err := p.planForeignTables(ctx, serverToProcess, dbServerForeignTables)
+			if err != nil {
+				log.Errorf("error planning foreign tables for server %s: %s", serverToProcess.Name, err)
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// isSessionUser determines if the named local user is the current user or the session user of the database
+// connection
+func (p *planner) isSessionUser(ctx context.Context, localUser string) (bool, error) {
+	log := logger.Log(ctx).
+		WithField("function", "isSessionUser")
+	if p.currentUser == "" {
+		var err error
+		p.currentUser, p.sessionUser, err = getSessionUsers(ctx, p.dbConnection)
+		if err != nil {
+			log.Errorf("error getting current and session users: %s", err)
+			return false, err
+		}
+	}
+	return localUser == p.currentUser || localUser == p.sessionUser, nil
+}
+
+// planServerChanges plans the removal of the foreign servers that are not in the desired state, the creation of the
+// ones that are missing, and the alteration of the others. The names of the servers that are re-created are returned.
+func (p *planner) planServerChanges(ctx context.Context, dbServers []model.ForeignServer, serversInDBButNotInDState []model.ForeignServer, serversInDStateButNotInDB []model.ForeignServer, serversAlreadyInDB []model.ForeignServer) (map[string]bool, error) {
+	log := logger.Log(ctx).
+		WithField("function", "planServerChanges")
+	recreatedServers := make(map[string]bool)
+	// Remove servers in DB but not in DState
+	for _, serverNotInDState := range serversInDBButNotInDState {
+		if !p.canPrune(ctx, model.ObjectServer, serverNotInDState.Name, serverNotInDState.Managed) {
+			continue
+		}
+		p.plan.Add(model.PlanAction{
+			Operation:  model.OperationDrop,
+			ObjectType: model.ObjectServer,
+			ObjectName: serverNotInDState.Name,
+			Statement:  dropServerSQL(serverNotInDState.Name, true),
+		})
+		p.droppedServers[serverNotInDState.Name] = true
+	}
+	// Create servers that are in DState but not yet in DB
+	for _, serverNotInDB := range serversInDStateButNotInDB {
+		p.plan.Add(model.PlanAction{
+			Operation:  model.OperationCreate,
+			ObjectType: model.ObjectServer,
+			ObjectName: serverNotInDB.Name,
+			Statement:  createServerSQL(serverNotInDB),
+		})
+		p.planMarkServer(serverNotInDB.Name, "", model.OperationCreate)
+	}
+	// Update servers that were already in the DB
+	for _, serverAlreadyInDB := range serversAlreadyInDB {
+		dbServer := FindForeignServer(dbServers, serverAlreadyInDB.Name)
+		if dbServer == nil {
+			return nil, logger.ErrorfAsError(log, "cannot find database server %s; THIS IS UNEXPECTED", serverAlreadyInDB.Name)
+		}
+		// The wrapper of a server cannot be altered so the server is dropped and created again
+		if serverAlreadyInDB.WrapperName() != dbServer.WrapperName() {
+			log.Infof("wrapper of server %s changed from %s to %s; it will be re-created", serverAlreadyInDB.Name, dbServer.WrapperName(), serverAlreadyInDB.WrapperName())
+			p.plan.Add(model.PlanAction{
+				Operation:  model.OperationDrop,
+				ObjectType: model.ObjectServer,
+				ObjectName: dbServer.Name,
+				Statement:  dropServerSQL(dbServer.Name, true),
+			})
+			p.plan.Add(model.PlanAction{
+				Operation:  model.OperationCreate,
+				ObjectType: model.ObjectServer,
+				ObjectName: serverAlreadyInDB.Name,
+				Statement:  createServerSQL(serverAlreadyInDB),
+			})
+			p.planMarkServer(serverAlreadyInDB.Name, "", model.OperationCreate)
+			recreatedServers[serverAlreadyInDB.Name] = true
+			p.droppedServers[serverAlreadyInDB.Name] = true
+			continue
+		}
+		// A server that exists but was not created by fdwctl is adopted by the desired state that defines it
+		if !dbServer.Managed {
+			log.Infof("server %s is not managed by fdwctl yet; it will be marked as managed", dbServer.Name)
+			p.planMarkServer(dbServer.Name, dbServer.Comment, model.OperationUpdate)
+		}
+		if serverAlreadyInDB.Equals(*dbServer) {
+			log.Debugf("server %s is no different from the database; skipping it", serverAlreadyInDB.Name)
+			continue
+		}
+		p.plan.Add(model.PlanAction{
+			Operation:  model.OperationUpdate,
+			ObjectType: model.ObjectServer,
+			ObjectName: serverAlreadyInDB.Name,
+			Statement:  updateServerSQL(serverAlreadyInDB, *dbServer),
+		})
+	}
+	return recreatedServers, nil
+}
+
+// planMarkServer plans the comment that marks the named foreign server as managed by fdwctl after the text of its
+// existing comment
+func (p *planner) planMarkServer(serverName string, commentText string, operation string) {
+	p.plan.Add(model.PlanAction{
+		Operation:  operation,
+		ObjectType: model.ObjectServer,
+		ObjectName: serverName,
+		Statement:  managedServerCommentSQL(serverName, commentText),
+	})
+}
+
+// planForeignTables plans the removal, creation, and alteration of the foreign tables a desired state server defines
+// column by column. Foreign tables whose local schema is dropped by the plan are created again.
+func (p *planner) planForeignTables(ctx context.Context, server model.ForeignServer, dbTables []model.ForeignTable) error {
+	log := logger.Log(ctx).
+		WithField("function", "planForeignTables")
+	for _, table := range server.ForeignTables {
+		err := ValidateForeignTable(table)
+		if err != nil {
+			return logger.ErrorfAsError(log, "invalid desired state foreign table: %s", err)
+		}
+	}
+	ftRemove, ftAdd, ftModify := DiffForeignTables(server.ForeignTables, dbTables)
+	log.Tracef("ftRemove: %#v, ftAdd: %#v, ftModify: %#v", ftRemove, ftAdd, ftModify)
+	for _, tableToRemove := range ftRemove {
+		if exists, ok := p.schemas[tableToRemove.LocalSchema]; ok && !exists {
+			continue
+		}
+		// The foreign tables of a server in the desired state are managed along with the server
+		if !p.canPrune(ctx, model.ObjectForeignTable, fmt.Sprintf("%s.%s", tableToRemove.LocalSchema, tableToRemove.Name), true) {
+			continue
+		}
+		p.planDropForeignTable(server.Name, tableToRemove)
+	}
+	for _, tableToAdd := range ftAdd {
+		tableToAdd.ServerName = server.Name
+		err := p.planCreateForeignTable(ctx, server, tableToAdd)
+		if err != nil {
+			return err
+		}
+	}
+	for _, tableToModify := range ftModify {
+		tableToModify.ServerName = server.Name
+		if exists, ok := p.schemas[tableToModify.LocalSchema]; ok && !exists {
+			log.Debugf("local schema of foreign table %s is dropped; will create it again", tableToModify.QualifiedName())
+			err := p.planCreateForeignTable(ctx, server, tableToModify)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		dbTable := FindForeignTable(dbTables, tableToModify.LocalSchema, tableToModify.Name)
+		query, recreate := alterForeignTableSQL(tableToModify, *dbTable, server.WrapperName())
+		if recreate {
+			log.Infof("columns of foreign table %s were reordered; will re-create it", tableToModify.QualifiedName())
+			p.planDropForeignTable(server.Name, *dbTable)
+			err := p.planCreateForeignTable(ctx, server, tableToModify)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		if query == "" {
+			log.Debugf("foreign table %s is no different from the database; skipping it", tableToModify.QualifiedName())
+			continue
+		}
+		p.plan.Add(model.PlanAction{
+			Operation:  model.OperationUpdate,
+			ObjectType: model.ObjectForeignTable,
+			ObjectName: tableToModify.QualifiedName(),
+			ServerName: server.Name,
+			Statement:  query,
+		})
+	}
+	return nil
+}
+
+// planDropForeignTable plans the removal of a foreign table
+func (p *planner) planDropForeignTable(serverName string, table model.ForeignTable) {
+	p.plan.Add(model.PlanAction{
+		Operation:  model.OperationDrop,
+		ObjectType: model.ObjectForeignTable,
+		ObjectName: table.QualifiedName(),
+		ServerName: serverName,
+		Statement:  dropForeignTableSQL(table.LocalSchema, table.Name),
+	})
+}
+
+// planCreateForeignTable plans the creation of the local schema of a desired state foreign table if it will not
+// already exist, followed by the creation of the foreign table and the comment that marks it as defined in the
+// desired state
+func (p *planner) planCreateForeignTable(ctx context.Context, server model.ForeignServer, table model.ForeignTable) error {
+	err := p.planEnsureSchema(ctx, table.LocalSchema)
+	if err != nil {
+		return err
+	}
+	p.plan.Add(model.PlanAction{
+		Operation:  model.OperationCreate,
+		ObjectType: model.ObjectForeignTable,
+		ObjectName: table.QualifiedName(),
+		ServerName: server.Name,
+		Statement:  createForeignTableSQL(table, server.WrapperName()),
+	})
+	p.plan.Add(model.PlanAction{
+		Operation:  model.OperationUpdate,
+		ObjectType: model.ObjectForeignTable,
+		ObjectName: table.QualifiedName(),
+		ServerName: server.Name,
+		Statement:  declaredTableCommentSQL(table),
+	})
+	return nil
+}
+
+// planServerGrants plans the grants and revocations of usage on a desired state server that manages its privileges
+func (p *planner) planServerGrants(server model.ForeignServer, dbGrantees []string) {
+	if server.ServerGrants == nil {
+		return
+	}
+	granteesToRevoke, granteesToGrant := DiffGrantees(server.ServerGrants.Users, dbGrantees)
+	for _, grantee := range granteesToRevoke {
+		p.plan.Add(model.PlanAction{
+			Operation:  model.OperationRevoke,
+			ObjectType: model.ObjectServer,
+			ObjectName: server.Name,
+			Statement:  revokeServerSQL(server.Name, grantee),
+		})
+	}
+	for _, grantee := range granteesToGrant {
+		p.plan.Add(model.PlanAction{
+			Operation:  model.OperationGrant,
+			ObjectType: model.ObjectServer,
+			ObjectName: server.Name,
+			Statement:  grantServerSQL(server.Name, grantee),
+		})
+	}
+}
+
+// planUserMaps plans the removal, creation, and update of the user mappings of a desired state server
+func (p *planner) planUserMaps(ctx context.Context, server model.ForeignServer, dbServerUsermaps []model.UserMap) error {
+	log := logger.Log(ctx).
+		WithField("function", "planUserMaps")
+	usRemove, usAdd, usModify := DiffUserMaps(server.UserMaps, dbServerUsermaps)
+	// Delete Usermaps not in DState along with their local users
+	for _, usermapToRemove := range usRemove {
+		usermapToRemove.ServerName = server.Name
+		// The user mappings of a server in the desired state are managed along with the server
+		if !p.canPrune(ctx, model.ObjectUserMap, usermapToRemove.LocalUser, true, server.Name) {
+			continue
+		}
+		p.plan.Add(model.PlanAction{
+			Operation:  model.OperationDrop,
+			ObjectType: model.ObjectUserMap,
+			ObjectName: usermapToRemove.LocalUser,
+			ServerName: server.Name,
+			Statement:  dropUserMapSQL(usermapToRemove),
+		})
+		// The role of a keyword mapping is stored under the name it resolves to; it cannot be dropped while connected
+		if model.IsSpecialLocalUser(usermapToRemove.LocalUser) || usermapToRemove.LocalUserKeyword != "" {
+			continue
+		}
+		sessionUser, err := p.isSessionUser(ctx, usermapToRemove.LocalUser)
+		if err != nil {
+			return err
+		}
+		if sessionUser {
+			log.Infof("local user %s is a user of the database connection; keeping it", usermapToRemove.LocalUser)
+			continue
+		}
+		if !p.canPrune(ctx, model.ObjectUser, usermapToRemove.LocalUser, p.managedRoles[usermapToRemove.LocalUser]) {
+			continue
+		}
+		p.plan.Add(model.PlanAction{
+			Operation:  model.OperationDrop,
+			ObjectType: model.ObjectUser,
+			ObjectName: usermapToRemove.LocalUser,
+			Statement:  dropUserSQL(usermapToRemove.LocalUser),
+		})
+	}
+	// Add Usermaps in DState but not in DB
+	for _, usermapToAdd := range usAdd {
+		usermapToAdd.ServerName = server.Name
+		secretValue := ""
+		if usermapToAdd.RemoteSecret.IsDefined() {
+			var err error
+			secretValue, err = GetSecret(ctx, usermapToAdd.RemoteSecret)
+			if err != nil {
+				return logger.ErrorfAsError(log, "error getting secret value: %s", err)
+			}
+		}
+		redactedStatement, position := createUserMapStatement(usermapToAdd, redactedSecretValue)
+		p.plan.Add(redactedUserMapAction(model.PlanAction{
+			Operation:  model.OperationCreate,
+			ObjectType: model.ObjectUserMap,
+			ObjectName: usermapToAdd.LocalUser,
+			ServerName: server.Name,
+			Statement:  createUserMapSQL(usermapToAdd, secretValue),
+			SQL:        redactedStatement,
+		}, position))
+	}
+	// Update usermaps that are already there
+	for _, usermapToUpdate := range usModify {
+		usermapToUpdate.ServerName = server.Name
+		dbUserMap := FindUserMap(dbServerUsermaps, usermapToUpdate.LocalUser)
+		if dbUserMap == nil {
+			return logger.ErrorfAsError(log, "cannot find user mapping for local user %s", usermapToUpdate.LocalUser)
+		}
+		secretValue := ""
+		if usermapToUpdate.RemoteSecret.IsDefined() {
+			var err error
+			secretValue, err = GetSecret(ctx, usermapToUpdate.RemoteSecret)
+			if err != nil {
+				return logger.ErrorfAsError(log, "error getting secret value: %s", err)
+			}
+			usermapToUpdate.RemoteSecret.Value = secretValue
+		}
+		if usermapToUpdate.Equals(*dbUserMap) {
+			log.Debugf("user mapping %s -> %s is no different from the database; skipping it", usermapToUpdate.LocalUser, usermapToUpdate.RemoteUser)
+			continue
+		}
+		redactedStatement, position := updateUserMapStatement(usermapToUpdate, *dbUserMap, secretValue, true)
+		p.plan.Add(redactedUserMapAction(model.PlanAction{
+			Operation:  model.OperationUpdate,
+			ObjectType: model.ObjectUserMap,
+			ObjectName: usermapToUpdate.LocalUser,
+			ServerName: server.Name,
+			Statement:  updateUserMapSQL(usermapToUpdate, *dbUserMap, secretValue, false),
+			SQL:        redactedStatement,
+		}, position))
+	}
+	return nil
+}
+
+// redactedUserMapAction records in the supplied user mapping action where its SQL holds the redacted password, whose
+// quoted value starts at the supplied byte offset; an offset of -1 means the SQL has no credential
+func redactedUserMapAction(action model.PlanAction, position int) model.PlanAction {
+	if position >= 0 {
+		action.RedactedOption = usermapOptionPassword
+		action.RedactedPosition = position
+	}
+	return action
+}
+
+// planSchemas plans the removal, import, and optional re-import of the foreign schemas of a desired state server and
+// reconciles the privileges of the schemas that are kept. Schemas whose import options changed are always re-imported.
+func (p *planner) planSchemas(ctx context.Context, server model.ForeignServer, dbSchemas []model.Schema) error {
+	log := logger.Log(ctx).
+		WithField("function", "planSchemas")
+	for _, schema := range server.Schemas {
+		err := ValidateSchemaGrants(schema)
+		if err != nil {
+			return logger.ErrorfAsError(log, "invalid desired state schema: %s", err)
+		}
+		err = ValidateTableFilter(server, schema)
+		if err != nil {
+			return logger.ErrorfAsError(log, "invalid desired state schema: %s", err)
+		}
+		err = ValidateImportOptions(server, schema)
+		if err != nil {
+			return logger.ErrorfAsError(log, "invalid desired state schema: %s", err)
+		}
+		err = ValidateRefreshPolicy(schema)
+		if err != nil {
+			return logger.ErrorfAsError(log, "invalid desired state schema: %s", err)
+		}
+		err = ValidateTypeSchema(schema)
+		if err != nil {
+			return logger.ErrorfAsError(log, "invalid desired state schema: %s", err)
+		}
+	}
+	schRemove, schAdd, schModify := DiffSchemas(server.Schemas, dbSchemas)
+	log.Tracef("schRemove: %#v, schAdd: %#v, schModify: %#v", schRemove, schAdd, schModify)
+	// Drop schemas not in DState
+	for _, schemaToRemove := range schRemove {
+		if !p.canPrune(ctx, model.ObjectSchema, schemaToRemove.LocalSchema, schemaToRemove.Managed) {
+			continue
+		}
+		err := p.planDropSchema(ctx, schemaToRemove)
+		if err != nil {
+			return err
+		}
+	}
+	// Import schemas in DState but not imported
+	for _, schemaToAdd := range schAdd {
+		err := p.planImportSchema(ctx, server, schemaToAdd)
+		if err != nil {
+			log.Errorf("error planning import of local schema %s: %s", schemaToAdd.LocalSchema, err)
+			return err
+		}
+	}
+	// Bring the other schemas up to date according to their refresh policy, re-importing them when asked to or when
+	// their import options changed
+	for _, schemaToModify := range schModify {
+		dbSchema := model.Schema{}
+		for _, schema := range dbSchemas {
+			if schema.LocalSchema == schemaToModify.LocalSchema {
+				dbSchema = schema
+				break
+			}
+		}
+		recreate := p.opts.RecreateSchemas || schemaToModify.RefreshPolicyName() == model.RefreshPolicyRecreate
+		if !schemaToModify.ImportOptionsEqual(dbSchema) {
+			log.Infof("import options of foreign schema %s changed; will re-import it", schemaToModify.RemoteSchema)
+			recreate = true
+		}
+		if schemaToModify.TypeSchema != dbSchema.TypeSchema {
+			log.Infof("type schema of foreign schema %s changed; will re-import it", schemaToModify.RemoteSchema)
+			recreate = true
+		}
+		if recreate {
+			err := p.planDropSchema(ctx, schemaToModify)
+			if err != nil {
+				return err
+			}
+			err = p.planImportSchema(ctx, server, schemaToModify)
+			if err != nil {
+				log.Errorf("error planning re-import of local schema %s: %s", schemaToModify.LocalSchema, err)
+				return err
+			}
+			continue
+		}
+		log.Infof("foreign schema %s exists; will not re-create it", schemaToModify.RemoteSchema)
+		var droppedTables, importedTables []string
+		var err error
+		switch {
+		case schemaToModify.RefreshPolicyName() == model.RefreshPolicyIncremental:
+			droppedTables, importedTables, err = p.planRefreshSchema(ctx, server, schemaToModify)
+		case len(schemaToModify.LimitTo) > 0 || len(schemaToModify.Except) > 0 || len(dbSchema.LimitTo) > 0 || len(dbSchema.Except) > 0:
+			droppedTables, importedTables, err = p.planTableFilter(ctx, server, schemaToModify)
+		}
+		if err != nil {
+			log.Errorf("error planning foreign tables of local schema %s: %s", schemaToModify.LocalSchema, err)
+			return err
+		}
+		if query := schemaMetadataUpdateSQL(schemaToModify, dbSchema); query != "" {
+			p.plan.Add(model.PlanAction{
+				Operation:  model.OperationUpdate,
+				ObjectType: model.ObjectSchema,
+				ObjectName: schemaToModify.LocalSchema,
+				Statement:  query,
+			})
+		}
+		if schemaToModify.SchemaGrants != nil {
+			err = p.planExistingSchemaGrants(ctx, schemaToModify, droppedTables, importedTables)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// planExistingSchemaGrants plans the reconciliation of the privileges of an existing local schema with the grants of a
+// desired state schema once the planned table changes have been made
+func (p *planner) planExistingSchemaGrants(ctx context.Context, schema model.Schema, droppedTables []string, importedTables []string) error {
+	log := logger.Log(ctx).
+		WithField("function", "planExistingSchemaGrants")
+	current, tables, err := getSchemaPrivileges(ctx, p.dbConnection, schema.LocalSchema)
+	if err != nil {
+		log.Errorf("error getting privileges of local schema %s: %s", schema.LocalSchema, err)
+		return err
+	}
+	keptTables := make([]string, 0, len(tables)+len(importedTables))
+	for _, table := range tables {
+		if !containsString(droppedTables, table) {
+			keptTables = append(keptTables, table)
+		}
+	}
+	for _, table := range droppedTables {
+		delete(current.tables, table)
+	}
+	for _, table := range importedTables {
+		if !containsString(keptTables, table) {
+			keptTables = append(keptTables, table)
+		}
+	}
+	sort.Strings(keptTables)
+	p.planSchemaGrants(schema, keptTables, current)
+	return nil
+}
+
+// planDropSchema plans the removal of a local schema and everything in it
+func (p *planner) planDropSchema(ctx context.Context, schema model.Schema) error {
+	err := p.loadTypes(ctx)
+	if err != nil {
+		return err
+	}
+	p.plan.Add(model.PlanAction{
+		Operation:  model.OperationDrop,
+		ObjectType: model.ObjectSchema,
+		ObjectName: schema.LocalSchema,
+		Statement:  dropSchemaSQL(schema, true),
+	})
+	p.schemas[schema.LocalSchema] = false
+	delete(p.schemaComments, schema.LocalSchema)
+	// The CASCADE drop takes any user-defined types in the schema with it
+	for key := range p.types {
+		if key.schema == schema.LocalSchema {
+			p.types[key] = false
+			delete(p.enumValues, key)
+		}
+	}
+	return nil
+}
+
+// planImportSchema plans the creation of the local schema, the optional creation of user-defined types, the import of
+// the remote schema, and any grants of a desired state schema
+func (p *planner) planImportSchema(ctx context.Context, server model.ForeignServer, schema model.Schema) error {
+	log := logger.Log(ctx).
+		WithField("function", "planImportSchema")
+	filteredSchema, _, err := expandTableFilter(ctx, p.dbConnection, server, schema)
+	if err != nil {
+		log.Errorf("error expanding table filter: %s", err)
+		return err
+	}
+	err = p.planEnsureSchema(ctx, schema.LocalSchema)
+	if err != nil {
+		return err
+	}
+	if schema.ImportENUMs {
+		err = p.planSchemaTypes(ctx, server, schema)
+		if err != nil {
+			return err
+		}
+	}
+	err = p.planImportTables(ctx, server, schema, filteredSchema)
+	if err != nil {
+		return err
+	}
+	// The comment of a local schema that already existed is kept ahead of the metadata
+	schema.Comment, _ = splitMetadataComment(p.schemaComments[schema.LocalSchema])
+	p.plan.Add(model.PlanAction{
+		Operation:  model.OperationUpdate,
+		ObjectType: model.ObjectSchema,
+		ObjectName: schema.LocalSchema,
+		Statement:  schemaMetadataCommentSQL(schema),
+	})
+	if schema.SchemaGrants != nil {
+		p.planSchemaGrants(schema, nil, newSchemaPrivileges())
+	}
+	return nil
+}
+
+// planTableFilter plans the removal of the foreign tables of an existing local schema that its LIMIT TO or EXCEPT
+// table filter excludes and the import of the remote tables that it includes but which are missing. Missing tables can
+// only be found for an EXCEPT filter when the tables of the remote schema can be read through the enum connection or
+// a user mapping of the server.
+// The names of the dropped and imported tables are returned; imported is nil when the imported tables are not known.
+func (p *planner) planTableFilter(ctx context.Context, server model.ForeignServer, schema model.Schema) ([]string, []string, error) {
+	log := logger.Log(ctx).
+		WithField("function", "planTableFilter")
+	filteredSchema, remoteTables, err := expandTableFilter(ctx, p.dbConnection, server, schema)
+	if err != nil {
+		log.Errorf("error expanding table filter: %s", err)
+		return nil, nil, err
+	}
+	localTables, err := getImportedTables(ctx, p.dbConnection, schema.LocalSchema, server.Name)
+	if err != nil {
+		log.Errorf("error getting foreign tables: %s", err)
+		return nil, nil, err
+	}
+	droppedTables := make([]string, 0)
+	importedTables := make([]string, 0)
+	switch {
+	case remoteTables == nil && len(filteredSchema.LimitTo) == 0 && len(filteredSchema.Except) == 0:
+		// The table filter was removed; import every table that has not been imported yet
+		log.Debugf("table filter of schema %s removed; importing the remaining tables of remote schema %s", schema.LocalSchema, schema.RemoteSchema)
+		if schema.ImportENUMs {
+			err = p.planSchemaTypes(ctx, server, schema)
+			if err != nil {
+				return nil, nil, err
+			}
+		}
+		missingSchema := schema
+		missingSchema.LimitTo = nil
+		missingSchema.Except = localTables
+		err = p.planImportTables(ctx, server, schema, missingSchema)
+		if err != nil {
+			return nil, nil, err
+		}
+		return droppedTables, nil, nil
+	case remoteTables == nil && len(filteredSchema.LimitTo) == 0:
+		// Without the remote tables only the excluded tables that were imported are known
+		log.Debugf("no connection to the remote database of schema %s; tables added to remote schema %s will not be imported", schema.LocalSchema, schema.RemoteSchema)
+		for _, table := range localTables {
+			if containsString(filteredSchema.Except, table) {
+				droppedTables = append(droppedTables, table)
+			}
+		}
+	default:
+		desiredTables := filteredSchema.LimitTo
+		if remoteTables != nil {
+			desiredTables = filterTables(filteredSchema.LimitTo, filteredSchema.Except, remoteTables)
+		}
+		for _, table := range localTables {
+			if !containsString(desiredTables, table) {
+				droppedTables = append(droppedTables, table)
+			}
+		}
+		for _, table := range desiredTables {
+			if !containsString(localTables, table) {
+				importedTables = append(importedTables, table)
+			}
+		}
+	}
+	err = p.planTableChanges(ctx, server, schema, droppedTables, importedTables, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	return droppedTables, importedTables, nil
+}
+
+// planTableChanges plans the removal of the named foreign tables of an existing local schema followed by the supplied
+// changes to foreign tables and the import of the named remote tables, creating any user-defined types they need first
+func (p *planner) planTableChanges(ctx context.Context, server model.ForeignServer, schema model.Schema, droppedTables []string, importedTables []string, alterations []model.PlanAction) error {
+	for _, table := range droppedTables {
+		p.plan.Add(model.PlanAction{
+			Operation:  model.OperationDrop,
+			ObjectType: model.ObjectForeignTable,
+			ObjectName: fmt.Sprintf("%s.%s", schema.LocalSchema, table),
+			ServerName: server.Name,
+			Statement:  dropForeignTableSQL(schema.LocalSchema, table),
+		})
+	}
+	if len(importedTables) == 0 && len(alterations) == 0 {
+		return nil
+	}
+	if schema.ImportENUMs {
+		err := p.planSchemaTypes(ctx, server, schema)
+		if err != nil {
+			return err
+		}
+	}
+	for _, action := range alterations {
+		p.plan.Add(action)
+	}
+	if len(importedTables) == 0 {
+		return nil
+	}
+	missingSchema := schema
+	missingSchema.LimitTo = importedTables
+	missingSchema.Except = nil
+	return p.planImportTables(ctx, server, schema, missingSchema)
+}
+
+// planImportTables plans the import of the tables of a remote schema that the table filter of importSchema includes.
+// When the schema has a type schema, the tables that use user-defined types are created one by one instead so that
+// their columns refer to the types in the type schema.
+func (p *planner) planImportTables(ctx context.Context, server model.ForeignServer, schema model.Schema, importSchema model.Schema) error {
+	log := logger.Log(ctx).
+		WithField("function", "planImportTables")
+	createdTables := make([]string, 0)
+	importNeeded := true
+	if schema.TypeSchema != "" {
+		typedTables, ok := p.typedTables[schema.LocalSchema]
+		if !ok {
+			var err error
+			typedTables, err = getRemoteTypedTables(ctx, p.dbConnection, server, schema)
+			if err != nil {
+				log.Errorf("error getting remote tables that use user-defined types: %s", err)
+				return err
+			}
+			p.typedTables[schema.LocalSchema] = typedTables
+		}
+		importSchema, createdTables, importNeeded = splitTypedTables(importSchema, typedTables)
+	}
+	if importNeeded {
+		p.plan.Add(model.PlanAction{
+			Operation:  model.OperationImport,
+			ObjectType: model.ObjectSchema,
+			ObjectName: schema.LocalSchema,
+			ServerName: server.Name,
+			Statement:  importForeignSchemaSQL(server.Name, importSchema),
+		})
+	}
+	for _, tableName := range createdTables {
+		table := typedForeignTable(server.Name, schema, tableName, p.typedTables[schema.LocalSchema][tableName])
+		p.plan.Add(model.PlanAction{
+			Operation:  model.OperationCreate,
+			ObjectType: model.ObjectForeignTable,
+			ObjectName: fmt.Sprintf("%s.%s", schema.LocalSchema, tableName),
+			ServerName: server.Name,
+			Statement:  createForeignTableSQL(table, server.WrapperName()),
+		})
+	}
+	return nil
+}
+
+// planSchemaGrants plans the revocations and grants that bring the privileges of a local schema in line with the
+// grants of a desired state schema. When tables is nil the schema is planned to be imported.
+func (p *planner) planSchemaGrants(schema model.Schema, tables []string, current schemaPrivileges) {
+	revokeStatements, grantStatements := schemaGrantSQL(schema.LocalSchema, *schema.SchemaGrants, tables, current)
+	for _, query := range revokeStatements {
+		p.plan.Add(model.PlanAction{
+			Operation:  model.OperationRevoke,
+			ObjectType: model.ObjectSchema,
+			ObjectName: schema.LocalSchema,
+			Statement:  query,
+		})
+	}
+	for _, query := range grantStatements {
+		p.plan.Add(model.PlanAction{
+			Operation:  model.OperationGrant,
+			ObjectType: model.ObjectSchema,
+			ObjectName: schema.LocalSchema,
+			Statement:  query,
+		})
+	}
+}
+
+// schemaWillExist determines if a local schema will exist once the actions planned so far have been executed
+func (p *planner) schemaWillExist(ctx context.Context, schemaName string) (bool, error) {
+	if exists, ok := p.schemas[schemaName]; ok {
+		return exists, nil
+	}
+	schemaComment, exists, err := getSchemaComment(ctx, p.dbConnection, schemaName)
+	if err != nil {
+		return false, err
+	}
+	p.schemaComments[schemaName] = schemaComment
+	return exists, nil
+}
+
+// planEnsureSchema plans the creation of a local schema if it will not already exist
+func (p *planner) planEnsureSchema(ctx context.Context, schemaName string) error {
+	exists, err := p.schemaWillExist(ctx, schemaName)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		p.planCreateSchema(schemaName)
+	}
+	p.schemas[schemaName] = true
+	return nil
+}
+
+// planCreateSchema plans the creation of a local schema
+func (p *planner) planCreateSchema(schemaName string) {
+	p.plan.Add(model.PlanAction{
+		Operation:  model.OperationCreate,
+		ObjectType: model.ObjectSchema,
+		ObjectName: schemaName,
+		Statement:  createSchemaSQL(schemaName),
+	})
+	p.schemas[schemaName] = true
+}
+
+// planSchemaTypes plans the creation of the user-defined types used in the remote schema that will not already exist
+// locally and the addition of the remote values that are missing from the ENUM types that will
+func (p *planner) planSchemaTypes(ctx context.Context, server model.ForeignServer, schema model.Schema) error {
+	log := logger.Log(ctx).
+		WithField("function", "planSchemaTypes")
+	remoteTypes, ok := p.remoteTypes[schema.LocalSchema]
+	if !ok {
+		var err error
+		remoteTypes, err = getRemoteSchemaTypes(ctx, p.dbConnection, server, schema)
+		if err != nil {
+			log.Errorf("error getting remote types: %s", err)
+			return err
+		}
+		p.remoteTypes[schema.LocalSchema] = remoteTypes
+	}
+	return p.planTypes(ctx, server.Name, schema.LocalSchema, remoteTypes)
+}
+
+// loadRemoteTypes reads the user-defined types used by the remote schema of each desired state schema of the selected
+// servers that imports them and returns an error, before anything is planned, if a type would be imported with
+// different definitions for different schemas. The schemas of the servers outside the selection are read as well
+// since they import types into the same local schemas, but only the types that the selected schemas import are
+// compared with theirs.
+func (p *planner) loadRemoteTypes(ctx context.Context, servers []model.ForeignServer) error {
+	log := logger.Log(ctx).
+		WithField("function", "loadRemoteTypes")
+	sources := make([]typeSource, 0)
+	selectedTypes := make(map[string]bool)
+	for _, selected := range []bool{true, false} {
+		if !selected && len(selectedTypes) == 0 {
+			break
+		}
+		for _, server := range servers {
+			if p.selectsServer(server.Name) != selected {
+				continue
+			}
+			for _, schema := range server.Schemas {
+				if !schema.ImportENUMs {
+					continue
+				}
+				remoteTypes, err := getRemoteSchemaTypes(ctx, p.dbConnection, server, schema)
+				if err != nil {
+					log.Errorf("error getting remote types of local schema %s: %s", schema.LocalSchema, err)
+					return err
+				}
+				if selected {
+					p.remoteTypes[schema.LocalSchema] = remoteTypes
+				}
+				for _, remoteType := range remoteTypes {
+					if selected {
+						selectedTypes[remoteType.String()] = true
+					} else if !selectedTypes[remoteType.String()] {
+						continue
+					}
+					sources = append(sources, typeSource{serverName: server.Name, localSchema: schema.LocalSchema, schemaType: remoteType})
+				}
+			}
+		}
+	}
+	conflicts := findTypeConflicts(sources)
+	if len(conflicts) > 0 {
+		return logger.ErrorfAsError(log, "conflicting user-defined types: %s; set a typeSchema to import them into another local schema", strings.Join(conflicts, "; "))
+	}
+	return nil
+}
+
+// planTypes plans the creation of the supplied remote user-defined types that will not already exist locally, in
+// the order they are supplied in, and the reconciliation of the values of the ENUM types that will. Differences that
+// cannot be reconciled are recorded as drift. Existing types of other kinds are left alone.
+// Created types are marked as imported for the local schema, as are the schemas created to hold them; existing types
+// that fdwctl created are marked as imported for the local schema as well.
+func (p *planner) planTypes(ctx context.Context, serverName string, localSchema string, remoteTypes []*model.SchemaType) error {
+	log := logger.Log(ctx).
+		WithField("function", "planTypes")
+	err := p.loadTypes(ctx)
+	if err != nil {
+		return err
+	}
+	err = p.loadImportedTypes(ctx)
+	if err != nil {
+		return err
+	}
+	for _, remoteType := range remoteTypes {
+		key := typeKey{schema: remoteType.Schema, name: remoteType.Name}
+		if p.types[key] {
+			p.planMarkImportedType(remoteType, localSchema)
+			if remoteType.Kind != model.ObjectEnum {
+				continue
+			}
+			remoteEnum := schemaEnumOf(remoteType)
+			localValues, ok := p.enumValues[key]
+			if !ok {
+				localValues, err = getSchemaEnumStrings(ctx, p.dbConnection, remoteEnum)
+				if err != nil {
+					log.Errorf("error getting local enum values: %s", err)
+					return err
+				}
+			}
+			statements, drifts := reconcileEnumSQL(&model.SchemaEnum{Schema: remoteEnum.Schema, Name: remoteEnum.Name, Values: localValues}, remoteEnum)
+			for _, query := range statements {
+				// ALTER TYPE ... ADD VALUE cannot run inside a transaction block before PostgreSQL 12; no later action
+				// of the plan uses the new value, which is not usable before the transaction commits
+				p.plan.Add(model.PlanAction{
+					Operation:        model.OperationUpdate,
+					ObjectType:       model.ObjectEnum,
+					ObjectName:       remoteEnum.String(),
+					Statement:        query,
+					NonTransactional: true,
+				})
+			}
+			for _, drift := range drifts {
+				drift.ServerName = serverName
+				p.enumDrift = append(p.enumDrift, drift)
+			}
+			p.enumValues[key] = mergeEnumValues(localValues, remoteEnum.Values)
+			continue
+		}
+		typeSchemaExists, err := p.schemaWillExist(ctx, remoteType.Schema)
+		if err != nil {
+			return err
+		}
+		if !typeSchemaExists {
+			p.planCreateSchema(remoteType.Schema)
+			p.plan.Add(model.PlanAction{
+				Operation:  model.OperationUpdate,
+				ObjectType: model.ObjectSchema,
+				ObjectName: remoteType.Schema,
+				Statement:  commentOnSchemaSQL(remoteType.Schema, "", objectMetadata{TypeSchema: true}),
+			})
+		}
+		p.plan.Add(model.PlanAction{
+			Operation:  model.OperationCreate,
+			ObjectType: remoteType.Kind,
+			ObjectName: remoteType.String(),
+			Statement:  createTypeSQL(remoteType),
+		})
+		p.plan.Add(model.PlanAction{
+			Operation:  model.OperationUpdate,
+			ObjectType: remoteType.Kind,
+			ObjectName: remoteType.String(),
+			Statement:  commentOnTypeSQL(remoteType, "", objectMetadata{ImportedFor: []string{localSchema}}),
+		})
+		p.types[key] = true
+		p.setImportedType(remoteType, []string{localSchema})
+		if remoteType.Kind == model.ObjectEnum {
+			p.enumValues[key] = remoteType.Values
+		}
+	}
+	return nil
+}
+
+// planMarkImportedType plans the addition of the local schema to the foreign schemas an existing type that fdwctl
+// created was imported for. Types that fdwctl did not create are left alone.
+func (p *planner) planMarkImportedType(schemaType *model.SchemaType, localSchema string) {
+	importedType := findImportedType(p.importedTypes, schemaType)
+	if importedType == nil || containsString(importedType.ImportedFor, localSchema) {
+		return
+	}
+	importedType.ImportedFor = append(importedType.ImportedFor, localSchema)
+	p.plan.Add(model.PlanAction{
+		Operation:  model.OperationUpdate,
+		ObjectType: importedType.Kind,
+		ObjectName: importedType.String(),
+		Statement:  commentOnTypeSQL(importedType, importedType.Comment, objectMetadata{ImportedFor: importedType.ImportedFor}),
+	})
+}
+
+// setImportedType records that a type created by the plan is imported for the supplied local schemas
+func (p *planner) setImportedType(schemaType *model.SchemaType, importedFor []string) {
+	if importedType := findImportedType(p.importedTypes, schemaType); importedType != nil {
+		importedType.ImportedFor = importedFor
+		return
+	}
+	p.importedTypes = append(p.importedTypes, &model.SchemaType{
+		Schema:      schemaType.Schema,
+		Name:        schemaType.Name,
+		Kind:        schemaType.Kind,
+		ImportedFor: importedFor,
+	})
+}
+
+// planPruneTypes plans the removal of the user-defined types fdwctl created that will no longer be needed: none of
+// the local schemas they were imported for is kept and no table that will remain uses them. When importedFor is not
+// empty only the types imported for that local schema are considered and keptSchemas may be nil, in which case the
+// other local schemas a type was imported for are kept if they will exist. Types are dropped in reverse dependency
+// order, followed by the schemas created to hold them that no longer contain anything.
+func (p *planner) planPruneTypes(ctx context.Context, keptSchemas map[string]bool, importedFor string) error {
+	log := logger.Log(ctx).
+		WithField("function", "planPruneTypes")
+	if importedFor == "" && p.opts.Prune == PruneNone {
+		log.Debug("pruning is disabled; leaving imported types alone")
+		return nil
+	}
+	err := p.loadImportedTypes(ctx)
+	if err != nil {
+		return err
+	}
+	candidates := make([]*model.SchemaType, 0)
+	for _, importedType := range p.importedTypes {
+		if exists, ok := p.types[typeKey{schema: importedType.Schema, name: importedType.Name}]; ok && !exists {
+			continue
+		}
+		if importedFor != "" && !containsString(importedType.ImportedFor, importedFor) {
+			continue
+		}
+		if matchesAnyPattern(p.ignore, importedType.String()) {
+			log.Infof("%s type %s is ignored; leaving it alone", importedType.Kind, importedType.String())
+			continue
+		}
+		candidates = append(candidates, importedType)
+	}
+	if len(candidates) == 0 {
+		return nil
+	}
+	if keptSchemas == nil {
+		keptSchemas = make(map[string]bool)
+		for _, candidate := range candidates {
+			for _, schemaName := range candidate.ImportedFor {
+				if _, ok := keptSchemas[schemaName]; ok || schemaName == importedFor {
+					continue
+				}
+				keptSchemas[schemaName], err = p.schemaWillExist(ctx, schemaName)
+				if err != nil {
+					return err
+				}
+			}
+		}
+	}
+	usages, err := getTypeUsages(ctx, p.dbConnection)
+	if err != nil {
+		log.Errorf("error getting type usages: %s", err)
+		return err
+	}
+	unusedTypes := unusedImportedTypes(candidates, usages, keptSchemas, func(usage typeUsage) bool {
+		if exists, ok := p.schemas[usage.tableSchema]; ok && !exists {
+			return true
+		}
+		return usage.tableSchema == importedFor || (usage.serverName != "" && p.droppedServers[usage.serverName])
+	})
+	if len(unusedTypes) == 0 {
+		return nil
+	}
+	// The definitions tell which of the types refer to others
+	typesToDrop := make([]*model.SchemaType, 0, len(unusedTypes))
+	for _, unusedType := range unusedTypes {
+		typeToDrop := &model.SchemaType{Schema: unusedType.Schema, Name: unusedType.Name, Kind: unusedType.Kind}
+		err = getTypeDefinition(ctx, p.dbConnection, typeToDrop)
+		if err != nil {
+			log.Errorf("error getting definition of %s type %s: %s", typeToDrop.Kind, typeToDrop, err)
+			return err
+		}
+		typesToDrop = append(typesToDrop, typeToDrop)
+	}
+	typesToDrop, err = sortTypesByDependency(typesToDrop)
+	if err != nil {
+		return err
+	}
+	err = p.loadTypes(ctx)
+	if err != nil {
+		return err
+	}
+	for i := len(typesToDrop) - 1; i >= 0; i-- {
+		typeToDrop := typesToDrop[i]
+		p.plan.Add(model.PlanAction{
+			Operation:  model.OperationDrop,
+			ObjectType: typeToDrop.Kind,
+			ObjectName: typeToDrop.String(),
+			Statement:  dropTypeSQL(typeToDrop),
+		})
+		key := typeKey{schema: typeToDrop.Schema, name: typeToDrop.Name}
+		p.types[key] = false
+		delete(p.enumValues, key)
+	}
+	return p.planPruneTypeSchemas(ctx, keptSchemas)
+}
+
+// planPruneTypeSchemas plans the removal of the schemas fdwctl created to hold imported types that contain nothing
+// once the actions planned so far have been executed
+func (p *planner) planPruneTypeSchemas(ctx context.Context, keptSchemas map[string]bool) error {
+	log := logger.Log(ctx).
+		WithField("function", "planPruneTypeSchemas")
+	typeSchemas, err := getTypeSchemas(ctx, p.dbConnection)
+	if err != nil {
+		log.Errorf("error getting type schemas: %s", err)
+		return err
+	}
+	schemaNames := make([]string, 0, len(typeSchemas))
+	for schemaName := range typeSchemas {
+		schemaNames = append(schemaNames, schemaName)
+	}
+	sort.Strings(schemaNames)
+	for _, schemaName := range schemaNames {
+		if typeSchemas[schemaName] > 0 || keptSchemas[schemaName] || matchesAnyPattern(p.ignore, schemaName) {
+			continue
+		}
+		if exists, ok := p.schemas[schemaName]; ok && !exists {
+			continue
+		}
+		empty := true
+		for key, exists := range p.types {
+			if exists && key.schema == schemaName {
+				empty = false
+				break
+			}
+		}
+		if !empty {
+			continue
+		}
+		p.plan.Add(model.PlanAction{
+			Operation:  model.OperationDrop,
+			ObjectType: model.ObjectSchema,
+			ObjectName: schemaName,
+			Statement:  dropSchemaSQL(model.Schema{LocalSchema: schemaName}, false),
+		})
+		p.schemas[schemaName] = false
+	}
+	return nil
+}
+
+// findImportedType returns the imported type of the supplied list with the same schema and name as the supplied type.
+// Nil is returned if there is no such type.
+func findImportedType(importedTypes []*model.SchemaType, schemaType *model.SchemaType) *model.SchemaType {
+	for _, importedType := range importedTypes {
+		if importedType.Schema == schemaType.Schema && importedType.Name == schemaType.Name {
+			return importedType
+		}
+	}
+	return nil
+}
+
+// mergeEnumValues returns the local values of an ENUM type followed by the remote values that are missing from them
+func mergeEnumValues(localValues []string, remoteValues []string) []string {
+	merged := append(make([]string, 0, len(localValues)+len(remoteValues)), localValues...)
+	for _, value := range remoteValues {
+		if !containsString(merged, value) {
+			merged = append(merged, value)
+		}
+	}
+	return merged
+}
+
+// loadTypes populates the set of known local user-defined types from the database if it has not been populated yet
+func (p *planner) loadTypes(ctx context.Context) error {
+	if p.types != nil {
+		return nil
+	}
+	localTypes, err := getEnums(ctx, p.dbConnection)
+	if err != nil {
+		return err
+	}
+	p.types = make(map[typeKey]bool)
+	for _, localType := range localTypes {
+		p.types[typeKey{schema: localType.Schema, name: localType.Name}] = true
+	}
+	return nil
+}
+
+// loadImportedTypes populates the list of user-defined types fdwctl created from the database if it has not been
+// populated yet
+func (p *planner) loadImportedTypes(ctx context.Context) error {
+	if p.importedTypes != nil {
+		return nil
+	}
+	importedTypes, err := getImportedTypes(ctx, p.dbConnection)
+	if err != nil {
+		return err
+	}
+	p.importedTypes = importedTypes
+	return nil
+}
+
+// WritePlanFile saves a plan to the specified file in YAML format if the file name ends in .yaml or .yml and in JSON
+// format otherwise
+func WritePlanFile(fileName string, plan *model.Plan) error {
+	var planBytes []byte
+	var err error
+
+	log := logger.Log().
+		WithField("function", "WritePlanFile")
+	if strings.HasSuffix(fileName, ".yaml") || strings.HasSuffix(fileName, ".yml") {
+		planBytes, err = yaml.Marshal(plan)
+	} else {
+		planBytes, err = json.MarshalIndent(plan, "", "  ")
+	}
+	if err != nil {
+		return logger.ErrorfAsError(log, "error marshaling plan: %s", err)
+	}
+	err = os.WriteFile(fileName, planBytes, planFilePermissions)
+	if err != nil {
+		return logger.ErrorfAsError(log, "error writing plan file %s: %s", fileName, err)
+	}
+	return nil
+}
+
+// ReadPlanFile loads a plan that was saved with WritePlanFile. The statements of actions without a redacted
+// credential are restored from their SQL; actions with a redacted credential must be resolved with
+// ResolvePlanSecrets before they are executed.
+func ReadPlanFile(fileName string) (*model.Plan, error) {
+	log := logger.Log().
+		WithField("function", "ReadPlanFile")
+	planBytes, err := os.ReadFile(fileName)
+	if err != nil {
+		return nil, logger.ErrorfAsError(log, "error reading plan file %s: %s", fileName, err)
+	}
+	plan := model.NewPlan()
+	if strings.HasSuffix(fileName, ".yaml") || strings.HasSuffix(fileName, ".yml") {
+		err = yaml.Unmarshal(planBytes, plan)
+	} else {
+		err = json.Unmarshal(planBytes, plan)
+	}
+	if err != nil {
+		return nil, logger.ErrorfAsError(log, "error unmarshaling plan file %s: %s", fileName, err)
+	}
+	for idx, action := range plan.Actions {
+		if action.Step != idx+1 {
+			return nil, logger.ErrorfAsError(log, "plan file %s is out of order at step %d", fileName, action.Step)
+		}
+		if action.RedactedOption == "" {
+			plan.Actions[idx].Statement = action.SQL
+		}
+	}
+	return plan, nil
+}
+
+// ResolvePlanSecrets restores the statements of plan actions that contain a redacted user mapping credential by
+// resolving the credential of the matching user mapping in the desired state. The statement is rebuilt by replacing
+// the redacted value at the recorded position of the action's SQL, which must still be the redacted value of the
+// redacted option.
+func ResolvePlanSecrets(ctx context.Context, plan *model.Plan, dState model.DesiredState) error {
+	log := logger.Log(ctx).
+		WithField("function", "ResolvePlanSecrets")
+	redactedValue := QuoteLiteral(redactedSecretValue)
+	for idx, action := range plan.Actions {
+		if action.RedactedOption == "" {
+			continue
+		}
+		if action.RedactedOption != usermapOptionPassword {
+			return logger.ErrorfAsError(log, "step %d: cannot resolve redacted option %s", action.Step, action.RedactedOption)
+		}
+		optionPrefix := QuoteIdentifier(action.RedactedOption) + " "
+		start := action.RedactedPosition
+		end := start + len(redactedValue)
+		if start < len(optionPrefix) || end > len(action.SQL) ||
+			action.SQL[start-len(optionPrefix):start] != optionPrefix || action.SQL[start:end] != redactedValue {
+			return logger.ErrorfAsError(log, "step %d: redacted value of option %s is not at position %d of the statement", action.Step, action.RedactedOption, start)
+		}
+		dsServer := FindForeignServer(dState.Servers, action.ServerName)
+		if dsServer == nil {
+			return logger.ErrorfAsError(log, "step %d: cannot find desired state server %s", action.Step, action.ServerName)
+		}
+		dsUserMap := FindUserMap(dsServer.UserMaps, action.ObjectName)
+		if dsUserMap == nil || !dsUserMap.RemoteSecret.IsDefined() {
+			return logger.ErrorfAsError(log, "step %d: cannot find desired state credential for user mapping %s", action.Step, action.ObjectName)
+		}
+		secretValue, err := GetSecret(ctx, dsUserMap.RemoteSecret)
+		if err != nil {
+			return logger.ErrorfAsError(log, "step %d: error getting secret value: %s", action.Step, err)
+		}
+		plan.Actions[idx].Statement = action.SQL[:start] + QuoteLiteral(secretValue) + action.SQL[end:]
+	}
+	return nil
+}
+
+// VerifyPlanFingerprint determines if the current state of the database is the same state that the plan was
+// computed against
+func VerifyPlanFingerprint(ctx context.Context, dbConnection database.Executor, plan *model.Plan) error {
+	log := logger.Log(ctx).
+		WithField("function", "VerifyPlanFingerprint")
+	if plan.Fingerprint == "" {
+		return logger.ErrorfAsError(log, "plan does not have a fingerprint")
+	}
+	_, snapshot, err := getCatalogSnapshot(ctx, dbConnection)
+	if err != nil {
+		log.Errorf("error getting current state: %s", err)
+		return err
+	}
+	fingerprint, err := snapshot.fingerprint()
+	if err != nil {
+		log.Errorf("error computing fingerprint of current state: %s", err)
+		return err
+	}
+	if fingerprint != plan.Fingerprint {
+		return logger.ErrorfAsError(log, "the database has changed since the plan was computed (plan fingerprint %s, current fingerprint %s); compute a new plan", plan.Fingerprint, fingerprint)
+	}
+	return nil
+}
+
+// ExecutePlan executes the actions of a plan in order and stops at the first action that fails
+func ExecutePlan(ctx context.Context, dbConnection database.Executor, plan *model.Plan) error {
+	log := logger.Log(ctx).
+		WithField("function", "ExecutePlan")
+	for _, action := range plan.Actions {
+		log.Debugf("step %d of %d: %s", action.Step, len(plan.Actions), action.String())
+		log.Tracef("query: %s", action.SQL)
+		_, err := dbConnection.ExecContext(ctx, action.Statement)
+		if err != nil {
+			return logger.ErrorfAsError(log, "error executing step %d (%s): %s", action.Step, action.String(), err)
+		}
+		log.Infof("%s", action.String())
+	}
+	return nil
+}
+
+// ExecutePlanInTransaction executes the actions of a plan inside a single transaction. If any action fails then the
+// transaction is rolled back and the database is left as it was before the plan was executed. A plan with
+// non-transactional actions is refused on PostgreSQL versions before 12, which do not allow them inside a transaction.
+func ExecutePlanInTransaction(ctx context.Context, dbConnection *sql.DB, plan *model.Plan) error {
+	log := logger.Log(ctx).
+		WithField("function", "ExecutePlanInTransaction")
+	err := checkTransactionalPlan(ctx, dbConnection, plan)
+	if err != nil {
+		return err
+	}
+	tx, err := dbConnection.BeginTx(ctx, nil)
+	if err != nil {
+		return logger.ErrorfAsError(log, "error starting transaction: %s", err)
+	}
+	err = ExecutePlan(ctx, tx, plan)
+	if err != nil {
+		database.RollbackTransaction(ctx, tx)
+		log.Warn("transaction rolled back; no changes were made")
+		return err
+	}
+	err = tx.Commit()
+	if err != nil {
+		return logger.ErrorfAsError(log, "error committing transaction: %s", err)
+	}
+	return nil
+}
+
+// checkTransactionalPlan determines if every action of a plan can run inside a transaction on the connected
+// PostgreSQL server. The server version is only read when the plan has a non-transactional action.
+func checkTransactionalPlan(ctx context.Context, dbConnection database.Executor, plan *model.Plan) error {
+	log := logger.Log(ctx).
+		WithField("function", "checkTransactionalPlan")
+	for _, action := range plan.Actions {
+		if !action.NonTransactional {
+			continue
+		}
+		serverVersion, err := getServerVersionNum(ctx, dbConnection)
+		if err != nil {
+			log.Errorf("error getting server version: %s", err)
+			return err
+		}
+		if serverVersion >= minTransactionalAddValueVersion {
+			return nil
+		}
+		return logger.ErrorfAsError(log, "step %d (%s) cannot run inside a transaction on PostgreSQL versions before 12 (server version %d); use --notransaction to apply the plan", action.Step, action.String(), serverVersion)
+	}
+	return nil
+}
+
+// getServerVersionNum returns the version of the connected PostgreSQL server as a number, e.g. 120005 for 12.5
+func getServerVersionNum(ctx context.Context, dbConnection database.Executor) (int, error) {
+	log := logger.Log(ctx).
+		WithField("function", "getServerVersionNum")
+	log.Tracef("query: %s", sqlServerVersionNum)
+	versionRows, err := dbConnection.QueryContext(ctx, sqlServerVersionNum)
+	if err != nil {
+		log.Errorf("error querying server version: %s", err)
+		return 0, err
+	}
+	defer database.CloseRows(ctx, versionRows)
+	serverVersion := 0
+	if versionRows.Next() {
+		err = versionRows.Scan(&serverVersion)
+		if err != nil {
+			log.Errorf("error scanning result row: %s", err)
+			return 0, err
+		}
+	}
+	if versionRows.Err() != nil {
+		log.Errorf("error iterating result rows: %s", versionRows.Err())
+		return 0, versionRows.Err()
+	}
+	return serverVersion, nil
+}
@@ -0,0 +1,372 @@
+package util
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/neflyte/fdwctl/lib/model"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUnit_PlanDesiredState_EmptyDatabase(t *testing.T) {
+	db, mock := newSQLMock(t)
+	defer closeSQLMock(t, db)
+
+	mock.ExpectQuery(regexp.QuoteMeta(sqlGetExtensions)).
+		WillReturnRows(sqlmock.NewRows([]string{"extname", "extversion"})).
+		RowsWillBeClosed()
+	mock.ExpectQuery(regexp.QuoteMeta(sqlForeignServerInfo)).
+		WillReturnRows(sqlmock.NewRows([]string{"srvname", "fdwname", "owner", "server_comment", "option_name", "option_value"})).
+		RowsWillBeClosed()
+	expectCatalog(mock)
+	expectNoImportedTypes(mock)
+	mock.ExpectClose()
+
+	dState := model.DesiredState{
+		Extensions: []model.Extension{
+			{Name: "postgres_fdw"},
+		},
+		Servers: []model.ForeignServer{
+			{
+				Name: "remotedb",
+				Host: "remotehost",
+				Port: 5432,
+				DB:   "remotedb",
+				UserMaps: []model.UserMap{
+					{
+						LocalUser:    "fdw",
+						RemoteUser:   "remoteuser",
+						RemoteSecret: model.Secret{Value: "s3cret"},
+					},
+				},
+			},
+		},
+	}
+	plan, err := PlanDesiredState(context.Background(), db, dState, PlanOptions{})
+	require.Nil(t, err)
+	require.NotNil(t, plan)
+	require.Len(t, plan.Actions, 4)
+
+	require.Equal(t, 1, plan.Actions[0].Step)
+	require.Equal(t, model.OperationCreate, plan.Actions[0].Operation)
+	require.Equal(t, model.ObjectExtension, plan.Actions[0].ObjectType)
+	require.Equal(t, `CREATE EXTENSION IF NOT EXISTS "postgres_fdw"`, plan.Actions[0].SQL)
+
+	require.Equal(t, 2, plan.Actions[1].Step)
+	require.Equal(t, model.ObjectServer, plan.Actions[1].ObjectType)
+	require.Equal(t, "remotedb", plan.Actions[1].ObjectName)
+
+	require.Equal(t, 3, plan.Actions[2].Step)
+	require.Equal(t, model.ObjectServer, plan.Actions[2].ObjectType)
+	require.Equal(t, `COMMENT ON SERVER "remotedb" IS 'fdwctl:{"managed":true}'`, plan.Actions[2].SQL)
+
+	require.Equal(t, 4, plan.Actions[3].Step)
+	require.Equal(t, model.ObjectUserMap, plan.Actions[3].ObjectType)
+	require.Equal(t, "remotedb", plan.Actions[3].ServerName)
+	require.True(t, strings.Contains(plan.Actions[3].Statement, "s3cret"))
+	require.False(t, strings.Contains(plan.Actions[3].SQL, "s3cret"))
+	require.True(t, strings.Contains(plan.Actions[3].SQL, redactedSecretValue))
+	closeSQLMock(t, db)
+	require.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestUnit_ExecutePlan_StopsAtFailedStep(t *testing.T) {
+	db, mock := newSQLMock(t)
+	defer closeSQLMock(t, db)
+
+	plan := model.NewPlan()
+	plan.Add(model.PlanAction{
+		Operation:  model.OperationCreate,
+		ObjectType: model.ObjectExtension,
+		ObjectName: "postgres_fdw",
+		Statement:  `CREATE EXTENSION IF NOT EXISTS "postgres_fdw"`,
+	})
+	plan.Add(model.PlanAction{
+		Operation:  model.OperationDrop,
+		ObjectType: model.ObjectServer,
+		ObjectName: "remotedb",
+		Statement:  `DROP SERVER "remotedb" CASCADE`,
+	})
+	plan.Add(model.PlanAction{
+		Operation:  model.OperationDrop,
+		ObjectType: model.ObjectServer,
+		ObjectName: "otherdb",
+		Statement:  `DROP SERVER "otherdb" CASCADE`,
+	})
+
+	mock.ExpectExec(regexp.QuoteMeta(plan.Actions[0].Statement)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta(plan.Actions[1].Statement)).
+		WillReturnError(errors.New("EXEC ERROR"))
+	mock.ExpectClose()
+
+	err := ExecutePlan(context.Background(), db, plan)
+	require.NotNil(t, err)
+	require.True(t, strings.Contains(err.Error(), "step 2"))
+	require.True(t, strings.Contains(err.Error(), "EXEC ERROR"))
+	closeSQLMock(t, db)
+	require.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestUnit_ExecutePlanInTransaction_Commit(t *testing.T) {
+	db, mock := newSQLMock(t)
+	defer closeSQLMock(t, db)
+
+	plan := model.NewPlan()
+	plan.Add(model.PlanAction{
+		Operation:  model.OperationCreate,
+		ObjectType: model.ObjectExtension,
+		ObjectName: "postgres_fdw",
+		Statement:  `CREATE EXTENSION IF NOT EXISTS "postgres_fdw"`,
+	})
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(plan.Actions[0].Statement)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	mock.ExpectClose()
+
+	err := ExecutePlanInTransaction(context.Background(), db, plan)
+	require.Nil(t, err)
+	closeSQLMock(t, db)
+	require.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestUnit_ExecutePlanInTransaction_RollbackOnError(t *testing.T) {
+	db, mock := newSQLMock(t)
+	defer closeSQLMock(t, db)
+
+	plan := model.NewPlan()
+	plan.Add(model.PlanAction{
+		Operation:  model.OperationDrop,
+		ObjectType: model.ObjectServer,
+		ObjectName: "remotedb",
+		Statement:  `DROP SERVER "remotedb" CASCADE`,
+	})
+	plan.Add(model.PlanAction{
+		Operation:  model.OperationCreate,
+		ObjectType: model.ObjectSchema,
+		ObjectName: "remotedb",
+		Statement:  `CREATE SCHEMA "remotedb"`,
+	})
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(plan.Actions[0].Statement)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta(plan.Actions[1].Statement)).
+		WillReturnError(errors.New("EXEC ERROR"))
+	mock.ExpectRollback()
+	mock.ExpectClose()
+
+	err := ExecutePlanInTransaction(context.Background(), db, plan)
+	require.NotNil(t, err)
+	require.True(t, strings.Contains(err.Error(), "step 2"))
+	closeSQLMock(t, db)
+	require.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestUnit_ExecutePlanInTransaction_NonTransactional(t *testing.T) {
+	db, mock := newSQLMock(t)
+	defer closeSQLMock(t, db)
+
+	plan := model.NewPlan()
+	plan.Add(model.PlanAction{
+		Operation:  model.OperationCreate,
+		ObjectType: model.ObjectSchema,
+		ObjectName: "remotedb",
+		Statement:  `CREATE SCHEMA "remotedb"`,
+	})
+	plan.Add(model.PlanAction{
+		Operation:        model.OperationUpdate,
+		ObjectType:       model.ObjectEnum,
+		ObjectName:       "public.color",
+		Statement:        `ALTER TYPE "public"."color" ADD VALUE 'blue' AFTER 'green'`,
+		NonTransactional: true,
+	})
+	plan.Add(model.PlanAction{
+		Operation:  model.OperationCreate,
+		ObjectType: model.ObjectSchema,
+		ObjectName: "otherdb",
+		Statement:  `CREATE SCHEMA "otherdb"`,
+	})
+
+	// PostgreSQL 11 cannot add an enum value inside a transaction
+	mock.ExpectQuery(regexp.QuoteMeta(sqlServerVersionNum)).
+		WillReturnRows(sqlmock.NewRows([]string{"current_setting"}).AddRow(110005)).
+		RowsWillBeClosed()
+	// PostgreSQL 12 adds it inside the single transaction, which is rolled back as a whole
+	mock.ExpectQuery(regexp.QuoteMeta(sqlServerVersionNum)).
+		WillReturnRows(sqlmock.NewRows([]string{"current_setting"}).AddRow(120000)).
+		RowsWillBeClosed()
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(plan.Actions[0].Statement)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta(plan.Actions[1].Statement)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta(plan.Actions[2].Statement)).
+		WillReturnError(errors.New("EXEC ERROR"))
+	mock.ExpectRollback()
+	mock.ExpectClose()
+
+	err := ExecutePlanInTransaction(context.Background(), db, plan)
+	require.NotNil(t, err)
+	require.True(t, strings.Contains(err.Error(), "step 2"))
+	require.True(t, strings.Contains(err.Error(), "--notransaction"))
+	err = ExecutePlanInTransaction(context.Background(), db, plan)
+	require.NotNil(t, err)
+	require.True(t, strings.Contains(err.Error(), "step 3"))
+	closeSQLMock(t, db)
+	require.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestUnit_catalogSnapshot_fingerprint(t *testing.T) {
+	stateOne := model.DesiredState{
+		Extensions: []model.Extension{{Name: "postgres_fdw"}, {Name: "file_fdw"}},
+		Servers: []model.ForeignServer{
+			{Name: "one", UserMaps: []model.UserMap{{LocalUser: "a"}, {LocalUser: "b"}}},
+			{Name: "two"},
+		},
+	}
+	stateTwo := model.DesiredState{
+		Extensions: []model.Extension{{Name: "file_fdw"}, {Name: "postgres_fdw"}},
+		Servers: []model.ForeignServer{
+			{Name: "two"},
+			{Name: "one", UserMaps: []model.UserMap{{LocalUser: "b"}, {LocalUser: "a"}}},
+		},
+	}
+	snapshot := &catalogSnapshot{State: stateOne}
+	fingerprintOne, err := snapshot.fingerprint()
+	require.Nil(t, err)
+	snapshot = &catalogSnapshot{State: stateTwo}
+	fingerprintTwo, err := snapshot.fingerprint()
+	require.Nil(t, err)
+	require.Equal(t, fingerprintOne, fingerprintTwo)
+	// The supplied state is not reordered
+	require.Equal(t, "postgres_fdw", stateOne.Extensions[0].Name)
+	require.Equal(t, "b", stateTwo.Servers[1].UserMaps[0].LocalUser)
+
+	stateTwo.Servers[0].Host = "otherhost"
+	fingerprintTwo, err = snapshot.fingerprint()
+	require.Nil(t, err)
+	require.NotEqual(t, fingerprintOne, fingerprintTwo)
+	// The rest of the catalog that a plan depends on is part of the fingerprint
+	for _, changed := range []*catalogSnapshot{
+		{State: stateOne, Comments: map[string]string{"server one": `fdwctl:{"managed":true}`}},
+		{State: stateOne, Privileges: map[string][]string{"remotedb": {"default reporting SELECT"}}},
+		{State: stateOne, Types: []*model.SchemaType{{Schema: "public", Name: "color", Kind: model.ObjectEnum, Values: []string{"red"}}}},
+		{State: stateOne, TypeSchemas: map[string]int{"types": 0}},
+		{State: stateOne, TypeUsages: []string{"public.color reports "}},
+		{State: stateOne, ManagedRoles: []string{"alice"}},
+	} {
+		fingerprintTwo, err = changed.fingerprint()
+		require.Nil(t, err)
+		require.NotEqual(t, fingerprintOne, fingerprintTwo)
+	}
+}
+
+func TestUnit_getCatalogSnapshot(t *testing.T) {
+	db, mock := newSQLMock(t)
+	defer closeSQLMock(t, db)
+
+	mock.ExpectQuery(regexp.QuoteMeta(sqlGetExtensions)).
+		WillReturnRows(sqlmock.NewRows([]string{"extname", "extversion"})).
+		RowsWillBeClosed()
+	mock.ExpectQuery(regexp.QuoteMeta(sqlForeignServerInfo)).
+		WillReturnRows(sqlmock.NewRows([]string{"srvname", "fdwname", "owner", "server_comment", "option_name", "option_value"})).
+		RowsWillBeClosed()
+	mock.ExpectQuery(regexp.QuoteMeta(sqlGetLocalTypes)).
+		WillReturnRows(
+			sqlmock.NewRows([]string{"nspname", "typname", "typtype", "comment", "enumlabel"}).
+				AddRow("public", "color", "e", "", "red").
+				AddRow("public", "color", "e", "", "green").
+				AddRow("types", "amount", "d", `fdwctl:{"importedFor":["remotedb"]}`, ""),
+		).
+		RowsWillBeClosed()
+	mock.ExpectQuery(regexp.QuoteMeta(sqlGetTypeSchemas)).
+		WillReturnRows(sqlmock.NewRows([]string{"nspname", "object_count"}).AddRow("types", 0)).
+		RowsWillBeClosed()
+	mock.ExpectQuery(regexp.QuoteMeta(sqlTypeUsages)).
+		WillReturnRows(sqlmock.NewRows([]string{"type_schema", "type_name", "table_schema", "server_name"})).
+		RowsWillBeClosed()
+	mock.ExpectQuery(regexp.QuoteMeta(sqlGetRoleComments)).
+		WillReturnRows(sqlmock.NewRows([]string{"rolname", "shobj_description"}).AddRow("alice", managedComment)).
+		RowsWillBeClosed()
+	mock.ExpectClose()
+
+	_, snapshot, err := getCatalogSnapshot(context.Background(), db)
+	require.Nil(t, err)
+	require.Equal(t, []*model.SchemaType{
+		{Schema: "public", Name: "color", Kind: model.ObjectEnum, Values: []string{"red", "green"}},
+		{Schema: "types", Name: "amount", Kind: model.ObjectDomain, Comment: `fdwctl:{"importedFor":["remotedb"]}`},
+	}, snapshot.Types)
+	require.Equal(t, map[string]int{"types": 0}, snapshot.TypeSchemas)
+	require.Equal(t, []string{"alice"}, snapshot.ManagedRoles)
+	closeSQLMock(t, db)
+	require.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestUnit_PlanFile_RoundTrip(t *testing.T) {
+	// The remote user looks like the redacted password and comes before it in the statement
+	usermap := model.UserMap{
+		ServerName:   "remotedb",
+		LocalUser:    "fdw",
+		RemoteUser:   redactedSecretValue,
+		RemoteSecret: model.Secret{Value: "s3cret"},
+		Options:      map[string]string{"fetch_size": redactedSecretValue},
+	}
+	redactedStatement, position := createUserMapStatement(usermap, redactedSecretValue)
+	plan := model.NewPlan()
+	plan.Fingerprint = "abc123"
+	plan.Add(model.PlanAction{
+		Operation:  model.OperationDrop,
+		ObjectType: model.ObjectServer,
+		ObjectName: "remotedb",
+		Statement:  `DROP SERVER "remotedb" CASCADE`,
+	})
+	plan.Add(redactedUserMapAction(model.PlanAction{
+		Operation:  model.OperationCreate,
+		ObjectType: model.ObjectUserMap,
+		ObjectName: "fdw",
+		ServerName: "remotedb",
+		Statement:  createUserMapSQL(usermap, "s3cret"),
+		SQL:        redactedStatement,
+	}, position))
+	require.Equal(t, `CREATE USER MAPPING FOR "fdw" SERVER "remotedb" OPTIONS ("fetch_size" '********', "password" '********', "user" '********')`, plan.Actions[1].SQL)
+	require.Equal(t, usermapOptionPassword, plan.Actions[1].RedactedOption)
+	for _, fileName := range []string{"plan.json", "plan.yaml"} {
+		planFile := filepath.Join(t.TempDir(), fileName)
+		err := WritePlanFile(planFile, plan)
+		require.Nil(t, err)
+
+		actual, err := ReadPlanFile(planFile)
+		require.Nil(t, err)
+		require.Equal(t, plan.Fingerprint, actual.Fingerprint)
+		require.Len(t, actual.Actions, 2)
+		require.Equal(t, plan.Actions[0].Statement, actual.Actions[0].Statement)
+		require.Equal(t, "", actual.Actions[1].Statement)
+
+		err = ResolvePlanSecrets(context.Background(), actual, model.DesiredState{
+			Servers: []model.ForeignServer{
+				{Name: "remotedb", UserMaps: []model.UserMap{usermap}},
+			},
+		})
+		require.Nil(t, err)
+		require.Equal(t, plan.Actions[1].Statement, actual.Actions[1].Statement)
+
+		// A statement whose redacted value is not at the recorded position is not resolved
+		actual.Actions[1].Statement = ""
+		actual.Actions[1].RedactedPosition--
+		err = ResolvePlanSecrets(context.Background(), actual, model.DesiredState{
+			Servers: []model.ForeignServer{
+				{Name: "remotedb", UserMaps: []model.UserMap{usermap}},
+			},
+		})
+		require.NotNil(t, err)
+		require.Equal(t, "", actual.Actions[1].Statement)
+	}
+}
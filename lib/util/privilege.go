@@ -0,0 +1,516 @@
+package util
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/neflyte/fdwctl/lib/database"
+	"github.com/neflyte/fdwctl/lib/logger"
+	"github.com/neflyte/fdwctl/lib/model"
+)
+
+const (
+	sqlGetSchemaTables = `SELECT c.relname
+	FROM pg_class c
+	JOIN pg_namespace n ON n.oid = c.relnamespace
+	WHERE n.nspname = $1 AND c.relkind IN ('r', 'v', 'm', 'f', 'p') AND NOT c.relispartition
+	ORDER BY c.relname`
+	sqlGetSchemaPrivileges = `SELECT 'usage' AS kind, CASE WHEN a.grantee = 0 THEN 'PUBLIC' ELSE r.rolname END AS grantee, '' AS table_name, a.privilege_type
+	FROM pg_namespace n
+	CROSS JOIN LATERAL aclexplode(n.nspacl) a
+	LEFT JOIN pg_roles r ON r.oid = a.grantee
+	WHERE n.nspname = $1 AND a.privilege_type = 'USAGE' AND a.grantee <> n.nspowner
+	UNION ALL
+	SELECT 'default', CASE WHEN a.grantee = 0 THEN 'PUBLIC' ELSE r.rolname END, '', a.privilege_type
+	FROM pg_default_acl d
+	JOIN pg_namespace n ON n.oid = d.defaclnamespace
+	CROSS JOIN LATERAL aclexplode(d.defaclacl) a
+	LEFT JOIN pg_roles r ON r.oid = a.grantee
+	WHERE n.nspname = $1 AND d.defaclobjtype = 'r' AND d.defaclrole = (SELECT oid FROM pg_roles WHERE rolname = current_user)
+	AND a.grantee <> d.defaclrole AND a.privilege_type IN ('SELECT', 'INSERT', 'UPDATE', 'DELETE', 'TRUNCATE', 'REFERENCES')
+	UNION ALL
+	SELECT 'table', g.grantee, g.table_name, g.privilege_type
+	FROM information_schema.role_table_grants g
+	WHERE g.table_schema = $1 AND g.grantee <> g.grantor
+	AND g.privilege_type IN ('SELECT', 'INSERT', 'UPDATE', 'DELETE', 'TRUNCATE', 'REFERENCES')
+	ORDER BY 1, 2, 3, 4`
+	sqlGrantSchemaUsage        = `GRANT USAGE ON SCHEMA %s TO %s`
+	sqlRevokeSchemaUsage       = `REVOKE USAGE ON SCHEMA %s FROM %s`
+	sqlGrantAllTables          = `GRANT %s ON ALL TABLES IN SCHEMA %s TO %s`
+	sqlGrantTable              = `GRANT %s ON TABLE %s TO %s`
+	sqlRevokeTable             = `REVOKE %s ON TABLE %s FROM %s`
+	sqlGrantDefaultPrivileges  = `ALTER DEFAULT PRIVILEGES IN SCHEMA %s GRANT %s ON TABLES TO %s`
+	sqlRevokeDefaultPrivileges = `ALTER DEFAULT PRIVILEGES IN SCHEMA %s REVOKE %s ON TABLES FROM %s`
+
+	// schemaPrivilegeKindUsage is the kind of a privileges row that grants usage on the schema
+	schemaPrivilegeKindUsage = "usage"
+	// schemaPrivilegeKindDefault is the kind of a privileges row that grants a privilege by default on new tables
+	schemaPrivilegeKindDefault = "default"
+	// schemaPrivilegeKindTable is the kind of a privileges row that grants a privilege on a table
+	schemaPrivilegeKindTable = "table"
+	// privilegeAll is the privilege that stands for every table privilege
+	privilegeAll = "ALL"
+	// privilegeSelect is the privilege that is granted to the users of a schema's grants
+	privilegeSelect = "SELECT"
+	// allTables is the table name under which the privileges held on every table of a schema are recorded
+	allTables = ""
+	// privilegeListSeparator separates the privileges of a GRANT or REVOKE statement
+	privilegeListSeparator = ", "
+)
+
+var (
+	// tablePrivileges are the table privileges that can be granted on the tables of a schema in the order they are
+	// written in statements
+	tablePrivileges = []string{"SELECT", "INSERT", "UPDATE", "DELETE", "TRUNCATE", "REFERENCES"}
+)
+
+// privilegeSet is a set of table privileges
+type privilegeSet map[string]bool
+
+// sorted returns the privileges in the set in the order of tablePrivileges
+func (ps privilegeSet) sorted() []string {
+	privileges := make([]string, 0, len(ps))
+	for _, privilege := range tablePrivileges {
+		if ps[privilege] {
+			privileges = append(privileges, privilege)
+		}
+	}
+	return privileges
+}
+
+// String returns the privileges in the set as they are written in a GRANT or REVOKE statement
+func (ps privilegeSet) String() string {
+	return strings.Join(ps.sorted(), privilegeListSeparator)
+}
+
+// minus returns the privileges in this set that are not in the other set
+func (ps privilegeSet) minus(other privilegeSet) privilegeSet {
+	result := make(privilegeSet)
+	for privilege := range ps {
+		if !other[privilege] {
+			result[privilege] = true
+		}
+	}
+	return result
+}
+
+// roleGrantSet maps a role to the privileges it holds on each table of a schema. The privileges a role holds on every
+// table, including tables that are created later, are stored under the allTables table name.
+type roleGrantSet map[string]map[string]privilegeSet
+
+// add records privileges of a role on a table; the role is recorded even if there are no privileges
+func (rgs roleGrantSet) add(role string, table string, privileges ...string) {
+	role = canonicalGrantee(role)
+	if rgs[role] == nil {
+		rgs[role] = map[string]privilegeSet{allTables: make(privilegeSet)}
+	}
+	if rgs[role][table] == nil {
+		rgs[role][table] = make(privilegeSet)
+	}
+	for _, privilege := range privileges {
+		rgs[role][table][privilege] = true
+	}
+}
+
+// privileges returns the privileges a role holds on a table, including the privileges it holds on every table
+func (rgs roleGrantSet) privileges(role string, table string) privilegeSet {
+	result := make(privilegeSet)
+	for privilege := range rgs[role][allTables] {
+		result[privilege] = true
+	}
+	for privilege := range rgs[role][table] {
+		result[privilege] = true
+	}
+	return result
+}
+
+// roles returns the roles in the set in sorted order
+func (rgs roleGrantSet) roles() []string {
+	roles := make([]string, 0, len(rgs))
+	for role := range rgs {
+		roles = append(roles, role)
+	}
+	sort.Strings(roles)
+	return roles
+}
+
+// schemaPrivileges represents the privileges that have been granted on a local schema and its tables
+type schemaPrivileges struct {
+	// usage is the set of roles that have been granted usage on the schema
+	usage map[string]bool
+	// defaults maps a role to the privileges it is granted by default on tables created in the schema
+	defaults map[string]privilegeSet
+	// tables maps a table to the privileges each role has been granted on it
+	tables map[string]map[string]privilegeSet
+}
+
+// entries returns a sorted description of every privilege and of the supplied tables of the schema
+func (sp schemaPrivileges) entries(tables []string) []string {
+	entries := make([]string, 0)
+	for _, table := range tables {
+		entries = append(entries, fmt.Sprintf("table %s", table))
+	}
+	for role := range sp.usage {
+		entries = append(entries, fmt.Sprintf("usage %s", role))
+	}
+	for role, privileges := range sp.defaults {
+		entries = append(entries, fmt.Sprintf("default %s %s", role, privileges))
+	}
+	for table, rolePrivileges := range sp.tables {
+		for role, privileges := range rolePrivileges {
+			entries = append(entries, fmt.Sprintf("grant %s %s %s", table, role, privileges))
+		}
+	}
+	sort.Strings(entries)
+	return entries
+}
+
+// newSchemaPrivileges returns an empty schemaPrivileges
+func newSchemaPrivileges() schemaPrivileges {
+	return schemaPrivileges{
+		usage:    make(map[string]bool),
+		defaults: make(map[string]privilegeSet),
+		tables:   make(map[string]map[string]privilegeSet),
+	}
+}
+
+// normalizePrivileges upper-cases the supplied privileges, expands ALL, and returns them in statement order. An error
+// is returned if a privilege is not a table privilege.
+func normalizePrivileges(privileges []string) ([]string, error) {
+	privSet := make(privilegeSet)
+	for _, privilege := range privileges {
+		privilege = strings.ToUpper(strings.TrimSpace(privilege))
+		if privilege == privilegeAll {
+			for _, tablePrivilege := range tablePrivileges {
+				privSet[tablePrivilege] = true
+			}
+			continue
+		}
+		if !containsString(tablePrivileges, privilege) {
+			return nil, fmt.Errorf("invalid privilege %q; expected one of %s or %s", privilege, strings.Join(tablePrivileges, ", "), privilegeAll)
+		}
+		privSet[privilege] = true
+	}
+	return privSet.sorted(), nil
+}
+
+// ValidateSchemaGrants determines if every role grant of the supplied schema names a role and only table privileges
+func ValidateSchemaGrants(schema model.Schema) error {
+	if schema.SchemaGrants == nil {
+		return nil
+	}
+	for _, roleGrant := range schema.SchemaGrants.Roles {
+		if strings.TrimSpace(roleGrant.Role) == "" {
+			return fmt.Errorf("schema %s: a role grant does not name a role", schema.LocalSchema)
+		}
+		_, err := normalizePrivileges(roleGrant.Privileges)
+		if err != nil {
+			return fmt.Errorf("schema %s: role %s: %s", schema.LocalSchema, roleGrant.Role, err)
+		}
+	}
+	return nil
+}
+
+// grantSetOf returns the privileges described by the grants of a schema. Each user is granted SELECT on every table
+// and each role grant applies to its tables or, if it has none, to every table. Invalid privileges are ignored; the
+// grants are expected to have been validated with ValidateSchemaGrants.
+func grantSetOf(grants model.Grants) roleGrantSet {
+	grantSet := make(roleGrantSet)
+	for _, user := range grants.Users {
+		grantSet.add(user, allTables, privilegeSelect)
+	}
+	for _, roleGrant := range grants.Roles {
+		privileges, _ := normalizePrivileges(roleGrant.Privileges)
+		if len(roleGrant.Tables) == 0 {
+			grantSet.add(roleGrant.Role, allTables, privileges...)
+			continue
+		}
+		for _, table := range roleGrant.Tables {
+			grantSet.add(roleGrant.Role, table, privileges...)
+		}
+	}
+	return grantSet
+}
+
+// grantSet returns the privileges of the schema in the form of a roleGrantSet. A privilege is held on every table
+// when it is granted by default and it has been granted on each of the supplied tables of the schema.
+func (sp schemaPrivileges) grantSet(tables []string) roleGrantSet {
+	grantSet := make(roleGrantSet)
+	for role := range sp.usage {
+		grantSet.add(role, allTables)
+	}
+	for role, defaultPrivileges := range sp.defaults {
+		onEveryTable := make(privilegeSet)
+		for privilege := range defaultPrivileges {
+			onEveryTable[privilege] = true
+		}
+		for _, table := range tables {
+			for privilege := range onEveryTable {
+				if !sp.tables[table][role][privilege] {
+					delete(onEveryTable, privilege)
+				}
+			}
+		}
+		grantSet.add(role, allTables, onEveryTable.sorted()...)
+	}
+	for table, rolePrivileges := range sp.tables {
+		for role, privileges := range rolePrivileges {
+			grantSet.add(role, table, privileges.minus(grantSet[role][allTables]).sorted()...)
+		}
+	}
+	return grantSet
+}
+
+// canonicalGrants returns the privileges of a roleGrantSet as grants in canonical form: roles are sorted, each role
+// has a role grant for every table followed by role grants for the tables that have additional privileges, and
+// tables with the same additional privileges share a role grant.
+func canonicalGrants(grantSet roleGrantSet) model.Grants {
+	grants := model.Grants{
+		Roles: make([]model.RoleGrant, 0),
+	}
+	for _, role := range grantSet.roles() {
+		allTablePrivileges := grantSet[role][allTables]
+		grants.Roles = append(grants.Roles, model.RoleGrant{
+			Role:       role,
+			Privileges: allTablePrivileges.sorted(),
+		})
+		tablesByPrivileges := make(map[string][]string)
+		privilegeLists := make([]string, 0)
+		for table, privileges := range grantSet[role] {
+			if table == allTables {
+				continue
+			}
+			extraPrivileges := privileges.minus(allTablePrivileges)
+			if len(extraPrivileges) == 0 {
+				continue
+			}
+			privilegeList := extraPrivileges.String()
+			if tablesByPrivileges[privilegeList] == nil {
+				privilegeLists = append(privilegeLists, privilegeList)
+			}
+			tablesByPrivileges[privilegeList] = append(tablesByPrivileges[privilegeList], table)
+		}
+		for _, privilegeList := range privilegeLists {
+			sort.Strings(tablesByPrivileges[privilegeList])
+		}
+		sort.Slice(privilegeLists, func(i, j int) bool {
+			return tablesByPrivileges[privilegeLists[i]][0] < tablesByPrivileges[privilegeLists[j]][0]
+		})
+		for _, privilegeList := range privilegeLists {
+			grants.Roles = append(grants.Roles, model.RoleGrant{
+				Role:       role,
+				Privileges: strings.Split(privilegeList, privilegeListSeparator),
+				Tables:     tablesByPrivileges[privilegeList],
+			})
+		}
+	}
+	return grants
+}
+
+// NormalizeGrants returns the supplied schema grants in canonical form so that grants which have the same effect are
+// equal; users are expressed as role grants of SELECT on every table
+func NormalizeGrants(grants model.Grants) model.Grants {
+	return canonicalGrants(grantSetOf(grants))
+}
+
+// describeRoleGrants returns a printable description of the role grants of a role in canonical grants
+func describeRoleGrants(grants model.Grants, role string) string {
+	descriptions := make([]string, 0)
+	for _, roleGrant := range grants.Roles {
+		if roleGrant.Role != role {
+			continue
+		}
+		tables := "all tables"
+		if len(roleGrant.Tables) > 0 {
+			tables = strings.Join(roleGrant.Tables, ", ")
+		}
+		descriptions = append(descriptions, fmt.Sprintf("%s: %s", tables, strings.Join(roleGrant.Privileges, ", ")))
+	}
+	return strings.Join(descriptions, "; ")
+}
+
+// getSchemaTables returns the names of the tables, views, and foreign tables in the named schema; partitions are left
+// out since IMPORT FOREIGN SCHEMA does not import them
+func getSchemaTables(ctx context.Context, dbConnection database.Executor, schemaName string) ([]string, error) {
+	log := logger.Log(ctx).
+		WithField("function", "getSchemaTables")
+	log.Tracef("query: %s, args: %#v", sqlGetSchemaTables, schemaName)
+	tableRows, err := dbConnection.QueryContext(ctx, sqlGetSchemaTables, schemaName)
+	if err != nil {
+		log.Errorf("error querying schema tables: %s", err)
+		return nil, err
+	}
+	defer database.CloseRows(ctx, tableRows)
+	tables := make([]string, 0)
+	var table string
+	for tableRows.Next() {
+		err = tableRows.Scan(&table)
+		if err != nil {
+			log.Errorf("error scanning result row: %s", err)
+			return nil, err
+		}
+		tables = append(tables, table)
+	}
+	if tableRows.Err() != nil {
+		log.Errorf("error iterating result rows: %s", tableRows.Err())
+		return nil, tableRows.Err()
+	}
+	return tables, nil
+}
+
+// getSchemaPrivileges returns the privileges that have been granted on the local schema and its tables along with
+// the names of its tables. Privileges held by the owners of the schema and its tables are not included.
+func getSchemaPrivileges(ctx context.Context, dbConnection database.Executor, schemaName string) (schemaPrivileges, []string, error) {
+	log := logger.Log(ctx).
+		WithField("function", "getSchemaPrivileges")
+	privileges := newSchemaPrivileges()
+	tables, err := getSchemaTables(ctx, dbConnection, schemaName)
+	if err != nil {
+		return privileges, nil, err
+	}
+	log.Tracef("query: %s, args: %#v", sqlGetSchemaPrivileges, schemaName)
+	privilegeRows, err := dbConnection.QueryContext(ctx, sqlGetSchemaPrivileges, schemaName)
+	if err != nil {
+		log.Errorf("error querying schema privileges: %s", err)
+		return privileges, nil, err
+	}
+	defer database.CloseRows(ctx, privilegeRows)
+	var kind, grantee, table, privilege string
+	for privilegeRows.Next() {
+		err = privilegeRows.Scan(&kind, &grantee, &table, &privilege)
+		if err != nil {
+			log.Errorf("error scanning result row: %s", err)
+			return privileges, nil, err
+		}
+		grantee = canonicalGrantee(grantee)
+		switch kind {
+		case schemaPrivilegeKindUsage:
+			privileges.usage[grantee] = true
+		case schemaPrivilegeKindDefault:
+			if privileges.defaults[grantee] == nil {
+				privileges.defaults[grantee] = make(privilegeSet)
+			}
+			privileges.defaults[grantee][privilege] = true
+		case schemaPrivilegeKindTable:
+			if privileges.tables[table] == nil {
+				privileges.tables[table] = make(map[string]privilegeSet)
+			}
+			if privileges.tables[table][grantee] == nil {
+				privileges.tables[table][grantee] = make(privilegeSet)
+			}
+			privileges.tables[table][grantee][privilege] = true
+		}
+	}
+	if privilegeRows.Err() != nil {
+		log.Errorf("error iterating result rows: %s", privilegeRows.Err())
+		return privileges, nil, privilegeRows.Err()
+	}
+	return privileges, tables, nil
+}
+
+// GetSchemaGrants returns the privileges that have been granted on the local schema and its tables as grants in
+// canonical form
+func GetSchemaGrants(ctx context.Context, dbConnection database.Executor, schemaName string) (model.Grants, error) {
+	privileges, tables, err := getSchemaPrivileges(ctx, dbConnection, schemaName)
+	if err != nil {
+		return model.Grants{}, err
+	}
+	return canonicalGrants(privileges.grantSet(tables)), nil
+}
+
+// schemaGrantSQL returns the statements that revoke and grant privileges on the local schema and its tables so that
+// the current privileges match the supplied grants. When tables is nil the schema is about to be imported; privileges
+// on every table are granted with a single statement and only tables named by the grants are granted individually.
+// Privileges on every table are also granted by default so that tables imported later receive them.
+func schemaGrantSQL(schemaName string, grants model.Grants, tables []string, current schemaPrivileges) (revokeStatements []string, grantStatements []string) {
+	revokeStatements = make([]string, 0)
+	grantStatements = make([]string, 0)
+	desired := grantSetOf(grants)
+	quotedSchema := QuoteIdentifier(schemaName)
+	// Revoke table privileges, default privileges, and usage that are not in the grants
+	currentTables := make([]string, 0, len(current.tables))
+	for table := range current.tables {
+		currentTables = append(currentTables, table)
+	}
+	sort.Strings(currentTables)
+	for _, table := range currentTables {
+		roles := make([]string, 0, len(current.tables[table]))
+		for role := range current.tables[table] {
+			roles = append(roles, role)
+		}
+		sort.Strings(roles)
+		for _, role := range roles {
+			extraPrivileges := current.tables[table][role].minus(desired.privileges(role, table))
+			if len(extraPrivileges) > 0 {
+				revokeStatements = append(revokeStatements, fmt.Sprintf(sqlRevokeTable, extraPrivileges, QuoteQualifiedIdentifier(schemaName, table), granteeSQL(role)))
+			}
+		}
+	}
+	defaultRoles := make([]string, 0, len(current.defaults))
+	for role := range current.defaults {
+		defaultRoles = append(defaultRoles, role)
+	}
+	sort.Strings(defaultRoles)
+	for _, role := range defaultRoles {
+		extraPrivileges := current.defaults[role].minus(desired[role][allTables])
+		if len(extraPrivileges) > 0 {
+			revokeStatements = append(revokeStatements, fmt.Sprintf(sqlRevokeDefaultPrivileges, quotedSchema, extraPrivileges, granteeSQL(role)))
+		}
+	}
+	usageRoles := make([]string, 0, len(current.usage))
+	for role := range current.usage {
+		usageRoles = append(usageRoles, role)
+	}
+	sort.Strings(usageRoles)
+	for _, role := range usageRoles {
+		if desired[role] == nil {
+			revokeStatements = append(revokeStatements, fmt.Sprintf(sqlRevokeSchemaUsage, quotedSchema, granteeSQL(role)))
+		}
+	}
+	// Grant usage, table privileges, and default privileges that are missing
+	for _, role := range desired.roles() {
+		grantee := granteeSQL(role)
+		if !current.usage[role] {
+			grantStatements = append(grantStatements, fmt.Sprintf(sqlGrantSchemaUsage, quotedSchema, grantee))
+		}
+		allTablePrivileges := desired[role][allTables]
+		// Privileges that no table has are granted on every table with a single statement
+		missingOnEveryTable := make(privilegeSet)
+		for privilege := range allTablePrivileges {
+			missingOnEveryTable[privilege] = true
+		}
+		for _, table := range tables {
+			for privilege := range current.tables[table][role] {
+				delete(missingOnEveryTable, privilege)
+			}
+		}
+		if tables == nil || len(tables) > 0 {
+			if len(missingOnEveryTable) > 0 {
+				grantStatements = append(grantStatements, fmt.Sprintf(sqlGrantAllTables, missingOnEveryTable, quotedSchema, grantee))
+			}
+		}
+		grantTables := tables
+		if tables == nil {
+			grantTables = make([]string, 0, len(desired[role]))
+			for table := range desired[role] {
+				if table != allTables {
+					grantTables = append(grantTables, table)
+				}
+			}
+			sort.Strings(grantTables)
+		}
+		for _, table := range grantTables {
+			missingPrivileges := desired.privileges(role, table).minus(current.tables[table][role]).minus(missingOnEveryTable)
+			if len(missingPrivileges) > 0 {
+				grantStatements = append(grantStatements, fmt.Sprintf(sqlGrantTable, missingPrivileges, QuoteQualifiedIdentifier(schemaName, table), grantee))
+			}
+		}
+		missingDefaults := allTablePrivileges.minus(current.defaults[role])
+		if len(missingDefaults) > 0 {
+			grantStatements = append(grantStatements, fmt.Sprintf(sqlGrantDefaultPrivileges, quotedSchema, missingDefaults, grantee))
+		}
+	}
+	return revokeStatements, grantStatements
+}
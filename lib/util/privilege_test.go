@@ -0,0 +1,210 @@
+package util
+
+import (
+	"context"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/neflyte/fdwctl/lib/model"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUnit_normalizePrivileges(t *testing.T) {
+	privileges, err := normalizePrivileges([]string{"update", " Select ", "SELECT"})
+	require.Nil(t, err)
+	require.Equal(t, []string{"SELECT", "UPDATE"}, privileges)
+	privileges, err = normalizePrivileges([]string{"all"})
+	require.Nil(t, err)
+	require.Equal(t, tablePrivileges, privileges)
+	_, err = normalizePrivileges([]string{"SELECT", "EXECUTE"})
+	require.NotNil(t, err)
+	require.Contains(t, err.Error(), `"EXECUTE"`)
+}
+
+func TestUnit_GetSchemaGrants(t *testing.T) {
+	db, mock := newSQLMock(t)
+	defer closeSQLMock(t, db)
+
+	mock.ExpectQuery(regexp.QuoteMeta(sqlGetSchemaTables)).
+		WithArgs("remotedb").
+		WillReturnRows(sqlmock.NewRows([]string{"relname"}).AddRow("items").AddRow("orders")).
+		RowsWillBeClosed()
+	mock.ExpectQuery(regexp.QuoteMeta(sqlGetSchemaPrivileges)).
+		WithArgs("remotedb").
+		WillReturnRows(
+			sqlmock.NewRows([]string{"kind", "grantee", "table_name", "privilege_type"}).
+				AddRow("default", "reporting", "", "SELECT").
+				AddRow("table", "legacy", "orders", "DELETE").
+				AddRow("table", "reporting", "items", "SELECT").
+				AddRow("table", "reporting", "orders", "INSERT").
+				AddRow("table", "reporting", "orders", "SELECT").
+				AddRow("usage", "reporting", "", "USAGE"),
+		).
+		RowsWillBeClosed()
+	mock.ExpectClose()
+
+	grants, err := GetSchemaGrants(context.Background(), db, "remotedb")
+	require.Nil(t, err)
+	require.Equal(t, []model.RoleGrant{
+		{Role: "legacy", Privileges: []string{}},
+		{Role: "legacy", Privileges: []string{"DELETE"}, Tables: []string{"orders"}},
+		{Role: "reporting", Privileges: []string{"SELECT"}},
+		{Role: "reporting", Privileges: []string{"INSERT"}, Tables: []string{"orders"}},
+	}, grants.Roles)
+	require.Equal(t, grants, NormalizeGrants(model.Grants{
+		Roles: []model.RoleGrant{
+			{Role: "legacy", Privileges: []string{"delete"}, Tables: []string{"orders"}},
+			{Role: "reporting", Privileges: []string{"insert", "select"}, Tables: []string{"orders"}},
+		},
+		Users: []string{"reporting"},
+	}))
+	closeSQLMock(t, db)
+	require.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestUnit_schemaGrantSQL_Import(t *testing.T) {
+	grants := model.Grants{
+		Users: []string{"fdw"},
+		Roles: []model.RoleGrant{
+			{Role: "reporting", Privileges: []string{"insert", "select"}},
+			{Role: "reporting", Privileges: []string{"update"}, Tables: []string{"orders"}},
+			{Role: "public", Privileges: []string{"select"}, Tables: []string{"lookup"}},
+		},
+	}
+	revokeStatements, grantStatements := schemaGrantSQL("remotedb", grants, nil, newSchemaPrivileges())
+	require.Empty(t, revokeStatements)
+	require.Equal(t, []string{
+		`GRANT USAGE ON SCHEMA "remotedb" TO PUBLIC`,
+		`GRANT SELECT ON TABLE "remotedb"."lookup" TO PUBLIC`,
+		`GRANT USAGE ON SCHEMA "remotedb" TO "fdw"`,
+		`GRANT SELECT ON ALL TABLES IN SCHEMA "remotedb" TO "fdw"`,
+		`ALTER DEFAULT PRIVILEGES IN SCHEMA "remotedb" GRANT SELECT ON TABLES TO "fdw"`,
+		`GRANT USAGE ON SCHEMA "remotedb" TO "reporting"`,
+		`GRANT SELECT, INSERT ON ALL TABLES IN SCHEMA "remotedb" TO "reporting"`,
+		`GRANT UPDATE ON TABLE "remotedb"."orders" TO "reporting"`,
+		`ALTER DEFAULT PRIVILEGES IN SCHEMA "remotedb" GRANT SELECT, INSERT ON TABLES TO "reporting"`,
+	}, grantStatements)
+}
+
+func TestUnit_schemaGrantSQL_Reconcile(t *testing.T) {
+	current := newSchemaPrivileges()
+	current.usage["legacy"] = true
+	current.usage["reporting"] = true
+	current.defaults["reporting"] = privilegeSet{"SELECT": true, "DELETE": true}
+	current.tables["orders"] = map[string]privilegeSet{"reporting": {"SELECT": true, "UPDATE": true}}
+	grants := model.Grants{
+		Roles: []model.RoleGrant{
+			{Role: "reporting", Privileges: []string{"SELECT"}},
+		},
+	}
+	revokeStatements, grantStatements := schemaGrantSQL("remotedb", grants, []string{"items", "orders"}, current)
+	require.Equal(t, []string{
+		`REVOKE UPDATE ON TABLE "remotedb"."orders" FROM "reporting"`,
+		`ALTER DEFAULT PRIVILEGES IN SCHEMA "remotedb" REVOKE DELETE ON TABLES FROM "reporting"`,
+		`REVOKE USAGE ON SCHEMA "remotedb" FROM "legacy"`,
+	}, revokeStatements)
+	require.Equal(t, []string{
+		`GRANT SELECT ON TABLE "remotedb"."items" TO "reporting"`,
+	}, grantStatements)
+}
+
+func TestUnit_ValidateSchemaGrants(t *testing.T) {
+	require.Nil(t, ValidateSchemaGrants(model.Schema{LocalSchema: "remotedb"}))
+	require.Nil(t, ValidateSchemaGrants(model.Schema{
+		LocalSchema:  "remotedb",
+		SchemaGrants: &model.Grants{Roles: []model.RoleGrant{{Role: "reporting", Privileges: []string{"ALL"}}}},
+	}))
+	require.NotNil(t, ValidateSchemaGrants(model.Schema{
+		LocalSchema:  "remotedb",
+		SchemaGrants: &model.Grants{Roles: []model.RoleGrant{{Privileges: []string{"SELECT"}}}},
+	}))
+	require.NotNil(t, ValidateSchemaGrants(model.Schema{
+		LocalSchema:  "remotedb",
+		SchemaGrants: &model.Grants{Roles: []model.RoleGrant{{Role: "reporting", Privileges: []string{"USAGE"}}}},
+	}))
+}
+
+func TestUnit_PlanDesiredState_ReconcilesSchemaGrants(t *testing.T) {
+	db, mock := newSQLMock(t)
+	defer closeSQLMock(t, db)
+
+	expectSchemaPrivileges := func() {
+		mock.ExpectQuery(regexp.QuoteMeta(sqlGetSchemaTables)).
+			WithArgs("remotedb").
+			WillReturnRows(sqlmock.NewRows([]string{"relname"}).AddRow("orders")).
+			RowsWillBeClosed()
+		mock.ExpectQuery(regexp.QuoteMeta(sqlGetSchemaPrivileges)).
+			WithArgs("remotedb").
+			WillReturnRows(
+				sqlmock.NewRows([]string{"kind", "grantee", "table_name", "privilege_type"}).
+					AddRow("table", "fdw", "orders", "SELECT").
+					AddRow("usage", "fdw", "", "USAGE"),
+			).
+			RowsWillBeClosed()
+	}
+	mock.ExpectQuery(regexp.QuoteMeta(sqlGetExtensions)).
+		WillReturnRows(sqlmock.NewRows([]string{"extname", "extversion"})).
+		RowsWillBeClosed()
+	mock.ExpectQuery(regexp.QuoteMeta(sqlForeignServerInfo)).
+		WillReturnRows(
+			sqlmock.NewRows([]string{"srvname", "fdwname", "owner", "server_comment", "option_name", "option_value"}).
+				AddRow("remotedb", "postgres_fdw", "postgres", managedComment, "host", "remotehost"),
+		).
+		RowsWillBeClosed()
+	mock.ExpectQuery(regexp.QuoteMeta(sqlGetUsermaps)).
+		WithArgs("remotedb").
+		WillReturnRows(sqlmock.NewRows([]string{"authorization_identifier", "foreign_server_name", "option_name", "option_value"})).
+		RowsWillBeClosed()
+	mock.ExpectQuery(regexp.QuoteMeta(sqlGetServerGrantees)).
+		WithArgs("remotedb").
+		WillReturnRows(sqlmock.NewRows([]string{"grantee"})).
+		RowsWillBeClosed()
+	mock.ExpectQuery(regexp.QuoteMeta(sqlGetForeignSchemas)).
+		WithArgs("remotedb").
+		WillReturnRows(
+			sqlmock.NewRows([]string{"foreign_table_schema", "foreign_server_name", "remote_schema", "schema_comment"}).
+				AddRow("remotedb", "remotedb", "public", managedComment),
+		).
+		RowsWillBeClosed()
+	expectSchemaPrivileges()
+	expectNoForeignTables(mock, "remotedb")
+	expectCatalog(mock)
+	expectSchemaPrivileges()
+	expectNoImportedTypes(mock)
+	mock.ExpectClose()
+
+	dState := model.DesiredState{
+		Servers: []model.ForeignServer{
+			{
+				Name: "remotedb",
+				Host: "remotehost",
+				Schemas: []model.Schema{
+					{
+						LocalSchema:  "remotedb",
+						RemoteSchema: "public",
+						SchemaGrants: &model.Grants{Roles: []model.RoleGrant{{Role: "reporting", Privileges: []string{"SELECT"}}}},
+					},
+				},
+			},
+		},
+	}
+	plan, err := PlanDesiredState(context.Background(), db, dState, PlanOptions{})
+	require.Nil(t, err)
+	statements := make([]string, 0)
+	for _, action := range plan.Actions {
+		require.Equal(t, model.ObjectSchema, action.ObjectType)
+		statements = append(statements, action.SQL)
+	}
+	require.Equal(t, []string{
+		`REVOKE SELECT ON TABLE "remotedb"."orders" FROM "fdw"`,
+		`REVOKE USAGE ON SCHEMA "remotedb" FROM "fdw"`,
+		`GRANT USAGE ON SCHEMA "remotedb" TO "reporting"`,
+		`GRANT SELECT ON ALL TABLES IN SCHEMA "remotedb" TO "reporting"`,
+		`ALTER DEFAULT PRIVILEGES IN SCHEMA "remotedb" GRANT SELECT ON TABLES TO "reporting"`,
+	}, statements)
+	require.Equal(t, model.OperationRevoke, plan.Actions[0].Operation)
+	require.Equal(t, model.OperationGrant, plan.Actions[2].Operation)
+	closeSQLMock(t, db)
+	require.Nil(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,98 @@
+package util
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/neflyte/fdwctl/lib/logger"
+)
+
+const (
+	// PruneNone leaves every object that is not in the desired state alone
+	PruneNone = "none"
+	// PruneOwned drops the objects that are not in the desired state when they are marked as managed by fdwctl
+	PruneOwned = "owned"
+	// PruneAll drops every object that is not in the desired state
+	PruneAll = "all"
+)
+
+var (
+	// pruneModes are the valid prune modes of a desired state plan
+	pruneModes = []string{PruneNone, PruneOwned, PruneAll}
+)
+
+// ValidatePruneMode determines if the supplied prune mode is valid; an empty mode is the default mode, owned
+func ValidatePruneMode(mode string) error {
+	if mode != "" && !containsString(pruneModes, mode) {
+		return fmt.Errorf("invalid prune mode %q; expected one of %v", mode, pruneModes)
+	}
+	return nil
+}
+
+// ValidateNamePatterns determines if every supplied pattern is a valid name, glob pattern, or regular expression
+// enclosed in slashes
+func ValidateNamePatterns(patterns []string) error {
+	for _, pattern := range patterns {
+		if strings.TrimSpace(pattern) == "" {
+			return fmt.Errorf("patterns cannot be empty")
+		}
+		if isTableRegex(pattern) {
+			_, err := regexp.Compile(tableRegex(pattern))
+			if err != nil {
+				return fmt.Errorf("invalid pattern %s: %s", pattern, err)
+			}
+			continue
+		}
+		_, err := path.Match(pattern, "")
+		if err != nil {
+			return fmt.Errorf("invalid pattern %s: %s", pattern, err)
+		}
+	}
+	return nil
+}
+
+// matchesAnyPattern determines if the object name matches any of the supplied names, glob patterns, or regular
+// expressions. The patterns must have been validated by ValidateNamePatterns.
+func matchesAnyPattern(patterns []string, objectName string) bool {
+	for _, pattern := range patterns {
+		if isTableRegex(pattern) {
+			if regexp.MustCompile(tableRegex(pattern)).MatchString(objectName) {
+				return true
+			}
+			continue
+		}
+		if ok, _ := path.Match(pattern, objectName); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// canPrune determines if an object that is not in the desired state may be dropped according to the prune mode and
+// ignore list of the plan. The object is also left alone when one of the related names, such as the server of a user
+// mapping, is ignored. The reason an object is kept is logged.
+func (p *planner) canPrune(ctx context.Context, objectType string, objectName string, managed bool, relatedNames ...string) bool {
+	log := logger.Log(ctx).
+		WithField("function", "canPrune")
+	for _, name := range append([]string{objectName}, relatedNames...) {
+		if matchesAnyPattern(p.ignore, name) {
+			log.Infof("%s %s is not in the desired state but %s is ignored; leaving it alone", objectType, objectName, name)
+			return false
+		}
+	}
+	switch p.opts.Prune {
+	case PruneNone:
+		log.Infof("%s %s is not in the desired state; leaving it alone since pruning is disabled", objectType, objectName)
+		return false
+	case PruneAll:
+		return true
+	default:
+		if !managed {
+			log.Warnf("%s %s is not in the desired state but is not managed by fdwctl; leaving it alone (use --prune=all to drop it)", objectType, objectName)
+		}
+		return managed
+	}
+}
@@ -0,0 +1,154 @@
+package util
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/neflyte/fdwctl/lib/model"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUnit_ValidatePruneMode(t *testing.T) {
+	require.Nil(t, ValidatePruneMode(""))
+	require.Nil(t, ValidatePruneMode(PruneNone))
+	require.Nil(t, ValidatePruneMode(PruneOwned))
+	require.Nil(t, ValidatePruneMode(PruneAll))
+	require.NotNil(t, ValidatePruneMode("some"))
+}
+
+func TestUnit_matchesAnyPattern(t *testing.T) {
+	patterns := []string{"legacy", "tmp_*", "/^audit_[0-9]+$/"}
+	require.Nil(t, ValidateNamePatterns(patterns))
+	require.True(t, matchesAnyPattern(patterns, "legacy"))
+	require.True(t, matchesAnyPattern(patterns, "tmp_reports"))
+	require.True(t, matchesAnyPattern(patterns, "audit_2020"))
+	require.False(t, matchesAnyPattern(patterns, "legacy2"))
+	require.False(t, matchesAnyPattern(patterns, "audit_log"))
+	require.False(t, matchesAnyPattern(nil, "legacy"))
+	require.True(t, matchesAnyPattern([]string{`/^a\/$/`}, "a/"))
+	require.False(t, matchesAnyPattern([]string{`/^a\/$/`}, "a"))
+	require.NotNil(t, ValidateNamePatterns([]string{"/(/"}))
+	require.NotNil(t, ValidateNamePatterns([]string{"tmp_["}))
+	require.NotNil(t, ValidateNamePatterns([]string{" "}))
+}
+
+// expectUnusedServers expects the queries of the current state for the supplied servers, which have no user
+// mappings, grantees, schemas, or foreign tables; the comment of each server is keyed by its name
+func expectUnusedServers(mock sqlmock.Sqlmock, serverNames []string, comments map[string]string) {
+	expectServers(mock, serverNames, comments, nil)
+}
+
+// expectServers expects the queries of the current state for the supplied servers, which have no grantees, schemas,
+// or foreign tables; the comment and the local users of the user mappings of each server are keyed by its name
+func expectServers(mock sqlmock.Sqlmock, serverNames []string, comments map[string]string, localUsers map[string][]string) {
+	mock.ExpectQuery(regexp.QuoteMeta(sqlGetExtensions)).
+		WillReturnRows(sqlmock.NewRows([]string{"extname", "extversion"})).
+		RowsWillBeClosed()
+	serverRows := sqlmock.NewRows([]string{"srvname", "fdwname", "owner", "server_comment", "option_name", "option_value"})
+	for _, serverName := range serverNames {
+		serverRows.AddRow(serverName, "postgres_fdw", "postgres", comments[serverName], "host", "remotehost")
+	}
+	mock.ExpectQuery(regexp.QuoteMeta(sqlForeignServerInfo)).
+		WillReturnRows(serverRows).
+		RowsWillBeClosed()
+	for _, serverName := range serverNames {
+		usermapRows := sqlmock.NewRows([]string{"authorization_identifier", "foreign_server_name", "option_name", "option_value"})
+		for _, localUser := range localUsers[serverName] {
+			usermapRows.AddRow(localUser, serverName, "user", "remoteuser")
+		}
+		mock.ExpectQuery(regexp.QuoteMeta(sqlGetUsermaps)).
+			WithArgs(serverName).
+			WillReturnRows(usermapRows).
+			RowsWillBeClosed()
+		mock.ExpectQuery(regexp.QuoteMeta(sqlGetServerGrantees)).
+			WithArgs(serverName).
+			WillReturnRows(sqlmock.NewRows([]string{"grantee"})).
+			RowsWillBeClosed()
+		mock.ExpectQuery(regexp.QuoteMeta(sqlGetForeignSchemas)).
+			WithArgs(serverName).
+			WillReturnRows(sqlmock.NewRows([]string{"foreign_table_schema", "foreign_server_name", "remote_schema", "schema_comment"})).
+			RowsWillBeClosed()
+		expectNoForeignTables(mock, serverName)
+	}
+}
+
+func TestUnit_PlanDesiredState_PruneModes(t *testing.T) {
+	// kept is in the desired state without its user mappings; fdwctl created the role alice but not bob
+	serverNames := []string{"kept", "legacy", "scratch", "stale"}
+	comments := map[string]string{"kept": managedComment, "scratch": managedComment, "stale": managedComment}
+	localUsers := map[string][]string{"kept": {"alice", "bob"}}
+	for _, testCase := range []struct {
+		prune    string
+		ignore   []string
+		expected []string
+	}{
+		{prune: "", expected: []string{
+			"server scratch", "server stale", "usermap alice", "user alice", "usermap bob",
+		}},
+		{prune: PruneOwned, ignore: []string{"scr*", "bob"}, expected: []string{
+			"server stale", "usermap alice", "user alice",
+		}},
+		{prune: PruneOwned, ignore: []string{"kept"}, expected: []string{
+			"server scratch", "server stale",
+		}},
+		{prune: PruneAll, expected: []string{
+			"server legacy", "server scratch", "server stale", "usermap alice", "user alice", "usermap bob", "user bob",
+		}},
+		{prune: PruneNone, expected: []string{}},
+	} {
+		db, mock := newSQLMock(t)
+		expectServers(mock, serverNames, comments, localUsers)
+		expectCatalog(mock, "alice")
+		if testCase.prune != PruneNone && !containsString(testCase.ignore, "kept") {
+			mock.ExpectQuery(regexp.QuoteMeta(sqlSessionUsers)).
+				WillReturnRows(sqlmock.NewRows([]string{"current_user", "session_user"}).AddRow("fdw", "fdw")).
+				RowsWillBeClosed()
+		}
+		if testCase.prune != PruneNone {
+			expectNoImportedTypes(mock)
+		}
+		mock.ExpectClose()
+
+		dState := model.DesiredState{
+			Ignore:  testCase.ignore,
+			Servers: []model.ForeignServer{{Name: "kept", Host: "remotehost"}},
+		}
+		plan, err := PlanDesiredState(context.Background(), db, dState, PlanOptions{Prune: testCase.prune})
+		require.Nil(t, err)
+		dropped := make([]string, 0)
+		for _, action := range plan.Actions {
+			require.Equal(t, model.OperationDrop, action.Operation)
+			dropped = append(dropped, fmt.Sprintf("%s %s", action.ObjectType, action.ObjectName))
+		}
+		require.Equal(t, testCase.expected, dropped, "prune mode %q, ignore %v", testCase.prune, testCase.ignore)
+		closeSQLMock(t, db)
+		require.Nil(t, mock.ExpectationsWereMet())
+	}
+}
+
+func TestUnit_PlanDesiredState_AdoptsServer(t *testing.T) {
+	db, mock := newSQLMock(t)
+	defer closeSQLMock(t, db)
+
+	expectUnusedServers(mock, []string{"remotedb"}, map[string]string{"remotedb": "Owned by the platform team"})
+	expectCatalog(mock)
+	expectNoImportedTypes(mock)
+	mock.ExpectClose()
+
+	dState := model.DesiredState{
+		Servers: []model.ForeignServer{{Name: "remotedb", Host: "remotehost"}},
+	}
+	plan, err := PlanDesiredState(context.Background(), db, dState, PlanOptions{})
+	require.Nil(t, err)
+	require.Len(t, plan.Actions, 1)
+	require.Equal(t, model.OperationUpdate, plan.Actions[0].Operation)
+	require.Equal(t, model.ObjectServer, plan.Actions[0].ObjectType)
+	require.Equal(t, `COMMENT ON SERVER "remotedb" IS 'Owned by the platform team`+"\n"+`fdwctl:{"managed":true}'`, plan.Actions[0].SQL)
+	_, err = PlanDesiredState(context.Background(), db, dState, PlanOptions{Prune: "some"})
+	require.NotNil(t, err)
+	closeSQLMock(t, db)
+	require.Nil(t, mock.ExpectationsWereMet())
+}
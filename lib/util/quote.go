@@ -0,0 +1,31 @@
+package util
+
+import (
+	"strings"
+)
+
+// QuoteIdentifier returns the supplied name as a quoted SQL identifier that is safe to embed in a statement. Embedded
+// double quotes are doubled and NUL characters, which Postgres does not allow in identifiers, are removed.
+func QuoteIdentifier(name string) string {
+	name = strings.ReplaceAll(name, "\x00", "")
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+// QuoteQualifiedIdentifier returns a schema-qualified name as quoted SQL identifiers separated by a period
+func QuoteQualifiedIdentifier(schema string, name string) string {
+	return QuoteIdentifier(schema) + "." + QuoteIdentifier(name)
+}
+
+// QuoteLiteral returns the supplied value as a quoted SQL string literal that is safe to embed in a statement. It
+// behaves like the Postgres quote_literal function: embedded single quotes are doubled and, if the value contains a
+// backslash, backslashes are doubled and the literal uses the escape string syntax (E'...') so that it is read the
+// same way regardless of the standard_conforming_strings setting. NUL characters, which Postgres does not allow in
+// text, are removed.
+func QuoteLiteral(value string) string {
+	value = strings.ReplaceAll(value, "\x00", "")
+	value = strings.ReplaceAll(value, `'`, `''`)
+	if strings.Contains(value, `\`) {
+		return `E'` + strings.ReplaceAll(value, `\`, `\\`) + `'`
+	}
+	return `'` + value + `'`
+}
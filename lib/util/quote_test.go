@@ -0,0 +1,254 @@
+package util
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/neflyte/fdwctl/lib/model"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	tokenWord       = "word"
+	tokenIdentifier = "identifier"
+	tokenLiteral    = "literal"
+	tokenSymbol     = "symbol"
+)
+
+var (
+	hostileNames = []string{
+		"",
+		"plain",
+		"MixedCase",
+		"with space",
+		`"`,
+		`""`,
+		`a"b`,
+		`"; DROP TABLE users; --`,
+		`'`,
+		`''`,
+		`O'Brien`,
+		`'); DROP TABLE users; --`,
+		`\`,
+		`\'`,
+		`\\'`,
+		`back\slash`,
+		"nul\x00byte",
+		"new\nline",
+		"tab\there",
+		"ünïcödé ✓",
+		"$$dollar$$",
+		"semi;colon",
+	}
+)
+
+// sqlToken is a lexical token of a SQL statement
+type sqlToken struct {
+	kind  string
+	value string
+}
+
+func (tok sqlToken) String() string {
+	return fmt.Sprintf("%s(%q)", tok.kind, tok.value)
+}
+
+// lexSQL splits a SQL statement into words, quoted identifiers, string literals, and symbols following the
+// Postgres lexical rules for those tokens. Quoted identifiers and string literals are returned unescaped.
+func lexSQL(statement string) ([]sqlToken, error) {
+	tokens := make([]sqlToken, 0)
+	pos := 0
+	for pos < len(statement) {
+		char := statement[pos]
+		switch {
+		case char == ' ' || char == '\t' || char == '\n':
+			pos++
+		case char == '"':
+			value, next, err := lexQuoted(statement, pos+1, '"', false)
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, sqlToken{kind: tokenIdentifier, value: value})
+			pos = next
+		case char == '\'':
+			value, next, err := lexQuoted(statement, pos+1, '\'', false)
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, sqlToken{kind: tokenLiteral, value: value})
+			pos = next
+		case (char == 'E' || char == 'e') && pos+1 < len(statement) && statement[pos+1] == '\'':
+			value, next, err := lexQuoted(statement, pos+2, '\'', true)
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, sqlToken{kind: tokenLiteral, value: value})
+			pos = next
+		case char == '_' || (char >= 'a' && char <= 'z') || (char >= 'A' && char <= 'Z'):
+			start := pos
+			for pos < len(statement) && (statement[pos] == '_' || statement[pos] == '$' ||
+				(statement[pos] >= 'a' && statement[pos] <= 'z') || (statement[pos] >= 'A' && statement[pos] <= 'Z') ||
+				(statement[pos] >= '0' && statement[pos] <= '9')) {
+				pos++
+			}
+			tokens = append(tokens, sqlToken{kind: tokenWord, value: statement[start:pos]})
+		default:
+			tokens = append(tokens, sqlToken{kind: tokenSymbol, value: string(char)})
+			pos++
+		}
+	}
+	return tokens, nil
+}
+
+// lexQuoted reads a quoted token that starts at pos, just after its opening quote, and returns its unescaped value
+// and the position after its closing quote
+func lexQuoted(statement string, pos int, quote byte, escapes bool) (string, int, error) {
+	var value strings.Builder
+	for pos < len(statement) {
+		char := statement[pos]
+		switch {
+		case char == quote && pos+1 < len(statement) && statement[pos+1] == quote:
+			value.WriteByte(quote)
+			pos += 2
+		case char == quote:
+			return value.String(), pos + 1, nil
+		case escapes && char == '\\' && pos+1 < len(statement):
+			value.WriteByte(statement[pos+1])
+			pos += 2
+		default:
+			value.WriteByte(char)
+			pos++
+		}
+	}
+	return "", pos, fmt.Errorf("unterminated quoted token in %q", statement)
+}
+
+// requireTokens asserts that the statement lexes to exactly the expected tokens
+func requireTokens(t *testing.T, statement string, expected ...sqlToken) {
+	t.Helper()
+	actual, err := lexSQL(statement)
+	require.Nil(t, err)
+	require.Equal(t, expected, actual, "statement: %s", statement)
+}
+
+func words(statement string) []sqlToken {
+	tokens := make([]sqlToken, 0)
+	for _, word := range strings.Fields(statement) {
+		tokens = append(tokens, sqlToken{kind: tokenWord, value: word})
+	}
+	return tokens
+}
+
+func ident(name string) sqlToken {
+	return sqlToken{kind: tokenIdentifier, value: strings.ReplaceAll(name, "\x00", "")}
+}
+
+func literal(value string) sqlToken {
+	return sqlToken{kind: tokenLiteral, value: strings.ReplaceAll(value, "\x00", "")}
+}
+
+func symbol(value string) sqlToken {
+	return sqlToken{kind: tokenSymbol, value: value}
+}
+
+func TestUnit_QuoteIdentifier(t *testing.T) {
+	require.Equal(t, `"plain"`, QuoteIdentifier("plain"))
+	require.Equal(t, `"a""b"`, QuoteIdentifier(`a"b`))
+	require.Equal(t, `"nulbyte"`, QuoteIdentifier("nul\x00byte"))
+	require.Equal(t, `"schema"."a""b"`, QuoteQualifiedIdentifier("schema", `a"b`))
+}
+
+func TestUnit_QuoteLiteral(t *testing.T) {
+	require.Equal(t, `'plain'`, QuoteLiteral("plain"))
+	require.Equal(t, `'O''Brien'`, QuoteLiteral("O'Brien"))
+	require.Equal(t, `E'back\\slash'`, QuoteLiteral(`back\slash`))
+	require.Equal(t, `E'\\'''`, QuoteLiteral(`\'`))
+}
+
+func TestUnit_GeneratedSQL_HostileNames(t *testing.T) {
+	for _, name := range hostileNames {
+		// An empty name falls back to defaults (e.g. the default wrapper) and is covered by the fuzz tests
+		if name == "" {
+			continue
+		}
+		requireTokens(
+			t,
+			createUserMapSQL(model.UserMap{LocalUser: name, ServerName: name, RemoteUser: name, RemoteSecret: model.Secret{Value: name}}, name),
+			append(words("CREATE USER MAPPING FOR"), ident(name), sqlToken{kind: tokenWord, value: "SERVER"}, ident(name),
+				sqlToken{kind: tokenWord, value: "OPTIONS"}, symbol("("), ident("password"), literal(name),
+				symbol(","), ident("user"), literal(name), symbol(")"))...,
+		)
+		requireTokens(
+			t,
+			createServerSQL(model.ForeignServer{Name: name, Wrapper: name, Host: name}),
+			append(words("CREATE SERVER"), ident(name), sqlToken{kind: tokenWord, value: "FOREIGN"}, sqlToken{kind: tokenWord, value: "DATA"},
+				sqlToken{kind: tokenWord, value: "WRAPPER"}, ident(name), sqlToken{kind: tokenWord, value: "OPTIONS"}, symbol("("),
+				ident("host"), literal(name), symbol(")"))...,
+		)
+		requireTokens(
+			t,
+			importForeignSchemaSQL(name, model.Schema{LocalSchema: name, RemoteSchema: name}),
+			append(words("IMPORT FOREIGN SCHEMA"), ident(name), sqlToken{kind: tokenWord, value: "FROM"}, sqlToken{kind: tokenWord, value: "SERVER"},
+				ident(name), sqlToken{kind: tokenWord, value: "INTO"}, ident(name))...,
+		)
+		requireTokens(
+			t,
+			createEnumSQL(&model.SchemaEnum{Schema: name, Name: name, Values: []string{name, name}}),
+			append(words("CREATE TYPE"), ident(name), symbol("."), ident(name), sqlToken{kind: tokenWord, value: "AS"},
+				sqlToken{kind: tokenWord, value: "ENUM"}, symbol("("), literal(name), symbol(","), literal(name), symbol(")"))...,
+		)
+	}
+}
+
+func FuzzQuoteIdentifier(f *testing.F) {
+	for _, name := range hostileNames {
+		f.Add(name)
+	}
+	f.Fuzz(func(t *testing.T, name string) {
+		requireTokens(t, QuoteIdentifier(name), ident(name))
+	})
+}
+
+func FuzzQuoteLiteral(f *testing.F) {
+	for _, name := range hostileNames {
+		f.Add(name)
+	}
+	f.Fuzz(func(t *testing.T, value string) {
+		requireTokens(t, QuoteLiteral(value), literal(value))
+	})
+}
+
+func FuzzUpdateUserMapSQL(f *testing.F) {
+	for _, name := range hostileNames {
+		f.Add(name, name, name)
+	}
+	f.Add("public", "remotedb", "s3cret")
+	f.Fuzz(func(t *testing.T, localUser string, serverName string, secretValue string) {
+		usermap := model.UserMap{
+			LocalUser:    localUser,
+			ServerName:   serverName,
+			RemoteUser:   secretValue,
+			RemoteSecret: model.Secret{Value: secretValue},
+		}
+		dbUserMap := model.UserMap{
+			RemoteUser:   secretValue + "-old",
+			RemoteSecret: model.Secret{Value: secretValue + "-old"},
+		}
+		if secretValue == "" {
+			// An empty remote user and undefined secret drop the options instead of setting them
+			return
+		}
+		localUserToken := ident(localUser)
+		if model.IsSpecialLocalUser(localUser) {
+			localUserToken = sqlToken{kind: tokenWord, value: strings.ToUpper(localUser)}
+		}
+		requireTokens(
+			t,
+			updateUserMapSQL(usermap, dbUserMap, secretValue, false),
+			append(words("ALTER USER MAPPING FOR"), localUserToken, sqlToken{kind: tokenWord, value: "SERVER"}, ident(serverName),
+				sqlToken{kind: tokenWord, value: "OPTIONS"}, symbol("("), sqlToken{kind: tokenWord, value: "SET"},
+				ident("password"), literal(secretValue), symbol(","), sqlToken{kind: tokenWord, value: "SET"},
+				ident("user"), literal(secretValue), symbol(")"))...,
+		)
+	})
+}
@@ -0,0 +1,385 @@
+package util
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/neflyte/fdwctl/lib/database"
+	"github.com/neflyte/fdwctl/lib/logger"
+	"github.com/neflyte/fdwctl/lib/model"
+)
+
+const (
+	// sqlGetSchemaColumns reads the columns from pg_attribute rather than information_schema.columns. format_type
+	// names a column type the way a foreign table column is declared, with its modifiers (varchar(20),
+	// numeric(12,2), timestamp(3) with time zone) and array brackets (integer[]), whereas information_schema.columns
+	// reports arrays and user-defined types only as ARRAY and USER-DEFINED and splits the modifiers across other
+	// columns. information_schema.columns also leaves out materialized views and the columns of tables the connecting
+	// role holds no privilege on, which would be reported as removed columns.
+	sqlGetSchemaColumns = `SELECT c.relname, a.attname,
+	CASE WHEN tn.nspname = 'pg_catalog' THEN pg_catalog.format_type(a.atttypid, a.atttypmod) ELSE t.typname END AS type_name,
+	a.attnotnull
+	FROM pg_catalog.pg_attribute a
+	JOIN pg_catalog.pg_class c ON c.oid = a.attrelid
+	JOIN pg_catalog.pg_namespace n ON n.oid = c.relnamespace
+	JOIN pg_catalog.pg_type t ON t.oid = a.atttypid
+	JOIN pg_catalog.pg_namespace tn ON tn.oid = t.typnamespace
+	WHERE n.nspname = $1 AND c.relkind IN ('r', 'v', 'm', 'f', 'p') AND NOT c.relispartition
+	AND a.attnum > 0 AND NOT a.attisdropped
+	ORDER BY c.relname, a.attnum`
+
+	// sqlGetTableDependents finds the views and materialized views whose rewrite rules refer to a table, which keep the
+	// table from being dropped
+	sqlGetTableDependents = `SELECT DISTINCT n.nspname, c.relname
+	FROM pg_catalog.pg_depend d
+	JOIN pg_catalog.pg_rewrite r ON r.oid = d.objid
+	JOIN pg_catalog.pg_class c ON c.oid = r.ev_class
+	JOIN pg_catalog.pg_namespace n ON n.oid = c.relnamespace
+	WHERE d.classid = 'pg_catalog.pg_rewrite'::regclass AND d.refclassid = 'pg_catalog.pg_class'::regclass
+	AND d.refobjid = $1::regclass AND c.oid <> d.refobjid
+	ORDER BY n.nspname, c.relname`
+
+	// importOptionNotNull is the import option of postgres_fdw that controls whether NOT NULL constraints are imported
+	importOptionNotNull = "import_not_null"
+)
+
+var (
+	// refreshPolicies are the valid refresh policies of a schema
+	refreshPolicies = []string{model.RefreshPolicyNone, model.RefreshPolicyIncremental, model.RefreshPolicyRecreate}
+)
+
+// ValidateRefreshPolicy determines if the refresh policy of the supplied schema is valid
+func ValidateRefreshPolicy(schema model.Schema) error {
+	if !containsString(refreshPolicies, schema.RefreshPolicyName()) {
+		return fmt.Errorf("schema %s: invalid refresh policy %q; expected one of %v", schema.LocalSchema, schema.RefreshPolicy, refreshPolicies)
+	}
+	return nil
+}
+
+// getSchemaColumns returns the columns, in order, of each table, view, and foreign table in the named schema keyed
+// by table name. User-defined types are named without their schema so that the columns of a remote table can be
+// compared with those of the foreign table imported from it.
+func getSchemaColumns(ctx context.Context, dbConnection database.Executor, schemaName string) (map[string][]model.Column, error) {
+	log := logger.Log(ctx).
+		WithField("function", "getSchemaColumns")
+	log.Tracef("query: %s, args: %#v", sqlGetSchemaColumns, schemaName)
+	columnRows, err := dbConnection.QueryContext(ctx, sqlGetSchemaColumns, schemaName)
+	if err != nil {
+		log.Errorf("error querying schema columns: %s", err)
+		return nil, err
+	}
+	defer database.CloseRows(ctx, columnRows)
+	columns := make(map[string][]model.Column)
+	var tableName string
+	for columnRows.Next() {
+		column := model.Column{}
+		err = columnRows.Scan(&tableName, &column.Name, &column.Type, &column.NotNull)
+		if err != nil {
+			log.Errorf("error scanning result row: %s", err)
+			return nil, err
+		}
+		columns[tableName] = append(columns[tableName], column)
+	}
+	if columnRows.Err() != nil {
+		log.Errorf("error iterating result rows: %s", columnRows.Err())
+		return nil, columnRows.Err()
+	}
+	return columns, nil
+}
+
+// columnsMatch determines if the columns of a foreign table are the ones IMPORT FOREIGN SCHEMA would create for the
+// columns of its remote table. NOT NULL constraints are only compared when compareNotNull is true.
+func columnsMatch(localColumns []model.Column, remoteColumns []model.Column, compareNotNull bool) bool {
+	if len(localColumns) != len(remoteColumns) {
+		return false
+	}
+	for idx, localColumn := range localColumns {
+		remoteColumn := remoteColumns[idx]
+		if localColumn.Name != remoteColumn.Name || localColumn.Type != remoteColumn.Type {
+			return false
+		}
+		if compareNotNull && localColumn.NotNull != remoteColumn.NotNull {
+			return false
+		}
+	}
+	return true
+}
+
+// importsNotNull determines if importing the supplied schema creates NOT NULL constraints, which postgres_fdw does
+// unless the import_not_null option is false
+func importsNotNull(schema model.Schema) bool {
+	return schema.ImportOptions[importOptionNotNull] != "false"
+}
+
+// getRemoteSchemaCatalog returns the tables of the remote schema of a foreign schema and the columns of each of them
+// keyed by table name
+func getRemoteSchemaCatalog(ctx context.Context, dbConnection database.Executor, server model.ForeignServer, schema model.Schema) ([]string, map[string][]model.Column, error) {
+	log := logger.Log(ctx).
+		WithField("function", "getRemoteSchemaCatalog")
+	remoteConnStr, err := remoteConnectionString(ctx, dbConnection, server, schema)
+	if err != nil {
+		return nil, nil, err
+	}
+	remoteConn, err := database.GetConnection(ctx, remoteConnStr)
+	if err != nil {
+		log.Errorf("error connecting to foreign database: %s", err)
+		return nil, nil, err
+	}
+	defer database.CloseConnection(ctx, remoteConn)
+	remoteTables, err := getSchemaTables(ctx, remoteConn, schema.RemoteSchema)
+	if err != nil {
+		log.Errorf("error getting remote tables: %s", err)
+		return nil, nil, err
+	}
+	remoteColumns, err := getSchemaColumns(ctx, remoteConn, schema.RemoteSchema)
+	if err != nil {
+		log.Errorf("error getting remote columns: %s", err)
+		return nil, nil, err
+	}
+	return remoteTables, remoteColumns, nil
+}
+
+// getRemoteDeclaredColumns returns the columns of each table of the remote schema of a foreign schema keyed by table
+// name, with their types as the foreign tables imported from them declare them
+func getRemoteDeclaredColumns(ctx context.Context, dbConnection database.Executor, server model.ForeignServer, schema model.Schema) (map[string][]model.Column, error) {
+	log := logger.Log(ctx).
+		WithField("function", "getRemoteDeclaredColumns")
+	remoteConnStr, err := remoteConnectionString(ctx, dbConnection, server, schema)
+	if err != nil {
+		return nil, err
+	}
+	remoteConn, err := database.GetConnection(ctx, remoteConnStr)
+	if err != nil {
+		log.Errorf("error connecting to foreign database: %s", err)
+		return nil, err
+	}
+	defer database.CloseConnection(ctx, remoteConn)
+	remoteColumns, _, err := getDeclaredColumns(ctx, remoteConn, schema.RemoteSchema, schema.TypeSchema)
+	if err != nil {
+		log.Errorf("error getting remote columns: %s", err)
+		return nil, err
+	}
+	return remoteColumns, nil
+}
+
+// getTableDependents returns the qualified names of the views and materialized views that refer to the named table
+func getTableDependents(ctx context.Context, dbConnection database.Executor, schemaName string, tableName string) ([]string, error) {
+	log := logger.Log(ctx).
+		WithField("function", "getTableDependents")
+	tableRef := QuoteQualifiedIdentifier(schemaName, tableName)
+	log.Tracef("query: %s, args: %#v", sqlGetTableDependents, tableRef)
+	dependentRows, err := dbConnection.QueryContext(ctx, sqlGetTableDependents, tableRef)
+	if err != nil {
+		log.Errorf("error querying table dependents: %s", err)
+		return nil, err
+	}
+	defer database.CloseRows(ctx, dependentRows)
+	dependents := make([]string, 0)
+	var dependentSchema, dependentName string
+	for dependentRows.Next() {
+		err = dependentRows.Scan(&dependentSchema, &dependentName)
+		if err != nil {
+			log.Errorf("error scanning result row: %s", err)
+			return nil, err
+		}
+		dependents = append(dependents, fmt.Sprintf("%s.%s", dependentSchema, dependentName))
+	}
+	if dependentRows.Err() != nil {
+		log.Errorf("error iterating result rows: %s", dependentRows.Err())
+		return nil, dependentRows.Err()
+	}
+	return dependents, nil
+}
+
+// planRefreshSchema plans an incremental refresh of an existing foreign schema: the remote tables that are missing
+// are imported, foreign tables whose remote table vanished or is excluded by the table filter are dropped, and foreign
+// tables whose columns no longer match their remote table are changed in place (see planColumnChanges). The names of
+// the dropped and imported tables are returned.
+func (p *planner) planRefreshSchema(ctx context.Context, server model.ForeignServer, schema model.Schema) ([]string, []string, error) {
+	log := logger.Log(ctx).
+		WithField("function", "planRefreshSchema")
+	remoteTables, remoteColumns, err := getRemoteSchemaCatalog(ctx, p.dbConnection, server, schema)
+	if err != nil {
+		return nil, nil, err
+	}
+	droppedTables, importedTables, changedTables, err := p.diffSchemaTables(ctx, server.Name, schema, remoteTables, remoteColumns)
+	if err != nil {
+		return nil, nil, err
+	}
+	var alterations []model.PlanAction
+	if len(changedTables) > 0 {
+		var declaredColumns map[string][]model.Column
+		declaredColumns, err = getRemoteDeclaredColumns(ctx, p.dbConnection, server, schema)
+		if err != nil {
+			return nil, nil, err
+		}
+		var recreatedTables []string
+		alterations, recreatedTables, err = p.planColumnChanges(ctx, server, schema, changedTables, declaredColumns)
+		if err != nil {
+			log.Errorf("error planning column changes: %s", err)
+			return nil, nil, err
+		}
+		droppedTables = append(droppedTables, recreatedTables...)
+		importedTables = append(importedTables, recreatedTables...)
+		sort.Strings(droppedTables)
+		sort.Strings(importedTables)
+	}
+	err = p.planTableChanges(ctx, server, schema, droppedTables, importedTables, alterations)
+	if err != nil {
+		return nil, nil, err
+	}
+	return droppedTables, importedTables, nil
+}
+
+// diffSchemaTables compares the foreign tables of an existing local schema with the tables of its remote schema and
+// returns the sorted names of the foreign tables to drop, of the remote tables to import, and of the foreign tables
+// whose columns changed
+func (p *planner) diffSchemaTables(ctx context.Context, serverName string, schema model.Schema, remoteTables []string, remoteColumns map[string][]model.Column) ([]string, []string, []string, error) {
+	log := logger.Log(ctx).
+		WithField("function", "diffSchemaTables")
+	desiredTables := filterTables(schema.LimitTo, schema.Except, remoteTables)
+	localTables, err := getImportedTables(ctx, p.dbConnection, schema.LocalSchema, serverName)
+	if err != nil {
+		log.Errorf("error getting foreign tables: %s", err)
+		return nil, nil, nil, err
+	}
+	localColumns, err := getSchemaColumns(ctx, p.dbConnection, schema.LocalSchema)
+	if err != nil {
+		log.Errorf("error getting local columns: %s", err)
+		return nil, nil, nil, err
+	}
+	droppedTables := make([]string, 0)
+	importedTables := make([]string, 0)
+	changedTables := make([]string, 0)
+	for _, table := range localTables {
+		switch {
+		case !containsString(desiredTables, table):
+			log.Debugf("foreign table %s.%s has no remote table to import", schema.LocalSchema, table)
+			droppedTables = append(droppedTables, table)
+		case !columnsMatch(localColumns[table], remoteColumns[table], importsNotNull(schema)):
+			log.Debugf("columns of foreign table %s.%s changed", schema.LocalSchema, table)
+			changedTables = append(changedTables, table)
+		}
+	}
+	for _, table := range desiredTables {
+		if !containsString(localTables, table) {
+			importedTables = append(importedTables, table)
+		}
+	}
+	sort.Strings(droppedTables)
+	sort.Strings(importedTables)
+	sort.Strings(changedTables)
+	return droppedTables, importedTables, changedTables, nil
+}
+
+// planColumnChanges returns the actions that change the columns of the named foreign tables of an existing local
+// schema in place to match the supplied columns of their remote tables, so that the views and privileges that depend
+// on the foreign tables are kept. Columns cannot be reordered in place: a foreign table whose columns must be
+// reordered is only dropped and imported again when no view depends on it, and its name is returned among the tables
+// to recreate. Otherwise the foreign table is left alone and the views that depend on it are reported.
+func (p *planner) planColumnChanges(ctx context.Context, server model.ForeignServer, schema model.Schema, changedTables []string, remoteColumns map[string][]model.Column) ([]model.PlanAction, []string, error) {
+	log := logger.Log(ctx).
+		WithField("function", "planColumnChanges")
+	localColumns, _, err := getDeclaredColumns(ctx, p.dbConnection, schema.LocalSchema, "")
+	if err != nil {
+		log.Errorf("error getting local columns: %s", err)
+		return nil, nil, err
+	}
+	actions := make([]model.PlanAction, 0)
+	recreatedTables := make([]string, 0)
+	for _, tableName := range changedTables {
+		table := typedForeignTable(server.Name, schema, tableName, remoteColumns[tableName])
+		dbTable := typedForeignTable(server.Name, schema, tableName, localColumns[tableName])
+		query, recreate := alterForeignTableSQL(table, dbTable, server.Wrapper)
+		if !recreate {
+			if query != "" {
+				actions = append(actions, model.PlanAction{
+					Operation:  model.OperationUpdate,
+					ObjectType: model.ObjectForeignTable,
+					ObjectName: fmt.Sprintf("%s.%s", schema.LocalSchema, tableName),
+					ServerName: server.Name,
+					Statement:  query,
+				})
+			}
+			continue
+		}
+		var dependents []string
+		dependents, err = getTableDependents(ctx, p.dbConnection, schema.LocalSchema, tableName)
+		if err != nil {
+			log.Errorf("error getting dependents of foreign table %s.%s: %s", schema.LocalSchema, tableName, err)
+			return nil, nil, err
+		}
+		if len(dependents) > 0 {
+			log.Warnf("columns of foreign table %s.%s must be reordered, which requires dropping it, but %s depend on it; leaving it alone", schema.LocalSchema, tableName, strings.Join(dependents, ", "))
+			continue
+		}
+		log.Debugf("columns of foreign table %s.%s must be reordered; it will be imported again", schema.LocalSchema, tableName)
+		recreatedTables = append(recreatedTables, tableName)
+	}
+	return actions, recreatedTables, nil
+}
+
+// getImportedSchema returns the foreign schema with the local schema name of the supplied schema and its foreign
+// server, including the server's user mappings. The remote schema, import options, and table filter are read from
+// the database; the ENUM import settings of the supplied schema are kept.
+func getImportedSchema(ctx context.Context, dbConnection database.Executor, schema model.Schema) (model.Schema, model.ForeignServer, error) {
+	log := logger.Log(ctx).
+		WithField("function", "getImportedSchema")
+	dbSchemas, err := GetSchemasForServer(ctx, dbConnection, "")
+	if err != nil {
+		log.Errorf("error getting foreign schemas: %s", err)
+		return schema, model.ForeignServer{}, err
+	}
+	var dbSchema *model.Schema
+	for idx := range dbSchemas {
+		if dbSchemas[idx].LocalSchema == schema.LocalSchema {
+			dbSchema = &dbSchemas[idx]
+			break
+		}
+	}
+	if dbSchema == nil {
+		return schema, model.ForeignServer{}, logger.ErrorfAsError(log, "foreign schema %s does not exist", schema.LocalSchema)
+	}
+	servers, err := GetServers(ctx, dbConnection)
+	if err != nil {
+		log.Errorf("error getting foreign servers: %s", err)
+		return schema, model.ForeignServer{}, err
+	}
+	server := FindForeignServer(servers, dbSchema.ServerName)
+	if server == nil {
+		return schema, model.ForeignServer{}, logger.ErrorfAsError(log, "foreign server %s does not exist", dbSchema.ServerName)
+	}
+	server.UserMaps, err = GetUserMapsForServer(ctx, dbConnection, server.Name)
+	if err != nil {
+		log.Errorf("error getting user mappings: %s", err)
+		return schema, model.ForeignServer{}, err
+	}
+	dbSchema.ImportENUMs = schema.ImportENUMs
+	dbSchema.ENUMConnection = schema.ENUMConnection
+	dbSchema.ENUMSecret = schema.ENUMSecret
+	return *dbSchema, *server, nil
+}
+
+// PlanRefreshSchema plans an incremental refresh of an existing foreign schema without changing the database. The
+// server, remote schema, import options, and table filter of the schema are read from the database; the ENUM import
+// settings of the supplied schema are used.
+func PlanRefreshSchema(ctx context.Context, dbConnection database.Executor, schema model.Schema) (*model.Plan, error) {
+	log := logger.Log(ctx).
+		WithField("function", "PlanRefreshSchema")
+	dbSchema, server, err := getImportedSchema(ctx, dbConnection, schema)
+	if err != nil {
+		return nil, err
+	}
+	p := newPlanner(dbConnection, PlanOptions{})
+	_, _, err = p.planRefreshSchema(ctx, server, dbSchema)
+	if err != nil {
+		log.Errorf("error planning refresh of local schema %s: %s", schema.LocalSchema, err)
+		return nil, err
+	}
+	for _, drift := range p.enumDrift {
+		log.Warnf("%s; the enum type must be re-created to fix it", drift.String())
+	}
+	return p.plan, nil
+}
@@ -0,0 +1,101 @@
+package util
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+
+	"github.com/neflyte/fdwctl/lib/database"
+	"github.com/neflyte/fdwctl/lib/logger"
+	"github.com/neflyte/fdwctl/lib/model"
+)
+
+var (
+	// remoteConnectionOptions are the server and user mapping options of postgres_fdw that are carried over into the
+	// connection string used to read the catalog of the remote database
+	remoteConnectionOptions = []string{"sslmode", "sslcert", "sslkey", "sslrootcert", "connect_timeout"}
+)
+
+// serverConnectionString returns a connection string for the remote database of a postgres_fdw server that connects
+// as the remote user of the supplied user mapping
+func serverConnectionString(server model.ForeignServer, usermap model.UserMap, secretValue string) string {
+	connURL := &url.URL{
+		Scheme: "postgres",
+		Host:   server.Host,
+		Path:   server.DB,
+	}
+	if server.Port > 0 {
+		connURL.Host = fmt.Sprintf("%s:%d", server.Host, server.Port)
+	}
+	if secretValue != "" {
+		connURL.User = url.UserPassword(usermap.RemoteUser, secretValue)
+	} else {
+		connURL.User = url.User(usermap.RemoteUser)
+	}
+	query := url.Values{}
+	for _, optionName := range remoteConnectionOptions {
+		if optionValue, ok := usermap.Options[optionName]; ok {
+			query.Set(optionName, optionValue)
+		} else if optionValue, ok = server.Options[optionName]; ok {
+			query.Set(optionName, optionValue)
+		}
+	}
+	connURL.RawQuery = query.Encode()
+	return connURL.String()
+}
+
+// findRemoteUserMap returns the user mapping of the supplied list that the connected user would use: the only user
+// mapping, the mapping of the current user, or the PUBLIC mapping. Nil is returned if there is no such user mapping.
+func findRemoteUserMap(ctx context.Context, dbConnection database.Executor, usermaps []model.UserMap) (*model.UserMap, error) {
+	if len(usermaps) == 0 {
+		return nil, nil
+	}
+	if len(usermaps) == 1 {
+		return &usermaps[0], nil
+	}
+	currentUser, _, err := getSessionUsers(ctx, dbConnection)
+	if err != nil {
+		return nil, err
+	}
+	usermap := FindUserMap(usermaps, currentUser)
+	if usermap == nil {
+		usermap = FindUserMap(usermaps, model.LocalUserPublic)
+	}
+	return usermap, nil
+}
+
+// canConnectToRemote determines if the catalog of the remote database of a foreign schema can be read: through the
+// enum connection of the schema or through a postgres_fdw server with a user mapping
+func canConnectToRemote(server model.ForeignServer, schema model.Schema) bool {
+	return schema.ENUMConnection != "" || (server.WrapperName() == model.DefaultWrapper && len(server.UserMaps) > 0)
+}
+
+// remoteConnectionString returns the connection string used to read the catalog of the remote database of a foreign
+// schema. The enum connection of the schema is used when it is set; otherwise the connection is derived from the
+// host, port, and database of a postgres_fdw server and the remote user and credential of its user mapping.
+func remoteConnectionString(ctx context.Context, dbConnection database.Executor, server model.ForeignServer, schema model.Schema) (string, error) {
+	log := logger.Log(ctx).
+		WithField("function", "remoteConnectionString")
+	if schema.ENUMConnection != "" {
+		return ResolveConnectionString(schema.ENUMConnection, &schema.ENUMSecret), nil
+	}
+	if server.WrapperName() != model.DefaultWrapper {
+		return "", logger.ErrorfAsError(log, "cannot connect to the remote database of %s server %s; an enum connection is required", server.WrapperName(), server.Name)
+	}
+	usermap, err := findRemoteUserMap(ctx, dbConnection, server.UserMaps)
+	if err != nil {
+		log.Errorf("error finding user mapping: %s", err)
+		return "", err
+	}
+	if usermap == nil {
+		return "", logger.ErrorfAsError(log, "server %s has no user mapping to connect to the remote database with; an enum connection is required", server.Name)
+	}
+	secretValue := ""
+	if usermap.RemoteSecret.IsDefined() {
+		secretValue, err = GetSecret(ctx, usermap.RemoteSecret)
+		if err != nil {
+			return "", logger.ErrorfAsError(log, "error getting secret value for user mapping %s: %s", usermap.LocalUser, err)
+		}
+	}
+	return serverConnectionString(server, *usermap, secretValue), nil
+}
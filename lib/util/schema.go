@@ -2,8 +2,9 @@ package util
 
 import (
 	"context"
-	"database/sql"
 	"fmt"
+	"path"
+	"regexp"
 	"sort"
 	"strings"
 
@@ -14,7 +15,7 @@ import (
 
 const (
 	sqlSchemaExists   = `SELECT 1 FROM information_schema.schemata WHERE schema_name = $1`
-	sqlCreateSchema   = `CREATE SCHEMA "%s"`
+	sqlCreateSchema   = `CREATE SCHEMA %s`
 	sqlGetSchemaEnums = `SELECT n.nspname as schema, t.typname as type
 	FROM pg_type t
 	LEFT JOIN pg_catalog.pg_namespace n ON n.oid = t.typnamespace
@@ -22,40 +23,188 @@ const (
 	AND NOT EXISTS(SELECT 1 FROM pg_catalog.pg_type el WHERE el.oid = t.typelem AND el.typarray = t.oid)
 	AND n.nspname NOT IN ('pg_catalog', 'information_schema')`
 
-	sqlSchemaEnumsInTables = `SELECT DISTINCT cuu.udt_name, cuu.udt_schema
-	FROM information_schema.column_udt_usage cuu
-	JOIN pg_type t ON t.typname = cuu.udt_name
-	WHERE t.typtype = 'e' AND cuu.table_schema = $1`
+	// sqlTypeReferences is the recursive step of the queries that find the user-defined types used by tables: the
+	// element type of an array, the base type of a domain, the subtype of a range type, and the attribute types of a
+	// composite type that is in used_types u
+	sqlTypeReferences = `JOIN pg_catalog.pg_type t ON t.oid = u.oid
+		CROSS JOIN LATERAL (
+			SELECT t.typelem WHERE t.typcategory = 'A' AND t.typelem <> 0
+			UNION ALL SELECT t.typbasetype WHERE t.typtype = 'd'
+			UNION ALL SELECT r.rngsubtype FROM pg_catalog.pg_range r WHERE r.rngtypid = t.oid
+			UNION ALL SELECT ca.atttypid FROM pg_catalog.pg_attribute ca
+			WHERE t.typtype = 'c' AND ca.attrelid = t.typrelid AND ca.attnum > 0 AND NOT ca.attisdropped
+		) ref(oid)`
 
-	sqlEnumStrings = `SELECT e.enumlabel FROM pg_type t
+	// sqlUserDefinedType restricts the types t in namespace n to the user-defined types fdwctl can re-create
+	sqlUserDefinedType = `t.typtype IN ('e', 'd', 'c', 'r') AND n.nspname NOT IN ('pg_catalog', 'information_schema')
+	AND (t.typtype <> 'c' OR (SELECT c.relkind = 'c' FROM pg_catalog.pg_class c WHERE c.oid = t.typrelid))`
+
+	// sqlSchemaTypesInTables finds the user-defined types used by the columns of the tables of a schema and,
+	// recursively, the types they refer to
+	sqlSchemaTypesInTables = `WITH RECURSIVE used_types(oid) AS (
+		SELECT a.atttypid FROM pg_catalog.pg_attribute a
+		JOIN pg_catalog.pg_class c ON c.oid = a.attrelid
+		JOIN pg_catalog.pg_namespace n ON n.oid = c.relnamespace
+		WHERE n.nspname = $1 AND c.relkind IN ('r', 'v', 'm', 'f', 'p') AND a.attnum > 0 AND NOT a.attisdropped
+		UNION
+		SELECT ref.oid FROM used_types u
+		` + sqlTypeReferences + `
+	)
+	SELECT n.nspname, t.typname, t.typtype
+	FROM used_types u
+	JOIN pg_catalog.pg_type t ON t.oid = u.oid
+	JOIN pg_catalog.pg_namespace n ON n.oid = t.typnamespace
+	WHERE ` + sqlUserDefinedType + `
+	ORDER BY n.nspname, t.typname`
+
+	// sqlTypeUsages finds the user-defined types used, directly or recursively, by the columns of every table of the
+	// database along with the schema of the table and, for a foreign table, its server
+	sqlTypeUsages = `WITH RECURSIVE used_types(oid, table_schema, server_name) AS (
+		SELECT a.atttypid, n.nspname, COALESCE(s.srvname, '') FROM pg_catalog.pg_attribute a
+		JOIN pg_catalog.pg_class c ON c.oid = a.attrelid
+		JOIN pg_catalog.pg_namespace n ON n.oid = c.relnamespace
+		LEFT JOIN pg_catalog.pg_foreign_table ft ON ft.ftrelid = c.oid
+		LEFT JOIN pg_catalog.pg_foreign_server s ON s.oid = ft.ftserver
+		WHERE c.relkind IN ('r', 'v', 'm', 'f', 'p') AND a.attnum > 0 AND NOT a.attisdropped
+		AND n.nspname NOT IN ('pg_catalog', 'information_schema')
+		UNION
+		SELECT ref.oid, u.table_schema, u.server_name FROM used_types u
+		` + sqlTypeReferences + `
+	)
+	SELECT DISTINCT n.nspname, t.typname, u.table_schema, u.server_name
+	FROM used_types u
+	JOIN pg_catalog.pg_type t ON t.oid = u.oid
+	JOIN pg_catalog.pg_namespace n ON n.oid = t.typnamespace
+	WHERE ` + sqlUserDefinedType + `
+	ORDER BY 1, 2, 3, 4`
+
+	// sqlGetLocalTypes reads the user-defined types of the database with their comments, one row for each label of an
+	// ENUM type in sort order and one row for every other type
+	sqlGetLocalTypes = `SELECT n.nspname, t.typname, t.typtype, COALESCE(obj_description(t.oid, 'pg_type'), ''), COALESCE(e.enumlabel, '')
+	FROM pg_catalog.pg_type t
+	JOIN pg_catalog.pg_namespace n ON n.oid = t.typnamespace
+	LEFT JOIN pg_catalog.pg_enum e ON e.enumtypid = t.oid
+	WHERE (t.typrelid = 0 OR (SELECT c.relkind = 'c' FROM pg_catalog.pg_class c WHERE c.oid = t.typrelid))
+	AND NOT EXISTS(SELECT 1 FROM pg_catalog.pg_type el WHERE el.oid = t.typelem AND el.typarray = t.oid)
+	AND n.nspname NOT IN ('pg_catalog', 'information_schema')
+	ORDER BY n.nspname, t.typname, e.enumsortorder`
+
+	// sqlGetSchemaComment reads the comment of a local schema, which yields no rows when the schema does not exist
+	sqlGetSchemaComment = `SELECT COALESCE(obj_description(n.oid, 'pg_namespace'), '') FROM pg_catalog.pg_namespace n WHERE n.nspname = $1`
+
+	// sqlGetImportedTypes finds the user-defined types fdwctl created, which are marked by the metadata in their comment
+	sqlGetImportedTypes = `SELECT n.nspname, t.typname, t.typtype, obj_description(t.oid, 'pg_type')
+	FROM pg_catalog.pg_type t
+	JOIN pg_catalog.pg_namespace n ON n.oid = t.typnamespace
+	WHERE COALESCE(obj_description(t.oid, 'pg_type'), '') LIKE '%fdwctl:%"importedFor"%'
+	ORDER BY n.nspname, t.typname`
+
+	// sqlGetTypeSchemas finds the local schemas fdwctl created for imported types and counts the objects in each of
+	// them that are not types
+	sqlGetTypeSchemas = `SELECT n.nspname,
+	(SELECT count(*) FROM pg_catalog.pg_class c WHERE c.relnamespace = n.oid AND c.relkind <> 'c')
+	+ (SELECT count(*) FROM pg_catalog.pg_proc pr WHERE pr.pronamespace = n.oid)
+	FROM pg_catalog.pg_namespace n
+	WHERE COALESCE(obj_description(n.oid, 'pg_namespace'), '') LIKE '%fdwctl:%"typeSchema":true%'
+	ORDER BY n.nspname`
+
+	// sqlReferencedTypeJoin joins the type rt that a definition refers to with its element type et, if rt is an
+	// array, and the namespace en of the element type
+	sqlReferencedTypeJoin = `JOIN pg_catalog.pg_type et ON et.oid = CASE WHEN rt.typcategory = 'A' AND rt.typelem <> 0 THEN rt.typelem ELSE rt.oid END
+	JOIN pg_catalog.pg_namespace en ON en.oid = et.typnamespace`
+
+	sqlSchemaEnumStrings = `SELECT e.enumlabel FROM pg_type t
 	JOIN pg_enum e ON e.enumtypid = t.oid
-	WHERE t.typname = $1
+	JOIN pg_catalog.pg_namespace n ON n.oid = t.typnamespace
+	WHERE n.nspname = $1 AND t.typname = $2
 	ORDER BY e.enumsortorder`
 
-	sqlGetForeignSchemas = `SELECT DISTINCT ft.foreign_table_schema, ft.foreign_server_name, ftos.option_value AS remote_schema
+	sqlDomainDefinition = `SELECT format_type(t.typbasetype, t.typtypmod), en.nspname, et.typname, et.oid <> rt.oid,
+	t.typnotnull, COALESCE(t.typdefault, '')
+	FROM pg_catalog.pg_type t
+	JOIN pg_catalog.pg_namespace n ON n.oid = t.typnamespace
+	JOIN pg_catalog.pg_type rt ON rt.oid = t.typbasetype
+	` + sqlReferencedTypeJoin + `
+	WHERE n.nspname = $1 AND t.typname = $2`
+
+	sqlDomainConstraints = `SELECT con.conname, pg_get_constraintdef(con.oid)
+	FROM pg_catalog.pg_constraint con
+	JOIN pg_catalog.pg_type t ON t.oid = con.contypid
+	JOIN pg_catalog.pg_namespace n ON n.oid = t.typnamespace
+	WHERE n.nspname = $1 AND t.typname = $2 AND con.contype = 'c'
+	ORDER BY con.conname`
+
+	sqlCompositeAttributes = `SELECT a.attname, format_type(a.atttypid, a.atttypmod), en.nspname, et.typname, et.oid <> rt.oid
+	FROM pg_catalog.pg_type t
+	JOIN pg_catalog.pg_namespace n ON n.oid = t.typnamespace
+	JOIN pg_catalog.pg_attribute a ON a.attrelid = t.typrelid AND a.attnum > 0 AND NOT a.attisdropped
+	JOIN pg_catalog.pg_type rt ON rt.oid = a.atttypid
+	` + sqlReferencedTypeJoin + `
+	WHERE n.nspname = $1 AND t.typname = $2
+	ORDER BY a.attnum`
+
+	sqlRangeDefinition = `SELECT format_type(r.rngsubtype, NULL), en.nspname, et.typname, et.oid <> rt.oid,
+	CASE WHEN opc.opcdefault THEN '' ELSE quote_ident(ocn.nspname) || '.' || quote_ident(opc.opcname) END,
+	CASE WHEN r.rngcollation = 0 OR r.rngcollation = rt.typcollation THEN '' ELSE (
+		SELECT quote_ident(cn.nspname) || '.' || quote_ident(co.collname)
+		FROM pg_catalog.pg_collation co
+		JOIN pg_catalog.pg_namespace cn ON cn.oid = co.collnamespace
+		WHERE co.oid = r.rngcollation
+	) END,
+	CASE WHEN r.rngcanonical::oid = 0 THEN '' ELSE r.rngcanonical::regproc::text END,
+	CASE WHEN r.rngsubdiff::oid = 0 THEN '' ELSE r.rngsubdiff::regproc::text END
+	FROM pg_catalog.pg_range r
+	JOIN pg_catalog.pg_type t ON t.oid = r.rngtypid
+	JOIN pg_catalog.pg_namespace n ON n.oid = t.typnamespace
+	JOIN pg_catalog.pg_opclass opc ON opc.oid = r.rngsubopc
+	JOIN pg_catalog.pg_namespace ocn ON ocn.oid = opc.opcnamespace
+	JOIN pg_catalog.pg_type rt ON rt.oid = r.rngsubtype
+	` + sqlReferencedTypeJoin + `
+	WHERE n.nspname = $1 AND t.typname = $2`
+
+	sqlGetForeignSchemas = `SELECT DISTINCT ft.foreign_table_schema, ft.foreign_server_name, ftos.option_value AS remote_schema,
+	COALESCE(obj_description(n.oid, 'pg_namespace'), '') AS schema_comment
 	FROM information_schema.foreign_tables ft
 	JOIN information_schema.foreign_table_options ftos ON ftos.foreign_table_schema = ft.foreign_table_schema
 	AND ftos.foreign_table_catalog = ft.foreign_table_catalog
 	AND ftos.foreign_table_name = ft.foreign_table_name
-	AND ftos.option_name = 'schema_name'`
+	AND ftos.option_name = 'schema_name'
+	JOIN pg_catalog.pg_namespace n ON n.nspname = ft.foreign_table_schema
+	JOIN pg_catalog.pg_class c ON c.relnamespace = n.oid AND c.relname = ft.foreign_table_name
+	AND NOT ` + sqlDeclaredTableFilter
 
 	sqlGetForeignSchemasConstraint = `WHERE ft.foreign_server_name = $1`
-	sqlDropSchema                  = `DROP SCHEMA "%s"`
-	sqlCreateEnum                  = `CREATE TYPE "%s"."%s" AS ENUM(%s)`
-	sqlImportForeignSchema         = `IMPORT FOREIGN SCHEMA "%s" FROM SERVER "%s" INTO "%s"`
-	sqlGrantSchemaUsage            = `GRANT USAGE ON SCHEMA "%s" TO "%s"`
-	sqlGrantTableSelect            = `GRANT SELECT ON ALL TABLES IN SCHEMA "%s" TO "%s"`
+	sqlDropSchema                  = `DROP SCHEMA %s`
+	sqlCreateEnum                  = `CREATE TYPE %s AS ENUM(%s)`
+	sqlCreateDomain                = `CREATE DOMAIN %s AS %s`
+	sqlCreateComposite             = `CREATE TYPE %s AS (%s)`
+	sqlCreateRange                 = `CREATE TYPE %s AS RANGE (%s)`
+	sqlDropType                    = `DROP TYPE %s`
+	sqlDropDomain                  = `DROP DOMAIN %s`
+	sqlAddEnumValue                = `ALTER TYPE %s ADD VALUE %s`
+	sqlAddEnumValueBefore          = `ALTER TYPE %s ADD VALUE %s BEFORE %s`
+	sqlAddEnumValueAfter           = `ALTER TYPE %s ADD VALUE %s AFTER %s`
+	sqlImportForeignSchema         = `IMPORT FOREIGN SCHEMA %s%s FROM SERVER %s INTO %s%s`
+
+	// tableFilterLimitTo is the IMPORT FOREIGN SCHEMA clause that restricts the import to a list of tables
+	tableFilterLimitTo = "LIMIT TO"
+	// tableFilterExcept is the IMPORT FOREIGN SCHEMA clause that excludes a list of tables from the import
+	tableFilterExcept = "EXCEPT"
+	// tablePatternRegexDelimiter encloses a table filter entry that is a regular expression
+	tablePatternRegexDelimiter = "/"
+	// tablePatternGlobChars are the characters that make a table filter entry a glob pattern
+	tablePatternGlobChars = "*?["
 )
 
-// ensureSchema verifies that a schema with the supplied name exists and if it does not then it will be created
-func ensureSchema(ctx context.Context, dbConnection *sql.DB, schemaName string) error {
+// schemaExists determines if a schema with the supplied name exists
+func schemaExists(ctx context.Context, dbConnection database.Executor, schemaName string) (bool, error) {
 	log := logger.Log(ctx).
-		WithField("function", "ensureSchema")
+		WithField("function", "schemaExists")
 	log.Tracef("query: %s, args: %#v", sqlSchemaExists, schemaName)
-	schemaRows, err := dbConnection.Query(sqlSchemaExists, schemaName)
+	schemaRows, err := dbConnection.QueryContext(ctx, sqlSchemaExists, schemaName)
 	if err != nil {
 		log.Errorf("error checking for schema: %s", err)
-		return err
+		return false, err
 	}
 	defer database.CloseRows(ctx, schemaRows)
 	localSchemaExists := false
@@ -64,7 +213,7 @@ func ensureSchema(ctx context.Context, dbConnection *sql.DB, schemaName string)
 		err = schemaRows.Scan(&foo)
 		if err != nil {
 			log.Errorf("error scanning result row: %s", err)
-			return err
+			return false, err
 		}
 		if foo == 1 {
 			localSchemaExists = true
@@ -72,13 +221,57 @@ func ensureSchema(ctx context.Context, dbConnection *sql.DB, schemaName string)
 	}
 	if schemaRows.Err() != nil {
 		log.Errorf("error iterating result rows: %s", schemaRows.Err())
-		return schemaRows.Err()
+		return false, schemaRows.Err()
+	}
+	return localSchemaExists, nil
+}
+
+// getSchemaComment returns the comment of the named local schema and whether the schema exists
+func getSchemaComment(ctx context.Context, dbConnection database.Executor, schemaName string) (string, bool, error) {
+	log := logger.Log(ctx).
+		WithField("function", "getSchemaComment")
+	log.Tracef("query: %s, args: %#v", sqlGetSchemaComment, schemaName)
+	rows, err := dbConnection.QueryContext(ctx, sqlGetSchemaComment, schemaName)
+	if err != nil {
+		log.Errorf("error querying schema comment: %s", err)
+		return "", false, err
+	}
+	defer database.CloseRows(ctx, rows)
+	var schemaComment string
+	exists := false
+	if rows.Next() {
+		err = rows.Scan(&schemaComment)
+		if err != nil {
+			log.Errorf("error scanning result row: %s", err)
+			return "", false, err
+		}
+		exists = true
+	}
+	if rows.Err() != nil {
+		log.Errorf("error iterating result rows: %s", rows.Err())
+		return "", false, rows.Err()
+	}
+	return schemaComment, exists, nil
+}
+
+// createSchemaSQL returns the statement that creates the named local schema
+func createSchemaSQL(schemaName string) string {
+	return fmt.Sprintf(sqlCreateSchema, QuoteIdentifier(schemaName))
+}
+
+// ensureSchema verifies that a schema with the supplied name exists and if it does not then it will be created
+func ensureSchema(ctx context.Context, dbConnection database.Executor, schemaName string) error {
+	log := logger.Log(ctx).
+		WithField("function", "ensureSchema")
+	localSchemaExists, err := schemaExists(ctx, dbConnection, schemaName)
+	if err != nil {
+		return err
 	}
 	if !localSchemaExists {
 		log.Debug("schema does not exist; creating")
-		query := fmt.Sprintf(sqlCreateSchema, schemaName)
+		query := createSchemaSQL(schemaName)
 		log.Tracef("query: %s", query)
-		_, err = dbConnection.Exec(query)
+		_, err = dbConnection.ExecContext(ctx, query)
 		if err != nil {
 			log.Errorf("error creating schema: %s", err)
 			return err
@@ -91,10 +284,10 @@ func ensureSchema(ctx context.Context, dbConnection *sql.DB, schemaName string)
 }
 
 // getEnums returns a list of ENUM types and what schema they're located in
-func getEnums(ctx context.Context, dbConnection *sql.DB) ([]*model.SchemaEnum, error) {
+func getEnums(ctx context.Context, dbConnection database.Executor) ([]*model.SchemaEnum, error) {
 	log := logger.Log(ctx).
 		WithField("function", "getEnums")
-	enumRows, err := dbConnection.Query(sqlGetSchemaEnums)
+	enumRows, err := dbConnection.QueryContext(ctx, sqlGetSchemaEnums)
 	if err != nil {
 		log.Errorf("error querying enums: %s", err)
 		return nil, err
@@ -117,64 +310,47 @@ func getEnums(ctx context.Context, dbConnection *sql.DB) ([]*model.SchemaEnum, e
 	return enums, nil
 }
 
-// getSchemaEnumsUsedInTables returns a list of ENUM types that are used in tables of the specified schema
-func getSchemaEnumsUsedInTables(ctx context.Context, dbConnection *sql.DB, schemaName string) ([]*model.SchemaEnum, error) {
-	log := logger.Log(ctx).
-		WithField("function", "getSchemaEnumsUsedInTables")
-	log.Tracef("query: %s, args: %#v", sqlSchemaEnumsInTables, schemaName)
-	enumRows, err := dbConnection.Query(sqlSchemaEnumsInTables, schemaName)
-	if err != nil {
-		log.Errorf("error querying enums: %s", err)
-		return nil, err
-	}
-	defer database.CloseRows(ctx, enumRows)
-	enums := make([]*model.SchemaEnum, 0)
-	for enumRows.Next() {
-		schemaEnum := new(model.SchemaEnum)
-		err = enumRows.Scan(&schemaEnum.Name, &schemaEnum.Schema)
-		if err != nil {
-			log.Errorf("error scanning result row: %s", err)
-			continue
-		}
-		enums = append(enums, schemaEnum)
-	}
-	if enumRows.Err() != nil {
-		log.Errorf("error iterating result rows: %s", enumRows.Err())
-		return nil, enumRows.Err()
-	}
-	return enums, nil
+// typeKinds maps the typtype of a user-defined type to its kind
+var typeKinds = map[string]string{
+	"e": model.ObjectEnum,
+	"d": model.ObjectDomain,
+	"c": model.ObjectComposite,
+	"r": model.ObjectRange,
 }
 
-// getEnumStrings returns a list of string entries from the specified ENUM type
-func getEnumStrings(ctx context.Context, dbConnection *sql.DB, enumType string) ([]string, error) {
+// getSchemaTypesUsedInTables returns a list of the user-defined types that are used in tables of the specified
+// schema, including the types those types refer to. Only the schema, name, and kind of each type are returned.
+func getSchemaTypesUsedInTables(ctx context.Context, dbConnection database.Executor, schemaName string) ([]*model.SchemaType, error) {
 	log := logger.Log(ctx).
-		WithField("function", "getEnumStrings")
-	log.Tracef("query: %s, args: %#v", sqlEnumStrings, enumType)
-	enumRows, err := dbConnection.Query(sqlEnumStrings, enumType)
+		WithField("function", "getSchemaTypesUsedInTables")
+	log.Tracef("query: %s, args: %#v", sqlSchemaTypesInTables, schemaName)
+	typeRows, err := dbConnection.QueryContext(ctx, sqlSchemaTypesInTables, schemaName)
 	if err != nil {
-		log.Errorf("error querying enum data: %s", err)
+		log.Errorf("error querying types: %s", err)
 		return nil, err
 	}
-	defer database.CloseRows(ctx, enumRows)
-	enumStrings := make([]string, 0)
-	var enumString string
-	for enumRows.Next() {
-		err = enumRows.Scan(&enumString)
+	defer database.CloseRows(ctx, typeRows)
+	schemaTypes := make([]*model.SchemaType, 0)
+	var typType string
+	for typeRows.Next() {
+		schemaType := new(model.SchemaType)
+		err = typeRows.Scan(&schemaType.Schema, &schemaType.Name, &typType)
 		if err != nil {
 			log.Errorf("error scanning result row: %s", err)
 			continue
 		}
-		enumStrings = append(enumStrings, enumString)
+		schemaType.Kind = typeKinds[typType]
+		schemaTypes = append(schemaTypes, schemaType)
 	}
-	if enumRows.Err() != nil {
-		log.Errorf("error iterating result rows: %s", enumRows.Err())
-		return nil, enumRows.Err()
+	if typeRows.Err() != nil {
+		log.Errorf("error iterating result rows: %s", typeRows.Err())
+		return nil, typeRows.Err()
 	}
-	return enumStrings, nil
+	return schemaTypes, nil
 }
 
 // GetSchemasForServer returns a list of foreign schemas
-func GetSchemasForServer(ctx context.Context, dbConnection *sql.DB, serverName string) ([]model.Schema, error) {
+func GetSchemasForServer(ctx context.Context, dbConnection database.Executor, serverName string) ([]model.Schema, error) {
 	log := logger.Log(ctx).
 		WithField("function", "GetSchemasForServer")
 	query := sqlGetForeignSchemas
@@ -184,24 +360,31 @@ func GetSchemasForServer(ctx context.Context, dbConnection *sql.DB, serverName s
 		args = append(args, serverName)
 	}
 	log.Tracef("query: %s; args: %#v", query, args)
-	schemaRows, err := dbConnection.Query(query, args...)
+	schemaRows, err := dbConnection.QueryContext(ctx, query, args...)
 	if err != nil {
 		log.Errorf("error listing schemas: %s", err)
 		return nil, err
 	}
 	defer database.CloseRows(ctx, schemaRows)
 	schemas := make([]model.Schema, 0)
-	var schemaName, foreignServer, remoteSchema string
+	var schemaName, foreignServer, remoteSchema, schemaComment string
 	for schemaRows.Next() {
-		err = schemaRows.Scan(&schemaName, &foreignServer, &remoteSchema)
+		err = schemaRows.Scan(&schemaName, &foreignServer, &remoteSchema, &schemaComment)
 		if err != nil {
 			log.Errorf("error scanning result row: %s", err)
 			return nil, err
 		}
+		commentText, metadata := splitMetadataComment(schemaComment)
 		schemas = append(schemas, model.Schema{
-			ServerName:   foreignServer,
-			LocalSchema:  schemaName,
-			RemoteSchema: remoteSchema,
+			ServerName:    foreignServer,
+			LocalSchema:   schemaName,
+			RemoteSchema:  remoteSchema,
+			ImportOptions: metadata.ImportOptions,
+			LimitTo:       metadata.LimitTo,
+			Except:        metadata.Except,
+			TypeSchema:    metadata.TypeSchemaName,
+			Managed:       metadata.Managed,
+			Comment:       commentText,
 		})
 	}
 	if schemaRows.Err() != nil {
@@ -249,20 +432,26 @@ func DiffSchemas(dStateSchemas []model.Schema, dbSchemas []model.Schema) (schRem
 	return
 }
 
-// DropSchema drops a database schema with optional CASCADE
-func DropSchema(ctx context.Context, dbConnection *sql.DB, schema model.Schema, cascadeDrop bool) error {
-	// TODO: Figure out if it's feasible to also drop the foreign ENUMs as well to make the drop as clean as possible
+// dropSchemaSQL returns the statement that drops the local schema of the supplied schema with optional CASCADE
+func dropSchemaSQL(schema model.Schema, cascadeDrop bool) string {
+	query := fmt.Sprintf(sqlDropSchema, QuoteIdentifier(schema.LocalSchema))
+	if cascadeDrop {
+		query = fmt.Sprintf("%s CASCADE", query)
+	}
+	return query
+}
+
+// DropSchema drops a database schema with optional CASCADE. The user-defined types imported for the schema are
+// left alone; see DropSchemaTypes.
+func DropSchema(ctx context.Context, dbConnection database.Executor, schema model.Schema, cascadeDrop bool) error {
 	log := logger.Log(ctx).
 		WithField("function", "DropSchema")
 	if schema.LocalSchema == "" {
 		return logger.ErrorfAsError(log, "local schema name is required")
 	}
-	query := fmt.Sprintf(sqlDropSchema, schema.LocalSchema)
-	if cascadeDrop {
-		query = fmt.Sprintf("%s CASCADE", query)
-	}
+	query := dropSchemaSQL(schema, cascadeDrop)
 	log.Tracef("query: %s", query)
-	_, err := dbConnection.Exec(query)
+	_, err := dbConnection.ExecContext(ctx, query)
 	if err != nil {
 		log.Errorf("error dropping schema: %s", err)
 		return err
@@ -270,131 +459,1088 @@ func DropSchema(ctx context.Context, dbConnection *sql.DB, schema model.Schema,
 	return nil
 }
 
-// importSchemaEnums attempts to create ENUM types locally that represent ENUM types used in the remote schema
-func importSchemaEnums(ctx context.Context, dbConnection *sql.DB, schema model.Schema) error {
+// DropSchemaTypes drops the user-defined types fdwctl created for the named local schema that are no longer used by
+// any table, along with the local schemas created to hold them once they are empty. It is meant to be called after
+// the local schema was dropped.
+func DropSchemaTypes(ctx context.Context, dbConnection database.Executor, schemaName string) error {
 	log := logger.Log(ctx).
-		WithField("function", "importSchemaEnums")
-	fdbConnStr := ResolveConnectionString(schema.ENUMConnection, &schema.ENUMSecret)
-	fdbConn, err := database.GetConnection(ctx, fdbConnStr)
+		WithField("function", "DropSchemaTypes")
+	if schemaName == "" {
+		return logger.ErrorfAsError(log, "local schema name is required")
+	}
+	p := newPlanner(dbConnection, PlanOptions{})
+	err := p.planPruneTypes(ctx, nil, schemaName)
 	if err != nil {
-		log.Errorf("error connecting to foreign database: %s", err)
+		log.Errorf("error planning removal of the types of local schema %s: %s", schemaName, err)
 		return err
 	}
+	return ExecutePlan(ctx, dbConnection, p.plan)
+}
+
+// getImportedTypes returns the user-defined types that fdwctl created along with the local foreign schemas each of
+// them was created for. Only the schema, name, kind, and foreign schemas of each type are returned.
+func getImportedTypes(ctx context.Context, dbConnection database.Executor) ([]*model.SchemaType, error) {
+	log := logger.Log(ctx).
+		WithField("function", "getImportedTypes")
+	log.Tracef("query: %s", sqlGetImportedTypes)
+	typeRows, err := dbConnection.QueryContext(ctx, sqlGetImportedTypes)
+	if err != nil {
+		log.Errorf("error querying imported types: %s", err)
+		return nil, err
+	}
+	defer database.CloseRows(ctx, typeRows)
+	importedTypes := make([]*model.SchemaType, 0)
+	var typType, typeComment string
+	for typeRows.Next() {
+		importedType := new(model.SchemaType)
+		err = typeRows.Scan(&importedType.Schema, &importedType.Name, &typType, &typeComment)
+		if err != nil {
+			log.Errorf("error scanning result row: %s", err)
+			continue
+		}
+		importedType.Kind = typeKinds[typType]
+		commentText, metadata := splitMetadataComment(typeComment)
+		importedType.ImportedFor = metadata.ImportedFor
+		importedType.Comment = commentText
+		importedTypes = append(importedTypes, importedType)
+	}
+	if typeRows.Err() != nil {
+		log.Errorf("error iterating result rows: %s", typeRows.Err())
+		return nil, typeRows.Err()
+	}
+	return importedTypes, nil
+}
+
+// getLocalTypes returns the user-defined types of the database with their kind, the labels of ENUM types, and their
+// comment
+func getLocalTypes(ctx context.Context, dbConnection database.Executor) ([]*model.SchemaType, error) {
+	log := logger.Log(ctx).
+		WithField("function", "getLocalTypes")
+	log.Tracef("query: %s", sqlGetLocalTypes)
+	typeRows, err := dbConnection.QueryContext(ctx, sqlGetLocalTypes)
+	if err != nil {
+		log.Errorf("error querying local types: %s", err)
+		return nil, err
+	}
+	defer database.CloseRows(ctx, typeRows)
+	localTypes := make([]*model.SchemaType, 0)
+	var typeSchema, typeName, typType, typeComment, enumLabel string
+	for typeRows.Next() {
+		err = typeRows.Scan(&typeSchema, &typeName, &typType, &typeComment, &enumLabel)
+		if err != nil {
+			log.Errorf("error scanning result row: %s", err)
+			return nil, err
+		}
+		// Rows are ordered by type so the labels of an ENUM type are always on consecutive rows
+		if len(localTypes) == 0 || localTypes[len(localTypes)-1].Schema != typeSchema || localTypes[len(localTypes)-1].Name != typeName {
+			localTypes = append(localTypes, &model.SchemaType{
+				Schema:  typeSchema,
+				Name:    typeName,
+				Kind:    typeKinds[typType],
+				Comment: typeComment,
+			})
+		}
+		if enumLabel != "" {
+			localType := localTypes[len(localTypes)-1]
+			localType.Values = append(localType.Values, enumLabel)
+		}
+	}
+	if typeRows.Err() != nil {
+		log.Errorf("error iterating result rows: %s", typeRows.Err())
+		return nil, typeRows.Err()
+	}
+	return localTypes, nil
+}
+
+// typeUsage records that a table uses a user-defined type, directly or through other types
+type typeUsage struct {
+	typeSchema  string
+	typeName    string
+	tableSchema string
+	// serverName is the foreign server of a foreign table; it is empty for other tables
+	serverName string
+}
+
+// getTypeUsages returns the user-defined types used by the tables of the database
+func getTypeUsages(ctx context.Context, dbConnection database.Executor) ([]typeUsage, error) {
+	log := logger.Log(ctx).
+		WithField("function", "getTypeUsages")
+	log.Tracef("query: %s", sqlTypeUsages)
+	usageRows, err := dbConnection.QueryContext(ctx, sqlTypeUsages)
+	if err != nil {
+		log.Errorf("error querying type usages: %s", err)
+		return nil, err
+	}
+	defer database.CloseRows(ctx, usageRows)
+	usages := make([]typeUsage, 0)
+	for usageRows.Next() {
+		usage := typeUsage{}
+		err = usageRows.Scan(&usage.typeSchema, &usage.typeName, &usage.tableSchema, &usage.serverName)
+		if err != nil {
+			log.Errorf("error scanning result row: %s", err)
+			continue
+		}
+		usages = append(usages, usage)
+	}
+	if usageRows.Err() != nil {
+		log.Errorf("error iterating result rows: %s", usageRows.Err())
+		return nil, usageRows.Err()
+	}
+	return usages, nil
+}
+
+// getTypeSchemas returns the local schemas that fdwctl created for imported types along with the number of objects
+// in each of them that are not types
+func getTypeSchemas(ctx context.Context, dbConnection database.Executor) (map[string]int, error) {
+	log := logger.Log(ctx).
+		WithField("function", "getTypeSchemas")
+	log.Tracef("query: %s", sqlGetTypeSchemas)
+	schemaRows, err := dbConnection.QueryContext(ctx, sqlGetTypeSchemas)
+	if err != nil {
+		log.Errorf("error querying type schemas: %s", err)
+		return nil, err
+	}
+	defer database.CloseRows(ctx, schemaRows)
+	typeSchemas := make(map[string]int)
+	var schemaName string
+	var objectCount int
+	for schemaRows.Next() {
+		err = schemaRows.Scan(&schemaName, &objectCount)
+		if err != nil {
+			log.Errorf("error scanning result row: %s", err)
+			continue
+		}
+		typeSchemas[schemaName] = objectCount
+	}
+	if schemaRows.Err() != nil {
+		log.Errorf("error iterating result rows: %s", schemaRows.Err())
+		return nil, schemaRows.Err()
+	}
+	return typeSchemas, nil
+}
+
+// unusedImportedTypes returns the imported types that no longer need to exist: none of the foreign schemas a type was
+// created for is kept, and no table uses it other than the tables for which removed returns true
+func unusedImportedTypes(importedTypes []*model.SchemaType, usages []typeUsage, keptSchemas map[string]bool, removed func(usage typeUsage) bool) []*model.SchemaType {
+	usedTypes := make(map[string]bool)
+	for _, usage := range usages {
+		if !removed(usage) {
+			usedTypes[fmt.Sprintf("%s.%s", usage.typeSchema, usage.typeName)] = true
+		}
+	}
+	unused := make([]*model.SchemaType, 0)
+	for _, importedType := range importedTypes {
+		if usedTypes[importedType.String()] {
+			continue
+		}
+		kept := false
+		for _, schemaName := range importedType.ImportedFor {
+			if keptSchemas[schemaName] {
+				kept = true
+				break
+			}
+		}
+		if !kept {
+			unused = append(unused, importedType)
+		}
+	}
+	return unused
+}
+
+// dropTypeSQL returns the statement that drops the supplied user-defined type
+func dropTypeSQL(schemaType *model.SchemaType) string {
+	query := sqlDropType
+	if schemaType.Kind == model.ObjectDomain {
+		query = sqlDropDomain
+	}
+	return fmt.Sprintf(query, QuoteQualifiedIdentifier(schemaType.Schema, schemaType.Name))
+}
+
+// getRemoteSchemaTypes returns the user-defined types used in tables of the remote schema with their definitions, in
+// the order they must be created in. The remote database is read through the enum connection of the schema or a
+// connection derived from the server and its user mapping. The types are moved into the type schema of the schema
+// when it has one.
+func getRemoteSchemaTypes(ctx context.Context, dbConnection database.Executor, server model.ForeignServer, schema model.Schema) ([]*model.SchemaType, error) {
+	log := logger.Log(ctx).
+		WithField("function", "getRemoteSchemaTypes")
+	remoteConnStr, err := remoteConnectionString(ctx, dbConnection, server, schema)
+	if err != nil {
+		return nil, err
+	}
+	remoteTypes, err := getRemoteTypes(ctx, remoteConnStr, schema.RemoteSchema)
+	if err != nil || schema.TypeSchema == "" {
+		return remoteTypes, err
+	}
+	remoteTypes, err = remapTypes(remoteTypes, schema.TypeSchema)
+	if err != nil {
+		return nil, logger.ErrorfAsError(log, "cannot import the types of schema %s into %s: %s", schema.LocalSchema, schema.TypeSchema, err)
+	}
+	return remoteTypes, nil
+}
+
+// getRemoteTypes connects to a remote database and returns the user-defined types used in tables of the named schema
+// with their definitions, ordered so that every type comes after the types it refers to
+func getRemoteTypes(ctx context.Context, connectionString string, remoteSchema string) ([]*model.SchemaType, error) {
+	log := logger.Log(ctx).
+		WithField("function", "getRemoteTypes")
+	fdbConn, err := database.GetConnection(ctx, connectionString)
+	if err != nil {
+		log.Errorf("error connecting to foreign database: %s", err)
+		return nil, err
+	}
 	defer database.CloseConnection(ctx, fdbConn)
-	remoteEnums, err := getSchemaEnumsUsedInTables(ctx, fdbConn, schema.RemoteSchema)
+	remoteTypes, err := getSchemaTypesUsedInTables(ctx, fdbConn, remoteSchema)
 	if err != nil {
-		log.Errorf("error getting remote ENUMs: %s", err)
+		log.Errorf("error getting remote types: %s", err)
+		return nil, err
+	}
+	// Get enough data from remote database to re-create the types
+	for _, remoteType := range remoteTypes {
+		err = getTypeDefinition(ctx, fdbConn, remoteType)
+		if err != nil {
+			log.Errorf("error getting definition of type %s: %s", remoteType, err)
+			return nil, err
+		}
+	}
+	return sortTypesByDependency(remoteTypes)
+}
+
+// getTypeDefinition reads the definition of a user-defined type according to its kind
+func getTypeDefinition(ctx context.Context, dbConnection database.Executor, schemaType *model.SchemaType) error {
+	var err error
+	switch schemaType.Kind {
+	case model.ObjectEnum:
+		schemaType.Values, err = getSchemaEnumStrings(ctx, dbConnection, &model.SchemaEnum{Schema: schemaType.Schema, Name: schemaType.Name})
+	case model.ObjectDomain:
+		err = getDomainDefinition(ctx, dbConnection, schemaType)
+	case model.ObjectComposite:
+		err = getCompositeAttributes(ctx, dbConnection, schemaType)
+	case model.ObjectRange:
+		err = getRangeDefinition(ctx, dbConnection, schemaType)
+	default:
+		err = fmt.Errorf("unsupported kind of type: %s", schemaType.Kind)
+	}
+	return err
+}
+
+// typeReference returns the name a type definition uses to refer to another type. Built-in types keep the name
+// format_type returned, including any type modifier; user-defined types are schema-qualified so that they do not
+// depend on the search path. The qualified name of a user-defined type is added to the dependencies of schemaType.
+func typeReference(schemaType *model.SchemaType, formattedType string, typeSchema string, typeName string, isArray bool) string {
+	if typeSchema == "pg_catalog" || typeSchema == "information_schema" {
+		return formattedType
+	}
+	dependency := fmt.Sprintf("%s.%s", typeSchema, typeName)
+	if !containsString(schemaType.DependsOn, dependency) {
+		schemaType.DependsOn = append(schemaType.DependsOn, dependency)
+	}
+	reference := QuoteQualifiedIdentifier(typeSchema, typeName)
+	if isArray {
+		reference += "[]"
+	}
+	return reference
+}
+
+// getDomainDefinition reads the base type, default, nullability, and CHECK constraints of a domain
+func getDomainDefinition(ctx context.Context, dbConnection database.Executor, schemaType *model.SchemaType) error {
+	log := logger.Log(ctx).
+		WithField("function", "getDomainDefinition")
+	log.Tracef("query: %s, args: %#v, %#v", sqlDomainDefinition, schemaType.Schema, schemaType.Name)
+	domainRows, err := dbConnection.QueryContext(ctx, sqlDomainDefinition, schemaType.Schema, schemaType.Name)
+	if err != nil {
+		log.Errorf("error querying domain: %s", err)
 		return err
 	}
-	sort.Slice(remoteEnums, func(i, j int) bool {
-		return strings.Compare(remoteEnums[i].Name, remoteEnums[j].Name) == -1
-	})
-	// Get a list of local enums, too
-	localEnums, err := getEnums(ctx, dbConnection)
+	defer database.CloseRows(ctx, domainRows)
+	if !domainRows.Next() {
+		if domainRows.Err() != nil {
+			log.Errorf("error iterating result rows: %s", domainRows.Err())
+			return domainRows.Err()
+		}
+		return logger.ErrorfAsError(log, "domain %s does not exist", schemaType)
+	}
+	var formattedType, typeSchema, typeName string
+	var isArray bool
+	err = domainRows.Scan(&formattedType, &typeSchema, &typeName, &isArray, &schemaType.NotNull, &schemaType.Default)
 	if err != nil {
-		log.Errorf("error getting local ENUMs: %s", err)
+		log.Errorf("error scanning result row: %s", err)
 		return err
 	}
-	sort.Slice(localEnums, func(i, j int) bool {
-		return strings.Compare(localEnums[i].Name, localEnums[j].Name) == -1
-	})
-	// sort.Strings(localEnums)
-	// Get enough data from remote database to re-create enums and then create them
-	for _, remoteEnum := range remoteEnums {
-		haveLocalEnum := false
-		for _, localEnum := range localEnums {
-			if remoteEnum.Name == localEnum.Name && remoteEnum.Schema == localEnum.Schema {
-				haveLocalEnum = true
-				break
+	schemaType.BaseType = typeReference(schemaType, formattedType, typeSchema, typeName, isArray)
+	database.CloseRows(ctx, domainRows)
+	schemaType.Constraints, err = getDomainConstraints(ctx, dbConnection, schemaType)
+	return err
+}
+
+// getDomainConstraints returns the CHECK constraints of a domain as named constraint clauses
+func getDomainConstraints(ctx context.Context, dbConnection database.Executor, schemaType *model.SchemaType) ([]string, error) {
+	log := logger.Log(ctx).
+		WithField("function", "getDomainConstraints")
+	log.Tracef("query: %s, args: %#v, %#v", sqlDomainConstraints, schemaType.Schema, schemaType.Name)
+	constraintRows, err := dbConnection.QueryContext(ctx, sqlDomainConstraints, schemaType.Schema, schemaType.Name)
+	if err != nil {
+		log.Errorf("error querying domain constraints: %s", err)
+		return nil, err
+	}
+	defer database.CloseRows(ctx, constraintRows)
+	constraints := make([]string, 0)
+	var constraintName, constraintDef string
+	for constraintRows.Next() {
+		err = constraintRows.Scan(&constraintName, &constraintDef)
+		if err != nil {
+			log.Errorf("error scanning result row: %s", err)
+			continue
+		}
+		constraints = append(constraints, fmt.Sprintf("CONSTRAINT %s %s", QuoteIdentifier(constraintName), constraintDef))
+	}
+	if constraintRows.Err() != nil {
+		log.Errorf("error iterating result rows: %s", constraintRows.Err())
+		return nil, constraintRows.Err()
+	}
+	return constraints, nil
+}
+
+// getCompositeAttributes reads the attributes of a composite type in order
+func getCompositeAttributes(ctx context.Context, dbConnection database.Executor, schemaType *model.SchemaType) error {
+	log := logger.Log(ctx).
+		WithField("function", "getCompositeAttributes")
+	log.Tracef("query: %s, args: %#v, %#v", sqlCompositeAttributes, schemaType.Schema, schemaType.Name)
+	attributeRows, err := dbConnection.QueryContext(ctx, sqlCompositeAttributes, schemaType.Schema, schemaType.Name)
+	if err != nil {
+		log.Errorf("error querying composite type attributes: %s", err)
+		return err
+	}
+	defer database.CloseRows(ctx, attributeRows)
+	schemaType.Attributes = make([]model.Column, 0)
+	var attributeName, formattedType, typeSchema, typeName string
+	var isArray bool
+	for attributeRows.Next() {
+		err = attributeRows.Scan(&attributeName, &formattedType, &typeSchema, &typeName, &isArray)
+		if err != nil {
+			log.Errorf("error scanning result row: %s", err)
+			continue
+		}
+		schemaType.Attributes = append(schemaType.Attributes, model.Column{
+			Name: attributeName,
+			Type: typeReference(schemaType, formattedType, typeSchema, typeName, isArray),
+		})
+	}
+	if attributeRows.Err() != nil {
+		log.Errorf("error iterating result rows: %s", attributeRows.Err())
+		return attributeRows.Err()
+	}
+	return nil
+}
+
+// getRangeDefinition reads the subtype and the options of a range type
+func getRangeDefinition(ctx context.Context, dbConnection database.Executor, schemaType *model.SchemaType) error {
+	log := logger.Log(ctx).
+		WithField("function", "getRangeDefinition")
+	log.Tracef("query: %s, args: %#v, %#v", sqlRangeDefinition, schemaType.Schema, schemaType.Name)
+	rangeRows, err := dbConnection.QueryContext(ctx, sqlRangeDefinition, schemaType.Schema, schemaType.Name)
+	if err != nil {
+		log.Errorf("error querying range type: %s", err)
+		return err
+	}
+	defer database.CloseRows(ctx, rangeRows)
+	if !rangeRows.Next() {
+		if rangeRows.Err() != nil {
+			log.Errorf("error iterating result rows: %s", rangeRows.Err())
+			return rangeRows.Err()
+		}
+		return logger.ErrorfAsError(log, "range type %s does not exist", schemaType)
+	}
+	var formattedType, typeSchema, typeName string
+	var isArray bool
+	err = rangeRows.Scan(&formattedType, &typeSchema, &typeName, &isArray, &schemaType.SubtypeOpClass, &schemaType.Collation, &schemaType.Canonical, &schemaType.SubtypeDiff)
+	if err != nil {
+		log.Errorf("error scanning result row: %s", err)
+		return err
+	}
+	schemaType.BaseType = typeReference(schemaType, formattedType, typeSchema, typeName, isArray)
+	return nil
+}
+
+// sortTypesByDependency orders user-defined types so that every type comes after the types it depends on. Types that
+// do not depend on each other keep their relative order. Dependencies on types that are not in the list are ignored.
+func sortTypesByDependency(schemaTypes []*model.SchemaType) ([]*model.SchemaType, error) {
+	pending := make(map[string]bool)
+	for _, schemaType := range schemaTypes {
+		pending[schemaType.String()] = true
+	}
+	sorted := make([]*model.SchemaType, 0, len(schemaTypes))
+	for len(sorted) < len(schemaTypes) {
+		progressed := false
+		for _, schemaType := range schemaTypes {
+			if !pending[schemaType.String()] {
+				continue
+			}
+			ready := true
+			for _, dependency := range schemaType.DependsOn {
+				if dependency != schemaType.String() && pending[dependency] {
+					ready = false
+					break
+				}
+			}
+			if ready {
+				sorted = append(sorted, schemaType)
+				pending[schemaType.String()] = false
+				progressed = true
+			}
+		}
+		if !progressed {
+			cyclic := make([]string, 0)
+			for _, schemaType := range schemaTypes {
+				if pending[schemaType.String()] {
+					cyclic = append(cyclic, schemaType.String())
+				}
 			}
+			return nil, fmt.Errorf("user-defined types %s have a circular dependency", strings.Join(cyclic, ", "))
+		}
+	}
+	return sorted, nil
+}
+
+// getSchemaEnumStrings returns the values of the ENUM type with the schema and name of the supplied ENUM in sort order
+func getSchemaEnumStrings(ctx context.Context, dbConnection database.Executor, schemaEnum *model.SchemaEnum) ([]string, error) {
+	log := logger.Log(ctx).
+		WithField("function", "getSchemaEnumStrings")
+	log.Tracef("query: %s, args: %#v, %#v", sqlSchemaEnumStrings, schemaEnum.Schema, schemaEnum.Name)
+	enumRows, err := dbConnection.QueryContext(ctx, sqlSchemaEnumStrings, schemaEnum.Schema, schemaEnum.Name)
+	if err != nil {
+		log.Errorf("error querying enum data: %s", err)
+		return nil, err
+	}
+	defer database.CloseRows(ctx, enumRows)
+	enumStrings := make([]string, 0)
+	var enumString string
+	for enumRows.Next() {
+		err = enumRows.Scan(&enumString)
+		if err != nil {
+			log.Errorf("error scanning result row: %s", err)
+			continue
+		}
+		enumStrings = append(enumStrings, enumString)
+	}
+	if enumRows.Err() != nil {
+		log.Errorf("error iterating result rows: %s", enumRows.Err())
+		return nil, enumRows.Err()
+	}
+	return enumStrings, nil
+}
+
+// findSchemaEnum returns the ENUM in the list with the same schema and name as the supplied ENUM, or nil if there
+// is no such ENUM
+func findSchemaEnum(schemaEnums []*model.SchemaEnum, schemaEnum *model.SchemaEnum) *model.SchemaEnum {
+	for _, se := range schemaEnums {
+		if se.Name == schemaEnum.Name && se.Schema == schemaEnum.Schema {
+			return se
+		}
+	}
+	return nil
+}
+
+// createEnumSQL returns the statement that creates the supplied ENUM type with its values
+func createEnumSQL(schemaEnum *model.SchemaEnum) string {
+	quotedEnumStrings := make([]string, len(schemaEnum.Values))
+	for idx, enumString := range schemaEnum.Values {
+		quotedEnumStrings[idx] = QuoteLiteral(enumString)
+	}
+	return fmt.Sprintf(sqlCreateEnum, QuoteQualifiedIdentifier(schemaEnum.Schema, schemaEnum.Name), strings.Join(quotedEnumStrings, ","))
+}
+
+// reconcileEnumSQL compares the values of a local ENUM type with the values of the remote ENUM type it represents.
+// The statements that add the missing remote values are returned; each value is placed BEFORE or AFTER a neighbouring
+// value so that the local sort order follows the remote one. Values that were removed from the remote ENUM, and
+// values whose relative order differs, cannot be changed in place and are returned as drift instead.
+func reconcileEnumSQL(localEnum *model.SchemaEnum, remoteEnum *model.SchemaEnum) ([]string, []model.Drift) {
+	enumName := QuoteQualifiedIdentifier(remoteEnum.Schema, remoteEnum.Name)
+	drifts := make([]model.Drift, 0)
+	sharedLocal := make([]string, 0)
+	for _, value := range localEnum.Values {
+		if !containsString(remoteEnum.Values, value) {
+			drifts = append(drifts, model.Drift{
+				ObjectType: model.ObjectEnum,
+				ObjectName: remoteEnum.String(),
+				Kind:       model.DriftUnexpected,
+				Attribute:  "value",
+				Actual:     value,
+			})
+			continue
+		}
+		sharedLocal = append(sharedLocal, value)
+	}
+	sharedRemote := make([]string, 0)
+	for _, value := range remoteEnum.Values {
+		if containsString(localEnum.Values, value) {
+			sharedRemote = append(sharedRemote, value)
+		}
+	}
+	if strings.Join(sharedLocal, ",") != strings.Join(sharedRemote, ",") {
+		drifts = append(drifts, model.Drift{
+			ObjectType: model.ObjectEnum,
+			ObjectName: remoteEnum.String(),
+			Kind:       model.DriftChanged,
+			Attribute:  "order",
+			Desired:    strings.Join(sharedRemote, ","),
+			Actual:     strings.Join(sharedLocal, ","),
+		})
+	}
+	statements := make([]string, 0)
+	present := make(map[string]bool)
+	for _, value := range localEnum.Values {
+		present[value] = true
+	}
+	for idx, value := range remoteEnum.Values {
+		if present[value] {
+			continue
+		}
+		query := fmt.Sprintf(sqlAddEnumValue, enumName, QuoteLiteral(value))
+		if idx > 0 {
+			// The previous remote value is present locally, either already or because it was just added
+			query = fmt.Sprintf(sqlAddEnumValueAfter, enumName, QuoteLiteral(value), QuoteLiteral(remoteEnum.Values[idx-1]))
+		} else {
+			for _, next := range remoteEnum.Values[idx+1:] {
+				if present[next] {
+					query = fmt.Sprintf(sqlAddEnumValueBefore, enumName, QuoteLiteral(value), QuoteLiteral(next))
+					break
+				}
+			}
+		}
+		statements = append(statements, query)
+		present[value] = true
+	}
+	return statements, drifts
+}
+
+// createTypeSQL returns the statement that creates the supplied user-defined type from its definition
+func createTypeSQL(schemaType *model.SchemaType) string {
+	typeName := QuoteQualifiedIdentifier(schemaType.Schema, schemaType.Name)
+	switch schemaType.Kind {
+	case model.ObjectDomain:
+		query := fmt.Sprintf(sqlCreateDomain, typeName, schemaType.BaseType)
+		if schemaType.Default != "" {
+			query = fmt.Sprintf("%s DEFAULT %s", query, schemaType.Default)
+		}
+		if schemaType.NotNull {
+			query += " NOT NULL"
+		}
+		for _, constraint := range schemaType.Constraints {
+			query = fmt.Sprintf("%s %s", query, constraint)
+		}
+		return query
+	case model.ObjectComposite:
+		attributes := make([]string, len(schemaType.Attributes))
+		for idx, attribute := range schemaType.Attributes {
+			attributes[idx] = fmt.Sprintf("%s %s", QuoteIdentifier(attribute.Name), attribute.Type)
+		}
+		return fmt.Sprintf(sqlCreateComposite, typeName, strings.Join(attributes, ", "))
+	case model.ObjectRange:
+		rangeOptions := []string{fmt.Sprintf("SUBTYPE = %s", schemaType.BaseType)}
+		if schemaType.SubtypeOpClass != "" {
+			rangeOptions = append(rangeOptions, fmt.Sprintf("SUBTYPE_OPCLASS = %s", schemaType.SubtypeOpClass))
+		}
+		if schemaType.Collation != "" {
+			rangeOptions = append(rangeOptions, fmt.Sprintf("COLLATION = %s", schemaType.Collation))
+		}
+		if schemaType.Canonical != "" {
+			rangeOptions = append(rangeOptions, fmt.Sprintf("CANONICAL = %s", schemaType.Canonical))
 		}
-		if haveLocalEnum {
+		if schemaType.SubtypeDiff != "" {
+			rangeOptions = append(rangeOptions, fmt.Sprintf("SUBTYPE_DIFF = %s", schemaType.SubtypeDiff))
+		}
+		return fmt.Sprintf(sqlCreateRange, typeName, strings.Join(rangeOptions, ", "))
+	default:
+		return createEnumSQL(schemaEnumOf(schemaType))
+	}
+}
+
+// schemaEnumOf returns the ENUM type represented by a user-defined type of kind enum
+func schemaEnumOf(schemaType *model.SchemaType) *model.SchemaEnum {
+	return &model.SchemaEnum{
+		Schema: schemaType.Schema,
+		Name:   schemaType.Name,
+		Values: schemaType.Values,
+	}
+}
+
+// importSchemaTypes attempts to create user-defined types locally that represent the supplied remote types used in
+// the remote schema, in dependency order. The values of ENUM types that already exist locally are reconciled with the
+// remote values; other types that already exist are left alone. Each type that is created is marked as imported for
+// the local schema, as is any schema that is created to hold it.
+func importSchemaTypes(ctx context.Context, dbConnection database.Executor, localSchema string, remoteTypes []*model.SchemaType) error {
+	log := logger.Log(ctx).
+		WithField("function", "importSchemaTypes")
+	// Get a list of local types, too
+	localTypes, err := getEnums(ctx, dbConnection)
+	if err != nil {
+		log.Errorf("error getting local types: %s", err)
+		return err
+	}
+	importedTypes, err := getImportedTypes(ctx, dbConnection)
+	if err != nil {
+		log.Errorf("error getting imported types: %s", err)
+		return err
+	}
+	for _, remoteType := range remoteTypes {
+		remoteEnum := schemaEnumOf(remoteType)
+		if localType := findSchemaEnum(localTypes, remoteEnum); localType != nil {
+			if remoteType.Kind == model.ObjectEnum {
+				err = reconcileEnum(ctx, dbConnection, localType, remoteEnum)
+				if err != nil {
+					return err
+				}
+			}
+			err = markImportedType(ctx, dbConnection, importedTypes, remoteType, localSchema)
+			if err != nil {
+				return err
+			}
 			continue
 		}
-		//if sort.SearchStrings(localEnumNames, remoteEnum.Name) != len(localEnums) {
-		//	log.Debugf("local enum %s exists", remoteEnum)
-		//	continue
-		//}
-		var enumStrings []string
-		enumStrings, err = getEnumStrings(ctx, fdbConn, remoteEnum.Name)
+		// ensure type schema exists
+		typeSchemaExists, err := schemaExists(ctx, dbConnection, remoteType.Schema)
 		if err != nil {
-			log.Errorf("error getting enum values: %s", err)
+			log.Errorf("error checking for schema: %s", err)
 			return err
 		}
-		quotedEnumStrings := make([]string, len(enumStrings))
-		for idx, enumString := range enumStrings {
-			quotedEnumStrings[idx] = fmt.Sprintf(`'%s'`, enumString)
+		if !typeSchemaExists {
+			err = ensureSchema(ctx, dbConnection, remoteType.Schema)
+			if err != nil {
+				log.WithError(err).
+					WithField("schema", remoteType.Schema).
+					Error("unable to ensure schema exists")
+				return err
+			}
+			query := commentOnSchemaSQL(remoteType.Schema, "", objectMetadata{TypeSchema: true})
+			log.Tracef("query: %s", query)
+			_, err = dbConnection.ExecContext(ctx, query)
+			if err != nil {
+				log.Errorf("error marking local schema %s: %s", remoteType.Schema, err)
+				return err
+			}
 		}
-		// ensure enum schema exists
-		err = ensureSchema(ctx, dbConnection, remoteEnum.Schema)
+		query := createTypeSQL(remoteType)
+		log.Tracef("query: %s", query)
+		_, err = dbConnection.ExecContext(ctx, query)
 		if err != nil {
-			log.WithError(err).
-				WithField("schema", remoteEnum.Schema).
-				Error("unable to ensure schema exists")
+			log.Errorf("error creating local %s type: %s", remoteType.Kind, err)
 			return err
 		}
-		query := fmt.Sprintf(sqlCreateEnum, remoteEnum.Schema, remoteEnum.Name, strings.Join(quotedEnumStrings, ","))
+		query = commentOnTypeSQL(remoteType, "", objectMetadata{ImportedFor: []string{localSchema}})
 		log.Tracef("query: %s", query)
-		_, err = dbConnection.Exec(query)
+		_, err = dbConnection.ExecContext(ctx, query)
 		if err != nil {
-			log.Errorf("error creating local enum type: %s", err)
+			log.Errorf("error marking local %s type: %s", remoteType.Kind, err)
 			return err
 		}
-		log.Infof("enum type %s created", remoteEnum)
+		log.Infof("%s type %s created", remoteType.Kind, remoteType)
 	}
 	return nil
 }
 
+// markImportedType adds the local schema to the foreign schemas an existing type was imported for. Types that fdwctl
+// did not create are left alone.
+func markImportedType(ctx context.Context, dbConnection database.Executor, importedTypes []*model.SchemaType, schemaType *model.SchemaType, localSchema string) error {
+	log := logger.Log(ctx).
+		WithField("function", "markImportedType")
+	importedType := findImportedType(importedTypes, schemaType)
+	if importedType == nil || containsString(importedType.ImportedFor, localSchema) {
+		return nil
+	}
+	importedType.ImportedFor = append(importedType.ImportedFor, localSchema)
+	query := commentOnTypeSQL(importedType, importedType.Comment, objectMetadata{ImportedFor: importedType.ImportedFor})
+	log.Tracef("query: %s", query)
+	_, err := dbConnection.ExecContext(ctx, query)
+	if err != nil {
+		log.Errorf("error marking local %s type: %s", importedType.Kind, err)
+		return err
+	}
+	return nil
+}
+
+// reconcileEnum adds the values of the remote ENUM type that are missing from the existing local ENUM type. Values
+// that were removed or reordered remotely are logged as warnings.
+func reconcileEnum(ctx context.Context, dbConnection database.Executor, localEnum *model.SchemaEnum, remoteEnum *model.SchemaEnum) error {
+	log := logger.Log(ctx).
+		WithField("function", "reconcileEnum")
+	var err error
+	localEnum.Values, err = getSchemaEnumStrings(ctx, dbConnection, localEnum)
+	if err != nil {
+		log.Errorf("error getting local enum values: %s", err)
+		return err
+	}
+	statements, drifts := reconcileEnumSQL(localEnum, remoteEnum)
+	for _, drift := range drifts {
+		log.Warnf("%s; the enum type must be re-created to fix it", drift.String())
+	}
+	for _, query := range statements {
+		log.Tracef("query: %s", query)
+		_, err = dbConnection.ExecContext(ctx, query)
+		if err != nil {
+			log.Errorf("error adding value to local enum type: %s", err)
+			return err
+		}
+	}
+	if len(statements) > 0 {
+		log.Infof("%d values added to enum type %s", len(statements), remoteEnum)
+	}
+	return nil
+}
+
+// importForeignSchemaSQL returns the statement that imports the remote schema from the named foreign server into
+// the local schema, restricted by the LIMIT TO or EXCEPT table filter of the schema and with its import options.
+// Patterns in the table filter must already have been expanded into table names.
+func importForeignSchemaSQL(serverName string, schema model.Schema) string {
+	tableFilter := ""
+	if len(schema.LimitTo) > 0 {
+		tableFilter = tableFilterSQL(tableFilterLimitTo, schema.LimitTo)
+	} else if len(schema.Except) > 0 {
+		tableFilter = tableFilterSQL(tableFilterExcept, schema.Except)
+	}
+	importOptions := ""
+	if len(schema.ImportOptions) > 0 {
+		importOptions = fmt.Sprintf(" OPTIONS (%s)", optionsClause(schema.ImportOptions))
+	}
+	return fmt.Sprintf(
+		sqlImportForeignSchema,
+		QuoteIdentifier(schema.RemoteSchema),
+		tableFilter,
+		QuoteIdentifier(serverName),
+		QuoteIdentifier(schema.LocalSchema),
+		importOptions,
+	)
+}
+
+// schemaMetadata returns the metadata recorded about a foreign schema that fdwctl manages: the import options and
+// table filter it was imported with and the local schema its types were imported into
+func schemaMetadata(schema model.Schema) objectMetadata {
+	return objectMetadata{
+		ImportOptions:  schema.ImportOptions,
+		LimitTo:        schema.LimitTo,
+		Except:         schema.Except,
+		TypeSchemaName: schema.TypeSchema,
+		Managed:        true,
+	}
+}
+
+// schemaMetadataCommentSQL returns the statement that marks a schema as managed by fdwctl and records its import
+// options and table filter in its comment, after the text of the comment of the schema, so that a change to them can
+// be detected
+func schemaMetadataCommentSQL(schema model.Schema) string {
+	return commentOnSchemaSQL(schema.LocalSchema, schema.Comment, schemaMetadata(schema))
+}
+
+// schemaMetadataUpdateSQL returns the statement that replaces the metadata recorded for an existing schema with that of
+// the desired state schema, or an empty string if the recorded metadata is current. A schema that is not marked as
+// managed yet is marked.
+func schemaMetadataUpdateSQL(schema model.Schema, dbSchema model.Schema) string {
+	metadata := schemaMetadata(schema)
+	if dbSchema.Managed && metadataComment("", metadata) == metadataComment("", schemaMetadata(dbSchema)) {
+		return ""
+	}
+	return commentOnSchemaSQL(schema.LocalSchema, dbSchema.Comment, metadata)
+}
+
+// isTablePattern determines if a table filter entry is a glob pattern or a regular expression rather than a table name
+func isTablePattern(entry string) bool {
+	return isTableRegex(entry) || strings.ContainsAny(entry, tablePatternGlobChars)
+}
+
+// isTableRegex determines if a table filter entry is a regular expression enclosed in slashes
+func isTableRegex(entry string) bool {
+	return len(entry) > len(tablePatternRegexDelimiter)*2 &&
+		strings.HasPrefix(entry, tablePatternRegexDelimiter) &&
+		strings.HasSuffix(entry, tablePatternRegexDelimiter)
+}
+
+// tableRegex returns the regular expression of a table filter entry without its enclosing slashes; slashes within
+// the expression are kept
+func tableRegex(entry string) string {
+	return entry[len(tablePatternRegexDelimiter) : len(entry)-len(tablePatternRegexDelimiter)]
+}
+
+// hasTablePatterns determines if any of the table filter entries is a pattern
+func hasTablePatterns(entries []string) bool {
+	for _, entry := range entries {
+		if isTablePattern(entry) {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidateTableFilter determines if the LIMIT TO and EXCEPT table filters of the supplied schema can be used to
+// import it from the supplied server: only one of them may be specified, every pattern must be valid, and patterns
+// require a connection to the remote database to read the tables of the remote schema
+func ValidateTableFilter(server model.ForeignServer, schema model.Schema) error {
+	if len(schema.LimitTo) > 0 && len(schema.Except) > 0 {
+		return fmt.Errorf("schema %s: only one of limitTo and except may be specified", schema.LocalSchema)
+	}
+	for _, entry := range append(append(make([]string, 0), schema.LimitTo...), schema.Except...) {
+		if strings.TrimSpace(entry) == "" {
+			return fmt.Errorf("schema %s: table filter entries cannot be empty", schema.LocalSchema)
+		}
+		if isTableRegex(entry) {
+			_, err := regexp.Compile(tableRegex(entry))
+			if err != nil {
+				return fmt.Errorf("schema %s: invalid table pattern %s: %s", schema.LocalSchema, entry, err)
+			}
+			continue
+		}
+		_, err := path.Match(entry, "")
+		if err != nil {
+			return fmt.Errorf("schema %s: invalid table pattern %s: %s", schema.LocalSchema, entry, err)
+		}
+	}
+	if !canConnectToRemote(server, schema) && (hasTablePatterns(schema.LimitTo) || hasTablePatterns(schema.Except)) {
+		return fmt.Errorf("schema %s: table patterns require an enum connection or a user mapping to connect to the remote database with", schema.LocalSchema)
+	}
+	return nil
+}
+
+// matchTables returns the tables that match any of the table filter entries. Table names in the entries are always
+// returned; patterns are matched against the supplied remote tables. The result is sorted and free of duplicates.
+func matchTables(entries []string, remoteTables []string) []string {
+	matched := make([]string, 0)
+	add := func(table string) {
+		if !containsString(matched, table) {
+			matched = append(matched, table)
+		}
+	}
+	for _, entry := range entries {
+		switch {
+		case isTableRegex(entry):
+			// The entry has been validated by ValidateTableFilter
+			tableRE := regexp.MustCompile(tableRegex(entry))
+			for _, table := range remoteTables {
+				if tableRE.MatchString(table) {
+					add(table)
+				}
+			}
+		case isTablePattern(entry):
+			for _, table := range remoteTables {
+				if ok, _ := path.Match(entry, table); ok {
+					add(table)
+				}
+			}
+		default:
+			add(entry)
+		}
+	}
+	sort.Strings(matched)
+	return matched
+}
+
+// filterTables returns the remote tables that a schema with the supplied LIMIT TO and EXCEPT table filters imports
+func filterTables(limitTo []string, except []string, remoteTables []string) []string {
+	if len(limitTo) > 0 {
+		return matchTables(limitTo, remoteTables)
+	}
+	excluded := matchTables(except, remoteTables)
+	tables := make([]string, 0, len(remoteTables))
+	for _, table := range remoteTables {
+		if !containsString(excluded, table) {
+			tables = append(tables, table)
+		}
+	}
+	return tables
+}
+
+// getRemoteSchemaTables returns the tables of the remote schema of a foreign schema read through the enum connection
+// of the schema or a connection derived from the server and its user mapping
+func getRemoteSchemaTables(ctx context.Context, dbConnection database.Executor, server model.ForeignServer, schema model.Schema) ([]string, error) {
+	log := logger.Log(ctx).
+		WithField("function", "getRemoteSchemaTables")
+	fdbConnStr, err := remoteConnectionString(ctx, dbConnection, server, schema)
+	if err != nil {
+		return nil, err
+	}
+	fdbConn, err := database.GetConnection(ctx, fdbConnStr)
+	if err != nil {
+		log.Errorf("error connecting to foreign database: %s", err)
+		return nil, err
+	}
+	defer database.CloseConnection(ctx, fdbConn)
+	return getSchemaTables(ctx, fdbConn, schema.RemoteSchema)
+}
+
+// expandTableFilter returns a copy of the supplied schema in which the patterns of its table filters have been
+// replaced by the names of the remote tables they match. The tables of the remote schema are also returned when they
+// were read, which is when the schema has a table filter and the remote database can be connected to; otherwise they
+// are nil.
+func expandTableFilter(ctx context.Context, dbConnection database.Executor, server model.ForeignServer, schema model.Schema) (model.Schema, []string, error) {
+	log := logger.Log(ctx).
+		WithField("function", "expandTableFilter")
+	err := ValidateTableFilter(server, schema)
+	if err != nil {
+		return schema, nil, err
+	}
+	if (len(schema.LimitTo) == 0 && len(schema.Except) == 0) || !canConnectToRemote(server, schema) {
+		return schema, nil, nil
+	}
+	remoteTables, err := getRemoteSchemaTables(ctx, dbConnection, server, schema)
+	if err != nil {
+		log.Errorf("error getting remote tables: %s", err)
+		return schema, nil, err
+	}
+	if len(schema.LimitTo) > 0 {
+		schema.LimitTo = matchTables(schema.LimitTo, remoteTables)
+		if len(schema.LimitTo) == 0 {
+			return schema, nil, fmt.Errorf("schema %s: limitTo does not match any table of remote schema %s", schema.LocalSchema, schema.RemoteSchema)
+		}
+	} else {
+		schema.Except = matchTables(schema.Except, remoteTables)
+	}
+	return schema, remoteTables, nil
+}
+
+// tableFilterSQL returns the LIMIT TO or EXCEPT clause of an IMPORT FOREIGN SCHEMA statement for the supplied tables
+func tableFilterSQL(clause string, tables []string) string {
+	quotedTables := make([]string, len(tables))
+	for idx, table := range tables {
+		quotedTables[idx] = QuoteIdentifier(table)
+	}
+	return fmt.Sprintf(" %s (%s)", clause, strings.Join(quotedTables, ", "))
+}
+
 // ImportSchema attempts to import a remote schema from a foreign server into a local schema, optionally importing
-// ENUM types used in the remote schema as well.
-func ImportSchema(ctx context.Context, dbConnection *sql.DB, serverName string, schema model.Schema) error {
+// the user-defined types used in the remote schema as well. The remote database is read through the enum connection
+// of the schema when it is set and through a connection derived from the server and its user mapping otherwise.
+func ImportSchema(ctx context.Context, dbConnection database.Executor, serverName string, schema model.Schema) error {
 	log := logger.Log(ctx).
 		WithField("function", "ImportSchema")
 	// Sanity Check
 	if serverName == "" {
 		return logger.ErrorfAsError(log, "server name is required")
 	}
-	if schema.ImportENUMs && schema.ENUMConnection == "" {
-		return logger.ErrorfAsError(log, "enum database connection string is required when importing enums")
+	err := ValidateSchemaGrants(schema)
+	if err != nil {
+		return logger.ErrorfAsError(log, "invalid schema grants: %s", err)
 	}
-	// Ensure the local schema exists
-	err := ensureSchema(ctx, dbConnection, schema.LocalSchema)
+	server, err := getForeignServer(ctx, dbConnection, serverName)
 	if err != nil {
-		log.Errorf("error ensuring local schema exists: %s", err)
 		return err
 	}
+	err = ValidateImportOptions(*server, schema)
+	if err != nil {
+		return logger.ErrorfAsError(log, "invalid import options: %s", err)
+	}
+	err = ValidateTypeSchema(schema)
+	if err != nil {
+		return logger.ErrorfAsError(log, "invalid type schema: %s", err)
+	}
+	if schema.ENUMConnection == "" {
+		// The user mappings of the server are needed to connect to the remote database
+		server.UserMaps, err = GetUserMapsForServer(ctx, dbConnection, serverName)
+		if err != nil {
+			log.Errorf("error getting user mappings: %s", err)
+			return err
+		}
+	}
+	// Replace table patterns with the names of the remote tables they match
+	filteredSchema, _, err := expandTableFilter(ctx, dbConnection, *server, schema)
+	if err != nil {
+		return logger.ErrorfAsError(log, "error expanding table filter: %s", err)
+	}
+	// Read the remote types and tables and look for conflicts before anything is changed
+	var remoteTypes []*model.SchemaType
 	if schema.ImportENUMs {
-		err = importSchemaEnums(ctx, dbConnection, schema)
+		remoteTypes, err = getRemoteSchemaTypes(ctx, dbConnection, *server, schema)
+		if err != nil {
+			log.Errorf("error getting remote types: %s", err)
+			return err
+		}
+		err = checkImportedTypeConflicts(ctx, dbConnection, serverName, schema.LocalSchema, remoteTypes)
 		if err != nil {
-			log.Errorf("error importing foreign enums: %s", err)
 			return err
 		}
 	}
-	// TODO: support LIMIT TO and EXCEPT
-	query := fmt.Sprintf(sqlImportForeignSchema, schema.RemoteSchema, serverName, schema.LocalSchema)
-	log.Tracef("query: %s", query)
-	_, err = dbConnection.Exec(query)
+	importSchema, createdTables, importNeeded := filteredSchema, []string{}, true
+	var typedTables map[string][]model.Column
+	if schema.TypeSchema != "" {
+		typedTables, err = getRemoteTypedTables(ctx, dbConnection, *server, schema)
+		if err != nil {
+			log.Errorf("error getting remote tables that use user-defined types: %s", err)
+			return err
+		}
+		importSchema, createdTables, importNeeded = splitTypedTables(filteredSchema, typedTables)
+	}
+	// The comment of a local schema that already exists is kept ahead of the metadata recorded in it
+	schemaComment, _, err := getSchemaComment(ctx, dbConnection, schema.LocalSchema)
 	if err != nil {
-		log.Errorf("error importing foreign schema: %s", err)
 		return err
 	}
-	// If there are permissions to configure then configure them
-	for _, user := range schema.SchemaGrants.Users {
-		log.Debugf("applying grants to schema %s for user %s", schema.LocalSchema, user)
-		query = fmt.Sprintf(sqlGrantSchemaUsage, schema.LocalSchema, user)
+	schema.Comment, _ = splitMetadataComment(schemaComment)
+	// Ensure the local schema exists
+	err = ensureSchema(ctx, dbConnection, schema.LocalSchema)
+	if err != nil {
+		log.Errorf("error ensuring local schema exists: %s", err)
+		return err
+	}
+	if schema.ImportENUMs {
+		err = importSchemaTypes(ctx, dbConnection, schema.LocalSchema, remoteTypes)
+		if err != nil {
+			log.Errorf("error importing foreign types: %s", err)
+			return err
+		}
+	}
+	var query string
+	if importNeeded {
+		query = importForeignSchemaSQL(serverName, importSchema)
 		log.Tracef("query: %s", query)
-		_, err = dbConnection.Exec(query)
+		_, err = dbConnection.ExecContext(ctx, query)
 		if err != nil {
-			log.Errorf("error granting usage to local user: %s", err)
+			log.Errorf("error importing foreign schema: %s", err)
 			return err
 		}
-		query = fmt.Sprintf(sqlGrantTableSelect, schema.LocalSchema, user)
+	}
+	for _, tableName := range createdTables {
+		query = createForeignTableSQL(typedForeignTable(serverName, schema, tableName, typedTables[tableName]), server.WrapperName())
 		log.Tracef("query: %s", query)
-		_, err = dbConnection.Exec(query)
+		_, err = dbConnection.ExecContext(ctx, query)
 		if err != nil {
-			log.Errorf("error granting select to local user: %s", err)
+			log.Errorf("error creating foreign table %s: %s", tableName, err)
 			return err
 		}
 	}
+	query = schemaMetadataCommentSQL(schema)
+	log.Tracef("query: %s", query)
+	_, err = dbConnection.ExecContext(ctx, query)
+	if err != nil {
+		log.Errorf("error recording import options of local schema: %s", err)
+		return err
+	}
+	// If there are permissions to configure then configure them
+	if schema.SchemaGrants != nil {
+		log.Debugf("applying grants to schema %s", schema.LocalSchema)
+		_, grantStatements := schemaGrantSQL(schema.LocalSchema, *schema.SchemaGrants, nil, newSchemaPrivileges())
+		for _, query = range grantStatements {
+			log.Tracef("query: %s", query)
+			_, err = dbConnection.ExecContext(ctx, query)
+			if err != nil {
+				log.Errorf("error granting privileges to local user: %s", err)
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// ApplyImportOptionChanges sets each `key=value` option in setOptions as an import option of the supplied schema and
+// then removes each option named in dropOptions from it
+func ApplyImportOptionChanges(schema *model.Schema, setOptions []string, dropOptions []string) error {
+	// Copy the options before changing them so that the map of the original schema is unaffected
+	schema.ImportOptions = copyOptions(schema.ImportOptions)
+	for _, setOption := range setOptions {
+		optionName, optionValue, found := strings.Cut(setOption, "=")
+		optionName = strings.TrimSpace(optionName)
+		if !found || optionName == "" {
+			return fmt.Errorf("invalid import option %q; expected key=value", setOption)
+		}
+		schema.ImportOptions[optionName] = optionValue
+	}
+	for _, dropOption := range dropOptions {
+		delete(schema.ImportOptions, strings.TrimSpace(dropOption))
+	}
 	return nil
 }
@@ -164,28 +164,35 @@ func TestUnit_getEnums_Nominal(t *testing.T) {
 	require.Nil(t, mock.ExpectationsWereMet())
 }
 
-func TestUnit_getSchemaEnumsUsedInTables_Nominal(t *testing.T) {
+func TestUnit_getSchemaTypesUsedInTables_Nominal(t *testing.T) {
 	db, mock := newSQLMock(t)
 	defer closeSQLMock(t, db)
 
 	schemaName := "my-schema"
 
-	mock.ExpectQuery(regexp.QuoteMeta(sqlSchemaEnumsInTables)).
+	mock.ExpectQuery(regexp.QuoteMeta(sqlSchemaTypesInTables)).
 		WithArgs(schemaName).
 		WillReturnRows(
-			sqlmock.NewRows([]string{"cuu.udt_name", "cuu.udt_schema"}).
-				AddRow("my-enum", schemaName),
+			sqlmock.NewRows([]string{"nspname", "typname", "typtype"}).
+				AddRow(schemaName, "my-domain", "d").
+				AddRow(schemaName, "my-enum", "e"),
 		).
 		RowsWillBeClosed()
 	mock.ExpectClose()
 
-	expected := []*model.SchemaEnum{
-		&model.SchemaEnum{
-			Name:   "my-enum",
+	expected := []*model.SchemaType{
+		{
+			Schema: schemaName,
+			Name:   "my-domain",
+			Kind:   model.ObjectDomain,
+		},
+		{
 			Schema: schemaName,
+			Name:   "my-enum",
+			Kind:   model.ObjectEnum,
 		},
 	}
-	actual, err := getSchemaEnumsUsedInTables(context.Background(), db, schemaName)
+	actual, err := getSchemaTypesUsedInTables(context.Background(), db, schemaName)
 	require.Nil(t, err)
 	require.NotNil(t, actual)
 	require.Equal(t, expected, actual)
@@ -193,14 +200,14 @@ func TestUnit_getSchemaEnumsUsedInTables_Nominal(t *testing.T) {
 	require.Nil(t, mock.ExpectationsWereMet())
 }
 
-func TestUnit_getEnumStrings_Nominal(t *testing.T) {
+func TestUnit_getSchemaEnumStrings_Nominal(t *testing.T) {
 	db, mock := newSQLMock(t)
 	defer closeSQLMock(t, db)
 
-	enumType := "e"
+	schemaEnum := &model.SchemaEnum{Schema: "s", Name: "e"}
 
-	mock.ExpectQuery(regexp.QuoteMeta(sqlEnumStrings)).
-		WithArgs(enumType).
+	mock.ExpectQuery(regexp.QuoteMeta(sqlSchemaEnumStrings)).
+		WithArgs(schemaEnum.Schema, schemaEnum.Name).
 		WillReturnRows(
 			sqlmock.NewRows([]string{"e.enumlabel"}).
 				AddRow("valueOne").
@@ -210,7 +217,7 @@ func TestUnit_getEnumStrings_Nominal(t *testing.T) {
 	mock.ExpectClose()
 
 	expected := []string{"valueOne", "valueTwo"}
-	actual, err := getEnumStrings(context.Background(), db, enumType)
+	actual, err := getSchemaEnumStrings(context.Background(), db, schemaEnum)
 	require.Nil(t, err)
 	require.NotNil(t, actual)
 	require.Equal(t, expected, actual)
@@ -218,29 +225,339 @@ func TestUnit_getEnumStrings_Nominal(t *testing.T) {
 	require.Nil(t, mock.ExpectationsWereMet())
 }
 
+func TestUnit_getTypeDefinition_Domain(t *testing.T) {
+	db, mock := newSQLMock(t)
+	defer closeSQLMock(t, db)
+
+	mock.ExpectQuery(regexp.QuoteMeta(sqlDomainDefinition)).
+		WithArgs("public", "positive_status").
+		WillReturnRows(
+			sqlmock.NewRows([]string{"format_type", "nspname", "typname", "is_array", "typnotnull", "typdefault"}).
+				AddRow("status", "public", "status", false, true, "'new'::status"),
+		).
+		RowsWillBeClosed()
+	mock.ExpectQuery(regexp.QuoteMeta(sqlDomainConstraints)).
+		WithArgs("public", "positive_status").
+		WillReturnRows(
+			sqlmock.NewRows([]string{"conname", "pg_get_constraintdef"}).
+				AddRow("not_closed", "CHECK ((VALUE <> 'closed'::status))"),
+		).
+		RowsWillBeClosed()
+	mock.ExpectClose()
+
+	actual := &model.SchemaType{Schema: "public", Name: "positive_status", Kind: model.ObjectDomain}
+	err := getTypeDefinition(context.Background(), db, actual)
+	require.Nil(t, err)
+	require.Equal(t, &model.SchemaType{
+		Schema:      "public",
+		Name:        "positive_status",
+		Kind:        model.ObjectDomain,
+		BaseType:    `"public"."status"`,
+		Default:     "'new'::status",
+		NotNull:     true,
+		Constraints: []string{`CONSTRAINT "not_closed" CHECK ((VALUE <> 'closed'::status))`},
+		DependsOn:   []string{"public.status"},
+	}, actual)
+	closeSQLMock(t, db)
+	require.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestUnit_getTypeDefinition_Composite(t *testing.T) {
+	db, mock := newSQLMock(t)
+	defer closeSQLMock(t, db)
+
+	mock.ExpectQuery(regexp.QuoteMeta(sqlCompositeAttributes)).
+		WithArgs("public", "address").
+		WillReturnRows(
+			sqlmock.NewRows([]string{"attname", "format_type", "nspname", "typname", "is_array"}).
+				AddRow("street", "character varying(80)", "pg_catalog", "varchar", false).
+				AddRow("tags", "tag[]", "public", "tag", true),
+		).
+		RowsWillBeClosed()
+	mock.ExpectClose()
+
+	actual := &model.SchemaType{Schema: "public", Name: "address", Kind: model.ObjectComposite}
+	err := getTypeDefinition(context.Background(), db, actual)
+	require.Nil(t, err)
+	require.Equal(t, []model.Column{
+		{Name: "street", Type: "character varying(80)"},
+		{Name: "tags", Type: `"public"."tag"[]`},
+	}, actual.Attributes)
+	require.Equal(t, []string{"public.tag"}, actual.DependsOn)
+	closeSQLMock(t, db)
+	require.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestUnit_createTypeSQL(t *testing.T) {
+	testCases := []struct {
+		name       string
+		schemaType *model.SchemaType
+		expected   string
+	}{
+		{
+			name:       "enum",
+			schemaType: &model.SchemaType{Schema: "public", Name: "status", Kind: model.ObjectEnum, Values: []string{"new", "closed"}},
+			expected:   `CREATE TYPE "public"."status" AS ENUM('new','closed')`,
+		},
+		{
+			name: "domain",
+			schemaType: &model.SchemaType{
+				Schema:      "public",
+				Name:        "open_status",
+				Kind:        model.ObjectDomain,
+				BaseType:    `"public"."status"`,
+				Default:     "'new'::status",
+				NotNull:     true,
+				Constraints: []string{`CONSTRAINT "not_closed" CHECK ((VALUE <> 'closed'::status))`},
+			},
+			expected: `CREATE DOMAIN "public"."open_status" AS "public"."status" DEFAULT 'new'::status NOT NULL CONSTRAINT "not_closed" CHECK ((VALUE <> 'closed'::status))`,
+		},
+		{
+			name: "composite",
+			schemaType: &model.SchemaType{
+				Schema: "public",
+				Name:   "address",
+				Kind:   model.ObjectComposite,
+				Attributes: []model.Column{
+					{Name: "street", Type: "character varying(80)"},
+					{Name: "status", Type: `"public"."status"`},
+				},
+			},
+			expected: `CREATE TYPE "public"."address" AS ("street" character varying(80), "status" "public"."status")`,
+		},
+		{
+			name:       "range",
+			schemaType: &model.SchemaType{Schema: "public", Name: "floatrange", Kind: model.ObjectRange, BaseType: "double precision", SubtypeDiff: "float8mi"},
+			expected:   `CREATE TYPE "public"."floatrange" AS RANGE (SUBTYPE = double precision, SUBTYPE_DIFF = float8mi)`,
+		},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			require.Equal(t, testCase.expected, createTypeSQL(testCase.schemaType))
+		})
+	}
+}
+
+func TestUnit_sortTypesByDependency(t *testing.T) {
+	address := &model.SchemaType{Schema: "public", Name: "address", Kind: model.ObjectComposite, DependsOn: []string{"public.open_status", "pg_catalog.text"}}
+	openStatus := &model.SchemaType{Schema: "public", Name: "open_status", Kind: model.ObjectDomain, DependsOn: []string{"public.status"}}
+	status := &model.SchemaType{Schema: "public", Name: "status", Kind: model.ObjectEnum}
+	tag := &model.SchemaType{Schema: "public", Name: "tag", Kind: model.ObjectEnum}
+
+	actual, err := sortTypesByDependency([]*model.SchemaType{address, openStatus, status, tag})
+	require.Nil(t, err)
+	require.Equal(t, []*model.SchemaType{status, tag, openStatus, address}, actual)
+
+	first := &model.SchemaType{Schema: "public", Name: "first", DependsOn: []string{"public.second"}}
+	second := &model.SchemaType{Schema: "public", Name: "second", DependsOn: []string{"public.first"}}
+	_, err = sortTypesByDependency([]*model.SchemaType{first, second})
+	require.NotNil(t, err)
+}
+
+func TestUnit_unusedImportedTypes(t *testing.T) {
+	status := &model.SchemaType{Schema: "types", Name: "status", Kind: model.ObjectEnum, ImportedFor: []string{"gone"}}
+	kind := &model.SchemaType{Schema: "types", Name: "kind", Kind: model.ObjectEnum, ImportedFor: []string{"gone"}}
+	color := &model.SchemaType{Schema: "types", Name: "color", Kind: model.ObjectEnum, ImportedFor: []string{"gone", "kept"}}
+	tag := &model.SchemaType{Schema: "types", Name: "tag", Kind: model.ObjectDomain, ImportedFor: []string{"gone"}}
+	usages := []typeUsage{
+		{typeSchema: "types", typeName: "kind", tableSchema: "other", serverName: "otherserver"},
+		{typeSchema: "types", typeName: "tag", tableSchema: "gone", serverName: "goneserver"},
+	}
+	actual := unusedImportedTypes(
+		[]*model.SchemaType{status, kind, color, tag},
+		usages,
+		map[string]bool{"kept": true},
+		func(usage typeUsage) bool {
+			return usage.tableSchema == "gone"
+		},
+	)
+	require.Equal(t, []*model.SchemaType{status, tag}, actual)
+}
+
+func TestUnit_dropTypeSQL(t *testing.T) {
+	require.Equal(t, `DROP TYPE "types"."status"`, dropTypeSQL(&model.SchemaType{Schema: "types", Name: "status", Kind: model.ObjectEnum}))
+	require.Equal(t, `DROP DOMAIN "types"."tag"`, dropTypeSQL(&model.SchemaType{Schema: "types", Name: "tag", Kind: model.ObjectDomain}))
+}
+
+func TestUnit_planner_planPruneTypes(t *testing.T) {
+	db, mock := newSQLMock(t)
+	defer closeSQLMock(t, db)
+
+	mock.ExpectQuery(regexp.QuoteMeta(sqlGetImportedTypes)).
+		WillReturnRows(
+			sqlmock.NewRows([]string{"nspname", "typname", "typtype", "comment"}).
+				AddRow("types", "status", "e", `fdwctl:{"importedFor":["gone"]}`).
+				AddRow("public", "color", "e", `fdwctl:{"importedFor":["kept"]}`),
+		).
+		RowsWillBeClosed()
+	mock.ExpectQuery(regexp.QuoteMeta(sqlTypeUsages)).
+		WillReturnRows(
+			sqlmock.NewRows([]string{"nspname", "typname", "table_schema", "server_name"}).
+				AddRow("types", "status", "gone", "goneserver"),
+		).
+		RowsWillBeClosed()
+	mock.ExpectQuery(regexp.QuoteMeta(sqlSchemaEnumStrings)).
+		WithArgs("types", "status").
+		WillReturnRows(sqlmock.NewRows([]string{"e.enumlabel"}).AddRow("open")).
+		RowsWillBeClosed()
+	mock.ExpectQuery(regexp.QuoteMeta(sqlGetSchemaEnums)).
+		WillReturnRows(
+			sqlmock.NewRows([]string{"schema", "type"}).
+				AddRow("public", "color").
+				AddRow("types", "status"),
+		).
+		RowsWillBeClosed()
+	mock.ExpectQuery(regexp.QuoteMeta(sqlGetTypeSchemas)).
+		WillReturnRows(
+			sqlmock.NewRows([]string{"nspname", "objects"}).
+				AddRow("types", 0),
+		).
+		RowsWillBeClosed()
+	mock.ExpectClose()
+
+	p := newPlanner(db, PlanOptions{})
+	p.droppedServers["goneserver"] = true
+	err := p.planPruneTypes(context.Background(), map[string]bool{"kept": true}, "")
+	require.Nil(t, err)
+	statements := make([]string, len(p.plan.Actions))
+	for idx, action := range p.plan.Actions {
+		statements[idx] = action.Statement
+	}
+	require.Equal(t, []string{
+		`DROP TYPE "types"."status"`,
+		`DROP SCHEMA "types"`,
+	}, statements)
+	closeSQLMock(t, db)
+	require.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestUnit_reconcileEnumSQL(t *testing.T) {
+	remoteEnum := &model.SchemaEnum{Schema: "public", Name: "status", Values: []string{"new", "open", "pending", "closed"}}
+	testCases := []struct {
+		name               string
+		localValues        []string
+		expectedStatements []string
+		expectedDrifts     []model.Drift
+	}{
+		{
+			name:               "in sync",
+			localValues:        []string{"new", "open", "pending", "closed"},
+			expectedStatements: []string{},
+			expectedDrifts:     []model.Drift{},
+		},
+		{
+			name:        "values added",
+			localValues: []string{"open", "closed"},
+			expectedStatements: []string{
+				`ALTER TYPE "public"."status" ADD VALUE 'new' BEFORE 'open'`,
+				`ALTER TYPE "public"."status" ADD VALUE 'pending' AFTER 'open'`,
+			},
+			expectedDrifts: []model.Drift{},
+		},
+		{
+			name:               "value removed",
+			localValues:        []string{"new", "open", "stale", "pending", "closed"},
+			expectedStatements: []string{},
+			expectedDrifts: []model.Drift{
+				{ObjectType: model.ObjectEnum, ObjectName: "public.status", Kind: model.DriftUnexpected, Attribute: "value", Actual: "stale"},
+			},
+		},
+		{
+			name:               "values reordered",
+			localValues:        []string{"new", "pending", "open"},
+			expectedStatements: []string{`ALTER TYPE "public"."status" ADD VALUE 'closed' AFTER 'pending'`},
+			expectedDrifts: []model.Drift{
+				{ObjectType: model.ObjectEnum, ObjectName: "public.status", Kind: model.DriftChanged, Attribute: "order", Desired: "new,open,pending", Actual: "new,pending,open"},
+			},
+		},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			localEnum := &model.SchemaEnum{Schema: "public", Name: "status", Values: testCase.localValues}
+			statements, drifts := reconcileEnumSQL(localEnum, remoteEnum)
+			require.Equal(t, testCase.expectedStatements, statements)
+			require.Equal(t, testCase.expectedDrifts, drifts)
+		})
+	}
+}
+
+func TestUnit_planner_planTypes(t *testing.T) {
+	db, mock := newSQLMock(t)
+	defer closeSQLMock(t, db)
+
+	mock.ExpectQuery(regexp.QuoteMeta(sqlGetSchemaEnums)).
+		WillReturnRows(
+			sqlmock.NewRows([]string{"schema", "type"}).
+				AddRow("public", "status"),
+		).
+		RowsWillBeClosed()
+	mock.ExpectQuery(regexp.QuoteMeta(sqlGetImportedTypes)).
+		WillReturnRows(
+			sqlmock.NewRows([]string{"nspname", "typname", "typtype", "comment"}).
+				AddRow("public", "status", "e", `fdwctl:{"importedFor":["other"]}`),
+		).
+		RowsWillBeClosed()
+	mock.ExpectQuery(regexp.QuoteMeta(sqlSchemaEnumStrings)).
+		WithArgs("public", "status").
+		WillReturnRows(
+			sqlmock.NewRows([]string{"e.enumlabel"}).
+				AddRow("open").
+				AddRow("stale"),
+		).
+		RowsWillBeClosed()
+	mock.ExpectQuery(regexp.QuoteMeta(sqlGetSchemaComment)).
+		WithArgs("remote").
+		WillReturnRows(sqlmock.NewRows([]string{"?column?"})).
+		RowsWillBeClosed()
+	mock.ExpectClose()
+
+	p := newPlanner(db, PlanOptions{})
+	err := p.planTypes(context.Background(), "remoteserver", "local", []*model.SchemaType{
+		{Schema: "public", Name: "status", Kind: model.ObjectEnum, Values: []string{"new", "open", "closed"}},
+		{Schema: "remote", Name: "kind", Kind: model.ObjectEnum, Values: []string{"a", "b"}},
+		{Schema: "remote", Name: "kinds", Kind: model.ObjectDomain, BaseType: `"remote"."kind"[]`, DependsOn: []string{"remote.kind"}},
+	})
+	require.Nil(t, err)
+	statements := make([]string, len(p.plan.Actions))
+	for idx, action := range p.plan.Actions {
+		statements[idx] = action.Statement
+		// Only the values added to an existing enum type are committed on their own
+		require.Equal(t, strings.Contains(action.Statement, "ADD VALUE"), action.NonTransactional)
+	}
+	require.Equal(t, []string{
+		`COMMENT ON TYPE "public"."status" IS 'fdwctl:{"importedFor":["other","local"]}'`,
+		`ALTER TYPE "public"."status" ADD VALUE 'new' BEFORE 'open'`,
+		`ALTER TYPE "public"."status" ADD VALUE 'closed' AFTER 'open'`,
+		`CREATE SCHEMA "remote"`,
+		`COMMENT ON SCHEMA "remote" IS 'fdwctl:{"typeSchema":true}'`,
+		`CREATE TYPE "remote"."kind" AS ENUM('a','b')`,
+		`COMMENT ON TYPE "remote"."kind" IS 'fdwctl:{"importedFor":["local"]}'`,
+		`CREATE DOMAIN "remote"."kinds" AS "remote"."kind"[]`,
+		`COMMENT ON DOMAIN "remote"."kinds" IS 'fdwctl:{"importedFor":["local"]}'`,
+	}, statements)
+	require.Equal(t, []model.Drift{
+		{ObjectType: model.ObjectEnum, ObjectName: "public.status", ServerName: "remoteserver", Kind: model.DriftUnexpected, Attribute: "value", Actual: "stale"},
+	}, p.enumDrift)
+	closeSQLMock(t, db)
+	require.Nil(t, mock.ExpectationsWereMet())
+}
+
 func TestUnit_GetSchemasForServer_Nominal_NoServerName(t *testing.T) {
 	db, mock := newSQLMock(t)
 	defer closeSQLMock(t, db)
 
-	queryResults := sqlmock.NewRows([]string{"ft.foreign_table_schema", "ft.foreign_server_name", "remote_schema"}).
-		AddRow("public", "my-server", "public").
-		AddRow("my-schema", "other-server", "public")
-
-	mock.ExpectQuery(
-		"SELECT DISTINCT ft.foreign_table_schema, ft.foreign_server_name, ftos.option_value AS remote_schema " +
-			"FROM information_schema.foreign_tables ft JOIN information_schema.foreign_table_options ftos ON " +
-			"ftos.foreign_table_schema = ft.foreign_table_schema " +
-			"AND ftos.foreign_table_catalog = ft.foreign_table_catalog " +
-			"AND ftos.foreign_table_name = ft.foreign_table_name " +
-			"AND ftos.option_name = 'schema_name'",
-	).
+	queryResults := sqlmock.NewRows([]string{"ft.foreign_table_schema", "ft.foreign_server_name", "remote_schema", "schema_comment"}).
+		AddRow("public", "my-server", "public", "").
+		AddRow("my-schema", "other-server", "public", `fdwctl:{"importOptions":{"import_default":"true"}}`)
+
+	mock.ExpectQuery(regexp.QuoteMeta(sqlGetForeignSchemas)).
 		WillReturnRows(queryResults).
 		RowsWillBeClosed()
 	mock.ExpectClose()
 
 	expected := []model.Schema{
 		{ServerName: "my-server", LocalSchema: "public", RemoteSchema: "public"},
-		{ServerName: "other-server", LocalSchema: "my-schema", RemoteSchema: "public"},
+		{ServerName: "other-server", LocalSchema: "my-schema", RemoteSchema: "public", ImportOptions: map[string]string{"import_default": "true"}},
 	}
 
 	actual, err := GetSchemasForServer(context.Background(), db, "")
@@ -255,24 +572,17 @@ func TestUnit_GetSchemasForServer_Nominal_WithServerName(t *testing.T) {
 	db, mock := newSQLMock(t)
 	defer closeSQLMock(t, db)
 
-	queryResults := sqlmock.NewRows([]string{"ft.foreign_table_schema", "ft.foreign_server_name", "remote_schema"}).
-		AddRow("my-schema", "other-server", "public")
-
-	mock.ExpectQuery(
-		"SELECT DISTINCT ft.foreign_table_schema, ft.foreign_server_name, ftos.option_value AS remote_schema " +
-			"FROM information_schema.foreign_tables ft JOIN information_schema.foreign_table_options ftos ON " +
-			"ftos.foreign_table_schema = ft.foreign_table_schema " +
-			"AND ftos.foreign_table_catalog = ft.foreign_table_catalog " +
-			"AND ftos.foreign_table_name = ft.foreign_table_name " +
-			"AND ftos.option_name = 'schema_name' WHERE ft.foreign_server_name = \\$1",
-	).
+	queryResults := sqlmock.NewRows([]string{"ft.foreign_table_schema", "ft.foreign_server_name", "remote_schema", "schema_comment"}).
+		AddRow("my-schema", "other-server", "public", "a comment written by hand")
+
+	mock.ExpectQuery(regexp.QuoteMeta(fmt.Sprintf("%s %s", sqlGetForeignSchemas, sqlGetForeignSchemasConstraint))).
 		WithArgs("other-server").
 		WillReturnRows(queryResults).
 		RowsWillBeClosed()
 	mock.ExpectClose()
 
 	expected := []model.Schema{
-		{ServerName: "other-server", LocalSchema: "my-schema", RemoteSchema: "public"},
+		{ServerName: "other-server", LocalSchema: "my-schema", RemoteSchema: "public", Comment: "a comment written by hand"},
 	}
 
 	actual, err := GetSchemasForServer(context.Background(), db, "other-server")
@@ -322,3 +632,166 @@ func TestUnit_DropSchema_WithCascade(t *testing.T) {
 	closeSQLMock(t, db)
 	require.Nil(t, mock.ExpectationsWereMet())
 }
+
+func TestUnit_importForeignSchemaSQL_ImportOptions(t *testing.T) {
+	schema := model.Schema{
+		LocalSchema:   "remotedb",
+		RemoteSchema:  "public",
+		LimitTo:       []string{"orders"},
+		ImportOptions: map[string]string{"import_not_null": "false", "import_default": "true"},
+	}
+	require.Equal(
+		t,
+		`IMPORT FOREIGN SCHEMA "public" LIMIT TO ("orders") FROM SERVER "remotedb" INTO "remotedb" OPTIONS ("import_default" 'true', "import_not_null" 'false')`,
+		importForeignSchemaSQL("remotedb", schema),
+	)
+	require.Equal(
+		t,
+		`COMMENT ON SCHEMA "remotedb" IS 'fdwctl:{"importOptions":{"import_default":"true","import_not_null":"false"},"limitTo":["orders"],"managed":true}'`,
+		schemaMetadataCommentSQL(schema),
+	)
+	require.Equal(t, `COMMENT ON SCHEMA "remotedb" IS 'fdwctl:{"managed":true}'`, schemaMetadataCommentSQL(model.Schema{LocalSchema: "remotedb"}))
+	managedSchema := schema
+	managedSchema.Managed = true
+	require.Equal(t, `COMMENT ON SCHEMA "remotedb" IS 'fdwctl:{"managed":true}'`, schemaMetadataUpdateSQL(model.Schema{LocalSchema: "remotedb"}, managedSchema))
+	require.Equal(t, "", schemaMetadataUpdateSQL(schema, managedSchema))
+	require.Equal(t, schemaMetadataCommentSQL(schema), schemaMetadataUpdateSQL(schema, schema))
+	require.Equal(t, schema.ImportOptions, parseMetadataComment(metadataComment("", objectMetadata{ImportOptions: schema.ImportOptions})).ImportOptions)
+	require.Nil(t, parseMetadataComment("fdwctl:not json").ImportOptions)
+	commentedSchema := managedSchema
+	commentedSchema.Managed = false
+	commentedSchema.Comment = "Owned by the billing team"
+	require.Equal(t, `COMMENT ON SCHEMA "remotedb" IS 'Owned by the billing team`+"\n"+`fdwctl:{"managed":true}'`, schemaMetadataUpdateSQL(model.Schema{LocalSchema: "remotedb"}, commentedSchema))
+}
+
+func TestUnit_splitMetadataComment(t *testing.T) {
+	text, metadata := splitMetadataComment("Owned by the billing team\nSee the runbook\nfdwctl:{\"managed\":true}")
+	require.Equal(t, "Owned by the billing team\nSee the runbook", text)
+	require.True(t, metadata.Managed)
+	text, metadata = splitMetadataComment(`fdwctl:{"managed":true}`)
+	require.Equal(t, "", text)
+	require.True(t, metadata.Managed)
+	text, metadata = splitMetadataComment("Mentions fdwctl: in passing")
+	require.Equal(t, "Mentions fdwctl: in passing", text)
+	require.False(t, metadata.Managed)
+	text, metadata = splitMetadataComment("Owned by the billing team\nfdwctl:not json")
+	require.Equal(t, "Owned by the billing team\nfdwctl:not json", text)
+	require.False(t, metadata.Managed)
+	require.Equal(t, "Owned by the billing team\nfdwctl:{\"managed\":true}", metadataComment("Owned by the billing team", objectMetadata{Managed: true}))
+	require.Equal(t, `COMMENT ON SCHEMA "remotedb" IS 'Owned by the billing team'`, commentOnSchemaSQL("remotedb", "Owned by the billing team", objectMetadata{}))
+}
+
+func TestUnit_ValidateImportOptions(t *testing.T) {
+	schema := model.Schema{LocalSchema: "remotedb", ImportOptions: map[string]string{"import_default": "true"}}
+	require.Nil(t, ValidateImportOptions(model.ForeignServer{Name: "remotedb"}, schema))
+	require.Nil(t, ValidateImportOptions(model.ForeignServer{Name: "remotedb", Wrapper: "file_fdw"}, schema))
+	schema.ImportOptions["import_enum_as_text"] = "true"
+	require.Nil(t, ValidateImportOptions(model.ForeignServer{Name: "remotedb", Wrapper: "mysql_fdw"}, schema))
+	err := ValidateImportOptions(model.ForeignServer{Name: "remotedb"}, schema)
+	require.NotNil(t, err)
+	require.Contains(t, err.Error(), "import_enum_as_text")
+}
+
+func TestUnit_ApplyImportOptionChanges(t *testing.T) {
+	original := map[string]string{"import_collate": "false"}
+	schema := model.Schema{ImportOptions: original}
+	require.Nil(t, ApplyImportOptionChanges(&schema, []string{"import_default=true"}, []string{"import_collate"}))
+	require.Equal(t, map[string]string{"import_default": "true"}, schema.ImportOptions)
+	require.Equal(t, map[string]string{"import_collate": "false"}, original)
+	require.NotNil(t, ApplyImportOptionChanges(&schema, []string{"import_default"}, nil))
+}
+
+func TestUnit_PlanDesiredState_ImportOptionsChanged(t *testing.T) {
+	db, mock := newSQLMock(t)
+	defer closeSQLMock(t, db)
+
+	mock.ExpectQuery(regexp.QuoteMeta(sqlGetExtensions)).
+		WillReturnRows(sqlmock.NewRows([]string{"extname", "extversion"})).
+		RowsWillBeClosed()
+	mock.ExpectQuery(regexp.QuoteMeta(sqlForeignServerInfo)).
+		WillReturnRows(
+			sqlmock.NewRows([]string{"srvname", "fdwname", "owner", "server_comment", "option_name", "option_value"}).
+				AddRow("remotedb", "postgres_fdw", "postgres", managedComment, "host", "remotehost"),
+		).
+		RowsWillBeClosed()
+	mock.ExpectQuery(regexp.QuoteMeta(sqlGetUsermaps)).
+		WithArgs("remotedb").
+		WillReturnRows(sqlmock.NewRows([]string{"authorization_identifier", "foreign_server_name", "option_name", "option_value"})).
+		RowsWillBeClosed()
+	mock.ExpectQuery(regexp.QuoteMeta(sqlGetServerGrantees)).
+		WithArgs("remotedb").
+		WillReturnRows(sqlmock.NewRows([]string{"grantee"})).
+		RowsWillBeClosed()
+	mock.ExpectQuery(regexp.QuoteMeta(sqlGetForeignSchemas)).
+		WithArgs("remotedb").
+		WillReturnRows(
+			sqlmock.NewRows([]string{"foreign_table_schema", "foreign_server_name", "remote_schema", "schema_comment"}).
+				AddRow("remotedb", "remotedb", "public", `fdwctl:{"importOptions":{"import_default":"false"}}`),
+		).
+		RowsWillBeClosed()
+	mock.ExpectQuery(regexp.QuoteMeta(sqlGetSchemaTables)).
+		WithArgs("remotedb").
+		WillReturnRows(sqlmock.NewRows([]string{"relname"})).
+		RowsWillBeClosed()
+	mock.ExpectQuery(regexp.QuoteMeta(sqlGetSchemaPrivileges)).
+		WithArgs("remotedb").
+		WillReturnRows(sqlmock.NewRows([]string{"kind", "grantee", "table_name", "privilege_type"})).
+		RowsWillBeClosed()
+	expectNoForeignTables(mock, "remotedb")
+	expectCatalog(mock)
+	mock.ExpectQuery(regexp.QuoteMeta(sqlGetSchemaEnums)).
+		WillReturnRows(sqlmock.NewRows([]string{"schema", "type"})).
+		RowsWillBeClosed()
+	expectNoImportedTypes(mock)
+	mock.ExpectClose()
+
+	dState := model.DesiredState{
+		Servers: []model.ForeignServer{
+			{
+				Name: "remotedb",
+				Host: "remotehost",
+				Schemas: []model.Schema{
+					{LocalSchema: "remotedb", RemoteSchema: "public", ImportOptions: map[string]string{"import_default": "true"}},
+				},
+			},
+		},
+	}
+	plan, err := PlanDesiredState(context.Background(), db, dState, PlanOptions{})
+	require.Nil(t, err)
+	statements := make([]string, 0)
+	for _, action := range plan.Actions {
+		statements = append(statements, action.SQL)
+	}
+	require.Equal(t, []string{
+		`DROP SCHEMA "remotedb" CASCADE`,
+		`CREATE SCHEMA "remotedb"`,
+		`IMPORT FOREIGN SCHEMA "public" FROM SERVER "remotedb" INTO "remotedb" OPTIONS ("import_default" 'true')`,
+		`COMMENT ON SCHEMA "remotedb" IS 'fdwctl:{"importOptions":{"import_default":"true"},"managed":true}'`,
+	}, statements)
+	closeSQLMock(t, db)
+	require.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestUnit_matchTables(t *testing.T) {
+	remoteTables := []string{"audit_log", "items", "order_lines", "orders"}
+	require.Equal(t, []string{"order_lines", "orders"}, matchTables([]string{"order*"}, remoteTables))
+	require.Equal(t, []string{"audit_log", "items"}, matchTables([]string{"/^(audit|item)/", "items"}, remoteTables))
+	require.Equal(t, []string{"missing"}, matchTables([]string{"missing"}, remoteTables))
+	require.Equal(t, []string{"items", "order_lines"}, filterTables(nil, []string{"audit_log", "orders"}, remoteTables))
+	require.Equal(t, []string{"orders"}, filterTables([]string{"orders"}, nil, remoteTables))
+}
+
+func TestUnit_ValidateTableFilter(t *testing.T) {
+	server := model.ForeignServer{Name: "remotedb"}
+	require.Nil(t, ValidateTableFilter(server, model.Schema{LocalSchema: "remotedb", LimitTo: []string{"orders"}}))
+	require.Nil(t, ValidateTableFilter(server, model.Schema{LocalSchema: "remotedb", Except: []string{"/^tmp_/"}, ENUMConnection: "postgres://remotehost/remotedb"}))
+	require.NotNil(t, ValidateTableFilter(server, model.Schema{LocalSchema: "remotedb", LimitTo: []string{"orders"}, Except: []string{"items"}}))
+	require.NotNil(t, ValidateTableFilter(server, model.Schema{LocalSchema: "remotedb", LimitTo: []string{"order*"}}))
+	require.NotNil(t, ValidateTableFilter(server, model.Schema{LocalSchema: "remotedb", LimitTo: []string{"/(/"}, ENUMConnection: "postgres://remotehost/remotedb"}))
+	require.NotNil(t, ValidateTableFilter(server, model.Schema{LocalSchema: "remotedb", Except: []string{"[a-"}, ENUMConnection: "postgres://remotehost/remotedb"}))
+	// Patterns can be expanded through a connection derived from a user mapping of a postgres_fdw server
+	server.UserMaps = []model.UserMap{{LocalUser: "public", RemoteUser: "remoteuser"}}
+	require.Nil(t, ValidateTableFilter(server, model.Schema{LocalSchema: "remotedb", LimitTo: []string{"order*"}}))
+	server.Wrapper = "mysql_fdw"
+	require.NotNil(t, ValidateTableFilter(server, model.Schema{LocalSchema: "remotedb", LimitTo: []string{"order*"}}))
+}
@@ -0,0 +1,65 @@
+package util
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/neflyte/fdwctl/lib/logger"
+	"github.com/neflyte/fdwctl/lib/model"
+)
+
+const (
+	// SelectExtensions selects the extensions of a desired state
+	SelectExtensions = "extensions"
+	// SelectServers selects the foreign servers of a desired state and the privileges on them
+	SelectServers = "servers"
+	// SelectUserMaps selects the user mappings of the foreign servers of a desired state
+	SelectUserMaps = "usermaps"
+	// SelectSchemas selects the foreign schemas of a desired state and the user-defined types imported for them
+	SelectSchemas = "schemas"
+	// SelectForeignTables selects the foreign tables a desired state defines column by column
+	SelectForeignTables = "foreigntables"
+)
+
+var (
+	// objectSelections are the kinds of objects a desired state plan can be restricted to
+	objectSelections = []string{SelectExtensions, SelectServers, SelectUserMaps, SelectSchemas, SelectForeignTables}
+)
+
+// ValidateObjectSelection determines if every entry of the supplied list is a kind of object a plan can be restricted
+// to
+func ValidateObjectSelection(only []string) error {
+	for _, kind := range only {
+		if !containsString(objectSelections, kind) {
+			return fmt.Errorf("invalid object kind %q; expected one of %v", kind, objectSelections)
+		}
+	}
+	return nil
+}
+
+// selects determines if the plan includes the supplied kind of object; every kind is included when the plan is not
+// restricted
+func (p *planner) selects(kind string) bool {
+	return len(p.opts.Only) == 0 || containsString(p.opts.Only, kind)
+}
+
+// selectsServer determines if the plan includes the named foreign server; every server is included when the plan is
+// not restricted
+func (p *planner) selectsServer(serverName string) bool {
+	return len(p.opts.Servers) == 0 || matchesAnyPattern(p.opts.Servers, serverName)
+}
+
+// selectServers returns the foreign servers the plan includes
+func (p *planner) selectServers(ctx context.Context, servers []model.ForeignServer) []model.ForeignServer {
+	log := logger.Log(ctx).
+		WithField("function", "selectServers")
+	selected := make([]model.ForeignServer, 0, len(servers))
+	for _, server := range servers {
+		if !p.selectsServer(server.Name) {
+			log.Debugf("server %s is not selected; skipping it", server.Name)
+			continue
+		}
+		selected = append(selected, server)
+	}
+	return selected
+}
@@ -0,0 +1,74 @@
+package util
+
+import (
+	"context"
+	"testing"
+
+	"github.com/neflyte/fdwctl/lib/model"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUnit_ValidateObjectSelection(t *testing.T) {
+	require.Nil(t, ValidateObjectSelection(nil))
+	require.Nil(t, ValidateObjectSelection([]string{SelectServers, SelectUserMaps}))
+	require.NotNil(t, ValidateObjectSelection([]string{"server"}))
+}
+
+func TestUnit_PlanDesiredState_ServerSelection(t *testing.T) {
+	db, mock := newSQLMock(t)
+	defer closeSQLMock(t, db)
+
+	serverNames := []string{"billing_eu", "billing_us", "crm"}
+	expectUnusedServers(mock, serverNames, map[string]string{"billing_eu": managedComment, "billing_us": managedComment, "crm": managedComment})
+	expectCatalog(mock)
+	mock.ExpectClose()
+
+	dState := model.DesiredState{
+		Extensions: []model.Extension{{Name: "postgres_fdw"}},
+		Servers: []model.ForeignServer{
+			{Name: "billing_us", Host: "remotehost", Port: 5433},
+			{Name: "billing_new", Host: "remotehost"},
+		},
+	}
+	plan, err := PlanDesiredState(context.Background(), db, dState, PlanOptions{Servers: []string{"billing_*"}, Only: []string{SelectServers}})
+	require.Nil(t, err)
+	statements := make([]string, 0)
+	for _, action := range plan.Actions {
+		statements = append(statements, action.SQL)
+	}
+	require.Equal(t, []string{
+		`DROP SERVER "billing_eu" CASCADE`,
+		`CREATE SERVER "billing_new" FOREIGN DATA WRAPPER "postgres_fdw" OPTIONS ("host" 'remotehost')`,
+		`COMMENT ON SERVER "billing_new" IS 'fdwctl:{"managed":true}'`,
+		`ALTER SERVER "billing_us" OPTIONS (ADD "port" '5433')`,
+	}, statements)
+	closeSQLMock(t, db)
+	require.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestUnit_PlanDesiredState_ObjectSelection(t *testing.T) {
+	db, mock := newSQLMock(t)
+	defer closeSQLMock(t, db)
+
+	expectUnusedServers(mock, []string{"remotedb", "stale"}, map[string]string{"stale": managedComment})
+	expectCatalog(mock)
+	mock.ExpectClose()
+
+	dState := model.DesiredState{
+		Servers: []model.ForeignServer{
+			{Name: "remotedb", Host: "remotehost", Port: 5433, UserMaps: []model.UserMap{{LocalUser: "fdw", RemoteUser: "remoteuser"}}},
+			{Name: "created", Host: "remotehost", UserMaps: []model.UserMap{{LocalUser: "fdw", RemoteUser: "remoteuser"}}},
+		},
+	}
+	plan, err := PlanDesiredState(context.Background(), db, dState, PlanOptions{Only: []string{SelectUserMaps}})
+	require.Nil(t, err)
+	require.Len(t, plan.Actions, 1)
+	require.Equal(t, model.ObjectUserMap, plan.Actions[0].ObjectType)
+	require.Equal(t, "remotedb", plan.Actions[0].ServerName)
+	_, err = PlanDesiredState(context.Background(), db, dState, PlanOptions{Servers: []string{"/(/"}})
+	require.NotNil(t, err)
+	_, err = PlanDesiredState(context.Background(), db, dState, PlanOptions{Only: []string{"tables"}})
+	require.NotNil(t, err)
+	closeSQLMock(t, db)
+	require.Nil(t, mock.ExpectationsWereMet())
+}
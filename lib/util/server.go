@@ -4,6 +4,7 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
+	"strconv"
 	"strings"
 
 	"github.com/neflyte/fdwctl/lib/database"
@@ -12,36 +13,67 @@ import (
 )
 
 const (
-	sqlCreateServer      = `CREATE SERVER "%s" FOREIGN DATA WRAPPER postgres_fdw OPTIONS (host '%s', port '%d', dbname '%s')`
-	sqlDropServer        = `DROP SERVER "%s"`
-	sqlUpdateServer      = `ALTER SERVER "%s" OPTIONS (%s)`
-	sqlRenameServer      = `ALTER SERVER "%s" RENAME TO "%s"`
-	sqlForeignServerInfo = `SELECT fs.foreign_server_name, fs.foreign_data_wrapper_name, fs.authorization_identifier, fsoh.option_value AS hostname, fsop.option_value::int AS port, fsod.option_value AS dbname
-	FROM information_schema.foreign_servers fs
-	JOIN information_schema.foreign_server_options fsoh ON fsoh.foreign_server_name = fs.foreign_server_name AND fsoh.option_name = 'host'
-	JOIN information_schema.foreign_server_options fsop ON fsop.foreign_server_name = fs.foreign_server_name AND fsop.option_name = 'port'
-	JOIN information_schema.foreign_server_options fsod ON fsod.foreign_server_name = fs.foreign_server_name AND fsod.option_name = 'dbname'`
+	sqlCreateServer      = `CREATE SERVER %s FOREIGN DATA WRAPPER %s`
+	sqlDropServer        = `DROP SERVER %s`
+	sqlUpdateServer      = `ALTER SERVER %s OPTIONS (%s)`
+	sqlRenameServer      = `ALTER SERVER %s RENAME TO %s`
+	sqlForeignServerInfo = `SELECT s.srvname, w.fdwname, pg_get_userbyid(s.srvowner) AS owner,
+	COALESCE(obj_description(s.oid, 'pg_foreign_server'), '') AS server_comment, o.option_name, o.option_value
+	FROM pg_foreign_server s
+	JOIN pg_foreign_data_wrapper w ON w.oid = s.srvfdw
+	LEFT JOIN LATERAL pg_options_to_table(s.srvoptions) o ON true
+	ORDER BY s.srvname, o.option_name`
+	sqlGetServerGrantees = `SELECT CASE WHEN a.grantee = 0 THEN 'PUBLIC' ELSE r.rolname END AS grantee
+	FROM pg_foreign_server s
+	CROSS JOIN LATERAL aclexplode(s.srvacl) a
+	LEFT JOIN pg_roles r ON r.oid = a.grantee
+	WHERE s.srvname = $1 AND a.privilege_type = 'USAGE' AND a.grantee <> s.srvowner
+	ORDER BY grantee`
+	sqlGrantServerUsage  = `GRANT USAGE ON FOREIGN SERVER %s TO %s`
+	sqlRevokeServerUsage = `REVOKE USAGE ON FOREIGN SERVER %s FROM %s`
+
+	// serverOptionHost is the name of the server option that holds the remote hostname
+	serverOptionHost = "host"
+	// serverOptionPort is the name of the server option that holds the remote port
+	serverOptionPort = "port"
+	// serverOptionDBName is the name of the server option that holds the remote database name
+	serverOptionDBName = "dbname"
 )
 
-func GetServers(ctx context.Context, dbConnection *sql.DB) ([]model.ForeignServer, error) {
+// GetServers returns every foreign server in the database regardless of its wrapper or options
+func GetServers(ctx context.Context, dbConnection database.Executor) ([]model.ForeignServer, error) {
 	log := logger.Log(ctx).
 		WithField("function", "GetServers")
 	log.Tracef("query: %s", sqlForeignServerInfo)
-	rows, err := dbConnection.Query(sqlForeignServerInfo)
+	rows, err := dbConnection.QueryContext(ctx, sqlForeignServerInfo)
 	if err != nil {
 		log.Errorf("error querying for servers: %s", err)
 		return nil, err
 	}
 	defer database.CloseRows(ctx, rows)
 	servers := make([]model.ForeignServer, 0)
+	var serverName, wrapper, owner, serverComment string
+	var optionName, optionValue sql.NullString
 	for rows.Next() {
-		server := new(model.ForeignServer)
-		err = rows.Scan(&server.Name, &server.Wrapper, &server.Owner, &server.Host, &server.Port, &server.DB)
+		err = rows.Scan(&serverName, &wrapper, &owner, &serverComment, &optionName, &optionValue)
 		if err != nil {
 			log.Errorf("error scanning result row: %s", err)
 			continue
 		}
-		servers = append(servers, *server)
+		// Rows are ordered by server name so the options of a server are always on consecutive rows
+		if len(servers) == 0 || servers[len(servers)-1].Name != serverName {
+			commentText, metadata := splitMetadataComment(serverComment)
+			servers = append(servers, model.ForeignServer{
+				Name:    serverName,
+				Wrapper: wrapper,
+				Owner:   owner,
+				Managed: metadata.Managed,
+				Comment: commentText,
+			})
+		}
+		if optionName.Valid {
+			setServerOption(&servers[len(servers)-1], optionName.String, optionValue.String)
+		}
 	}
 	if rows.Err() != nil {
 		log.Errorf("error iterating result rows: %s", rows.Err())
@@ -50,6 +82,44 @@ func GetServers(ctx context.Context, dbConnection *sql.DB) ([]model.ForeignServe
 	return servers, nil
 }
 
+// setServerOption stores a server option from the catalog in the supplied server. The host, port, and dbname options
+// are stored in their dedicated fields and all other options are stored in the Options map.
+func setServerOption(server *model.ForeignServer, optionName string, optionValue string) {
+	switch optionName {
+	case serverOptionHost:
+		server.Host = optionValue
+		return
+	case serverOptionDBName:
+		server.DB = optionValue
+		return
+	case serverOptionPort:
+		port, err := strconv.Atoi(optionValue)
+		if err == nil {
+			server.Port = port
+			return
+		}
+	}
+	if server.Options == nil {
+		server.Options = make(map[string]string)
+	}
+	server.Options[optionName] = optionValue
+}
+
+// serverOptions returns all options of the supplied server, including host, port, and dbname, keyed by option name
+func serverOptions(server model.ForeignServer) map[string]string {
+	options := copyOptions(server.Options)
+	if server.Host != "" {
+		options[serverOptionHost] = server.Host
+	}
+	if server.Port > 0 {
+		options[serverOptionPort] = strconv.Itoa(server.Port)
+	}
+	if server.DB != "" {
+		options[serverOptionDBName] = server.DB
+	}
+	return options
+}
+
 func FindForeignServer(foreignServers []model.ForeignServer, serverName string) *model.ForeignServer {
 	for _, server := range foreignServers {
 		if server.Name == serverName {
@@ -59,18 +129,40 @@ func FindForeignServer(foreignServers []model.ForeignServer, serverName string)
 	return nil
 }
 
-func DropServer(ctx context.Context, dbConnection *sql.DB, servername string, cascade bool) error {
+// getForeignServer returns the named foreign server from the database or an error if it does not exist
+func getForeignServer(ctx context.Context, dbConnection database.Executor, serverName string) (*model.ForeignServer, error) {
 	log := logger.Log(ctx).
-		WithField("function", "DropServer")
-	if servername == "" {
-		return logger.ErrorfAsError(log, "server name is required")
+		WithField("function", "getForeignServer")
+	servers, err := GetServers(ctx, dbConnection)
+	if err != nil {
+		log.Errorf("error getting foreign servers: %s", err)
+		return nil, err
 	}
-	query := fmt.Sprintf(sqlDropServer, servername)
+	server := FindForeignServer(servers, serverName)
+	if server == nil {
+		return nil, logger.ErrorfAsError(log, "foreign server %s does not exist", serverName)
+	}
+	return server, nil
+}
+
+// dropServerSQL returns the statement that drops the named foreign server with optional CASCADE
+func dropServerSQL(servername string, cascade bool) string {
+	query := fmt.Sprintf(sqlDropServer, QuoteIdentifier(servername))
 	if cascade {
 		query = fmt.Sprintf("%s CASCADE", query)
 	}
+	return query
+}
+
+func DropServer(ctx context.Context, dbConnection database.Executor, servername string, cascade bool) error {
+	log := logger.Log(ctx).
+		WithField("function", "DropServer")
+	if servername == "" {
+		return logger.ErrorfAsError(log, "server name is required")
+	}
+	query := dropServerSQL(servername, cascade)
 	log.Tracef("query: %s", query)
-	_, err := dbConnection.Exec(query)
+	_, err := dbConnection.ExecContext(ctx, query)
 	if err != nil {
 		log.Errorf("error dropping server: %s", err)
 		return err
@@ -78,36 +170,86 @@ func DropServer(ctx context.Context, dbConnection *sql.DB, servername string, ca
 	return nil
 }
 
-func CreateServer(ctx context.Context, dbConnection *sql.DB, server model.ForeignServer) error {
+// createServerSQL returns the statement that creates the supplied foreign server with its wrapper and options
+func createServerSQL(server model.ForeignServer) string {
+	query := fmt.Sprintf(sqlCreateServer, QuoteIdentifier(server.Name), QuoteIdentifier(server.WrapperName()))
+	options := serverOptions(server)
+	if len(options) == 0 {
+		return query
+	}
+	return fmt.Sprintf("%s OPTIONS (%s)", query, optionsClause(options))
+}
+
+func CreateServer(ctx context.Context, dbConnection database.Executor, server model.ForeignServer) error {
 	log := logger.Log(ctx).
 		WithField("function", "CreateServer")
-	query := fmt.Sprintf(sqlCreateServer, server.Name, server.Host, server.Port, server.DB)
+	err := ValidateServerOptions(server)
+	if err != nil {
+		log.Errorf("invalid server options: %s", err)
+		return err
+	}
+	query := createServerSQL(server)
 	log.Tracef("query: %s", query)
-	_, err := dbConnection.Exec(query)
+	_, err = dbConnection.ExecContext(ctx, query)
 	if err != nil {
 		log.Errorf("error creating server: %s", err)
 		return err
 	}
+	query = managedServerCommentSQL(server.Name, "")
+	log.Tracef("query: %s", query)
+	_, err = dbConnection.ExecContext(ctx, query)
+	if err != nil {
+		log.Errorf("error marking server as managed: %s", err)
+		return err
+	}
 	return nil
 }
 
-func UpdateServer(ctx context.Context, dbConnection *sql.DB, server model.ForeignServer) error {
+// managedServerCommentSQL returns the statement that marks a foreign server as managed by fdwctl, keeping the text of
+// its comment that fdwctl did not write
+func managedServerCommentSQL(serverName string, commentText string) string {
+	return commentOnServerSQL(serverName, commentText, objectMetadata{Managed: true})
+}
+
+// updateServerSQL returns the statement that changes the options of the database server dbServer to those of the
+// supplied server. Options that are new are added, options whose values differ are set, and options that are no
+// longer present are dropped. An empty string is returned if the options are the same.
+func updateServerSQL(server model.ForeignServer, dbServer model.ForeignServer) string {
+	changes := diffOptions(serverOptions(server), serverOptions(dbServer))
+	if len(changes) == 0 {
+		return ""
+	}
+	return fmt.Sprintf(sqlUpdateServer, QuoteIdentifier(server.Name), optionChangesClause(changes))
+}
+
+// UpdateServer changes the options of an existing foreign server to match those of the supplied server
+func UpdateServer(ctx context.Context, dbConnection database.Executor, server model.ForeignServer) error {
 	log := logger.Log(ctx).
 		WithField("function", "UpdateServer")
-	// Edit server hostname, port, and dbname
-	opts := make([]string, 0)
-	if server.Host != "" {
-		opts = append(opts, fmt.Sprintf("SET host '%s'", server.Host))
+	dbServers, err := GetServers(ctx, dbConnection)
+	if err != nil {
+		log.Errorf("error getting servers: %s", err)
+		return err
 	}
-	if server.Port > 0 {
-		opts = append(opts, fmt.Sprintf("SET port '%d'", server.Port))
+	dbServer := FindForeignServer(dbServers, server.Name)
+	if dbServer == nil {
+		return logger.ErrorfAsError(log, "server %s does not exist", server.Name)
 	}
-	if server.DB != "" {
-		opts = append(opts, fmt.Sprintf("SET dbname '%s'", server.DB))
+	if server.Wrapper == "" {
+		server.Wrapper = dbServer.Wrapper
+	}
+	err = ValidateServerOptions(server)
+	if err != nil {
+		log.Errorf("invalid server options: %s", err)
+		return err
+	}
+	query := updateServerSQL(server, *dbServer)
+	if query == "" {
+		log.Debugf("options of server %s are unchanged", server.Name)
+		return nil
 	}
-	query := fmt.Sprintf(sqlUpdateServer, server.Name, strings.Join(opts, ","))
 	log.Tracef("query: %s", query)
-	_, err := dbConnection.Exec(query)
+	_, err = dbConnection.ExecContext(ctx, query)
 	if err != nil {
 		log.Errorf("error updating server: %s", err)
 		return err
@@ -116,12 +258,115 @@ func UpdateServer(ctx context.Context, dbConnection *sql.DB, server model.Foreig
 	return nil
 }
 
-func UpdateServerName(ctx context.Context, dbConnection *sql.DB, server model.ForeignServer, newServerName string) error {
+// ApplyServerOptionChanges sets each `key=value` option in setOptions on the supplied server and then removes each
+// option named in dropOptions from it. The host, port, and dbname options change the corresponding server fields.
+func ApplyServerOptionChanges(server *model.ForeignServer, setOptions []string, dropOptions []string) error {
+	// Copy the options before changing them so that the map of the original server is unaffected
+	server.Options = copyOptions(server.Options)
+	for _, setOption := range setOptions {
+		optionName, optionValue, found := strings.Cut(setOption, "=")
+		optionName = strings.TrimSpace(optionName)
+		if !found || optionName == "" {
+			return fmt.Errorf("invalid option %q; expected key=value", setOption)
+		}
+		setServerOption(server, optionName, optionValue)
+	}
+	for _, dropOption := range dropOptions {
+		optionName := strings.TrimSpace(dropOption)
+		switch optionName {
+		case serverOptionHost:
+			server.Host = ""
+		case serverOptionPort:
+			server.Port = 0
+		case serverOptionDBName:
+			server.DB = ""
+		}
+		delete(server.Options, optionName)
+	}
+	return nil
+}
+
+// GetServerGrants returns the users, other than the owner of the server, that have been granted usage on the named
+// foreign server
+func GetServerGrants(ctx context.Context, dbConnection database.Executor, serverName string) (model.Grants, error) {
+	log := logger.Log(ctx).
+		WithField("function", "GetServerGrants")
+	grants := model.Grants{
+		Users: make([]string, 0),
+	}
+	log.Tracef("query: %s, args: %#v", sqlGetServerGrantees, serverName)
+	granteeRows, err := dbConnection.QueryContext(ctx, sqlGetServerGrantees, serverName)
+	if err != nil {
+		log.Errorf("error querying server grants: %s", err)
+		return grants, err
+	}
+	defer database.CloseRows(ctx, granteeRows)
+	var grantee string
+	for granteeRows.Next() {
+		err = granteeRows.Scan(&grantee)
+		if err != nil {
+			log.Errorf("error scanning result row: %s", err)
+			return grants, err
+		}
+		grants.Users = append(grants.Users, grantee)
+	}
+	if granteeRows.Err() != nil {
+		log.Errorf("error iterating result rows: %s", granteeRows.Err())
+		return grants, granteeRows.Err()
+	}
+	return grants, nil
+}
+
+// grantServerSQL returns the statement that grants usage on the named foreign server to a user
+func grantServerSQL(serverName string, grantee string) string {
+	return fmt.Sprintf(sqlGrantServerUsage, QuoteIdentifier(serverName), granteeSQL(grantee))
+}
+
+// revokeServerSQL returns the statement that revokes usage on the named foreign server from a user
+func revokeServerSQL(serverName string, grantee string) string {
+	return fmt.Sprintf(sqlRevokeServerUsage, QuoteIdentifier(serverName), granteeSQL(grantee))
+}
+
+// GrantServer grants usage on the named foreign server to a user
+func GrantServer(ctx context.Context, dbConnection database.Executor, serverName string, grantee string) error {
+	log := logger.Log(ctx).
+		WithField("function", "GrantServer")
+	if serverName == "" || grantee == "" {
+		return logger.ErrorfAsError(log, "server name and user name are required")
+	}
+	query := grantServerSQL(serverName, grantee)
+	log.Tracef("query: %s", query)
+	_, err := dbConnection.ExecContext(ctx, query)
+	if err != nil {
+		log.Errorf("error granting usage on server: %s", err)
+		return err
+	}
+	return nil
+}
+
+// RevokeServer revokes usage on the named foreign server from a user
+func RevokeServer(ctx context.Context, dbConnection database.Executor, serverName string, grantee string) error {
+	log := logger.Log(ctx).
+		WithField("function", "RevokeServer")
+	if serverName == "" || grantee == "" {
+		return logger.ErrorfAsError(log, "server name and user name are required")
+	}
+	query := revokeServerSQL(serverName, grantee)
+	log.Tracef("query: %s", query)
+	_, err := dbConnection.ExecContext(ctx, query)
+	if err != nil {
+		log.Errorf("error revoking usage on server: %s", err)
+		return err
+	}
+	return nil
+}
+
+func UpdateServerName(ctx context.Context, dbConnection database.Executor, server model.ForeignServer, newServerName string) error {
 	log := logger.Log(ctx).
 		WithField("function", "UpdateServerName")
-	query := fmt.Sprintf(sqlRenameServer, server.Name, newServerName)
+	query := fmt.Sprintf(sqlRenameServer, QuoteIdentifier(server.Name), QuoteIdentifier(newServerName))
 	log.Tracef("query: %s", query)
-	_, err := dbConnection.Exec(query)
+	_, err := dbConnection.ExecContext(ctx, query)
 	if err != nil {
 		log.Errorf("error renaming server object: %s", err)
 		return err
@@ -0,0 +1,241 @@
+package util
+
+import (
+	"context"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/neflyte/fdwctl/lib/model"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUnit_GetServers_AllWrappers(t *testing.T) {
+	db, mock := newSQLMock(t)
+	defer closeSQLMock(t, db)
+
+	mock.ExpectQuery(regexp.QuoteMeta(sqlForeignServerInfo)).
+		WillReturnRows(
+			sqlmock.NewRows([]string{"srvname", "fdwname", "owner", "server_comment", "option_name", "option_value"}).
+				AddRow("csvfiles", "file_fdw", "postgres", "", nil, nil).
+				AddRow("mssql", "tds_fdw", "postgres", managedComment, "database", "sales").
+				AddRow("mssql", "tds_fdw", "postgres", managedComment, "servername", "mssqlhost").
+				AddRow("remotedb", "postgres_fdw", "postgres", managedComment, "host", "remotehost"),
+		).
+		RowsWillBeClosed()
+	mock.ExpectClose()
+
+	expected := []model.ForeignServer{
+		{Name: "csvfiles", Wrapper: "file_fdw", Owner: "postgres"},
+		{Name: "mssql", Wrapper: "tds_fdw", Owner: "postgres", Managed: true, Options: map[string]string{"database": "sales", "servername": "mssqlhost"}},
+		{Name: "remotedb", Wrapper: "postgres_fdw", Owner: "postgres", Managed: true, Host: "remotehost"},
+	}
+	actual, err := GetServers(context.Background(), db)
+	require.Nil(t, err)
+	require.Equal(t, expected, actual)
+	closeSQLMock(t, db)
+	require.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestUnit_createServerSQL_Wrappers(t *testing.T) {
+	require.Equal(
+		t,
+		`CREATE SERVER "remotedb" FOREIGN DATA WRAPPER "postgres_fdw" OPTIONS ("dbname" 'data', "fetch_size" '500', "host" 'remotehost', "port" '5432')`,
+		createServerSQL(model.ForeignServer{
+			Name:    "remotedb",
+			Host:    "remotehost",
+			Port:    5432,
+			DB:      "data",
+			Options: map[string]string{"fetch_size": "500"},
+		}),
+	)
+	require.Equal(
+		t,
+		`CREATE SERVER "csvfiles" FOREIGN DATA WRAPPER "file_fdw"`,
+		createServerSQL(model.ForeignServer{Name: "csvfiles", Wrapper: "file_fdw"}),
+	)
+}
+
+func TestUnit_ValidateServerOptions(t *testing.T) {
+	require.Nil(t, ValidateServerOptions(model.ForeignServer{
+		Name:    "remotedb",
+		Host:    "remotehost",
+		Port:    5432,
+		Options: map[string]string{"fetch_size": "500", "sslmode": "require"},
+	}))
+	require.Nil(t, ValidateServerOptions(model.ForeignServer{
+		Name:    "custom",
+		Wrapper: "my_custom_fdw",
+		Options: map[string]string{"anything": "goes"},
+	}))
+	err := ValidateServerOptions(model.ForeignServer{
+		Name:    "oracle",
+		Wrapper: "oracle_fdw",
+		Host:    "oraclehost",
+		Options: map[string]string{"dbserver": "//oraclehost/ORCL", "bogus": "1"},
+	})
+	require.NotNil(t, err)
+	require.Contains(t, err.Error(), "bogus, host")
+	require.NotNil(t, ValidateServerOptions(model.ForeignServer{
+		Name:    "remotedb",
+		Options: map[string]string{"password": "s3cret"},
+	}))
+}
+
+func TestUnit_updateServerSQL_AddSetDrop(t *testing.T) {
+	dbServer := model.ForeignServer{
+		Name:    "remotedb",
+		Host:    "remotehost",
+		Port:    5432,
+		DB:      "data",
+		Options: map[string]string{"fetch_size": "100", "updatable": "false"},
+	}
+	server := model.ForeignServer{
+		Name:    "remotedb",
+		Host:    "otherhost",
+		Port:    5432,
+		DB:      "data",
+		Options: map[string]string{"fetch_size": "100", "use_remote_estimate": "true"},
+	}
+	require.False(t, server.Equals(dbServer))
+	require.Equal(
+		t,
+		`ALTER SERVER "remotedb" OPTIONS (SET "host" 'otherhost', DROP "updatable", ADD "use_remote_estimate" 'true')`,
+		updateServerSQL(server, dbServer),
+	)
+	require.Equal(t, "", updateServerSQL(dbServer, dbServer))
+}
+
+func TestUnit_UpdateServer_Nominal(t *testing.T) {
+	db, mock := newSQLMock(t)
+	defer closeSQLMock(t, db)
+
+	mock.ExpectQuery(regexp.QuoteMeta(sqlForeignServerInfo)).
+		WillReturnRows(
+			sqlmock.NewRows([]string{"srvname", "fdwname", "owner", "server_comment", "option_name", "option_value"}).
+				AddRow("remotedb", "postgres_fdw", "postgres", managedComment, "host", "remotehost"),
+		).
+		RowsWillBeClosed()
+	mock.ExpectExec(regexp.QuoteMeta(`ALTER SERVER "remotedb" OPTIONS (ADD "fetch_size" '500')`)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectClose()
+
+	err := UpdateServer(context.Background(), db, model.ForeignServer{
+		Name:    "remotedb",
+		Host:    "remotehost",
+		Options: map[string]string{"fetch_size": "500"},
+	})
+	require.Nil(t, err)
+	closeSQLMock(t, db)
+	require.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestUnit_ApplyServerOptionChanges(t *testing.T) {
+	original := model.ForeignServer{
+		Name:    "remotedb",
+		Host:    "remotehost",
+		Port:    5432,
+		Options: map[string]string{"fetch_size": "100", "updatable": "false"},
+	}
+	server := original
+	err := ApplyServerOptionChanges(&server, []string{"fetch_size=500", "port=5433", "extensions=cube,seg"}, []string{"updatable", "host"})
+	require.Nil(t, err)
+	require.Equal(t, "", server.Host)
+	require.Equal(t, 5433, server.Port)
+	require.Equal(t, map[string]string{"fetch_size": "500", "extensions": "cube,seg"}, server.Options)
+	// The options of the original server are unchanged
+	require.Equal(t, "100", original.Options["fetch_size"])
+
+	require.NotNil(t, ApplyServerOptionChanges(&server, []string{"fetch_size"}, nil))
+}
+
+func TestUnit_GetServerGrants(t *testing.T) {
+	db, mock := newSQLMock(t)
+	defer closeSQLMock(t, db)
+
+	mock.ExpectQuery(regexp.QuoteMeta(sqlGetServerGrantees)).
+		WithArgs("remotedb").
+		WillReturnRows(sqlmock.NewRows([]string{"grantee"}).AddRow("PUBLIC").AddRow("fdw")).
+		RowsWillBeClosed()
+	mock.ExpectClose()
+
+	grants, err := GetServerGrants(context.Background(), db, "remotedb")
+	require.Nil(t, err)
+	require.Equal(t, []string{"PUBLIC", "fdw"}, grants.Users)
+	closeSQLMock(t, db)
+	require.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestUnit_serverGrantSQL(t *testing.T) {
+	require.Equal(t, `GRANT USAGE ON FOREIGN SERVER "remotedb" TO "fdw"`, grantServerSQL("remotedb", "fdw"))
+	require.Equal(t, `GRANT USAGE ON FOREIGN SERVER "remotedb" TO PUBLIC`, grantServerSQL("remotedb", "public"))
+	require.Equal(t, `REVOKE USAGE ON FOREIGN SERVER "remotedb" FROM "Public Relations"`, revokeServerSQL("remotedb", "Public Relations"))
+}
+
+func TestUnit_PlanDesiredState_ServerGrants(t *testing.T) {
+	db, mock := newSQLMock(t)
+	defer closeSQLMock(t, db)
+
+	mock.ExpectQuery(regexp.QuoteMeta(sqlGetExtensions)).
+		WillReturnRows(sqlmock.NewRows([]string{"extname", "extversion"})).
+		RowsWillBeClosed()
+	mock.ExpectQuery(regexp.QuoteMeta(sqlForeignServerInfo)).
+		WillReturnRows(
+			sqlmock.NewRows([]string{"srvname", "fdwname", "owner", "server_comment", "option_name", "option_value"}).
+				AddRow("managed", "postgres_fdw", "postgres", managedComment, "host", "remotehost").
+				AddRow("unmanaged", "postgres_fdw", "postgres", managedComment, "host", "remotehost"),
+		).
+		RowsWillBeClosed()
+	for _, server := range []struct {
+		name     string
+		grantees []string
+	}{
+		{name: "managed", grantees: []string{"PUBLIC", "fdw"}},
+		{name: "unmanaged", grantees: []string{"someone"}},
+	} {
+		mock.ExpectQuery(regexp.QuoteMeta(sqlGetUsermaps)).
+			WithArgs(server.name).
+			WillReturnRows(sqlmock.NewRows([]string{"authorization_identifier", "foreign_server_name", "option_name", "option_value"})).
+			RowsWillBeClosed()
+		granteeRows := sqlmock.NewRows([]string{"grantee"})
+		for _, grantee := range server.grantees {
+			granteeRows.AddRow(grantee)
+		}
+		mock.ExpectQuery(regexp.QuoteMeta(sqlGetServerGrantees)).
+			WithArgs(server.name).
+			WillReturnRows(granteeRows).
+			RowsWillBeClosed()
+		mock.ExpectQuery(regexp.QuoteMeta(sqlGetForeignSchemas)).
+			WithArgs(server.name).
+			WillReturnRows(sqlmock.NewRows([]string{"foreign_table_schema", "foreign_server_name", "remote_schema", "schema_comment"})).
+			RowsWillBeClosed()
+		expectNoForeignTables(mock, server.name)
+	}
+	expectCatalog(mock)
+	expectNoImportedTypes(mock)
+	mock.ExpectClose()
+
+	dState := model.DesiredState{
+		Servers: []model.ForeignServer{
+			{Name: "managed", Host: "remotehost", ServerGrants: &model.Grants{Users: []string{"fdw", "reporting"}}},
+			{Name: "unmanaged", Host: "remotehost"},
+			{Name: "created", Host: "remotehost", ServerGrants: &model.Grants{Users: []string{"public"}}},
+		},
+	}
+	plan, err := PlanDesiredState(context.Background(), db, dState, PlanOptions{})
+	require.Nil(t, err)
+	statements := make([]string, 0)
+	for _, action := range plan.Actions {
+		statements = append(statements, action.SQL)
+	}
+	require.Equal(t, []string{
+		`CREATE SERVER "created" FOREIGN DATA WRAPPER "postgres_fdw" OPTIONS ("host" 'remotehost')`,
+		`COMMENT ON SERVER "created" IS 'fdwctl:{"managed":true}'`,
+		`GRANT USAGE ON FOREIGN SERVER "created" TO PUBLIC`,
+		`REVOKE USAGE ON FOREIGN SERVER "managed" FROM PUBLIC`,
+		`GRANT USAGE ON FOREIGN SERVER "managed" TO "reporting"`,
+	}, statements)
+	require.Equal(t, model.OperationRevoke, plan.Actions[3].Operation)
+	closeSQLMock(t, db)
+	require.Nil(t, mock.ExpectationsWereMet())
+}
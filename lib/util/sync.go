@@ -0,0 +1,41 @@
+package util
+
+import (
+	"context"
+
+	"github.com/neflyte/fdwctl/lib/database"
+	"github.com/neflyte/fdwctl/lib/logger"
+	"github.com/neflyte/fdwctl/lib/model"
+)
+
+// PlanSyncEnums plans the reconciliation of the local ENUM types used by an existing foreign schema, directly or through
+// other user-defined types, with the ENUM types of its remote schema without changing the database. Missing ENUM types are created and missing values are added in
+// remote sort order. Values that were removed or reordered remotely cannot be changed in place and are returned as
+// drift instead.
+func PlanSyncEnums(ctx context.Context, dbConnection database.Executor, schema model.Schema) (*model.Plan, []model.Drift, error) {
+	log := logger.Log(ctx).
+		WithField("function", "PlanSyncEnums")
+	dbSchema, server, err := getImportedSchema(ctx, dbConnection, schema)
+	if err != nil {
+		return nil, nil, err
+	}
+	remoteTypes, err := getRemoteSchemaTypes(ctx, dbConnection, server, dbSchema)
+	if err != nil {
+		log.Errorf("error getting remote types: %s", err)
+		return nil, nil, err
+	}
+	// ENUM types do not depend on other types so they can be planned on their own
+	remoteEnums := make([]*model.SchemaType, 0, len(remoteTypes))
+	for _, remoteType := range remoteTypes {
+		if remoteType.Kind == model.ObjectEnum {
+			remoteEnums = append(remoteEnums, remoteType)
+		}
+	}
+	p := newPlanner(dbConnection, PlanOptions{})
+	err = p.planTypes(ctx, server.Name, dbSchema.LocalSchema, remoteEnums)
+	if err != nil {
+		log.Errorf("error planning ENUMs of local schema %s: %s", schema.LocalSchema, err)
+		return nil, nil, err
+	}
+	return p.plan, p.enumDrift, nil
+}
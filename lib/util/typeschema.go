@@ -0,0 +1,304 @@
+package util
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/neflyte/fdwctl/lib/database"
+	"github.com/neflyte/fdwctl/lib/logger"
+	"github.com/neflyte/fdwctl/lib/model"
+)
+
+const (
+	// sqlSchemaColumnTypes finds the columns of the tables of a schema along with the element type et, if the type of
+	// a column is an array, and the namespace en of the element type
+	sqlSchemaColumnTypes = `SELECT c.relname, a.attname, format_type(a.atttypid, a.atttypmod), en.nspname, et.typname, et.oid <> rt.oid,
+	a.attnotnull
+	FROM pg_catalog.pg_attribute a
+	JOIN pg_catalog.pg_class c ON c.oid = a.attrelid
+	JOIN pg_catalog.pg_namespace n ON n.oid = c.relnamespace
+	JOIN pg_catalog.pg_type rt ON rt.oid = a.atttypid
+	` + sqlReferencedTypeJoin + `
+	WHERE n.nspname = $1 AND c.relkind IN ('r', 'v', 'm', 'f', 'p') AND NOT c.relispartition
+	AND a.attnum > 0 AND NOT a.attisdropped
+	ORDER BY c.relname, a.attnum`
+
+	// importColumnNameOption is the column option that IMPORT FOREIGN SCHEMA of postgres_fdw sets on each column
+	importColumnNameOption = "column_name"
+)
+
+// typeSource records the local schema and server that a user-defined type is imported for
+type typeSource struct {
+	serverName  string
+	localSchema string
+	schemaType  *model.SchemaType
+}
+
+// ValidateTypeSchema determines if the type schema of the supplied schema can be used: types are only created in it
+// when they are imported
+func ValidateTypeSchema(schema model.Schema) error {
+	if schema.TypeSchema != "" && !schema.ImportENUMs {
+		return fmt.Errorf("schema %s: typeSchema %s requires importenums", schema.LocalSchema, schema.TypeSchema)
+	}
+	return nil
+}
+
+// remapTypes returns copies of the supplied remote user-defined types that are created in the named local schema
+// instead of the schemas named after their remote schemas. The references of the types to each other are changed
+// to match. An error is returned if two remote types would have the same name in the local schema.
+func remapTypes(remoteTypes []*model.SchemaType, typeSchema string) ([]*model.SchemaType, error) {
+	references := make([]string, 0, len(remoteTypes)*2)
+	remoteNames := make(map[string]string)
+	dependencies := make(map[string]string)
+	for _, remoteType := range remoteTypes {
+		if other, ok := remoteNames[remoteType.Name]; ok {
+			return nil, fmt.Errorf("remote types %s and %s would both be created as %s.%s", other, remoteType.String(), typeSchema, remoteType.Name)
+		}
+		remoteNames[remoteType.Name] = remoteType.String()
+		dependencies[remoteType.String()] = fmt.Sprintf("%s.%s", typeSchema, remoteType.Name)
+		references = append(references, QuoteQualifiedIdentifier(remoteType.Schema, remoteType.Name), QuoteQualifiedIdentifier(typeSchema, remoteType.Name))
+	}
+	replacer := strings.NewReplacer(references...)
+	remappedTypes := make([]*model.SchemaType, len(remoteTypes))
+	for idx, remoteType := range remoteTypes {
+		remappedType := *remoteType
+		remappedType.Schema = typeSchema
+		remappedType.BaseType = replacer.Replace(remoteType.BaseType)
+		remappedType.Default = replacer.Replace(remoteType.Default)
+		remappedType.Constraints = make([]string, len(remoteType.Constraints))
+		for cIdx, constraint := range remoteType.Constraints {
+			remappedType.Constraints[cIdx] = replacer.Replace(constraint)
+		}
+		remappedType.Attributes = make([]model.Column, len(remoteType.Attributes))
+		for aIdx, attribute := range remoteType.Attributes {
+			remappedType.Attributes[aIdx] = attribute
+			remappedType.Attributes[aIdx].Type = replacer.Replace(attribute.Type)
+		}
+		remappedType.DependsOn = make([]string, len(remoteType.DependsOn))
+		for dIdx, dependency := range remoteType.DependsOn {
+			remappedType.DependsOn[dIdx] = dependency
+			if remappedDependency, ok := dependencies[dependency]; ok {
+				remappedType.DependsOn[dIdx] = remappedDependency
+			}
+		}
+		remappedTypes[idx] = &remappedType
+	}
+	return remappedTypes, nil
+}
+
+// findTypeConflicts returns a description of each user-defined type that is imported with different definitions for
+// different local schemas
+func findTypeConflicts(sources []typeSource) []string {
+	firstSources := make(map[string]typeSource)
+	reported := make(map[string]bool)
+	conflicts := make([]string, 0)
+	for _, source := range sources {
+		typeName := source.schemaType.String()
+		firstSource, ok := firstSources[typeName]
+		if !ok {
+			firstSources[typeName] = source
+			continue
+		}
+		if reported[typeName] || createTypeSQL(firstSource.schemaType) == createTypeSQL(source.schemaType) {
+			continue
+		}
+		reported[typeName] = true
+		conflicts = append(conflicts, fmt.Sprintf(
+			"%s type %s is imported for local schema %s of server %s and local schema %s of server %s with different definitions",
+			source.schemaType.Kind,
+			typeName,
+			firstSource.localSchema,
+			firstSource.serverName,
+			source.localSchema,
+			source.serverName,
+		))
+	}
+	return conflicts
+}
+
+// checkImportedTypeConflicts returns an error if a remote user-defined type that is imported for the local schema
+// already exists locally, was imported for a local schema of another server, and has a different definition there
+func checkImportedTypeConflicts(ctx context.Context, dbConnection database.Executor, serverName string, localSchema string, remoteTypes []*model.SchemaType) error {
+	log := logger.Log(ctx).
+		WithField("function", "checkImportedTypeConflicts")
+	importedTypes, err := getImportedTypes(ctx, dbConnection)
+	if err != nil {
+		log.Errorf("error getting imported types: %s", err)
+		return err
+	}
+	if len(importedTypes) == 0 {
+		return nil
+	}
+	dbSchemas, err := GetSchemasForServer(ctx, dbConnection, "")
+	if err != nil {
+		log.Errorf("error getting foreign schemas: %s", err)
+		return err
+	}
+	schemaServers := make(map[string]string)
+	for _, dbSchema := range dbSchemas {
+		schemaServers[dbSchema.LocalSchema] = dbSchema.ServerName
+	}
+	sources := make([]typeSource, 0)
+	for _, remoteType := range remoteTypes {
+		importedType := findImportedType(importedTypes, remoteType)
+		if importedType == nil {
+			continue
+		}
+		otherSchema := ""
+		for _, schemaName := range importedType.ImportedFor {
+			if otherServer, ok := schemaServers[schemaName]; ok && otherServer != serverName {
+				otherSchema = schemaName
+				break
+			}
+		}
+		if otherSchema == "" {
+			continue
+		}
+		localType := &model.SchemaType{Schema: importedType.Schema, Name: importedType.Name, Kind: importedType.Kind}
+		err = getTypeDefinition(ctx, dbConnection, localType)
+		if err != nil {
+			log.Errorf("error getting definition of local %s type %s: %s", localType.Kind, localType, err)
+			return err
+		}
+		sources = append(
+			sources,
+			typeSource{serverName: schemaServers[otherSchema], localSchema: otherSchema, schemaType: localType},
+			typeSource{serverName: serverName, localSchema: localSchema, schemaType: remoteType},
+		)
+	}
+	conflicts := findTypeConflicts(sources)
+	if len(conflicts) > 0 {
+		return logger.ErrorfAsError(log, "conflicting user-defined types: %s; set a typeSchema to import them into another local schema", strings.Join(conflicts, "; "))
+	}
+	return nil
+}
+
+// getTypedTables returns the columns, in order, of each table in the named schema that has a column of a
+// user-defined type, keyed by table name. The user-defined types are named as they are created in the supplied
+// local type schema.
+func getTypedTables(ctx context.Context, dbConnection database.Executor, schemaName string, typeSchema string) (map[string][]model.Column, error) {
+	columns, typedTables, err := getDeclaredColumns(ctx, dbConnection, schemaName, typeSchema)
+	if err != nil {
+		return nil, err
+	}
+	for table := range columns {
+		if !typedTables[table] {
+			delete(columns, table)
+		}
+	}
+	return columns, nil
+}
+
+// getDeclaredColumns returns the columns, in order, of each table in the named schema keyed by table name, with their
+// types as a foreign table column declares them. User-defined types are named as they are created in the supplied
+// local type schema, or in their own schema when the type schema is empty. The tables that have a column of a
+// user-defined type are returned as well.
+func getDeclaredColumns(ctx context.Context, dbConnection database.Executor, schemaName string, typeSchema string) (map[string][]model.Column, map[string]bool, error) {
+	log := logger.Log(ctx).
+		WithField("function", "getDeclaredColumns")
+	log.Tracef("query: %s, args: %#v", sqlSchemaColumnTypes, schemaName)
+	columnRows, err := dbConnection.QueryContext(ctx, sqlSchemaColumnTypes, schemaName)
+	if err != nil {
+		log.Errorf("error querying schema columns: %s", err)
+		return nil, nil, err
+	}
+	defer database.CloseRows(ctx, columnRows)
+	columns := make(map[string][]model.Column)
+	typedTables := make(map[string]bool)
+	var tableName, formattedType, elementSchema, elementName string
+	var isArray bool
+	for columnRows.Next() {
+		column := model.Column{}
+		err = columnRows.Scan(&tableName, &column.Name, &formattedType, &elementSchema, &elementName, &isArray, &column.NotNull)
+		if err != nil {
+			log.Errorf("error scanning result row: %s", err)
+			return nil, nil, err
+		}
+		column.Type = formattedType
+		if elementSchema != "pg_catalog" && elementSchema != "information_schema" {
+			localTypeSchema := typeSchema
+			if localTypeSchema == "" {
+				localTypeSchema = elementSchema
+			}
+			column.Type = QuoteQualifiedIdentifier(localTypeSchema, elementName)
+			if isArray {
+				column.Type += "[]"
+			}
+			typedTables[tableName] = true
+		}
+		columns[tableName] = append(columns[tableName], column)
+	}
+	if columnRows.Err() != nil {
+		log.Errorf("error iterating result rows: %s", columnRows.Err())
+		return nil, nil, columnRows.Err()
+	}
+	return columns, typedTables, nil
+}
+
+// getRemoteTypedTables returns the columns of each table of the remote schema of a foreign schema that has a column
+// of a user-defined type, keyed by table name, with the user-defined types named as they are created in the type
+// schema of the foreign schema
+func getRemoteTypedTables(ctx context.Context, dbConnection database.Executor, server model.ForeignServer, schema model.Schema) (map[string][]model.Column, error) {
+	log := logger.Log(ctx).
+		WithField("function", "getRemoteTypedTables")
+	remoteConnStr, err := remoteConnectionString(ctx, dbConnection, server, schema)
+	if err != nil {
+		return nil, err
+	}
+	remoteConn, err := database.GetConnection(ctx, remoteConnStr)
+	if err != nil {
+		log.Errorf("error connecting to foreign database: %s", err)
+		return nil, err
+	}
+	defer database.CloseConnection(ctx, remoteConn)
+	return getTypedTables(ctx, remoteConn, schema.RemoteSchema, schema.TypeSchema)
+}
+
+// splitTypedTables separates the tables that use user-defined types from the tables of an import. IMPORT FOREIGN
+// SCHEMA refers to user-defined types by their remote schema, so the tables that use types which are created in a
+// type schema are created one by one instead. The import without those tables, the names of the tables to create,
+// and whether anything is left to import are returned.
+func splitTypedTables(importSchema model.Schema, typedTables map[string][]model.Column) (model.Schema, []string, bool) {
+	createdTables := make([]string, 0)
+	if len(importSchema.LimitTo) > 0 {
+		limitTo := make([]string, 0, len(importSchema.LimitTo))
+		for _, table := range importSchema.LimitTo {
+			if _, ok := typedTables[table]; ok {
+				createdTables = append(createdTables, table)
+			} else {
+				limitTo = append(limitTo, table)
+			}
+		}
+		importSchema.LimitTo = limitTo
+		return importSchema, createdTables, len(limitTo) > 0
+	}
+	for table := range typedTables {
+		if !containsString(importSchema.Except, table) {
+			createdTables = append(createdTables, table)
+		}
+	}
+	sort.Strings(createdTables)
+	importSchema.Except = append(append(make([]string, 0, len(importSchema.Except)+len(createdTables)), importSchema.Except...), createdTables...)
+	return importSchema, createdTables, true
+}
+
+// typedForeignTable returns the foreign table that imports the named remote table of a foreign schema the way IMPORT
+// FOREIGN SCHEMA would, using the supplied columns
+func typedForeignTable(serverName string, schema model.Schema, tableName string, columns []model.Column) model.ForeignTable {
+	table := model.ForeignTable{
+		ServerName:   serverName,
+		LocalSchema:  schema.LocalSchema,
+		Name:         tableName,
+		RemoteSchema: schema.RemoteSchema,
+		RemoteTable:  tableName,
+		Columns:      make([]model.Column, len(columns)),
+	}
+	for idx, column := range columns {
+		column.Options = map[string]string{importColumnNameOption: column.Name}
+		column.NotNull = column.NotNull && importsNotNull(schema)
+		table.Columns[idx] = column
+	}
+	return table
+}
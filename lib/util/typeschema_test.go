@@ -0,0 +1,162 @@
+package util
+
+import (
+	"context"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/neflyte/fdwctl/lib/model"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUnit_ValidateTypeSchema(t *testing.T) {
+	require.Nil(t, ValidateTypeSchema(model.Schema{LocalSchema: "remotedb"}))
+	require.Nil(t, ValidateTypeSchema(model.Schema{LocalSchema: "remotedb", TypeSchema: "remotedb_types", ImportENUMs: true}))
+	require.NotNil(t, ValidateTypeSchema(model.Schema{LocalSchema: "remotedb", TypeSchema: "remotedb_types"}))
+}
+
+func TestUnit_remapTypes(t *testing.T) {
+	status := &model.SchemaType{Schema: "public", Name: "status", Kind: model.ObjectEnum, Values: []string{"open", "closed"}}
+	openStatus := &model.SchemaType{
+		Schema:      "public",
+		Name:        "open_status",
+		Kind:        model.ObjectDomain,
+		BaseType:    `"public"."status"`,
+		Default:     `'open'::"public"."status"`,
+		Constraints: []string{`CONSTRAINT "is_open" CHECK (VALUE = 'open'::"public"."status")`},
+		DependsOn:   []string{"public.status"},
+	}
+	address := &model.SchemaType{
+		Schema: "shared",
+		Name:   "address",
+		Kind:   model.ObjectComposite,
+		Attributes: []model.Column{
+			{Name: "street", Type: "text"},
+			{Name: "statuses", Type: `"public"."status"[]`},
+		},
+		DependsOn: []string{"public.status"},
+	}
+
+	actual, err := remapTypes([]*model.SchemaType{status, openStatus, address}, "remotedb_types")
+	require.Nil(t, err)
+	require.Equal(t, []*model.SchemaType{
+		{Schema: "remotedb_types", Name: "status", Kind: model.ObjectEnum, Values: []string{"open", "closed"}, Constraints: []string{}, Attributes: []model.Column{}, DependsOn: []string{}},
+		{
+			Schema:      "remotedb_types",
+			Name:        "open_status",
+			Kind:        model.ObjectDomain,
+			BaseType:    `"remotedb_types"."status"`,
+			Default:     `'open'::"remotedb_types"."status"`,
+			Constraints: []string{`CONSTRAINT "is_open" CHECK (VALUE = 'open'::"remotedb_types"."status")`},
+			Attributes:  []model.Column{},
+			DependsOn:   []string{"remotedb_types.status"},
+		},
+		{
+			Schema:      "remotedb_types",
+			Name:        "address",
+			Kind:        model.ObjectComposite,
+			Constraints: []string{},
+			Attributes: []model.Column{
+				{Name: "street", Type: "text"},
+				{Name: "statuses", Type: `"remotedb_types"."status"[]`},
+			},
+			DependsOn: []string{"remotedb_types.status"},
+		},
+	}, actual)
+	// The remote types are left alone
+	require.Equal(t, "public", status.Schema)
+	require.Equal(t, `"public"."status"`, openStatus.BaseType)
+
+	_, err = remapTypes([]*model.SchemaType{status, {Schema: "shared", Name: "status", Kind: model.ObjectEnum}}, "remotedb_types")
+	require.NotNil(t, err)
+}
+
+func TestUnit_findTypeConflicts(t *testing.T) {
+	status := &model.SchemaType{Schema: "public", Name: "status", Kind: model.ObjectEnum, Values: []string{"open", "closed"}}
+	sameStatus := &model.SchemaType{Schema: "public", Name: "status", Kind: model.ObjectEnum, Values: []string{"open", "closed"}}
+	otherStatus := &model.SchemaType{Schema: "public", Name: "status", Kind: model.ObjectEnum, Values: []string{"active", "inactive"}}
+	kind := &model.SchemaType{Schema: "public", Name: "kind", Kind: model.ObjectEnum, Values: []string{"a"}}
+
+	require.Empty(t, findTypeConflicts([]typeSource{
+		{serverName: "db1", localSchema: "db1", schemaType: status},
+		{serverName: "db2", localSchema: "db2", schemaType: sameStatus},
+		{serverName: "db2", localSchema: "db2", schemaType: kind},
+	}))
+	require.Equal(t, []string{
+		"enum type public.status is imported for local schema db1 of server db1 and local schema db3 of server db3 with different definitions",
+	}, findTypeConflicts([]typeSource{
+		{serverName: "db1", localSchema: "db1", schemaType: status},
+		{serverName: "db2", localSchema: "db2", schemaType: sameStatus},
+		{serverName: "db3", localSchema: "db3", schemaType: otherStatus},
+		{serverName: "db4", localSchema: "db4", schemaType: otherStatus},
+	}))
+}
+
+func TestUnit_getTypedTables(t *testing.T) {
+	db, mock := newSQLMock(t)
+	defer closeSQLMock(t, db)
+
+	mock.ExpectQuery(regexp.QuoteMeta(sqlSchemaColumnTypes)).
+		WithArgs("public").
+		WillReturnRows(
+			sqlmock.NewRows([]string{"relname", "attname", "format_type", "nspname", "typname", "is_array", "attnotnull"}).
+				AddRow("orders", "id", "integer", "pg_catalog", "int4", false, true).
+				AddRow("orders", "status", "status", "public", "status", false, true).
+				AddRow("orders", "tags", "tag[]", "public", "tag", true, false).
+				AddRow("users", "id", "integer", "pg_catalog", "int4", false, true),
+		).
+		RowsWillBeClosed()
+	mock.ExpectClose()
+
+	actual, err := getTypedTables(context.Background(), db, "public", "remotedb_types")
+	require.Nil(t, err)
+	require.Equal(t, map[string][]model.Column{
+		"orders": {
+			{Name: "id", Type: "integer", NotNull: true},
+			{Name: "status", Type: `"remotedb_types"."status"`, NotNull: true},
+			{Name: "tags", Type: `"remotedb_types"."tag"[]`},
+		},
+	}, actual)
+	closeSQLMock(t, db)
+	require.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestUnit_splitTypedTables(t *testing.T) {
+	typedTables := map[string][]model.Column{
+		"orders":   {{Name: "status", Type: `"remotedb_types"."status"`}},
+		"invoices": {{Name: "status", Type: `"remotedb_types"."status"`}},
+	}
+
+	importSchema, createdTables, importNeeded := splitTypedTables(model.Schema{LocalSchema: "remotedb", Except: []string{"invoices", "audit"}}, typedTables)
+	require.True(t, importNeeded)
+	require.Equal(t, []string{"orders"}, createdTables)
+	require.Equal(t, []string{"invoices", "audit", "orders"}, importSchema.Except)
+
+	importSchema, createdTables, importNeeded = splitTypedTables(model.Schema{LocalSchema: "remotedb", LimitTo: []string{"orders", "users"}}, typedTables)
+	require.True(t, importNeeded)
+	require.Equal(t, []string{"orders"}, createdTables)
+	require.Equal(t, []string{"users"}, importSchema.LimitTo)
+
+	_, createdTables, importNeeded = splitTypedTables(model.Schema{LocalSchema: "remotedb", LimitTo: []string{"orders"}}, typedTables)
+	require.False(t, importNeeded)
+	require.Equal(t, []string{"orders"}, createdTables)
+}
+
+func TestUnit_typedForeignTable(t *testing.T) {
+	schema := model.Schema{LocalSchema: "remotedb", RemoteSchema: "public", TypeSchema: "remotedb_types", ImportENUMs: true}
+	columns := []model.Column{
+		{Name: "id", Type: "integer", NotNull: true},
+		{Name: "status", Type: `"remotedb_types"."status"`},
+	}
+	table := typedForeignTable("remotedb", schema, "orders", columns)
+	require.Equal(t,
+		`CREATE FOREIGN TABLE "remotedb"."orders" ("id" integer OPTIONS ("column_name" 'id') NOT NULL, "status" "remotedb_types"."status" OPTIONS ("column_name" 'status')) SERVER "remotedb" OPTIONS ("schema_name" 'public', "table_name" 'orders')`,
+		createForeignTableSQL(table, model.DefaultWrapper),
+	)
+	require.Nil(t, columns[0].Options)
+
+	schema.ImportOptions = map[string]string{"import_not_null": "false"}
+	table = typedForeignTable("remotedb", schema, "orders", columns)
+	require.False(t, table.Columns[0].NotNull)
+}
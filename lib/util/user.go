@@ -2,24 +2,33 @@ package util
 
 import (
 	"context"
-	"database/sql"
 	"fmt"
+	"strings"
 
 	"github.com/neflyte/fdwctl/lib/database"
 	"github.com/neflyte/fdwctl/lib/logger"
+	"github.com/neflyte/fdwctl/lib/model"
 )
 
 const (
 	sqlUserExists = `SELECT 1 FROM pg_user WHERE usename = $1`
-	sqlCreateUser = `CREATE USER "%s" WITH PASSWORD '%s'`
-	sqlDropUser   = `DROP USER IF EXISTS "%s"`
+	sqlCreateUser = `CREATE USER %s WITH PASSWORD %s`
+	sqlDropUser   = `DROP USER IF EXISTS %s`
+	// sqlGetRoleComments finds the local roles that have a comment written by fdwctl
+	sqlGetRoleComments = `SELECT r.rolname, shobj_description(r.oid, 'pg_authid')
+	FROM pg_catalog.pg_roles r
+	WHERE shobj_description(r.oid, 'pg_authid') LIKE '%fdwctl:%'`
 )
 
-func EnsureUser(ctx context.Context, dbConnection *sql.DB, userName string, userPassword string) error {
+func EnsureUser(ctx context.Context, dbConnection database.Executor, userName string, userPassword string) error {
 	log := logger.Log(ctx).
 		WithField("function", "EnsureUser")
+	if model.IsSpecialLocalUser(userName) {
+		log.Debugf("%s is a user mapping keyword and not a role; skipping", userName)
+		return nil
+	}
 	log.Tracef("query: %s, args: %#v", sqlUserExists, userName)
-	rows, err := dbConnection.Query(sqlUserExists, userName)
+	rows, err := dbConnection.QueryContext(ctx, sqlUserExists, userName)
 	if err != nil {
 		return fmt.Errorf("error verifying user: %s", err)
 	}
@@ -41,12 +50,19 @@ func EnsureUser(ctx context.Context, dbConnection *sql.DB, userName string, user
 	}
 	if !userExists {
 		log.Debugf("user does not exist; creating")
-		query := fmt.Sprintf(sqlCreateUser, userName, userPassword)
+		query := fmt.Sprintf(sqlCreateUser, QuoteIdentifier(userName), QuoteLiteral(userPassword))
 		log.Tracef("query: %s", query)
-		_, err = dbConnection.Exec(query)
+		_, err = dbConnection.ExecContext(ctx, query)
 		if err != nil {
 			return fmt.Errorf("error creating user: %s", err)
 		}
+		// The mark lets apply drop the user along with its last user mapping
+		query = commentOnRoleSQL(userName, objectMetadata{Managed: true})
+		log.Tracef("query: %s", query)
+		_, err = dbConnection.ExecContext(ctx, query)
+		if err != nil {
+			return fmt.Errorf("error marking user as managed: %s", err)
+		}
 		log.Infof("user %s created", userName)
 		return nil
 	}
@@ -54,15 +70,98 @@ func EnsureUser(ctx context.Context, dbConnection *sql.DB, userName string, user
 	return nil
 }
 
-func DropUser(ctx context.Context, dbConnection *sql.DB, username string) error {
+// canonicalGrantee returns the name of a grantee the way the database catalog reports it; the PUBLIC keyword is
+// upper-cased and every other grantee is a role name that is returned unchanged
+func canonicalGrantee(grantee string) string {
+	if strings.EqualFold(grantee, model.LocalUserPublic) {
+		return model.LocalUserPublic
+	}
+	return grantee
+}
+
+// granteeSQL returns the grantee of a GRANT or REVOKE statement; PUBLIC is a keyword and every other grantee is a
+// quoted role name
+func granteeSQL(grantee string) string {
+	if canonicalGrantee(grantee) == model.LocalUserPublic {
+		return model.LocalUserPublic
+	}
+	return QuoteIdentifier(grantee)
+}
+
+// DiffGrantees produces the lists of grantees to revoke and to grant to bring `dbGrantees` in line with
+// `dStateGrantees`. PUBLIC is matched regardless of case.
+func DiffGrantees(dStateGrantees []string, dbGrantees []string) (revoke []string, grant []string) {
+	revoke = make([]string, 0)
+	grant = make([]string, 0)
+	canonicalDState := make([]string, 0, len(dStateGrantees))
+	for _, grantee := range dStateGrantees {
+		canonicalDState = append(canonicalDState, canonicalGrantee(grantee))
+	}
+	canonicalDB := make([]string, 0, len(dbGrantees))
+	for _, grantee := range dbGrantees {
+		canonicalDB = append(canonicalDB, canonicalGrantee(grantee))
+	}
+	for _, grantee := range canonicalDB {
+		if !containsString(canonicalDState, grantee) && !containsString(revoke, grantee) {
+			revoke = append(revoke, grantee)
+		}
+	}
+	for _, grantee := range canonicalDState {
+		if !containsString(canonicalDB, grantee) && !containsString(grant, grantee) {
+			grant = append(grant, grantee)
+		}
+	}
+	return
+}
+
+// getManagedRoles returns the names of the local roles that fdwctl created
+func getManagedRoles(ctx context.Context, dbConnection database.Executor) (map[string]bool, error) {
+	log := logger.Log(ctx).
+		WithField("function", "getManagedRoles")
+	log.Tracef("query: %s", sqlGetRoleComments)
+	rows, err := dbConnection.QueryContext(ctx, sqlGetRoleComments)
+	if err != nil {
+		log.Errorf("error querying role comments: %s", err)
+		return nil, err
+	}
+	defer database.CloseRows(ctx, rows)
+	managedRoles := make(map[string]bool)
+	var roleName, comment string
+	for rows.Next() {
+		err = rows.Scan(&roleName, &comment)
+		if err != nil {
+			log.Errorf("error scanning result row: %s", err)
+			return nil, err
+		}
+		if parseMetadataComment(comment).Managed {
+			managedRoles[roleName] = true
+		}
+	}
+	if rows.Err() != nil {
+		log.Errorf("error iterating result rows: %s", rows.Err())
+		return nil, rows.Err()
+	}
+	return managedRoles, nil
+}
+
+// dropUserSQL returns the statement that drops the named local user
+func dropUserSQL(username string) string {
+	return fmt.Sprintf(sqlDropUser, QuoteIdentifier(username))
+}
+
+func DropUser(ctx context.Context, dbConnection database.Executor, username string) error {
 	log := logger.Log(ctx).
 		WithField("function", "DropUser")
 	if username == "" {
 		return logger.ErrorfAsError(log, "user name is required")
 	}
-	query := fmt.Sprintf(sqlDropUser, username)
+	if model.IsSpecialLocalUser(username) {
+		log.Debugf("%s is a user mapping keyword and not a role; skipping", username)
+		return nil
+	}
+	query := dropUserSQL(username)
 	log.Tracef("query: %s", query)
-	_, err := dbConnection.Exec(query)
+	_, err := dbConnection.ExecContext(ctx, query)
 	if err != nil {
 		log.Errorf("error dropping user: %s", err)
 		return err
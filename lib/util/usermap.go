@@ -12,20 +12,121 @@ import (
 )
 
 const (
-	sqlGetUsermaps = `WITH remoteuser AS (
-	SELECT authorization_identifier, foreign_server_name, option_value AS remoteuser FROM information_schema.user_mapping_options WHERE option_name = 'user'
-), remotepassword AS (
-	SELECT authorization_identifier, foreign_server_name, option_value AS remotepassword FROM information_schema.user_mapping_options WHERE option_name = 'password'
-)
-SELECT ru.authorization_identifier, ru.remoteuser, rp.remotepassword, ru.foreign_server_name
-FROM remoteuser ru
-JOIN remotepassword rp ON ru.authorization_identifier = rp.authorization_identifier AND ru.foreign_server_name = rp.foreign_server_name`
+	sqlGetUsermaps = `SELECT um.authorization_identifier, um.foreign_server_name, umo.option_name, umo.option_value
+FROM information_schema.user_mappings um
+LEFT JOIN information_schema.user_mapping_options umo ON umo.authorization_identifier = um.authorization_identifier AND umo.foreign_server_name = um.foreign_server_name`
+	sqlGetUsermapsConstraint = `WHERE um.foreign_server_name = $1`
+	sqlGetUsermapsOrder      = `ORDER BY um.foreign_server_name, um.authorization_identifier, umo.option_name`
+
+	sqlDropUsermap   = `DROP USER MAPPING IF EXISTS FOR %s SERVER %s`
+	sqlCreateUsermap = `CREATE USER MAPPING FOR %s SERVER %s`
+	sqlUpdateUsermap = `ALTER USER MAPPING FOR %s SERVER %s`
+	sqlSessionUsers  = `SELECT current_user, session_user`
 
-	sqlDropUsermap   = `DROP USER MAPPING IF EXISTS FOR "%s" SERVER "%s"`
-	sqlCreateUsermap = `CREATE USER MAPPING FOR "%s" SERVER "%s" OPTIONS (user '%s', password '%s')`
-	sqlUpdateUsermap = `ALTER USER MAPPING FOR "%s" SERVER "%s" OPTIONS (%s)`
+	// usermapOptionUser is the name of the user mapping option that holds the remote user
+	usermapOptionUser = "user"
+	// usermapOptionPassword is the name of the user mapping option that holds the remote user's credential
+	usermapOptionPassword = "password"
 )
 
+// userMapUserSQL returns the local user of a user mapping as it appears in a statement; the keywords PUBLIC,
+// CURRENT_USER, SESSION_USER, and USER are not quoted
+func userMapUserSQL(localUser string) string {
+	if model.IsSpecialLocalUser(localUser) {
+		return strings.ToUpper(localUser)
+	}
+	return QuoteIdentifier(localUser)
+}
+
+// ResolveLocalUsers returns a copy of the supplied desired state in which the local user of each user mapping is
+// named the way the database catalog reports it: PUBLIC is upper-cased and CURRENT_USER, USER, and SESSION_USER
+// are replaced by the name of the corresponding role of the database connection.
+func ResolveLocalUsers(ctx context.Context, dbConnection database.Executor, dState model.DesiredState) (model.DesiredState, error) {
+	log := logger.Log(ctx).
+		WithField("function", "ResolveLocalUsers")
+	var currentUser, sessionUser string
+	resolved := dState
+	resolved.Servers = make([]model.ForeignServer, len(dState.Servers))
+	for serverIdx, server := range dState.Servers {
+		server.UserMaps = append(make([]model.UserMap, 0, len(server.UserMaps)), server.UserMaps...)
+		for umIdx := range server.UserMaps {
+			usermap := &server.UserMaps[umIdx]
+			if !model.IsSpecialLocalUser(usermap.LocalUser) {
+				continue
+			}
+			keyword := strings.ToUpper(usermap.LocalUser)
+			usermap.LocalUserKeyword = keyword
+			if keyword == model.LocalUserPublic {
+				usermap.LocalUser = keyword
+				continue
+			}
+			if currentUser == "" {
+				var err error
+				currentUser, sessionUser, err = getSessionUsers(ctx, dbConnection)
+				if err != nil {
+					log.Errorf("error getting current and session users: %s", err)
+					return dState, err
+				}
+			}
+			if keyword == model.LocalUserSessionUser {
+				usermap.LocalUser = sessionUser
+			} else {
+				usermap.LocalUser = currentUser
+			}
+		}
+		resolved.Servers[serverIdx] = server
+	}
+	return resolved, nil
+}
+
+// ResolveLocalUser returns the supplied local user of a user mapping named the way the database catalog reports it,
+// like ResolveLocalUsers does
+func ResolveLocalUser(ctx context.Context, dbConnection database.Executor, localUser string) (string, error) {
+	log := logger.Log(ctx).
+		WithField("function", "ResolveLocalUser")
+	if !model.IsSpecialLocalUser(localUser) {
+		return localUser, nil
+	}
+	keyword := strings.ToUpper(localUser)
+	if keyword == model.LocalUserPublic {
+		return keyword, nil
+	}
+	currentUser, sessionUser, err := getSessionUsers(ctx, dbConnection)
+	if err != nil {
+		log.Errorf("error getting current and session users: %s", err)
+		return "", err
+	}
+	if keyword == model.LocalUserSessionUser {
+		return sessionUser, nil
+	}
+	return currentUser, nil
+}
+
+// getSessionUsers returns the names of the current user and the session user of the database connection
+func getSessionUsers(ctx context.Context, dbConnection database.Executor) (currentUser string, sessionUser string, err error) {
+	log := logger.Log(ctx).
+		WithField("function", "getSessionUsers")
+	log.Tracef("query: %s", sqlSessionUsers)
+	rows, err := dbConnection.QueryContext(ctx, sqlSessionUsers)
+	if err != nil {
+		log.Errorf("error querying for session users: %s", err)
+		return "", "", err
+	}
+	defer database.CloseRows(ctx, rows)
+	if !rows.Next() {
+		if rows.Err() != nil {
+			return "", "", rows.Err()
+		}
+		return "", "", logger.ErrorfAsError(log, "no session users returned")
+	}
+	err = rows.Scan(&currentUser, &sessionUser)
+	if err != nil {
+		log.Errorf("error scanning result row: %s", err)
+		return "", "", err
+	}
+	return currentUser, sessionUser, nil
+}
+
 func FindUserMap(usermaps []model.UserMap, localuser string) *model.UserMap {
 	for _, usermap := range usermaps {
 		if usermap.LocalUser == localuser {
@@ -35,32 +136,42 @@ func FindUserMap(usermaps []model.UserMap, localuser string) *model.UserMap {
 	return nil
 }
 
-func GetUserMapsForServer(ctx context.Context, dbConnection *sql.DB, foreignServer string) ([]model.UserMap, error) {
+func GetUserMapsForServer(ctx context.Context, dbConnection database.Executor, foreignServer string) ([]model.UserMap, error) {
 	log := logger.Log(ctx).
 		WithField("function", "GetUserMapsForServer")
 	query := sqlGetUsermaps
-	qArgs := make([]interface{}, 1)
+	qArgs := make([]interface{}, 0)
 	if foreignServer != "" {
-		query += " WHERE ru.foreign_server_name = $1"
-		qArgs[0] = foreignServer
+		query = fmt.Sprintf("%s %s", query, sqlGetUsermapsConstraint)
+		qArgs = append(qArgs, foreignServer)
 	}
+	query = fmt.Sprintf("%s %s", query, sqlGetUsermapsOrder)
 	log.Tracef("query: %s, args: %#v", query, qArgs)
-	userRows, err := dbConnection.Query(query, qArgs...)
+	userRows, err := dbConnection.QueryContext(ctx, query, qArgs...)
 	if err != nil {
 		log.Errorf("error getting users for server: %s", err)
 		return nil, err
 	}
 	defer database.CloseRows(ctx, userRows)
 	users := make([]model.UserMap, 0)
+	var localUser, serverName string
+	var optionName, optionValue sql.NullString
 	for userRows.Next() {
-		user := new(model.UserMap)
-		user.RemoteSecret = model.Secret{}
-		err = userRows.Scan(&user.LocalUser, &user.RemoteUser, &user.RemoteSecret.Value, &user.ServerName)
+		err = userRows.Scan(&localUser, &serverName, &optionName, &optionValue)
 		if err != nil {
 			log.Errorf("error scanning result row: %s", err)
 			continue
 		}
-		users = append(users, *user)
+		// Rows are ordered by server and local user so the options of a mapping are always on consecutive rows
+		if len(users) == 0 || users[len(users)-1].ServerName != serverName || users[len(users)-1].LocalUser != localUser {
+			users = append(users, model.UserMap{
+				ServerName: serverName,
+				LocalUser:  localUser,
+			})
+		}
+		if optionName.Valid {
+			setUserMapOption(&users[len(users)-1], optionName.String, optionValue.String)
+		}
 	}
 	if userRows.Err() != nil {
 		log.Errorf("error iterating result rows: %s", userRows.Err())
@@ -69,6 +180,35 @@ func GetUserMapsForServer(ctx context.Context, dbConnection *sql.DB, foreignServ
 	return users, nil
 }
 
+// setUserMapOption stores a user mapping option from the catalog in the supplied user mapping. The user and password
+// options are stored in RemoteUser and RemoteSecret and all other options are stored in the Options map.
+func setUserMapOption(usermap *model.UserMap, optionName string, optionValue string) {
+	switch optionName {
+	case usermapOptionUser:
+		usermap.RemoteUser = optionValue
+	case usermapOptionPassword:
+		usermap.RemoteSecret = model.Secret{Value: optionValue}
+	default:
+		if usermap.Options == nil {
+			usermap.Options = make(map[string]string)
+		}
+		usermap.Options[optionName] = optionValue
+	}
+}
+
+// userMapOptions returns all options of the supplied user mapping, including user and password, keyed by option
+// name. The password option is only included when hasPassword is true.
+func userMapOptions(usermap model.UserMap, secretValue string, hasPassword bool) map[string]string {
+	options := copyOptions(usermap.Options)
+	if usermap.RemoteUser != "" {
+		options[usermapOptionUser] = usermap.RemoteUser
+	}
+	if hasPassword {
+		options[usermapOptionPassword] = secretValue
+	}
+	return options
+}
+
 func DiffUserMaps(dStateUserMaps []model.UserMap, dbUserMaps []model.UserMap) (umRemove []model.UserMap, umAdd []model.UserMap, umModify []model.UserMap) {
 	// Init return variables
 	umRemove = make([]model.UserMap, 0)
@@ -91,20 +231,25 @@ func DiffUserMaps(dStateUserMaps []model.UserMap, dbUserMaps []model.UserMap) (u
 	return
 }
 
-func DropUserMap(ctx context.Context, dbConnection *sql.DB, usermap model.UserMap, dropLocalUser bool) error {
+// dropUserMapSQL returns the statement that drops the supplied user mapping
+func dropUserMapSQL(usermap model.UserMap) string {
+	return fmt.Sprintf(sqlDropUsermap, userMapUserSQL(usermap.LocalUser), QuoteIdentifier(usermap.ServerName))
+}
+
+func DropUserMap(ctx context.Context, dbConnection database.Executor, usermap model.UserMap, dropLocalUser bool) error {
 	log := logger.Log(ctx).
 		WithField("function", "DropUserMap")
 	if usermap.ServerName == "" {
 		return logger.ErrorfAsError(log, "server name is required")
 	}
-	query := fmt.Sprintf(sqlDropUsermap, usermap.LocalUser, usermap.ServerName)
+	query := dropUserMapSQL(usermap)
 	log.Tracef("query: %s", query)
-	_, err := dbConnection.Exec(query)
+	_, err := dbConnection.ExecContext(ctx, query)
 	if err != nil {
 		log.Errorf("error dropping user mapping: %s", err)
 		return err
 	}
-	if dropLocalUser {
+	if dropLocalUser && !model.IsSpecialLocalUser(usermap.LocalUser) {
 		err = DropUser(ctx, dbConnection, usermap.LocalUser)
 		if err != nil {
 			log.Errorf("error dropping local user %s: %s", usermap.LocalUser, err)
@@ -115,7 +260,44 @@ func DropUserMap(ctx context.Context, dbConnection *sql.DB, usermap model.UserMa
 	return nil
 }
 
-func CreateUserMap(ctx context.Context, dbConnection *sql.DB, usermap model.UserMap) error {
+// userMapOptionsSQL returns the supplied user mapping statement with an OPTIONS clause made of the supplied clauses
+// and the byte offset in it of the quoted password value that ends the clause at passwordIdx. The offset is -1 when
+// passwordIdx is -1.
+func userMapOptionsSQL(query string, clauses []string, passwordIdx int, passwordValue string) (string, int) {
+	query = fmt.Sprintf("%s OPTIONS (", query)
+	position := -1
+	if passwordIdx >= 0 {
+		position = len(query) + optionValuePosition(clauses, passwordIdx, passwordValue)
+	}
+	return fmt.Sprintf("%s%s)", query, strings.Join(clauses, ", ")), position
+}
+
+// createUserMapSQL returns the statement that creates the supplied user mapping with its options. The password
+// option is only included, with the supplied secret value, when the remote secret is defined.
+func createUserMapSQL(usermap model.UserMap, secretValue string) string {
+	query, _ := createUserMapStatement(usermap, secretValue)
+	return query
+}
+
+// createUserMapStatement returns the statement of createUserMapSQL and the byte offset in it of the quoted password
+// value, or -1 when the statement does not include the password option
+func createUserMapStatement(usermap model.UserMap, secretValue string) (string, int) {
+	query := fmt.Sprintf(sqlCreateUsermap, userMapUserSQL(usermap.LocalUser), QuoteIdentifier(usermap.ServerName))
+	options := userMapOptions(usermap, secretValue, usermap.RemoteSecret.IsDefined())
+	if len(options) == 0 {
+		return query, -1
+	}
+	optionNames, clauses := optionClauses(options)
+	passwordIdx := -1
+	for idx, optionName := range optionNames {
+		if optionName == usermapOptionPassword {
+			passwordIdx = idx
+		}
+	}
+	return userMapOptionsSQL(query, clauses, passwordIdx, secretValue)
+}
+
+func CreateUserMap(ctx context.Context, dbConnection database.Executor, usermap model.UserMap) error {
 	var secretValue string
 	var err error
 
@@ -130,13 +312,10 @@ func CreateUserMap(ctx context.Context, dbConnection *sql.DB, usermap model.User
 		if err != nil {
 			return logger.ErrorfAsError(log, "error getting secret value: %s", err)
 		}
-	} else {
-		secretValue = ""
 	}
-	// FIXME: There could be no password at all; check for a password before using it in the SQL statement
-	query := fmt.Sprintf(sqlCreateUsermap, usermap.LocalUser, usermap.ServerName, usermap.RemoteUser, secretValue)
+	query := createUserMapSQL(usermap, secretValue)
 	log.Tracef("query: %s", query)
-	_, err = dbConnection.Exec(query)
+	_, err = dbConnection.ExecContext(ctx, query)
 	if err != nil {
 		log.Errorf("error creating user mapping: %s", err)
 		return err
@@ -144,29 +323,108 @@ func CreateUserMap(ctx context.Context, dbConnection *sql.DB, usermap model.User
 	return nil
 }
 
-func UpdateUserMap(ctx context.Context, dbConnection *sql.DB, usermap model.UserMap) error {
+// updateUserMapSQL returns the statement that changes the options of the database user mapping dbUserMap to those of
+// the supplied user mapping using the resolved secret value. The password option is dropped when the remote secret
+// is not defined. When redactSecret is true the new password is shown as a redacted value. An empty string is
+// returned if the options are the same.
+func updateUserMapSQL(usermap model.UserMap, dbUserMap model.UserMap, secretValue string, redactSecret bool) string {
+	query, _ := updateUserMapStatement(usermap, dbUserMap, secretValue, redactSecret)
+	return query
+}
+
+// updateUserMapStatement returns the statement of updateUserMapSQL and the byte offset in it of the quoted password
+// value, or -1 when the statement does not set the password option
+func updateUserMapStatement(usermap model.UserMap, dbUserMap model.UserMap, secretValue string, redactSecret bool) (string, int) {
+	changes := diffOptions(
+		userMapOptions(usermap, secretValue, usermap.RemoteSecret.IsDefined()),
+		userMapOptions(dbUserMap, dbUserMap.RemoteSecret.Value, dbUserMap.RemoteSecret.Value != ""),
+	)
+	if len(changes) == 0 {
+		return "", -1
+	}
+	passwordIdx := -1
+	for idx := range changes {
+		if changes[idx].name == usermapOptionPassword && changes[idx].operation != optionDrop {
+			passwordIdx = idx
+			if redactSecret {
+				changes[idx].value = redactedSecretValue
+			}
+		}
+	}
+	query := fmt.Sprintf(sqlUpdateUsermap, userMapUserSQL(usermap.LocalUser), QuoteIdentifier(usermap.ServerName))
+	passwordValue := ""
+	if passwordIdx >= 0 {
+		passwordValue = changes[passwordIdx].value
+	}
+	return userMapOptionsSQL(query, optionChangeClauses(changes), passwordIdx, passwordValue)
+}
+
+// UpdateUserMap changes the options of an existing user mapping to match those of the supplied user mapping
+func UpdateUserMap(ctx context.Context, dbConnection database.Executor, usermap model.UserMap) error {
+	var secretValue string
+	var err error
+
 	log := logger.Log(ctx).
 		WithField("function", "UpdateUserMap")
 	if usermap.ServerName == "" {
 		return logger.ErrorfAsError(log, "server name is required")
 	}
-	optArgs := make([]string, 0)
-	if usermap.RemoteUser != "" {
-		optArgs = append(optArgs, fmt.Sprintf("SET user '%s'", usermap.RemoteUser))
+	usermap.LocalUser, err = ResolveLocalUser(ctx, dbConnection, usermap.LocalUser)
+	if err != nil {
+		log.Errorf("error resolving local user: %s", err)
+		return err
+	}
+	dbUserMaps, err := GetUserMapsForServer(ctx, dbConnection, usermap.ServerName)
+	if err != nil {
+		log.Errorf("error getting user mappings for server %s: %s", usermap.ServerName, err)
+		return err
+	}
+	dbUserMap := FindUserMap(dbUserMaps, usermap.LocalUser)
+	if dbUserMap == nil {
+		return logger.ErrorfAsError(log, "user mapping for local user %s on server %s does not exist", usermap.LocalUser, usermap.ServerName)
 	}
 	if usermap.RemoteSecret.IsDefined() {
-		secretValue, err := GetSecret(ctx, usermap.RemoteSecret)
+		secretValue, err = GetSecret(ctx, usermap.RemoteSecret)
 		if err != nil {
 			return logger.ErrorfAsError(log, "error getting secret value: %s", err)
 		}
-		optArgs = append(optArgs, fmt.Sprintf("SET password '%s'", secretValue))
 	}
-	query := fmt.Sprintf(sqlUpdateUsermap, usermap.LocalUser, usermap.ServerName, strings.Join(optArgs, ", "))
-	log.Tracef("query: %s", query)
-	_, err := dbConnection.Exec(query)
+	query := updateUserMapSQL(usermap, *dbUserMap, secretValue, false)
+	if query == "" {
+		log.Debugf("options of user mapping %s are unchanged", usermap.LocalUser)
+		return nil
+	}
+	log.Tracef("query: %s", updateUserMapSQL(usermap, *dbUserMap, secretValue, true))
+	_, err = dbConnection.ExecContext(ctx, query)
 	if err != nil {
 		log.Errorf("error editing user mapping: %s", err)
 		return err
 	}
 	return nil
 }
+
+// ApplyUserMapOptionChanges sets each `key=value` option in setOptions on the supplied user mapping and then removes
+// each option named in dropOptions from it. The user and password options change RemoteUser and RemoteSecret.
+func ApplyUserMapOptionChanges(usermap *model.UserMap, setOptions []string, dropOptions []string) error {
+	// Copy the options before changing them so that the map of the original user mapping is unaffected
+	usermap.Options = copyOptions(usermap.Options)
+	for _, setOption := range setOptions {
+		optionName, optionValue, found := strings.Cut(setOption, "=")
+		optionName = strings.TrimSpace(optionName)
+		if !found || optionName == "" {
+			return fmt.Errorf("invalid option %q; expected key=value", setOption)
+		}
+		setUserMapOption(usermap, optionName, optionValue)
+	}
+	for _, dropOption := range dropOptions {
+		optionName := strings.TrimSpace(dropOption)
+		switch optionName {
+		case usermapOptionUser:
+			usermap.RemoteUser = ""
+		case usermapOptionPassword:
+			usermap.RemoteSecret = model.Secret{}
+		}
+		delete(usermap.Options, optionName)
+	}
+	return nil
+}
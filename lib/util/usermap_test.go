@@ -0,0 +1,303 @@
+package util
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/neflyte/fdwctl/lib/model"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUnit_GetUserMapsForServer_WithoutPassword(t *testing.T) {
+	db, mock := newSQLMock(t)
+	defer closeSQLMock(t, db)
+
+	mock.ExpectQuery(regexp.QuoteMeta(fmt.Sprintf("%s %s %s", sqlGetUsermaps, sqlGetUsermapsConstraint, sqlGetUsermapsOrder))).
+		WithArgs("remotedb").
+		WillReturnRows(
+			sqlmock.NewRows([]string{"authorization_identifier", "foreign_server_name", "option_name", "option_value"}).
+				AddRow("admin", "remotedb", "password_required", "false").
+				AddRow("admin", "remotedb", "user", "postgres").
+				AddRow("bare", "remotedb", nil, nil).
+				AddRow("fdw", "remotedb", "password", "s3cret").
+				AddRow("fdw", "remotedb", "user", "remoteuser"),
+		).
+		RowsWillBeClosed()
+	mock.ExpectClose()
+
+	expected := []model.UserMap{
+		{ServerName: "remotedb", LocalUser: "admin", RemoteUser: "postgres", Options: map[string]string{"password_required": "false"}},
+		{ServerName: "remotedb", LocalUser: "bare"},
+		{ServerName: "remotedb", LocalUser: "fdw", RemoteUser: "remoteuser", RemoteSecret: model.Secret{Value: "s3cret"}},
+	}
+	actual, err := GetUserMapsForServer(context.Background(), db, "remotedb")
+	require.Nil(t, err)
+	require.Equal(t, expected, actual)
+	closeSQLMock(t, db)
+	require.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestUnit_createUserMapSQL_WithoutPassword(t *testing.T) {
+	require.Equal(
+		t,
+		`CREATE USER MAPPING FOR "admin" SERVER "remotedb" OPTIONS ("password_required" 'false', "user" 'postgres')`,
+		createUserMapSQL(model.UserMap{
+			ServerName: "remotedb",
+			LocalUser:  "admin",
+			RemoteUser: "postgres",
+			Options:    map[string]string{"password_required": "false"},
+		}, ""),
+	)
+	require.Equal(
+		t,
+		`CREATE USER MAPPING FOR "bare" SERVER "remotedb"`,
+		createUserMapSQL(model.UserMap{ServerName: "remotedb", LocalUser: "bare"}, ""),
+	)
+}
+
+func TestUnit_updateUserMapSQL_AddSetDrop(t *testing.T) {
+	dbUserMap := model.UserMap{
+		ServerName:   "remotedb",
+		LocalUser:    "fdw",
+		RemoteUser:   "remoteuser",
+		RemoteSecret: model.Secret{Value: "s3cret"},
+	}
+	usermap := model.UserMap{
+		ServerName: "remotedb",
+		LocalUser:  "fdw",
+		RemoteUser: "certuser",
+		Options:    map[string]string{"sslcert": "/certs/client.crt", "sslkey": "/certs/client.key"},
+	}
+	require.Equal(
+		t,
+		`ALTER USER MAPPING FOR "fdw" SERVER "remotedb" OPTIONS (DROP "password", ADD "sslcert" '/certs/client.crt', ADD "sslkey" '/certs/client.key', SET "user" 'certuser')`,
+		updateUserMapSQL(usermap, dbUserMap, "", false),
+	)
+
+	usermap = dbUserMap
+	usermap.RemoteSecret = model.Secret{FromEnv: "FDW_PASSWORD"}
+	require.Equal(
+		t,
+		`ALTER USER MAPPING FOR "fdw" SERVER "remotedb" OPTIONS (SET "password" 'n3w')`,
+		updateUserMapSQL(usermap, dbUserMap, "n3w", false),
+	)
+	require.Equal(
+		t,
+		`ALTER USER MAPPING FOR "fdw" SERVER "remotedb" OPTIONS (SET "password" '********')`,
+		updateUserMapSQL(usermap, dbUserMap, "n3w", true),
+	)
+	require.Equal(t, "", updateUserMapSQL(usermap, dbUserMap, "s3cret", false))
+
+	usermap.RemoteUser = redactedSecretValue
+	statement, position := updateUserMapStatement(usermap, dbUserMap, "n3w", true)
+	require.Equal(t, `ALTER USER MAPPING FOR "fdw" SERVER "remotedb" OPTIONS (SET "password" '********', SET "user" '********')`, statement)
+	require.Equal(t, len(`ALTER USER MAPPING FOR "fdw" SERVER "remotedb" OPTIONS (SET "password" `), position)
+	_, position = updateUserMapStatement(usermap, dbUserMap, "s3cret", true)
+	require.Equal(t, -1, position)
+}
+
+func TestUnit_PlanDesiredState_UserMapWithoutPassword(t *testing.T) {
+	db, mock := newSQLMock(t)
+	defer closeSQLMock(t, db)
+
+	mock.ExpectQuery(regexp.QuoteMeta(sqlGetExtensions)).
+		WillReturnRows(sqlmock.NewRows([]string{"extname", "extversion"})).
+		RowsWillBeClosed()
+	mock.ExpectQuery(regexp.QuoteMeta(sqlForeignServerInfo)).
+		WillReturnRows(
+			sqlmock.NewRows([]string{"srvname", "fdwname", "owner", "server_comment", "option_name", "option_value"}).
+				AddRow("remotedb", "postgres_fdw", "postgres", managedComment, "host", "remotehost"),
+		).
+		RowsWillBeClosed()
+	mock.ExpectQuery(regexp.QuoteMeta(sqlGetUsermaps)).
+		WithArgs("remotedb").
+		WillReturnRows(
+			sqlmock.NewRows([]string{"authorization_identifier", "foreign_server_name", "option_name", "option_value"}).
+				AddRow("admin", "remotedb", "password_required", "false").
+				AddRow("admin", "remotedb", "user", "postgres"),
+		).
+		RowsWillBeClosed()
+	mock.ExpectQuery(regexp.QuoteMeta(sqlGetServerGrantees)).
+		WithArgs("remotedb").
+		WillReturnRows(sqlmock.NewRows([]string{"grantee"})).
+		RowsWillBeClosed()
+	mock.ExpectQuery(regexp.QuoteMeta(sqlGetForeignSchemas)).
+		WithArgs("remotedb").
+		WillReturnRows(sqlmock.NewRows([]string{"foreign_table_schema", "foreign_server_name", "remote_schema", "schema_comment"})).
+		RowsWillBeClosed()
+	expectNoForeignTables(mock, "remotedb")
+	expectCatalog(mock)
+	expectNoImportedTypes(mock)
+	mock.ExpectClose()
+
+	dState := model.DesiredState{
+		Servers: []model.ForeignServer{
+			{
+				Name: "remotedb",
+				Host: "remotehost",
+				UserMaps: []model.UserMap{
+					{LocalUser: "admin", RemoteUser: "postgres", Options: map[string]string{"password_required": "false"}},
+				},
+			},
+		},
+	}
+	plan, err := PlanDesiredState(context.Background(), db, dState, PlanOptions{})
+	require.Nil(t, err)
+	require.True(t, plan.IsEmpty())
+	closeSQLMock(t, db)
+	require.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestUnit_PlanDesiredState_KeepsSessionUsers(t *testing.T) {
+	db, mock := newSQLMock(t)
+	defer closeSQLMock(t, db)
+
+	mock.ExpectQuery(regexp.QuoteMeta(sqlGetExtensions)).
+		WillReturnRows(sqlmock.NewRows([]string{"extname", "extversion"})).
+		RowsWillBeClosed()
+	mock.ExpectQuery(regexp.QuoteMeta(sqlForeignServerInfo)).
+		WillReturnRows(
+			sqlmock.NewRows([]string{"srvname", "fdwname", "owner", "server_comment", "option_name", "option_value"}).
+				AddRow("remotedb", "postgres_fdw", "postgres", managedComment, "host", "remotehost"),
+		).
+		RowsWillBeClosed()
+	// The CURRENT_USER mapping of a previous desired state is stored under the role it resolved to
+	mock.ExpectQuery(regexp.QuoteMeta(sqlGetUsermaps)).
+		WithArgs("remotedb").
+		WillReturnRows(
+			sqlmock.NewRows([]string{"authorization_identifier", "foreign_server_name", "option_name", "option_value"}).
+				AddRow("fdw", "remotedb", "user", "remoteuser"),
+		).
+		RowsWillBeClosed()
+	mock.ExpectQuery(regexp.QuoteMeta(sqlGetServerGrantees)).
+		WithArgs("remotedb").
+		WillReturnRows(sqlmock.NewRows([]string{"grantee"})).
+		RowsWillBeClosed()
+	mock.ExpectQuery(regexp.QuoteMeta(sqlGetForeignSchemas)).
+		WithArgs("remotedb").
+		WillReturnRows(sqlmock.NewRows([]string{"foreign_table_schema", "foreign_server_name", "remote_schema", "schema_comment"})).
+		RowsWillBeClosed()
+	expectNoForeignTables(mock, "remotedb")
+	expectCatalog(mock)
+	mock.ExpectQuery(regexp.QuoteMeta(sqlSessionUsers)).
+		WillReturnRows(sqlmock.NewRows([]string{"current_user", "session_user"}).AddRow("fdw", "login")).
+		RowsWillBeClosed()
+	expectNoImportedTypes(mock)
+	mock.ExpectClose()
+
+	dState := model.DesiredState{
+		Servers: []model.ForeignServer{{Name: "remotedb", Host: "remotehost"}},
+	}
+	plan, err := PlanDesiredState(context.Background(), db, dState, PlanOptions{})
+	require.Nil(t, err)
+	require.Len(t, plan.Actions, 1)
+	require.Equal(t, `DROP USER MAPPING IF EXISTS FOR "fdw" SERVER "remotedb"`, plan.Actions[0].SQL)
+	closeSQLMock(t, db)
+	require.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestUnit_userMapSQL_SpecialLocalUsers(t *testing.T) {
+	require.Equal(
+		t,
+		`CREATE USER MAPPING FOR PUBLIC SERVER "remotedb" OPTIONS ("user" 'readonly')`,
+		createUserMapSQL(model.UserMap{ServerName: "remotedb", LocalUser: "public", RemoteUser: "readonly"}, ""),
+	)
+	require.Equal(
+		t,
+		`DROP USER MAPPING IF EXISTS FOR CURRENT_USER SERVER "remotedb"`,
+		dropUserMapSQL(model.UserMap{ServerName: "remotedb", LocalUser: "current_user"}),
+	)
+	require.Equal(
+		t,
+		`DROP USER MAPPING IF EXISTS FOR "Public Relations" SERVER "remotedb"`,
+		dropUserMapSQL(model.UserMap{ServerName: "remotedb", LocalUser: "Public Relations"}),
+	)
+}
+
+func TestUnit_ResolveLocalUsers(t *testing.T) {
+	db, mock := newSQLMock(t)
+	defer closeSQLMock(t, db)
+
+	mock.ExpectQuery(regexp.QuoteMeta(sqlSessionUsers)).
+		WillReturnRows(sqlmock.NewRows([]string{"current_user", "session_user"}).AddRow("fdw", "login")).
+		RowsWillBeClosed()
+	mock.ExpectClose()
+
+	dState := model.DesiredState{
+		Servers: []model.ForeignServer{
+			{
+				Name: "remotedb",
+				UserMaps: []model.UserMap{
+					{LocalUser: "public"},
+					{LocalUser: "CURRENT_USER"},
+					{LocalUser: "session_user"},
+					{LocalUser: "User"},
+					{LocalUser: "someone"},
+				},
+			},
+		},
+	}
+	resolved, err := ResolveLocalUsers(context.Background(), db, dState)
+	require.Nil(t, err)
+	localUsers := make([]string, 0)
+	for _, usermap := range resolved.Servers[0].UserMaps {
+		localUsers = append(localUsers, usermap.LocalUser)
+	}
+	require.Equal(t, []string{"PUBLIC", "fdw", "login", "fdw", "someone"}, localUsers)
+	require.Equal(t, model.LocalUserCurrentUser, resolved.Servers[0].UserMaps[1].LocalUserKeyword)
+	require.Equal(t, "", resolved.Servers[0].UserMaps[4].LocalUserKeyword)
+	// The supplied state is not changed
+	require.Equal(t, "public", dState.Servers[0].UserMaps[0].LocalUser)
+	closeSQLMock(t, db)
+	require.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestUnit_DropUserMap_PublicKeepsRoles(t *testing.T) {
+	db, mock := newSQLMock(t)
+	defer closeSQLMock(t, db)
+
+	mock.ExpectExec(regexp.QuoteMeta(`DROP USER MAPPING IF EXISTS FOR PUBLIC SERVER "remotedb"`)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectClose()
+
+	err := DropUserMap(context.Background(), db, model.UserMap{ServerName: "remotedb", LocalUser: "PUBLIC"}, true)
+	require.Nil(t, err)
+	require.Nil(t, EnsureUser(context.Background(), db, "PUBLIC", ""))
+	closeSQLMock(t, db)
+	require.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestUnit_UpdateUserMap_LocalUserKeywords(t *testing.T) {
+	db, mock := newSQLMock(t)
+	defer closeSQLMock(t, db)
+
+	mock.ExpectQuery(regexp.QuoteMeta(sqlGetUsermaps)).
+		WithArgs("remotedb").
+		WillReturnRows(sqlmock.NewRows([]string{"authorization_identifier", "foreign_server_name", "option_name", "option_value"}).
+			AddRow("PUBLIC", "remotedb", "user", "olduser")).
+		RowsWillBeClosed()
+	mock.ExpectExec(regexp.QuoteMeta(`ALTER USER MAPPING FOR PUBLIC SERVER "remotedb" OPTIONS (SET "user" 'readonly')`)).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(regexp.QuoteMeta(sqlSessionUsers)).
+		WillReturnRows(sqlmock.NewRows([]string{"current_user", "session_user"}).AddRow("fdw", "admin")).
+		RowsWillBeClosed()
+	mock.ExpectQuery(regexp.QuoteMeta(sqlGetUsermaps)).
+		WithArgs("remotedb").
+		WillReturnRows(sqlmock.NewRows([]string{"authorization_identifier", "foreign_server_name", "option_name", "option_value"}).
+			AddRow("PUBLIC", "remotedb", "user", "readonly").
+			AddRow("fdw", "remotedb", "user", "olduser")).
+		RowsWillBeClosed()
+	mock.ExpectExec(regexp.QuoteMeta(`ALTER USER MAPPING FOR "fdw" SERVER "remotedb" OPTIONS (SET "user" 'fdwuser')`)).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectClose()
+
+	err := UpdateUserMap(context.Background(), db, model.UserMap{ServerName: "remotedb", LocalUser: "public", RemoteUser: "readonly"})
+	require.Nil(t, err)
+	err = UpdateUserMap(context.Background(), db, model.UserMap{ServerName: "remotedb", LocalUser: "CURRENT_USER", RemoteUser: "fdwuser"})
+	require.Nil(t, err)
+	closeSQLMock(t, db)
+	require.Nil(t, mock.ExpectationsWereMet())
+}
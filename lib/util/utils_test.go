@@ -3,6 +3,7 @@ package util
 import (
 	"database/sql"
 	"os"
+	"regexp"
 	"testing"
 
 	"github.com/DATA-DOG/go-sqlmock"
@@ -10,6 +11,11 @@ import (
 	"github.com/stretchr/testify/require"
 )
 
+const (
+	// managedComment is the comment of a foreign server or schema that fdwctl manages
+	managedComment = `fdwctl:{"managed":true}`
+)
+
 func TestMain(m *testing.M) {
 	logger.SetFormat(logger.TextFormat)
 	logger.SetLevel(logger.TraceLevel)
@@ -50,3 +56,31 @@ func TestUnit_StartsWithNumber(t *testing.T) {
 	require.True(t, StartsWithNumber("1NightInRio"))
 	require.False(t, StartsWithNumber("TwoDaysInLA"))
 }
+
+// expectNoImportedTypes expects the query of the planner for the user-defined types fdwctl created and returns none
+func expectNoImportedTypes(mock sqlmock.Sqlmock) {
+	mock.ExpectQuery(regexp.QuoteMeta(sqlGetImportedTypes)).
+		WillReturnRows(sqlmock.NewRows([]string{"nspname", "typname", "typtype", "comment"})).
+		RowsWillBeClosed()
+}
+
+// expectCatalog expects the queries for the rest of the catalog that a plan is computed against and returns no
+// user-defined types and the supplied roles as the roles fdwctl created
+func expectCatalog(mock sqlmock.Sqlmock, managedRoles ...string) {
+	mock.ExpectQuery(regexp.QuoteMeta(sqlGetLocalTypes)).
+		WillReturnRows(sqlmock.NewRows([]string{"nspname", "typname", "typtype", "comment", "enumlabel"})).
+		RowsWillBeClosed()
+	mock.ExpectQuery(regexp.QuoteMeta(sqlGetTypeSchemas)).
+		WillReturnRows(sqlmock.NewRows([]string{"nspname", "object_count"})).
+		RowsWillBeClosed()
+	mock.ExpectQuery(regexp.QuoteMeta(sqlTypeUsages)).
+		WillReturnRows(sqlmock.NewRows([]string{"type_schema", "type_name", "table_schema", "server_name"})).
+		RowsWillBeClosed()
+	roleRows := sqlmock.NewRows([]string{"rolname", "shobj_description"})
+	for _, roleName := range managedRoles {
+		roleRows.AddRow(roleName, managedComment)
+	}
+	mock.ExpectQuery(regexp.QuoteMeta(sqlGetRoleComments)).
+		WillReturnRows(roleRows).
+		RowsWillBeClosed()
+}
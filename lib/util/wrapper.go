@@ -0,0 +1,123 @@
+package util
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/neflyte/fdwctl/lib/model"
+)
+
+var (
+	// postgresFDWServerOptions are the server options accepted by postgres_fdw; these are the libpq connection options
+	// that may be set on a server plus the options of postgres_fdw itself
+	postgresFDWServerOptions = []string{
+		"host", "hostaddr", "port", "dbname", "service", "passfile", "channel_binding", "connect_timeout", "options",
+		"application_name", "fallback_application_name", "keepalives", "keepalives_idle", "keepalives_interval",
+		"keepalives_count", "tcp_user_timeout", "replication", "gssencmode", "sslmode", "sslcompression", "sslcert",
+		"sslkey", "sslrootcert", "sslcrl", "sslcrldir", "sslsni", "requirepeer", "require_auth",
+		"ssl_min_protocol_version", "ssl_max_protocol_version", "krbsrvname", "gsslib", "gssdelegation",
+		"target_session_attrs", "load_balance_hosts",
+		"use_remote_estimate", "fdw_startup_cost", "fdw_tuple_cost", "extensions", "fetch_size", "batch_size",
+		"updatable", "truncatable", "async_capable", "parallel_commit", "parallel_abort", "keep_connections",
+		"analyze_sampling",
+	}
+	// wrapperServerOptions maps the name of a well-known foreign data wrapper to the server options it accepts.
+	// Servers of a wrapper that is not in this map are not validated.
+	wrapperServerOptions = map[string][]string{
+		model.DefaultWrapper: postgresFDWServerOptions,
+		"mysql_fdw": {
+			"host", "port", "init_command", "secure_auth", "use_remote_estimate", "reconnect", "character_set",
+			"mysql_default_file", "sql_mode", "ssl_key", "ssl_cert", "ssl_ca", "ssl_capath", "ssl_cipher", "fetch_size",
+		},
+		"tds_fdw": {
+			"servername", "port", "database", "dbuse", "language", "character_set", "tds_version", "msg_handler",
+			"row_estimate_method", "use_remote_estimate", "fdw_startup_cost", "fdw_tuple_cost", "sqlserver_ansi_mode",
+		},
+		"oracle_fdw": {
+			"dbserver", "isolation_level", "nchar", "set_timezone",
+		},
+		"file_fdw": {},
+	}
+	// wrapperImportOptions maps the name of a well-known foreign data wrapper to the options it accepts in the OPTIONS
+	// clause of IMPORT FOREIGN SCHEMA. Schemas of servers whose wrapper is not in this map are not validated.
+	wrapperImportOptions = map[string][]string{
+		model.DefaultWrapper: {"import_collate", "import_default", "import_generated", "import_not_null"},
+		"mysql_fdw":          {"import_default", "import_enum_as_text", "import_generated", "import_not_null"},
+	}
+	// defaultRemoteTableOptions are the foreign table options that name the remote schema and table for postgres_fdw
+	// and for wrappers that are not in wrapperRemoteTableOptions
+	defaultRemoteTableOptions = remoteTableOptions{schema: "schema_name", table: "table_name"}
+	// wrapperRemoteTableOptions maps the name of a well-known foreign data wrapper to the foreign table options that
+	// name the remote schema and table when they differ from defaultRemoteTableOptions
+	wrapperRemoteTableOptions = map[string]remoteTableOptions{
+		"mysql_fdw":  {schema: "dbname", table: "table_name"},
+		"oracle_fdw": {schema: "schema", table: "table"},
+	}
+)
+
+// remoteTableOptions are the names of the foreign table options of a foreign data wrapper that hold the remote schema
+// and the remote table of a foreign table
+type remoteTableOptions struct {
+	schema string
+	table  string
+}
+
+// remoteTableOptionsOf returns the names of the foreign table options that hold the remote schema and table of a
+// foreign table of the named foreign data wrapper
+func remoteTableOptionsOf(wrapper string) remoteTableOptions {
+	if tableOptions, ok := wrapperRemoteTableOptions[wrapper]; ok {
+		return tableOptions
+	}
+	return defaultRemoteTableOptions
+}
+
+// ValidateServerOptions determines if every option of the supplied server, including host, port, and dbname, is
+// accepted by the server's foreign data wrapper. An error naming the rejected options is returned if any are not.
+func ValidateServerOptions(server model.ForeignServer) error {
+	allowedOptions, ok := wrapperServerOptions[server.WrapperName()]
+	if !ok {
+		return nil
+	}
+	invalidOptions := make([]string, 0)
+	for optionName := range serverOptions(server) {
+		if !containsString(allowedOptions, optionName) {
+			invalidOptions = append(invalidOptions, optionName)
+		}
+	}
+	if len(invalidOptions) > 0 {
+		sort.Strings(invalidOptions)
+		return fmt.Errorf(
+			"server %s: option(s) %s are not supported by foreign data wrapper %s",
+			server.Name,
+			strings.Join(invalidOptions, ", "),
+			server.WrapperName(),
+		)
+	}
+	return nil
+}
+
+// ValidateImportOptions determines if every import option of the supplied schema is accepted by the foreign data
+// wrapper of the supplied server. An error naming the rejected options is returned if any are not.
+func ValidateImportOptions(server model.ForeignServer, schema model.Schema) error {
+	allowedOptions, ok := wrapperImportOptions[server.WrapperName()]
+	if !ok {
+		return nil
+	}
+	invalidOptions := make([]string, 0)
+	for optionName := range schema.ImportOptions {
+		if !containsString(allowedOptions, optionName) {
+			invalidOptions = append(invalidOptions, optionName)
+		}
+	}
+	if len(invalidOptions) > 0 {
+		sort.Strings(invalidOptions)
+		return fmt.Errorf(
+			"schema %s: import option(s) %s are not supported by foreign data wrapper %s",
+			schema.LocalSchema,
+			strings.Join(invalidOptions, ", "),
+			server.WrapperName(),
+		)
+	}
+	return nil
+}